@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/ingest"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// publicRoutes are served without an API key
+var publicRoutes = map[string]bool{
+	"/health":                   true,
+	"/webpush/vapid-public-key": true,
+	"/gateway/connect":          true, // clients present a connect token
+}
+
+// sendRoutes need the send scope for their mutating methods
+var sendRoutes = map[string]bool{
+	"/send":            true,
+	"/send/batch":      true,
+	"/broadcasts":      true,
+	"/broadcasts/{id}": true,
+
+	"/users/{userID}/gateway/token": true,
+}
+
+// requiredScope maps a request to the scope it needs: reads need
+// read-status, sending needs send and every other change needs admin
+func requiredScope(r *http.Request) auth.Scope {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return auth.ScopeAdmin
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return auth.ScopeAdmin
+	}
+
+	switch {
+	case publicRoutes[template]:
+		return ""
+	case template == "/keys" || template == "/audit" || len(template) > 6 && template[:6] == "/keys/":
+		return auth.ScopeAdmin
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return auth.ScopeReadStatus
+	case sendRoutes[template]:
+		return auth.ScopeSend
+	default:
+		return auth.ScopeAdmin
+	}
+}
+
+// tenantMiddleware scopes each request to a tenant: the tenant of its API
+// key, or the X-Tenant-ID header for system keys and when authentication is
+// disabled. Stores and sends then act on that tenant only.
+func tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID, err := auth.ResolveTenant(auth.KeyFromContext(r.Context()), r.Header.Get("X-Tenant-ID"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if tenantID == "" {
+			tenantID = tenant.Default
+		}
+		if err := tenant.Validate(tenantID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(tenant.WithID(r.Context(), tenantID)))
+	})
+}
+
+// enforceTenant binds a notification to the request's tenant, rejecting
+// notifications that name another one
+func enforceTenant(w http.ResponseWriter, r *http.Request, n *pkg.NotificationMessage) bool {
+	if err := ingest.BindTenant(r.Context(), n); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// registerKeyRoutes adds the API key management and audit endpoints
+func (s *Service) registerKeyRoutes(router *mux.Router) {
+	router.HandleFunc("/keys", s.listKeysHandler).Methods("GET")
+	router.HandleFunc("/keys", s.createKeyHandler).Methods("POST")
+	router.HandleFunc("/keys/{id}", s.getKeyHandler).Methods("GET")
+	router.HandleFunc("/keys/{id}", s.revokeKeyHandler).Methods("DELETE")
+	router.HandleFunc("/keys/{id}/rotate", s.rotateKeyHandler).Methods("POST")
+	router.HandleFunc("/audit", s.auditHandler).Methods("GET")
+}
+
+// callerTenant returns the tenant a management request acts on: the caller's
+// own, or the one named by the tenant parameter for system keys
+func callerTenant(r *http.Request, requested string) (string, error) {
+	key := auth.KeyFromContext(r.Context())
+	if key == nil {
+		// Authentication is disabled
+		if requested == "" {
+			return tenant.FromContext(r.Context()), nil
+		}
+		return requested, nil
+	}
+
+	if requested == "" {
+		if key.Tenant == auth.SystemTenant {
+			return "", fmt.Errorf("tenant is required for system keys")
+		}
+		return key.Tenant, nil
+	}
+	if !key.CanAccessTenant(requested) {
+		return "", fmt.Errorf("api key cannot manage tenant %s", requested)
+	}
+	return requested, nil
+}
+
+// keyForRequest loads the key named in the path and checks the caller may manage it
+func (s *Service) keyForRequest(w http.ResponseWriter, r *http.Request) *auth.APIKey {
+	key, err := s.authenticator.Get(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, auth.ErrNotFound) {
+		http.Error(w, "api key not found", http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting api key: %v", err), http.StatusInternalServerError)
+		return nil
+	}
+	if caller := auth.KeyFromContext(r.Context()); caller != nil && !caller.CanAccessTenant(key.Tenant) {
+		http.Error(w, "api key not found", http.StatusNotFound)
+		return nil
+	}
+	return key
+}
+
+// listKeysHandler lists the keys of the caller's tenant
+func (s *Service) listKeysHandler(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := callerTenant(r, r.URL.Query().Get("tenant"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	keys, err := s.authenticator.List(r.Context(), tenantID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing api keys: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tenant": tenantID,
+		"keys":   keys,
+	})
+}
+
+// createKeyHandler creates a key and returns its plaintext, which is not
+// retrievable afterwards
+func (s *Service) createKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name   string       `json:"name"`
+		Tenant string       `json:"tenant"`
+		Scopes []auth.Scope `json:"scopes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	tenantID, err := callerTenant(r, req.Tenant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if tenantID == auth.SystemTenant {
+		http.Error(w, "system keys can only be configured as the bootstrap key", http.StatusBadRequest)
+		return
+	}
+	if err := tenant.Validate(tenantID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plaintext, key, err := s.authenticator.Create(r.Context(), req.Name, tenantID, req.Scopes)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error creating api key: %v", err), http.StatusBadRequest)
+		return
+	}
+	auth.Annotate(r.Context(), "created_key_id", key.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":     plaintext,
+		"api_key": key,
+	})
+}
+
+// getKeyHandler returns the metadata of a key
+func (s *Service) getKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key := s.keyForRequest(w, r)
+	if key == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
+
+// rotateKeyHandler issues a replacement key; the old one stays valid for the
+// grace period given as a duration, default one hour
+func (s *Service) rotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key := s.keyForRequest(w, r)
+	if key == nil {
+		return
+	}
+
+	var req struct {
+		GracePeriod string `json:"grace_period"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	grace := time.Hour
+	if req.GracePeriod != "" {
+		parsed, err := time.ParseDuration(req.GracePeriod)
+		if err != nil || parsed < 0 {
+			http.Error(w, "grace_period must be a non-negative duration", http.StatusBadRequest)
+			return
+		}
+		grace = parsed
+	}
+
+	plaintext, rotated, err := s.authenticator.Rotate(r.Context(), key.ID, grace)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error rotating api key: %v", err), http.StatusBadRequest)
+		return
+	}
+	auth.Annotate(r.Context(), "rotated_key_id", key.ID)
+	auth.Annotate(r.Context(), "created_key_id", rotated.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":     plaintext,
+		"api_key": rotated,
+	})
+}
+
+// revokeKeyHandler disables a key immediately
+func (s *Service) revokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key := s.keyForRequest(w, r)
+	if key == nil {
+		return
+	}
+
+	if _, err := s.authenticator.Revoke(r.Context(), key.ID); err != nil {
+		http.Error(w, fmt.Sprintf("Error revoking api key: %v", err), http.StatusInternalServerError)
+		return
+	}
+	auth.Annotate(r.Context(), "revoked_key_id", key.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// auditHandler returns the newest audit entries of the caller's tenant,
+// optionally for a single key. System keys see every tenant unless one is
+// given.
+func (s *Service) auditHandler(w http.ResponseWriter, r *http.Request) {
+	requested := r.URL.Query().Get("tenant")
+	tenantID := requested
+	if key := auth.KeyFromContext(r.Context()); key == nil || key.Tenant != auth.SystemTenant || requested != "" {
+		var err error
+		if tenantID, err = callerTenant(r, requested); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := s.auditLog.Recent(r.Context(), tenantID, r.URL.Query().Get("key_id"), limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tenant":  tenantID,
+		"entries": entries,
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/ingest"
+)
+
+// isNDJSON reports whether the request body holds newline delimited JSON
+func isNDJSON(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-ndjson" || mediaType == "application/jsonl"
+}
+
+// sendBatchHandler accepts a JSON array, or NDJSON with Content-Type
+// application/x-ndjson, of notifications. Each one is validated on its own
+// and the valid ones are published through the batching producer; the
+// response reports every item as accepted or rejected.
+func (s *Service) sendBatchHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.BatchMaxBytes)
+
+	items, err := ingest.DecodeBatch(r.Body, isNDJSON(r), s.config.BatchMaxItems)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, fmt.Sprintf("batch exceeds %d bytes", s.config.BatchMaxBytes), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, ingest.ErrTooManyItems):
+		http.Error(w, fmt.Sprintf("batch exceeds %d notifications", s.config.BatchMaxItems), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batchID := fmt.Sprintf("batch_%d", time.Now().UnixNano())
+	batch := ingest.NewBatch(r.Context(), items, batchID)
+
+	// Count the whole batch against the tenant's quota at once
+	if len(batch.Valid) > 0 {
+		if !s.admitQuota(w, r, batch.Valid[0].Tenant(), int64(len(batch.Valid))) {
+			return
+		}
+		batch.Published(s.batchProducer.SendAll(batch.Valid))
+	}
+
+	accepted := batch.Accepted()
+	auth.Annotate(r.Context(), "batch_id", batchID)
+	auth.Annotate(r.Context(), "accepted", strconv.Itoa(accepted))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"accepted": accepted,
+		"rejected": len(batch.Results) - accepted,
+		"results":  batch.Results,
+	})
+}
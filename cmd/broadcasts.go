@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/broadcast"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/ingest"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/validation"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// registerBroadcastRoutes adds the broadcast and user attribute endpoints
+func (s *Service) registerBroadcastRoutes(router *mux.Router) {
+	router.HandleFunc("/users/{userID}/attributes", s.getAttributesHandler).Methods("GET")
+	router.HandleFunc("/users/{userID}/attributes", s.putAttributesHandler).Methods("PUT")
+
+	// Broadcasts need the producer to re-publish per-user messages
+	if s.broadcasts != nil {
+		router.HandleFunc("/broadcasts", s.createBroadcastHandler).Methods("POST")
+		router.HandleFunc("/broadcasts/{id}", s.getBroadcastHandler).Methods("GET")
+		router.HandleFunc("/broadcasts/{id}", s.cancelBroadcastHandler).Methods("DELETE")
+	}
+}
+
+// createBroadcastHandler starts fanning out a broadcast and returns its progress
+func (s *Service) createBroadcastHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read body: %v", err), http.StatusBadRequest)
+		return
+	}
+	var b pkg.BroadcastMessage
+	if err := json.Unmarshal(body, &b); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Set defaults if not provided
+	if b.ID == "" {
+		b.ID = fmt.Sprintf("broadcast_%d", time.Now().UnixNano())
+	}
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now()
+	}
+	var fields struct {
+		Notification json.RawMessage `json:"notification"`
+	}
+	json.Unmarshal(body, &fields)
+	ingest.DefaultPriority(&b.Notification, fields.Notification)
+	if b.Topic == "" && len(b.Segment) == 0 {
+		http.Error(w, "topic or segment is required", http.StatusBadRequest)
+		return
+	}
+	for _, ch := range b.Notification.Channels {
+		if !ch.IsValid() {
+			http.Error(w, fmt.Sprintf("Unknown channel: %s", ch), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !b.Notification.CollapseMode.IsValid() {
+		http.Error(w, fmt.Sprintf("Unknown collapse mode: %s", b.Notification.CollapseMode), http.StatusBadRequest)
+		return
+	}
+	if !enforceTenant(w, r, &b.Notification) {
+		return
+	}
+
+	// Validate the notification as fanned out, with a placeholder user, so an
+	// invalid broadcast is rejected here rather than by every recipient
+	if err := validation.Validate(broadcast.Expand(&b, "broadcast"), time.Now()); err != nil {
+		writeInvalid(w, err)
+		return
+	}
+
+	progress, err := s.broadcasts.Start(r.Context(), &b)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error starting broadcast: %v", err), http.StatusInternalServerError)
+		return
+	}
+	auth.Annotate(r.Context(), "broadcast_id", b.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(progress)
+}
+
+// getBroadcastHandler returns the progress of a broadcast
+func (s *Service) getBroadcastHandler(w http.ResponseWriter, r *http.Request) {
+	progress, err := s.broadcasts.Progress(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, broadcast.ErrNotFound) {
+		http.Error(w, "broadcast not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting broadcast: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
+
+// cancelBroadcastHandler stops a broadcast mid-flight
+func (s *Service) cancelBroadcastHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	auth.Annotate(r.Context(), "broadcast_id", id)
+
+	err := s.broadcasts.Cancel(r.Context(), id)
+	if errors.Is(err, broadcast.ErrNotFound) {
+		http.Error(w, "broadcast not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error cancelling broadcast: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// getAttributesHandler returns the segmentation attributes of a user
+func (s *Service) getAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+
+	attrs, err := s.audienceStore.UserAttributes(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting attributes: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":    userID,
+		"attributes": attrs,
+	})
+}
+
+// putAttributesHandler replaces the segmentation attributes of a user
+func (s *Service) putAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	var attrs map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&attrs); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.audienceStore.SetUserAttributes(r.Context(), mux.Vars(r)["userID"], attrs); err != nil {
+		http.Error(w, fmt.Sprintf("Error saving attributes: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/digest"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// registerDigestRoutes adds the digest policy, inspection and flush endpoints
+func (s *Service) registerDigestRoutes(router *mux.Router) {
+	router.HandleFunc("/digests/policies", s.digestPoliciesHandler).Methods("GET")
+	router.HandleFunc("/users/{userID}/digests", s.getDigestsHandler).Methods("GET")
+	router.HandleFunc("/users/{userID}/digests/flush", s.flushDigestsHandler).Methods("POST")
+}
+
+// digestPoliciesHandler returns the configured digest policies
+func (s *Service) digestPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.digester.Policies())
+}
+
+// getDigestsHandler returns the pending digests of a user with their items
+func (s *Service) getDigestsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+
+	pending, err := s.digester.Pending(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting digests: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"digests": pending,
+	})
+}
+
+// flushDigestsHandler sends a user's pending digests now, or only the one
+// named by the type query parameter
+func (s *Service) flushDigestsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+
+	var refs []digest.Ref
+	if digestType := r.URL.Query().Get("type"); digestType != "" {
+		refs = append(refs, digest.NewRef(tenant.FromContext(r.Context()), userID, digestType))
+	} else {
+		pending, err := s.digester.Pending(r.Context(), userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error getting digests: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, p := range pending {
+			refs = append(refs, p.Ref)
+		}
+	}
+
+	flushed := make([]*pkg.NotificationMessage, 0, len(refs))
+	for _, ref := range refs {
+		summary, err := s.digester.Flush(r.Context(), ref)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error flushing %s digest: %v", ref.Type, err), http.StatusInternalServerError)
+			return
+		}
+		if summary != nil {
+			s.submitDigest(summary)
+			flushed = append(flushed, summary)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"flushed": flushed,
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/config"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+)
+
+// instanceID names this instance for the gateway: INSTANCE_ID, or the host
+// name and process ID
+func instanceID(cfg *config.Config) string {
+	if cfg.InstanceID != "" {
+		return cfg.InstanceID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// registerGatewayRoutes adds the live gateway connection endpoint, which
+// authenticates clients with connect tokens, and the endpoint issuing them
+func (s *Service) registerGatewayRoutes(router *mux.Router) {
+	router.Handle("/gateway/connect", s.gateway.Handler(s.ctx, s.gatewayTokens)).Methods("GET")
+	router.HandleFunc("/users/{userID}/gateway/token", s.gatewayTokenHandler).Methods("POST")
+}
+
+// runGateway relays deliveries and acknowledgements between instances
+func (s *Service) runGateway() {
+	defer s.wg.Done()
+
+	if err := s.gateway.Run(s.ctx); err != nil {
+		log.Printf("Gateway error: %v", err)
+	}
+}
+
+// gatewayTokenHandler issues a token a user's app connects to the gateway
+// with; the backend requesting it vouches for the user
+func (s *Service) gatewayTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+	auth.Annotate(r.Context(), "user_id", userID)
+
+	token, expiresAt, err := s.gatewayTokens.Issue(tenant.FromContext(r.Context()), userID, time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error issuing token: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":    userID,
+		"token":      token,
+		"expires_at": expiresAt,
+	})
+}
+
+// gatewayTokenSecret returns the secret connect tokens are signed with:
+// GATEWAY_TOKEN_SECRET, or a random one that only this instance and run
+// accept
+func gatewayTokenSecret(cfg *config.Config) ([]byte, error) {
+	if cfg.GatewayTokenSecret != "" {
+		return []byte(cfg.GatewayTokenSecret), nil
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate gateway token secret: %w", err)
+	}
+	log.Println("GATEWAY_TOKEN_SECRET is not set; connect tokens are only valid on this instance until it restarts")
+	return secret, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+	"net"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/grpcapi"
+)
+
+// setupGRPCServer configures the gRPC API on the same pipeline, stores and
+// authentication as the HTTP API
+func (s *Service) setupGRPCServer() {
+	server := grpcapi.NewServer(s.statusStore, s.resultHub, s.config.ResultStreamBuffer)
+	if s.kafkaProducer != nil {
+		server.SetPublisher(s.kafkaProducer)
+	}
+	if s.batchProducer != nil {
+		server.SetBatchPublisher(s.batchProducer, s.config.BatchMaxItems)
+	}
+	server.SetQuota(s.quotas)
+	if s.config.AuthEnabled {
+		server.SetAuth(s.authenticator, s.auditLog)
+	}
+
+	s.grpcServer = server.NewGRPCServer()
+}
+
+// startGRPCServer serves the gRPC API until it is stopped
+func (s *Service) startGRPCServer(listener net.Listener) {
+	defer s.wg.Done()
+
+	log.Printf("gRPC server starting on %s", listener.Addr())
+	if err := s.grpcServer.Serve(listener); err != nil {
+		log.Printf("gRPC server error: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/inbox"
+)
+
+// registerInboxRoutes adds the in-app inbox endpoints
+func (s *Service) registerInboxRoutes(router *mux.Router) {
+	router.HandleFunc("/users/{userID}/inbox", s.listInboxHandler).Methods("GET")
+	router.HandleFunc("/users/{userID}/inbox/unread_count", s.unreadCountHandler).Methods("GET")
+	router.HandleFunc("/users/{userID}/inbox/read", s.markAllReadHandler).Methods("POST")
+	router.HandleFunc("/users/{userID}/inbox/{id}/read", s.markReadHandler).Methods("POST")
+	router.HandleFunc("/users/{userID}/inbox/{id}/archive", s.archiveHandler).Methods("POST")
+}
+
+// listInboxHandler returns a page of a user's inbox, newest first
+func (s *Service) listInboxHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+
+	state, err := inbox.ParseState(r.URL.Query().Get("state"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > 100 {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+	}
+	cursor := r.URL.Query().Get("cursor")
+	if cursor != "" {
+		if _, _, err := inbox.DecodeCursor(cursor); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := s.inboxStore.List(r.Context(), userID, inbox.Query{State: state, Cursor: cursor, Limit: limit})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing inbox: %v", err), http.StatusInternalServerError)
+		return
+	}
+	unread, err := s.inboxStore.UnreadCount(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error counting unread items: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":      userID,
+		"items":        page.Items,
+		"next_cursor":  page.NextCursor,
+		"unread_count": unread,
+	})
+}
+
+// unreadCountHandler returns the number of unread items in a user's inbox
+func (s *Service) unreadCountHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+
+	unread, err := s.inboxStore.UnreadCount(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error counting unread items: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":      userID,
+		"unread_count": unread,
+	})
+}
+
+// markReadHandler marks an inbox item read
+func (s *Service) markReadHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	s.changeInboxItem(w, r, s.inboxStore.MarkRead(r.Context(), vars["userID"], vars["id"]))
+}
+
+// archiveHandler moves an inbox item to the archive
+func (s *Service) archiveHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	s.changeInboxItem(w, r, s.inboxStore.Archive(r.Context(), vars["userID"], vars["id"]))
+}
+
+// changeInboxItem answers a change of a single item with the new unread count
+func (s *Service) changeInboxItem(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, inbox.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error updating inbox item: %v", err), http.StatusInternalServerError)
+		return
+	}
+	s.unreadCountHandler(w, r)
+}
+
+// markAllReadHandler marks every unread item of a user's inbox read
+func (s *Service) markAllReadHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+
+	marked, err := s.inboxStore.MarkAllRead(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error marking inbox read: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":      userID,
+		"marked":       marked,
+		"unread_count": 0,
+	})
+}
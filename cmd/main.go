@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,11 +17,28 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
 
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/broadcast"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/channel"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/codec"
 	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/config"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/digest"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/gateway"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/inbox"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/ingest"
 	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/kafka"
 	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/provider"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/quota"
 	redisLib "github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/redis"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/results"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/retry"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/templates"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/throttle"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/validation"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/webpush"
 	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/worker"
 	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
 )
@@ -29,11 +49,58 @@ type Service struct {
 	workerPool      *worker.Pool
 	kafkaConsumer   *kafka.Consumer
 	kafkaProducer   *kafka.Producer
+	batchProducer   *kafka.AsyncProducer
+	deadLetters     *kafka.DeadLetterQueue
+	retryQueue      *kafka.RetryQueue
 	rateLimiter     *redisLib.RateLimiter
 	redisClient     *redis.Client
 	providerManager *provider.ProviderManager
 	httpServer      *http.Server
 
+	// Templates and preferences
+	templateStore   *redisLib.TemplateStore
+	preferenceStore *redisLib.PreferenceStore
+
+	// Delivery status and quiet hours deferral
+	statusStore   *redisLib.StatusStore
+	deferredQueue *redisLib.DeferredQueue
+
+	// Web Push
+	subscriptionStore *redisLib.SubscriptionStore
+	vapidKeys         *webpush.VAPIDKeys
+
+	// Broadcast fan-out
+	audienceStore *redisLib.AudienceStore
+	broadcasts    *broadcast.Expander
+
+	// Digests
+	digester *digest.Digester
+
+	// In-app inbox
+	inboxStore *redisLib.InboxStore
+
+	// Topic subscriptions and device registry
+	topicStore  *redisLib.TopicStore
+	deviceStore *redisLib.DeviceStore
+
+	// API key authentication and audit log
+	authenticator *auth.Authenticator
+	auditLog      *redisLib.AuditLog
+
+	// Tenant throughput quotas
+	quotas *quota.Enforcer
+
+	// Outbound provider rate limiting
+	providerLimiter *throttle.Limiter
+
+	// Live connection gateway and the connect tokens of its clients
+	gateway       *gateway.Gateway
+	gatewayTokens *gateway.Tokens
+
+	// Live processing results and the gRPC API
+	resultHub  *results.Hub
+	grpcServer *grpc.Server
+
 	// Channels
 	messageChan chan *pkg.NotificationMessage
 	errorChan   chan error
@@ -74,6 +141,28 @@ func NewService() (*Service, error) {
 
 	log.Printf("Initialized %d mock providers", len(providerManager.GetAllProviders()))
 
+	// Deliver push notifications over live WebSocket connections to users
+	// with the app open, ahead of the push providers
+	var liveGateway *gateway.Gateway
+	var gatewayTokens *gateway.Tokens
+	if cfg.GatewayEnabled {
+		secret, err := gatewayTokenSecret(cfg)
+		if err != nil {
+			cancel() // Clean up context
+			return nil, err
+		}
+		gatewayTokens = gateway.NewTokens(secret, cfg.GatewayTokenTTL)
+		liveGateway = gateway.NewGateway(
+			"gateway",
+			instanceID(cfg),
+			redisLib.NewPresenceStore(redisClient),
+			redisLib.NewGatewayBus(redisClient),
+			cfg.GatewayHeartbeat,
+			cfg.GatewayAckTimeout,
+		)
+		providerManager.AddPreferred(liveGateway)
+	}
+
 	// Initialize worker pool
 	workerPool := worker.NewPool(
 		cfg.WorkerCount,
@@ -82,17 +171,169 @@ func NewService() (*Service, error) {
 		providerManager,
 		cfg.RetryAttempts,
 		cfg.RetryDelay,
+		newProviderSettings(cfg),
 	)
 
+	// Retry transient failures with exponential backoff and full jitter
+	retryableCodes := cfg.RetryableCodes
+	if len(retryableCodes) == 0 {
+		retryableCodes = retry.DefaultRetryableCodes
+	}
+	workerPool.SetRetryPolicy(retry.NewPolicy(cfg.RetryAttempts, cfg.RetryDelay, cfg.RetryMaxDelay, retryableCodes))
+
+	// Hedge slow sends of urgent notifications to a second provider
+	workerPool.SetHedging(cfg.HedgePercentile)
+
+	// Coalesce notifications that share a collapse key
+	workerPool.SetCoalesceWindow(cfg.CoalesceWindow)
+
+	// Keep one tenant's burst from filling the whole queue
+	workerPool.SetTenantQueueLimit(cfg.TenantMaxQueueSize)
+
+	// Apply the processing policies of the consumed topics
+	topicPolicies, err := worker.ParseTopicPolicies(cfg.TopicPolicies)
+	if err != nil {
+		cancel() // Clean up context
+		return nil, fmt.Errorf("invalid topic policy configuration: %w", err)
+	}
+	for _, policy := range topicPolicies {
+		var topicLimiter *redisLib.RateLimiter
+		if policy.RateLimit > 0 {
+			topicLimiter = redisLib.NewTopicRateLimiter(redisClient, policy.Topic, policy.RateLimit, policy.RateWindow)
+		}
+		workerPool.SetTopicPolicy(policy, topicLimiter)
+	}
+
+	// Enforce tenant throughput quotas cluster-wide; usage is counted for
+	// billing even when unlimited
+	defaultQuota := quota.Policy{
+		PerSecond: int64(cfg.QuotaPerSecond),
+		PerDay:    int64(cfg.QuotaPerDay),
+		Mode:      quota.Mode(cfg.QuotaMode),
+	}
+	if err := defaultQuota.Validate(); err != nil {
+		cancel() // Clean up context
+		return nil, fmt.Errorf("invalid quota configuration: %w", err)
+	}
+	quotas := quota.NewEnforcer(redisLib.NewQuotaStore(redisClient, cfg.QuotaUsageRetention), defaultQuota)
+	workerPool.SetQuota(quotas)
+
+	// Pace sends to providers with token buckets shared across instances
+	// that back off when providers throttle us
+	providerLimiter, err := newProviderLimiter(cfg, redisLib.NewThrottleStore(redisClient))
+	if err != nil {
+		cancel() // Clean up context
+		return nil, fmt.Errorf("invalid provider rate limit configuration: %w", err)
+	}
+	workerPool.SetProviderLimiter(providerLimiter)
+
+	// Register the optional email and SMS channels
+	if cfg.SMTPAddr != "" {
+		emailManager := provider.NewProviderManager(provider.HealthBased)
+		emailManager.AddProvider(provider.NewSMTPProvider("smtp", cfg.SMTPAddr, cfg.SMTPFrom, cfg.SMTPUsername, cfg.SMTPPassword))
+		workerPool.Router().Register(pkg.ChannelEmail, emailManager)
+	}
+	if cfg.SMSGatewayURL != "" {
+		smsManager := provider.NewProviderManager(provider.HealthBased)
+		smsManager.AddProvider(provider.NewSMSProvider("sms-gateway", cfg.SMSGatewayURL, cfg.SMSAPIKey, cfg.SMSSender))
+		workerPool.Router().Register(pkg.ChannelSMS, smsManager)
+	}
+
+	// Register the Web Push channel when VAPID keys are configured
+	subscriptionStore := redisLib.NewSubscriptionStore(redisClient)
+	var vapidKeys *webpush.VAPIDKeys
+	if cfg.VAPIDPrivateKey != "" {
+		keys, err := webpush.ParseVAPIDPrivateKey(cfg.VAPIDPrivateKey)
+		if err != nil {
+			cancel() // Clean up context
+			return nil, fmt.Errorf("invalid web push configuration: %w", err)
+		}
+		vapidKeys = keys
+
+		webPushManager := provider.NewProviderManager(provider.HealthBased)
+		webPushManager.AddProvider(provider.NewWebPushProvider("webpush", vapidKeys, cfg.VAPIDSubject, subscriptionStore))
+		workerPool.Router().Register(pkg.ChannelWebPush, webPushManager)
+	}
+	// Tenants with their own email and SMS credentials get their own providers
+	if cfg.TenantProvidersFile != "" {
+		tenantProviders, err := tenant.LoadProviders(cfg.TenantProvidersFile)
+		if err != nil {
+			cancel() // Clean up context
+			return nil, fmt.Errorf("invalid tenant configuration: %w", err)
+		}
+		for tenantID, creds := range tenantProviders {
+			registerTenantProviders(workerPool.Router(), cfg, tenantID, creds)
+		}
+		log.Printf("Loaded provider credentials for %d tenants", len(tenantProviders))
+	}
+	log.Printf("Delivery channels: %v", workerPool.Router().Channels())
+
+	// Enforce user preferences and render notifications that reference a
+	// stored template in the user's preferred locale
+	preferenceStore := redisLib.NewPreferenceStore(redisClient)
+	workerPool.SetPreferences(preferenceStore)
+
+	// Hold back non-urgent notifications during quiet hours
+	deferredQueue := redisLib.NewDeferredQueue(redisClient)
+	workerPool.SetDeferrer(deferredQueue)
+
+	// Batch low priority notifications of types with a digest policy
+	digestPolicies, err := digest.ParsePolicies(cfg.DigestPolicies)
+	if err != nil {
+		cancel() // Clean up context
+		return nil, fmt.Errorf("invalid digest configuration: %w", err)
+	}
+	digester := digest.NewDigester(redisLib.NewDigestStore(redisClient), digestPolicies)
+	if len(digestPolicies) > 0 {
+		workerPool.SetDigester(digester)
+	}
+
+	templateStore := redisLib.NewTemplateStore(redisClient)
+	workerPool.SetRenderer(templates.NewRenderer(templateStore, preferenceStore))
+
+	// Keep delivered notifications in the users' in-app inboxes
+	inboxStore := redisLib.NewInboxStore(redisClient, cfg.InboxMaxItems, cfg.InboxRetention)
+	if cfg.InboxEnabled {
+		workerPool.SetInbox(inbox.NewInbox(inboxStore, cfg.InboxTypes))
+	}
+
 	// Create channels
 	messageChan := make(chan *pkg.NotificationMessage, cfg.MaxQueueSize)
 	errorChan := make(chan error, 100)
 
+	// Messages are read in any known wire format and produced in KAFKA_CODEC
+	producerCodec, codecs, err := kafkaCodecs(cfg)
+	if err != nil {
+		cancel() // Clean up context
+		return nil, err
+	}
+	compression, err := kafka.ParseCompression(cfg.KafkaCompression)
+	if err != nil {
+		cancel() // Clean up context
+		return nil, fmt.Errorf("invalid KAFKA_COMPRESSION: %w", err)
+	}
+
+	// Large encoded notifications are offloaded to Redis; the consumer
+	// resolves offloaded messages whatever the local threshold
+	offloader := kafka.NewOffloader(redisLib.NewBlobStore(redisClient), cfg.OffloadThreshold, cfg.OffloadTTL)
+
+	// Failed deliveries are retried through topics of increasing delay,
+	// which are consumed along with the notification topics
+	retryTiers, err := kafka.ParseRetryTiers(cfg.KafkaTopic, cfg.KafkaRetryDelays)
+	if err != nil {
+		cancel() // Clean up context
+		return nil, fmt.Errorf("invalid kafka retry configuration: %w", err)
+	}
+	consumedTopics := append([]string(nil), cfg.KafkaTopics...)
+	for _, tier := range retryTiers {
+		consumedTopics = append(consumedTopics, tier.Topic)
+	}
+
 	// Initialize Kafka consumer
 	kafkaConsumer, err := kafka.NewConsumer(
 		cfg.KafkaBrokers,
 		cfg.ConsumerGroup,
-		[]string{cfg.KafkaTopic},
+		consumedTopics,
 		messageChan,
 		errorChan,
 	)
@@ -100,12 +341,78 @@ func NewService() (*Service, error) {
 		cancel() // Clean up context
 		return nil, fmt.Errorf("failed to create kafka consumer: %w", err)
 	}
+	kafkaConsumer.SetCodecs(codecs)
+	kafkaConsumer.SetOffloader(offloader)
+	kafkaConsumer.SetRetryTiers(retryTiers, cfg.RetryMaxDelay)
+
+	// Notifications consumed without a priority get their topic's default
+	priorities := make(map[string]pkg.Priority)
+	for _, policy := range topicPolicies {
+		if policy.Priority != nil {
+			priorities[policy.Topic] = *policy.Priority
+		}
+	}
+	kafkaConsumer.SetDefaultPriorities(priorities)
+
+	// Messages that cannot be decoded or fail validation go to the dead
+	// letter topic; expiry is left to the workers
+	kafkaConsumer.SetValidator(func(n *pkg.NotificationMessage) error {
+		return validation.Validate(n, time.Time{})
+	})
+	deadLetters, err := kafka.NewDeadLetterQueue(cfg.KafkaBrokers, cfg.KafkaDLQTopic, compression)
+	if err != nil {
+		log.Printf("Warning: failed to create kafka dead letter queue: %v", err)
+		deadLetters = nil // Invalid messages are then only reported
+	} else {
+		kafkaConsumer.SetDeadLetter(deadLetters)
+	}
+
+	var retryQueue *kafka.RetryQueue
+	if len(retryTiers) > 0 {
+		retryQueue, err = kafka.NewRetryQueue(cfg.KafkaBrokers, retryTiers, cfg.KafkaDLQTopic, compression)
+		if err != nil {
+			log.Printf("Warning: failed to create kafka retry queue: %v", err)
+			retryQueue = nil // Workers then retry in place
+		} else {
+			retryQueue.SetCodec(producerCodec)
+			if cfg.OffloadThreshold > 0 {
+				retryQueue.SetOffloader(offloader)
+			}
+			workerPool.SetRetrier(retryQueue)
+		}
+	}
 
 	// Initialize Kafka producer (for testing purposes)
-	kafkaProducer, err := kafka.NewProducer(cfg.KafkaBrokers, cfg.KafkaTopic)
+	kafkaProducer, err := kafka.NewProducer(cfg.KafkaBrokers, cfg.KafkaTopic, compression)
 	if err != nil {
 		log.Printf("Warning: failed to create kafka producer: %v", err)
 		kafkaProducer = nil // Non-critical for the service
+	} else {
+		kafkaProducer.SetCodec(producerCodec)
+		if cfg.OffloadThreshold > 0 {
+			kafkaProducer.SetOffloader(offloader)
+		}
+	}
+
+	// Bulk submissions are published through a batching producer
+	batchProducer, err := kafka.NewAsyncProducer(cfg.KafkaBrokers, cfg.KafkaTopic, compression, cfg.BatchFlushFrequency, cfg.BatchFlushMessages)
+	if err != nil {
+		log.Printf("Warning: failed to create kafka batch producer: %v", err)
+		batchProducer = nil // Non-critical for the service
+	} else {
+		batchProducer.SetCodec(producerCodec)
+		if cfg.OffloadThreshold > 0 {
+			batchProducer.SetOffloader(offloader)
+		}
+	}
+
+	topicStore := redisLib.NewTopicStore(redisClient)
+
+	// API keys are stored hashed in Redis; the bootstrap key creates the first ones
+	authenticator := auth.NewAuthenticator(redisLib.NewAPIKeyStore(redisClient))
+	authenticator.SetBootstrapKey(cfg.BootstrapAPIKey)
+	if cfg.AuthEnabled && cfg.BootstrapAPIKey == "" {
+		log.Printf("Warning: authentication is enabled without BOOTSTRAP_API_KEY, only stored keys are accepted")
 	}
 
 	service := &Service{
@@ -113,6 +420,9 @@ func NewService() (*Service, error) {
 		workerPool:      workerPool,
 		kafkaConsumer:   kafkaConsumer,
 		kafkaProducer:   kafkaProducer,
+		batchProducer:   batchProducer,
+		deadLetters:     deadLetters,
+		retryQueue:      retryQueue,
 		rateLimiter:     rateLimiter,
 		redisClient:     redisClient,
 		providerManager: providerManager,
@@ -120,14 +430,111 @@ func NewService() (*Service, error) {
 		errorChan:       errorChan,
 		ctx:             ctx,
 		cancel:          cancel,
+
+		templateStore:     templateStore,
+		preferenceStore:   preferenceStore,
+		inboxStore:        inboxStore,
+		statusStore:       redisLib.NewStatusStore(redisClient, cfg.StatusRetention),
+		deferredQueue:     deferredQueue,
+		digester:          digester,
+		subscriptionStore: subscriptionStore,
+		vapidKeys:         vapidKeys,
+		audienceStore:     redisLib.NewAudienceStore(redisClient),
+		topicStore:        topicStore,
+		deviceStore:       redisLib.NewDeviceStore(redisClient, topicStore),
+		authenticator:     authenticator,
+		auditLog:          redisLib.NewAuditLog(redisClient, cfg.AuditLogMaxLen),
+		quotas:            quotas,
+		providerLimiter:   providerLimiter,
+		gateway:           liveGateway,
+		gatewayTokens:     gatewayTokens,
+		resultHub:         results.NewHub(),
+	}
+
+	// Broadcasts are fanned out by re-publishing per-user messages to Kafka
+	if kafkaProducer != nil {
+		service.broadcasts = broadcast.NewExpander(
+			service.audienceStore,
+			kafkaProducer,
+			redisLib.NewBroadcastStore(redisClient, cfg.StatusRetention),
+			cfg.BroadcastChunkSize,
+			cfg.BroadcastConcurrency,
+			cfg.BroadcastChunkInterval,
+		)
 	}
 
 	// Initialize HTTP server
 	service.setupHTTPServer()
 
+	// Initialize gRPC server
+	if cfg.GRPCPort != "" {
+		service.setupGRPCServer()
+	}
+
 	return service, nil
 }
 
+// kafkaCodecs returns the codec messages are produced with and the codecs
+// they are read with: JSON, Protobuf and, with a schema registry, Avro
+func kafkaCodecs(cfg *config.Config) (codec.Codec, *codec.Codecs, error) {
+	var avro *codec.Avro
+	codecs := codec.NewCodecs(codec.JSON{}, codec.Protobuf{})
+	if cfg.SchemaRegistryURL != "" {
+		avro = codec.NewAvro(codec.NewSchemaRegistry(cfg.SchemaRegistryURL, cfg.SchemaRegistryTimeout))
+		codecs = codec.NewCodecs(codec.JSON{}, codec.Protobuf{}, avro)
+	}
+
+	switch cfg.KafkaCodec {
+	case "json":
+		return codec.JSON{}, codecs, nil
+	case "protobuf":
+		return codec.Protobuf{}, codecs, nil
+	case "avro":
+		if avro == nil {
+			return nil, nil, fmt.Errorf("KAFKA_CODEC avro requires SCHEMA_REGISTRY_URL")
+		}
+		return avro, codecs, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown KAFKA_CODEC %q", cfg.KafkaCodec)
+	}
+}
+
+// registerTenantProviders registers the email and SMS providers of a tenant
+// with its own credentials
+func registerTenantProviders(router *channel.Router, cfg *config.Config, tenantID string, creds tenant.Providers) {
+	if creds.SMTPAddr != "" {
+		from := creds.SMTPFrom
+		if from == "" {
+			from = cfg.SMTPFrom
+		}
+		emailManager := provider.NewProviderManager(provider.HealthBased)
+		emailManager.AddProvider(provider.NewSMTPProvider("smtp-"+tenantID, creds.SMTPAddr, from, creds.SMTPUsername, creds.SMTPPassword))
+		router.RegisterTenant(tenantID, pkg.ChannelEmail, emailManager)
+	}
+	if creds.SMSGatewayURL != "" {
+		smsManager := provider.NewProviderManager(provider.HealthBased)
+		smsManager.AddProvider(provider.NewSMSProvider("sms-gateway-"+tenantID, creds.SMSGatewayURL, creds.SMSAPIKey, creds.SMSSender))
+		router.RegisterTenant(tenantID, pkg.ChannelSMS, smsManager)
+	}
+}
+
+// newProviderSettings builds the timeouts and retries of providers from
+// their defaults and per-provider overrides
+func newProviderSettings(cfg *config.Config) *provider.SettingsTable {
+	settings := provider.NewSettingsTable(provider.Settings{Timeout: cfg.ProviderTimeout, Retries: cfg.ProviderRetries})
+	for name, timeout := range cfg.ProviderTimeouts {
+		s := settings.For(name)
+		s.Timeout = timeout
+		settings.Set(name, s)
+	}
+	for name, retries := range cfg.ProviderRetryLimits {
+		s := settings.For(name)
+		s.Retries = retries
+		settings.Set(name, s)
+	}
+	return settings
+}
+
 // Start starts the notification service
 func (s *Service) Start() error {
 	log.Println("Starting notification service...")
@@ -152,10 +559,34 @@ func (s *Service) Start() error {
 	s.wg.Add(1)
 	go s.processErrors()
 
+	// Start deferred notification dispatcher
+	s.wg.Add(1)
+	go s.processDeferred()
+
+	// Start digest flusher
+	s.wg.Add(1)
+	go s.processDigests()
+
+	// Start live gateway relay
+	if s.gateway != nil {
+		s.wg.Add(1)
+		go s.runGateway()
+	}
+
 	// Start HTTP server
 	s.wg.Add(1)
 	go s.startHTTPServer()
 
+	// Start gRPC server
+	if s.grpcServer != nil {
+		listener, err := net.Listen("tcp", ":"+s.config.GRPCPort)
+		if err != nil {
+			return fmt.Errorf("failed to listen for grpc: %w", err)
+		}
+		s.wg.Add(1)
+		go s.startGRPCServer(listener)
+	}
+
 	log.Println("Notification service started successfully")
 	return nil
 }
@@ -167,6 +598,9 @@ func (s *Service) Stop() {
 	// Cancel context
 	s.cancel()
 
+	// End live result streams so HTTP and gRPC shutdown need not wait for them
+	s.resultHub.Close()
+
 	// Stop HTTP server
 	if s.httpServer != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
@@ -176,6 +610,11 @@ func (s *Service) Stop() {
 		}
 	}
 
+	// Stop gRPC server
+	if s.grpcServer != nil {
+		s.grpcServer.GracefulStop()
+	}
+
 	// Stop Kafka consumer
 	if err := s.kafkaConsumer.Stop(); err != nil {
 		log.Printf("Kafka consumer stop error: %v", err)
@@ -184,6 +623,11 @@ func (s *Service) Stop() {
 	// Stop worker pool
 	s.workerPool.Stop()
 
+	// Stop broadcast fan-outs before the producer is closed
+	if s.broadcasts != nil {
+		s.broadcasts.Stop()
+	}
+
 	// Close Redis client
 	if err := s.redisClient.Close(); err != nil {
 		log.Printf("Redis client close error: %v", err)
@@ -195,6 +639,21 @@ func (s *Service) Stop() {
 			log.Printf("Kafka producer close error: %v", err)
 		}
 	}
+	if s.batchProducer != nil {
+		if err := s.batchProducer.Close(); err != nil {
+			log.Printf("Kafka batch producer close error: %v", err)
+		}
+	}
+	if s.deadLetters != nil {
+		if err := s.deadLetters.Close(); err != nil {
+			log.Printf("Kafka dead letter queue close error: %v", err)
+		}
+	}
+	if s.retryQueue != nil {
+		if err := s.retryQueue.Close(); err != nil {
+			log.Printf("Kafka retry queue close error: %v", err)
+		}
+	}
 
 	// Wait for goroutines
 	s.wg.Wait()
@@ -236,18 +695,94 @@ func (s *Service) processResults() {
 				continue
 			}
 
+			// Record the latest status for the status API
+			if err := s.statusStore.Record(s.ctx, result); err != nil {
+				log.Printf("Failed to record status for notification %s: %v", result.MessageID, err)
+			}
+
+			// Push the result to live watchers
+			s.resultHub.Publish(result)
+
 			// Log result
 			if result.Success {
-				log.Printf("Successfully processed notification %s for user %s via %s (attempts: %d)",
-					result.MessageID, result.UserID, result.Provider, result.Attempts)
+				log.Printf("Successfully processed notification %s for user %s on %s via %s (attempts: %d)",
+					result.MessageID, result.UserID, result.Channel, result.Provider, result.Attempts)
 			} else {
-				log.Printf("Failed to process notification %s for user %s: %v (attempts: %d)",
-					result.MessageID, result.UserID, result.Error, result.Attempts)
+				log.Printf("Failed to process notification %s for user %s on %s: %v (attempts: %d)",
+					result.MessageID, result.UserID, result.Channel, result.Error, result.Attempts)
 			}
 		}
 	}
 }
 
+// processDeferred resubmits deferred notifications once they are due
+func (s *Service) processDeferred() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.DeferredPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			due, err := s.deferredQueue.PopDue(s.ctx, time.Now(), s.config.MaxQueueSize)
+			if err != nil {
+				log.Printf("Failed to fetch deferred notifications: %v", err)
+				continue
+			}
+
+			for i, msg := range due {
+				if err := s.workerPool.Submit(msg); err != nil {
+					// Put the rest back so nothing is lost while the queue is full
+					for _, pending := range due[i:] {
+						if err := s.deferredQueue.Defer(s.ctx, pending, time.Now()); err != nil {
+							log.Printf("Failed to requeue deferred notification %s: %v", pending.ID, err)
+						}
+					}
+					log.Printf("Worker pool full, requeued %d deferred notifications", len(due)-i)
+					break
+				}
+			}
+		}
+	}
+}
+
+// processDigests flushes digests once they are due
+func (s *Service) processDigests() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.DigestPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			summaries, err := s.digester.FlushDue(s.ctx, time.Now(), s.config.MaxQueueSize)
+			if err != nil {
+				log.Printf("Failed to flush digests: %v", err)
+			}
+			for _, summary := range summaries {
+				s.submitDigest(summary)
+			}
+		}
+	}
+}
+
+// submitDigest hands a digest summary to the worker pool, parking it in the
+// deferred queue while the pool is full so it is not lost
+func (s *Service) submitDigest(summary *pkg.NotificationMessage) {
+	if err := s.workerPool.Submit(summary); err == nil {
+		return
+	}
+	if err := s.deferredQueue.Defer(s.ctx, summary, time.Now()); err != nil {
+		log.Printf("Failed to requeue digest %s: %v", summary.ID, err)
+	}
+}
+
 // processErrors processes errors from various components
 func (s *Service) processErrors() {
 	defer s.wg.Done()
@@ -274,6 +809,16 @@ func (s *Service) processErrors() {
 func (s *Service) setupHTTPServer() {
 	router := mux.NewRouter()
 
+	// API key authentication with per-route scopes
+	if s.config.AuthEnabled {
+		router.Use(auth.Middleware(s.authenticator, requiredScope, s.auditLog))
+	} else {
+		log.Printf("Warning: authentication is disabled")
+	}
+
+	// Scope requests to the tenant of their API key
+	router.Use(tenantMiddleware)
+
 	// Health check endpoint
 	router.HandleFunc("/health", s.healthHandler).Methods("GET")
 
@@ -283,11 +828,57 @@ func (s *Service) setupHTTPServer() {
 	// Rate limit status endpoint
 	router.HandleFunc("/ratelimit/{userID}", s.rateLimitHandler).Methods("GET")
 
+	// User preference endpoints
+	s.registerPreferenceRoutes(router)
+
+	// Digest inspection endpoints
+	s.registerDigestRoutes(router)
+
+	// In-app inbox endpoints
+	s.registerInboxRoutes(router)
+
+	// Template management endpoints
+	s.registerTemplateRoutes(router)
+
+	// Web Push subscription endpoints
+	s.registerWebPushRoutes(router)
+
+	// Topic subscription and device registry endpoints
+	s.registerTopicRoutes(router)
+
+	// Broadcast and segmentation endpoints
+	s.registerBroadcastRoutes(router)
+
+	// API key management and audit endpoints
+	s.registerKeyRoutes(router)
+
+	// Tenant quota and usage endpoints
+	s.registerQuotaRoutes(router)
+
+	// Live result stream endpoints
+	s.registerStreamRoutes(router)
+
+	// Live gateway connection endpoint
+	if s.gateway != nil {
+		s.registerGatewayRoutes(router)
+	}
+
+	// Provider rate limit inspection endpoint
+	router.HandleFunc("/providers/{name}/throttle", s.providerThrottleHandler).Methods("GET")
+
+	// Delivery status endpoint
+	router.HandleFunc("/notifications/{id}/status", s.statusHandler).Methods("GET")
+
 	// Test endpoint to send a notification (for testing)
 	if s.kafkaProducer != nil {
 		router.HandleFunc("/send", s.sendNotificationHandler).Methods("POST")
 	}
 
+	// Bulk send endpoint
+	if s.batchProducer != nil {
+		router.HandleFunc("/send/batch", s.sendBatchHandler).Methods("POST")
+	}
+
 	s.httpServer = &http.Server{
 		Addr:         ":" + s.config.Port,
 		Handler:      router,
@@ -362,13 +953,26 @@ func (s *Service) healthHandler(w http.ResponseWriter, r *http.Request) {
 // metricsHandler provides metrics endpoint
 func (s *Service) metricsHandler(w http.ResponseWriter, r *http.Request) {
 	processed, failed, rateLimited := s.workerPool.GetMetrics()
+	hedged, hedgeWins := s.workerPool.GetHedgeMetrics()
+
+	deferredPending, err := s.deferredQueue.Pending(r.Context())
+	if err != nil {
+		log.Printf("Failed to count deferred notifications: %v", err)
+	}
 
 	metrics := map[string]interface{}{
 		"processed_messages":    processed,
 		"failed_messages":       failed,
 		"rate_limited_messages": rateLimited,
+		"channels":              s.workerPool.GetChannelMetrics(),
+		"outcomes":              s.workerPool.GetOutcomeMetrics(),
+		"tenants":               s.tenantMetrics(r),
+		"topics":                s.workerPool.GetTopicMetrics(),
+		"hedged_sends":          hedged,
+		"hedge_wins":            hedgeWins,
+		"deferred_pending":      deferredPending,
 		"queue_size":            s.workerPool.QueueSize(),
-		"worker_count":          s.config.WorkerCount,
+		"worker_count":          s.workerPool.Workers(),
 		"timestamp":             time.Now().Unix(),
 	}
 
@@ -376,6 +980,23 @@ func (s *Service) metricsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(metrics)
 }
 
+// tenantMetrics returns the per-tenant metrics visible to the caller: every
+// tenant for system keys and unauthenticated deployments, otherwise only the
+// caller's own
+func (s *Service) tenantMetrics(r *http.Request) map[string]worker.TenantMetrics {
+	metrics := s.workerPool.GetTenantMetrics()
+	if key := auth.KeyFromContext(r.Context()); key == nil || key.Tenant == auth.SystemTenant {
+		return metrics
+	}
+
+	tenantID := tenant.FromContext(r.Context())
+	own := make(map[string]worker.TenantMetrics, 1)
+	if m, ok := metrics[tenantID]; ok {
+		own[tenantID] = m
+	}
+	return own
+}
+
 // rateLimitHandler provides rate limit status for a user
 func (s *Service) rateLimitHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -417,6 +1038,24 @@ func (s *Service) rateLimitHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
+// statusHandler returns the latest per-channel status of a notification
+func (s *Service) statusHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	status, err := s.statusStore.Get(r.Context(), id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting status: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if status == nil {
+		http.Error(w, "notification not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
 // sendNotificationHandler provides a test endpoint to send notifications
 func (s *Service) sendNotificationHandler(w http.ResponseWriter, r *http.Request) {
 	if s.kafkaProducer == nil {
@@ -424,28 +1063,35 @@ func (s *Service) sendNotificationHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var notification pkg.NotificationMessage
-	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read body: %v", err), http.StatusBadRequest)
+		return
+	}
+	notification, err := ingest.Decode(body)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	// Set defaults if not provided
-	if notification.ID == "" {
-		notification.ID = fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if err := ingest.Prepare(notification, fmt.Sprintf("test_%d", time.Now().UnixNano())); err != nil {
+		writeInvalid(w, err)
+		return
 	}
-	if notification.CreatedAt.IsZero() {
-		notification.CreatedAt = time.Now()
+	if !enforceTenant(w, r, notification) {
+		return
 	}
-	if notification.Priority == 0 {
-		notification.Priority = pkg.PriorityNormal
+	if !s.admitQuota(w, r, notification.Tenant(), 1) {
+		return
 	}
 
 	// Send to Kafka
-	if err := s.kafkaProducer.Send(&notification); err != nil {
+	if err := s.kafkaProducer.Send(notification); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to send notification: %v", err), http.StatusInternalServerError)
 		return
 	}
+	auth.Annotate(r.Context(), "notification_id", notification.ID)
+	auth.Annotate(r.Context(), "user_id", notification.UserID)
 
 	response := map[string]interface{}{
 		"message":         "Notification sent successfully",
@@ -458,6 +1104,23 @@ func (s *Service) sendNotificationHandler(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(response)
 }
 
+// writeInvalid answers a rejected notification with 400, listing the invalid
+// fields when validation failed
+func writeInvalid(w http.ResponseWriter, err error) {
+	var invalid *validation.Error
+	if !errors.As(err, &invalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "invalid notification",
+		"fields": invalid.Fields,
+	})
+}
+
 // main function
 func main() {
 	// Create service
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/preferences"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// registerPreferenceRoutes adds the user preference CRUD endpoints
+func (s *Service) registerPreferenceRoutes(router *mux.Router) {
+	router.HandleFunc("/users/{userID}/preferences", s.getPreferencesHandler).Methods("GET")
+	router.HandleFunc("/users/{userID}/preferences", s.putPreferencesHandler).Methods("PUT")
+	router.HandleFunc("/users/{userID}/preferences", s.patchPreferencesHandler).Methods("PATCH")
+	router.HandleFunc("/users/{userID}/preferences", s.deletePreferencesHandler).Methods("DELETE")
+}
+
+// getPreferencesHandler returns a user's preferences, or the defaults
+func (s *Service) getPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	prefs, err := s.preferenceStore.Get(r.Context(), mux.Vars(r)["userID"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting preferences: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// putPreferencesHandler replaces a user's preferences
+func (s *Service) putPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var prefs preferences.Preferences
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	prefs.UserID = mux.Vars(r)["userID"]
+
+	if err := validatePreferences(prefs.Channels, prefs.QuietHours); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.preferenceStore.Save(r.Context(), &prefs); err != nil {
+		http.Error(w, fmt.Sprintf("Error saving preferences: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// patchPreferencesHandler merges a partial update into a user's preferences
+func (s *Service) patchPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var patch preferences.Patch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := validatePreferences(patch.Channels, patch.QuietHours); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := s.preferenceStore.Get(r.Context(), mux.Vars(r)["userID"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting preferences: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	prefs.Merge(&patch)
+	if err := s.preferenceStore.Save(r.Context(), prefs); err != nil {
+		http.Error(w, fmt.Sprintf("Error saving preferences: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// deletePreferencesHandler resets a user's preferences to the defaults
+func (s *Service) deletePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.preferenceStore.Delete(r.Context(), mux.Vars(r)["userID"]); err != nil {
+		http.Error(w, fmt.Sprintf("Error deleting preferences: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validatePreferences rejects toggles for unknown channels and malformed quiet hours
+func validatePreferences(channels map[pkg.Channel]bool, quiet *preferences.QuietHours) error {
+	for ch := range channels {
+		if !ch.IsValid() {
+			return fmt.Errorf("unknown channel: %s", ch)
+		}
+	}
+	if quiet != nil {
+		if err := quiet.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
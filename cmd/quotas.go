@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/quota"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+)
+
+// maxUsageDays bounds the range of a usage query
+const maxUsageDays = 366
+
+// registerQuotaRoutes adds the tenant quota and usage endpoints
+func (s *Service) registerQuotaRoutes(router *mux.Router) {
+	router.HandleFunc("/tenants/{tenantID}/quota", s.getQuotaHandler).Methods("GET")
+	router.HandleFunc("/tenants/{tenantID}/quota", s.setQuotaHandler).Methods("PUT")
+	router.HandleFunc("/tenants/{tenantID}/usage", s.usageHandler).Methods("GET")
+}
+
+// admitQuota rejects a request with 429 when the tenant's quota is exhausted
+// and its policy rejects over-quota traffic
+func (s *Service) admitQuota(w http.ResponseWriter, r *http.Request, tenantID string, n int64) bool {
+	decision, err := s.quotas.Admit(r.Context(), tenantID, n)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error checking quota: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	if decision.Allowed {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+	http.Error(w, fmt.Sprintf("quota of tenant %s exceeded", tenantID), http.StatusTooManyRequests)
+	return false
+}
+
+// quotaTenant returns the tenant named in the path if the caller may read it
+func quotaTenant(w http.ResponseWriter, r *http.Request) (string, bool) {
+	tenantID := mux.Vars(r)["tenantID"]
+	if err := tenant.Validate(tenantID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	if key := auth.KeyFromContext(r.Context()); key != nil && !key.CanAccessTenant(tenantID) {
+		http.Error(w, fmt.Sprintf("api key cannot access tenant %s", tenantID), http.StatusForbidden)
+		return "", false
+	}
+	return tenantID, true
+}
+
+// getQuotaHandler returns a tenant's effective policy and current usage
+func (s *Service) getQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := quotaTenant(w, r)
+	if !ok {
+		return
+	}
+
+	policy, err := s.quotas.Policy(r.Context(), tenantID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting quota: %v", err), http.StatusInternalServerError)
+		return
+	}
+	current, err := s.quotas.Check(r.Context(), tenantID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting quota: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tenant":  tenantID,
+		"policy":  policy,
+		"current": current,
+	})
+}
+
+// setQuotaHandler sets a tenant's own policy. Tenants must not raise their
+// own quota, so this needs a system key.
+func (s *Service) setQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := quotaTenant(w, r)
+	if !ok {
+		return
+	}
+	if key := auth.KeyFromContext(r.Context()); key != nil && key.Tenant != auth.SystemTenant {
+		http.Error(w, "quotas can only be set with a system key", http.StatusForbidden)
+		return
+	}
+
+	var policy quota.Policy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := s.quotas.SetPolicy(r.Context(), tenantID, policy); err != nil {
+		http.Error(w, fmt.Sprintf("Error setting quota: %v", err), http.StatusBadRequest)
+		return
+	}
+	auth.Annotate(r.Context(), "quota_tenant", tenantID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// usageHandler returns a tenant's daily usage between the from and to dates
+// (YYYY-MM-DD, UTC), by default over the last 30 days
+func (s *Service) usageHandler(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := quotaTenant(w, r)
+	if !ok {
+		return
+	}
+
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -29)
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = time.Parse(time.DateOnly, value); err != nil {
+			http.Error(w, "from must be a date like 2024-01-31", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = time.Parse(time.DateOnly, value); err != nil {
+			http.Error(w, "to must be a date like 2024-01-31", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Sub(from) > maxUsageDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("usage range is limited to %d days", maxUsageDays), http.StatusBadRequest)
+		return
+	}
+
+	usage, err := s.quotas.Usage(r.Context(), tenantID, from, to)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting usage: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var total quota.Usage
+	for _, day := range usage {
+		total.Accepted += day.Accepted
+		total.Rejected += day.Rejected
+		total.Queued += day.Queued
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tenant": tenantID,
+		"from":   from.Format(time.DateOnly),
+		"to":     to.Format(time.DateOnly),
+		"days":   usage,
+		"total":  total,
+	})
+}
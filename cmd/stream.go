@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/results"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// resultUpgrader upgrades result stream requests to WebSocket connections
+var resultUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// registerStreamRoutes registers the live result stream endpoints
+func (s *Service) registerStreamRoutes(router *mux.Router) {
+	router.HandleFunc("/stream/results", s.streamResultsHandler).Methods("GET")
+	router.HandleFunc("/stream/results/ws", s.streamResultsWebSocketHandler).Methods("GET")
+}
+
+// resultFilter builds a result filter from the query string. Keys of a
+// single tenant only see their own tenant's results; system keys see every
+// tenant unless tenant_id is given.
+func resultFilter(r *http.Request) (results.Filter, error) {
+	query := r.URL.Query()
+	tenantID, err := auth.ResolveTenant(auth.KeyFromContext(r.Context()), query.Get("tenant_id"))
+	if err != nil {
+		return results.Filter{}, err
+	}
+	return results.Filter{
+		TenantID: tenantID,
+		UserID:   query.Get("user_id"),
+		Provider: query.Get("provider"),
+		Outcome:  pkg.Outcome(query.Get("outcome")),
+	}, nil
+}
+
+// streamResultsHandler streams processing results as server-sent events
+func (s *Service) streamResultsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := resultFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sub := s.resultHub.Subscribe(filter, s.config.ResultStreamBuffer)
+	defer sub.Close()
+
+	if err := results.StreamSSE(w, r, sub, s.config.ResultStreamHeartbeat); err != nil {
+		log.Printf("Result stream ended: %v", err)
+	}
+}
+
+// streamResultsWebSocketHandler streams processing results over a WebSocket
+func (s *Service) streamResultsWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := resultFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Upgrade writes the error response itself
+	conn, err := resultUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	sub := s.resultHub.Subscribe(filter, s.config.ResultStreamBuffer)
+	defer sub.Close()
+
+	if err := results.StreamWebSocket(conn, sub, s.config.ResultStreamHeartbeat); err != nil {
+		log.Printf("Result WebSocket ended: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/templates"
+)
+
+// registerTemplateRoutes adds the template management endpoints
+func (s *Service) registerTemplateRoutes(router *mux.Router) {
+	router.HandleFunc("/templates", s.saveTemplateHandler).Methods("POST")
+	router.HandleFunc("/templates/{id}", s.getTemplateHandler).Methods("GET")
+	router.HandleFunc("/templates/{id}", s.deleteTemplateHandler).Methods("DELETE")
+	router.HandleFunc("/templates/{id}/versions", s.templateVersionsHandler).Methods("GET")
+	router.HandleFunc("/templates/{id}/rollback", s.rollbackTemplateHandler).Methods("POST")
+	router.HandleFunc("/templates/{id}/preview", s.previewTemplateHandler).Methods("POST")
+}
+
+// saveTemplateHandler stores a template as a new current version
+func (s *Service) saveTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var tpl templates.Template
+	if err := json.NewDecoder(r.Body).Decode(&tpl); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := tpl.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid template: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := s.templateStore.Save(r.Context(), &tpl)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error saving template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(saved)
+}
+
+// getTemplateHandler returns the current template, or the version given in ?version=
+func (s *Service) getTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var tpl *templates.Template
+	var err error
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, convErr := strconv.Atoi(v)
+		if convErr != nil {
+			http.Error(w, "version must be a number", http.StatusBadRequest)
+			return
+		}
+		tpl, err = s.templateStore.GetVersion(r.Context(), id, version)
+	} else {
+		tpl, err = s.templateStore.Get(r.Context(), id)
+	}
+	if err != nil {
+		templateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tpl)
+}
+
+// deleteTemplateHandler removes a template and all of its versions
+func (s *Service) deleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.templateStore.Delete(r.Context(), mux.Vars(r)["id"]); err != nil {
+		templateError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// templateVersionsHandler lists the stored versions of a template
+func (s *Service) templateVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	versions, err := s.templateStore.Versions(r.Context(), id)
+	if err != nil {
+		templateError(w, err)
+		return
+	}
+	current, err := s.templateStore.Get(r.Context(), id)
+	if err != nil {
+		templateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":              id,
+		"versions":        versions,
+		"current_version": current.Version,
+	})
+}
+
+// rollbackTemplateHandler makes an earlier version current
+func (s *Service) rollbackTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Version int `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Version <= 0 {
+		http.Error(w, "version is required", http.StatusBadRequest)
+		return
+	}
+
+	tpl, err := s.templateStore.Rollback(r.Context(), mux.Vars(r)["id"], req.Version)
+	if err != nil {
+		templateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tpl)
+}
+
+// previewTemplateHandler renders the current template with sample data
+func (s *Service) previewTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Locale string                 `json:"locale"`
+		Data   map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	tpl, err := s.templateStore.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		templateError(w, err)
+		return
+	}
+
+	rendered, err := tpl.Render(req.Locale, req.Data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Render error: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": tpl.Version,
+		"locale":  rendered.Locale,
+		"title":   rendered.Title,
+		"body":    rendered.Body,
+	})
+}
+
+// templateError maps template store errors to HTTP responses
+func templateError(w http.ResponseWriter, err error) {
+	if errors.Is(err, templates.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Template store error: %v", err), http.StatusInternalServerError)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/config"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/throttle"
+)
+
+// newProviderLimiter builds the provider limiter from the configured default
+// rate and the per-provider overrides
+func newProviderLimiter(cfg *config.Config, store throttle.Store) (*throttle.Limiter, error) {
+	policy := func(rate float64) (throttle.Policy, error) {
+		p := throttle.Policy{
+			Rate:     rate,
+			Burst:    cfg.ProviderRateBurst,
+			MinRate:  cfg.ProviderMinRate,
+			Increase: cfg.ProviderRateIncrease,
+			Decrease: cfg.ProviderRateDecrease,
+			Backoff:  cfg.ProviderThrottleBackoff,
+		}
+		if p.MinRate > p.Rate {
+			p.MinRate = p.Rate
+		}
+		return p, p.Validate()
+	}
+
+	defaults, err := policy(cfg.ProviderRateLimit)
+	if err != nil {
+		return nil, err
+	}
+	limiter := throttle.NewLimiter(store, defaults, cfg.ProviderMaxWait)
+
+	for name, rate := range cfg.ProviderRateLimits {
+		p, err := policy(rate)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %w", name, err)
+		}
+		limiter.SetPolicy(name, p)
+	}
+	return limiter, nil
+}
+
+// providerThrottleHandler returns a provider's rate limit policy and the
+// current state of its shared bucket
+func (s *Service) providerThrottleHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	state, err := s.providerLimiter.State(r.Context(), name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting provider throttle state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"provider": name,
+		"policy":   s.providerLimiter.Policy(name),
+		"state":    state,
+	})
+}
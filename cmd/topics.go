@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/topics"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// importBatchSize is the number of subscriptions written per Redis round trip
+// during a bulk import, and maxImportErrors caps the errors reported back
+const (
+	importBatchSize = 500
+	maxImportErrors = 100
+)
+
+// registerTopicRoutes adds the topic subscription and device registry endpoints
+func (s *Service) registerTopicRoutes(router *mux.Router) {
+	router.HandleFunc("/topics/{topic}", s.topicHandler).Methods("GET")
+	router.HandleFunc("/topics/{topic}/subscribers", s.subscribeHandler).Methods("POST")
+	router.HandleFunc("/topics/{topic}/subscribers", s.unsubscribeHandler).Methods("DELETE")
+	router.HandleFunc("/topics/{topic}/subscribers/import", s.importSubscribersHandler).Methods("POST")
+	router.HandleFunc("/users/{userID}/topics", s.userTopicsHandler).Methods("GET")
+
+	router.HandleFunc("/users/{userID}/devices", s.listDevicesHandler).Methods("GET")
+	router.HandleFunc("/users/{userID}/devices", s.registerDeviceHandler).Methods("POST")
+	router.HandleFunc("/users/{userID}/devices/{deviceID}", s.unregisterDeviceHandler).Methods("DELETE")
+}
+
+// topicFromRequest returns the validated topic name of the request path
+func topicFromRequest(r *http.Request) (string, error) {
+	topic := mux.Vars(r)["topic"]
+	return topic, topics.ValidateName(topic)
+}
+
+// resolveSubscriber fills in the owner of a device subscription from the
+// registry and rejects devices that are unknown or owned by someone else
+func (s *Service) resolveSubscriber(ctx context.Context, sub topics.Subscriber) (topics.Subscriber, error) {
+	if sub.DeviceID == "" {
+		if sub.UserID == "" {
+			return sub, fmt.Errorf("user_id or device_id is required")
+		}
+		return sub, nil
+	}
+
+	device, err := s.deviceStore.Get(ctx, sub.DeviceID)
+	if err != nil {
+		return sub, err
+	}
+	if device == nil {
+		return sub, fmt.Errorf("device %s is not registered", sub.DeviceID)
+	}
+	if sub.UserID != "" && sub.UserID != device.UserID {
+		return sub, fmt.Errorf("device %s does not belong to user %s", sub.DeviceID, sub.UserID)
+	}
+	sub.UserID = device.UserID
+	return sub, nil
+}
+
+// topicHandler returns the number of users subscribed to a topic
+func (s *Service) topicHandler(w http.ResponseWriter, r *http.Request) {
+	topic, err := topicFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	count, err := s.topicStore.Count(r.Context(), topic)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error counting subscribers: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"topic":   topic,
+		"members": count,
+	})
+}
+
+// subscribeHandler subscribes a user or one of its devices to a topic
+func (s *Service) subscribeHandler(w http.ResponseWriter, r *http.Request) {
+	s.changeSubscription(w, r, s.topicStore.Subscribe, http.StatusCreated)
+}
+
+// unsubscribeHandler removes a user or device subscription from a topic
+func (s *Service) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	s.changeSubscription(w, r, s.topicStore.Unsubscribe, http.StatusNoContent)
+}
+
+// changeSubscription decodes and resolves a subscriber, then applies change
+func (s *Service) changeSubscription(w http.ResponseWriter, r *http.Request, change func(context.Context, string, topics.Subscriber) error, status int) {
+	topic, err := topicFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var sub topics.Subscriber
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	sub, err = s.resolveSubscriber(r.Context(), sub)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := change(r.Context(), topic, sub); err != nil {
+		http.Error(w, fmt.Sprintf("Error updating subscription: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(status)
+}
+
+// importSubscribersHandler bulk subscribes users and devices from a CSV or
+// NDJSON body. Malformed records are skipped and reported.
+func (s *Service) importSubscribersHandler(w http.ResponseWriter, r *http.Request) {
+	topic, err := topicFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, err := topics.FormatFromContentType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	reader, err := topics.NewReader(r.Body, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var imported, failed int
+	var lineErrors []*topics.LineError
+	reject := func(lineErr *topics.LineError) {
+		failed++
+		if len(lineErrors) < maxImportErrors {
+			lineErrors = append(lineErrors, lineErr)
+		}
+	}
+
+	batch := make([]topics.Subscriber, 0, importBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.topicStore.SubscribeMany(r.Context(), topic, batch); err != nil {
+			return err
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		sub, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		var lineErr *topics.LineError
+		if errors.As(err, &lineErr) {
+			reject(lineErr)
+			continue
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading import after %d subscriptions: %v", imported, err), http.StatusBadRequest)
+			return
+		}
+
+		if sub, err = s.resolveSubscriber(r.Context(), sub); err != nil {
+			reject(&topics.LineError{Line: reader.Line(), Err: err.Error()})
+			continue
+		}
+
+		batch = append(batch, sub)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				http.Error(w, fmt.Sprintf("Error importing after %d subscriptions: %v", imported, err), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		http.Error(w, fmt.Sprintf("Error importing after %d subscriptions: %v", imported, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"topic":    topic,
+		"imported": imported,
+		"failed":   failed,
+		"errors":   lineErrors,
+	})
+}
+
+// userTopicsHandler lists the topics a user is subscribed to
+func (s *Service) userTopicsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+
+	userTopics, err := s.topicStore.UserTopics(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting topics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"topics":  userTopics,
+	})
+}
+
+// listDevicesHandler returns the devices registered for a user
+func (s *Service) listDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+
+	devices, err := s.deviceStore.UserDevices(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting devices: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"devices": devices,
+	})
+}
+
+// registerDeviceHandler registers or updates a device of a user
+func (s *Service) registerDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	var device pkg.Device
+	if err := json.NewDecoder(r.Body).Decode(&device); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	if device.ID == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	device.UserID = mux.Vars(r)["userID"]
+
+	if err := s.deviceStore.Register(r.Context(), &device); err != nil {
+		http.Error(w, fmt.Sprintf("Error registering device: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(device)
+}
+
+// unregisterDeviceHandler removes a device and its topic subscriptions
+func (s *Service) unregisterDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	device, err := s.deviceStore.Get(r.Context(), vars["deviceID"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting device: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if device == nil || device.UserID != vars["userID"] {
+		http.Error(w, "device not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.deviceStore.Unregister(r.Context(), device.ID); err != nil {
+		http.Error(w, fmt.Sprintf("Error unregistering device: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// registerWebPushRoutes adds the Web Push key and subscription endpoints
+func (s *Service) registerWebPushRoutes(router *mux.Router) {
+	router.HandleFunc("/webpush/vapid-public-key", s.vapidPublicKeyHandler).Methods("GET")
+	router.HandleFunc("/webpush/subscriptions/{userID}", s.listSubscriptionsHandler).Methods("GET")
+	router.HandleFunc("/webpush/subscriptions/{userID}", s.addSubscriptionHandler).Methods("POST")
+	router.HandleFunc("/webpush/subscriptions/{userID}", s.removeSubscriptionHandler).Methods("DELETE")
+}
+
+// vapidPublicKeyHandler returns the applicationServerKey browsers subscribe with
+func (s *Service) vapidPublicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if s.vapidKeys == nil {
+		http.Error(w, "Web Push is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"public_key": s.vapidKeys.PublicKey()})
+}
+
+// listSubscriptionsHandler returns the Web Push subscriptions of a user
+func (s *Service) listSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+
+	subscriptions, err := s.subscriptionStore.Subscriptions(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting subscriptions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":       userID,
+		"subscriptions": subscriptions,
+	})
+}
+
+// addSubscriptionHandler stores a PushSubscription sent by the browser
+func (s *Service) addSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+
+	var sub pkg.PushSubscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if u, err := url.Parse(sub.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+		http.Error(w, "endpoint must be an https URL", http.StatusBadRequest)
+		return
+	}
+	if sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+		http.Error(w, "keys.p256dh and keys.auth are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.subscriptionStore.AddSubscription(r.Context(), userID, sub); err != nil {
+		http.Error(w, fmt.Sprintf("Error storing subscription: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// removeSubscriptionHandler deletes a subscription identified by its endpoint
+func (s *Service) removeSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+
+	var req struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Endpoint == "" {
+		http.Error(w, "endpoint is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.subscriptionStore.RemoveSubscription(r.Context(), userID, req.Endpoint); err != nil {
+		http.Error(w, fmt.Sprintf("Error removing subscription: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
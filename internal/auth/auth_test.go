@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is an in-memory Store
+type memoryStore struct {
+	mu   sync.Mutex
+	keys map[string]APIKey
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{keys: make(map[string]APIKey)}
+}
+
+func (m *memoryStore) Save(ctx context.Context, key *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[key.ID] = *key
+	return nil
+}
+
+func (m *memoryStore) Get(ctx context.Context, id string) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &key, nil
+}
+
+func (m *memoryStore) GetByHash(ctx context.Context, hash string) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range m.keys {
+		if key.Hash == hash {
+			return &key, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryStore) List(ctx context.Context, tenant string) ([]*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []*APIKey
+	for _, key := range m.keys {
+		if key.Tenant == tenant {
+			key := key
+			keys = append(keys, &key)
+		}
+	}
+	return keys, nil
+}
+
+// memoryAudit collects recorded audit entries
+type memoryAudit struct {
+	mu      sync.Mutex
+	entries []*AuditEntry
+}
+
+func (m *memoryAudit) Record(ctx context.Context, entry *AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func TestCreateAndAuthenticate(t *testing.T) {
+	authn := NewAuthenticator(newMemoryStore())
+	ctx := context.Background()
+
+	plaintext, key, err := authn.Create(ctx, "backend", "acme", []Scope{ScopeSend})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if key.Hash == "" || key.Hash == plaintext {
+		t.Errorf("Expected only a hash of the key to be stored")
+	}
+
+	got, err := authn.Authenticate(ctx, plaintext)
+	if err != nil {
+		t.Fatalf("Expected key to authenticate, got %v", err)
+	}
+	if got.ID != key.ID || got.Tenant != "acme" {
+		t.Errorf("Unexpected key %+v", got)
+	}
+	if !got.HasScope(ScopeSend) || got.HasScope(ScopeAdmin) || got.HasScope(ScopeReadStatus) {
+		t.Errorf("Unexpected scopes %v", got.Scopes)
+	}
+
+	if _, err := authn.Authenticate(ctx, plaintext+"x"); err != ErrInvalidKey {
+		t.Errorf("Expected ErrInvalidKey for a wrong key, got %v", err)
+	}
+	if _, _, err := authn.Create(ctx, "bad", "acme", []Scope{"superuser"}); err == nil {
+		t.Errorf("Expected error for unknown scope")
+	}
+	if _, _, err := authn.Create(ctx, "bad", "", []Scope{ScopeSend}); err == nil {
+		t.Errorf("Expected error for missing tenant")
+	}
+}
+
+func TestRotateAndRevoke(t *testing.T) {
+	authn := NewAuthenticator(newMemoryStore())
+	ctx := context.Background()
+
+	oldKey, old, _ := authn.Create(ctx, "backend", "acme", []Scope{ScopeSend})
+	newKey, rotated, err := authn.Rotate(ctx, old.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rotated.RotatedFrom != old.ID {
+		t.Errorf("Expected rotated key to reference %s, got %q", old.ID, rotated.RotatedFrom)
+	}
+
+	// Both keys work during the grace period
+	if _, err := authn.Authenticate(ctx, oldKey); err != nil {
+		t.Errorf("Expected old key to work during the grace period, got %v", err)
+	}
+	if _, err := authn.Authenticate(ctx, newKey); err != nil {
+		t.Errorf("Expected new key to work, got %v", err)
+	}
+
+	// Without a grace period the old key stops working immediately
+	_, _, err = authn.Rotate(ctx, rotated.ID, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := authn.Authenticate(ctx, newKey); err != ErrInvalidKey {
+		t.Errorf("Expected rotated key without grace to be rejected, got %v", err)
+	}
+
+	if _, err := authn.Revoke(ctx, old.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := authn.Authenticate(ctx, oldKey); err != ErrInvalidKey {
+		t.Errorf("Expected revoked key to be rejected, got %v", err)
+	}
+	if _, err := authn.Revoke(ctx, "unknown"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestBootstrapKey(t *testing.T) {
+	authn := NewAuthenticator(newMemoryStore())
+	authn.SetBootstrapKey("let-me-in")
+
+	key, err := authn.Authenticate(context.Background(), "let-me-in")
+	if err != nil {
+		t.Fatalf("Expected bootstrap key to authenticate, got %v", err)
+	}
+	if !key.HasScope(ScopeSend) || !key.CanAccessTenant("acme") {
+		t.Errorf("Expected bootstrap key to be an admin of every tenant, got %+v", key)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	authn := NewAuthenticator(newMemoryStore())
+	audit := &memoryAudit{}
+	ctx := context.Background()
+	sendKey, _, _ := authn.Create(ctx, "sender", "acme", []Scope{ScopeSend})
+	readKey, _, _ := authn.Create(ctx, "reader", "acme", []Scope{ScopeReadStatus})
+
+	scopes := func(r *http.Request) Scope {
+		switch r.URL.Path {
+		case "/health":
+			return ""
+		case "/send":
+			return ScopeSend
+		default:
+			return ScopeReadStatus
+		}
+	}
+	handler := Middleware(authn, scopes, audit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Annotate(r.Context(), "notification_id", "n-1")
+		if KeyFromContext(r.Context()) == nil && r.URL.Path != "/health" {
+			t.Errorf("Expected key in request context")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		value  string
+		status int
+	}{
+		{"public", "GET", "/health", "", "", http.StatusCreated},
+		{"missing key", "POST", "/send", "", "", http.StatusUnauthorized},
+		{"wrong key", "POST", "/send", "X-API-Key", "pk_nope", http.StatusUnauthorized},
+		{"missing scope", "POST", "/send", "Authorization", "Bearer " + readKey, http.StatusForbidden},
+		{"bearer", "POST", "/send", "Authorization", "Bearer " + sendKey, http.StatusCreated},
+		{"header", "GET", "/metrics", "X-API-Key", readKey, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+
+	// Only the authenticated send is audited; reads are not
+	if len(audit.entries) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(audit.entries))
+	}
+	entry := audit.entries[0]
+	if entry.Tenant != "acme" || entry.Path != "/send" || entry.Status != http.StatusCreated || entry.Details["notification_id"] != "n-1" {
+		t.Errorf("Unexpected audit entry %+v", entry)
+	}
+}
+
+func TestMiddlewareStreams(t *testing.T) {
+	authn := NewAuthenticator(newMemoryStore())
+	readKey, _, _ := authn.Create(context.Background(), "reader", "acme", []Scope{ScopeReadStatus})
+
+	scopes := func(r *http.Request) Scope { return ScopeReadStatus }
+	handler := Middleware(authn, scopes, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		if r.URL.Path == "/hijack" {
+			conn, _, err := rc.Hijack()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer conn.Close()
+			conn.Write([]byte("HTTP/1.1 204 No Content\r\nConnection: close\r\n\r\n"))
+			return
+		}
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, ok := w.(http.Hijacker); !ok {
+			http.Error(w, "no hijacker", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		if err := rc.Flush(); err != nil {
+			t.Errorf("Expected flushing through the middleware, got %v", err)
+		}
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for path, status := range map[string]int{"/stream": http.StatusAccepted, "/hijack": http.StatusNoContent} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.Header.Set("X-API-Key", readKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("%s: expected status %d, got %d", path, status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Scope is a permission granted to an API key
+type Scope string
+
+const (
+	ScopeSend       Scope = "send"
+	ScopeReadStatus Scope = "read-status"
+	// ScopeAdmin grants every other scope as well as key management
+	ScopeAdmin Scope = "admin"
+)
+
+// IsValid reports whether the scope is one of the known scopes
+func (s Scope) IsValid() bool {
+	switch s {
+	case ScopeSend, ScopeReadStatus, ScopeAdmin:
+		return true
+	default:
+		return false
+	}
+}
+
+// SystemTenant marks keys that may act on every tenant, such as the
+// bootstrap key
+const SystemTenant = "*"
+
+// keyPrefix starts every API key so leaked keys are easy to recognise
+const keyPrefix = "pk"
+
+var (
+	// ErrInvalidKey is returned for unknown, malformed, revoked or expired keys
+	ErrInvalidKey = errors.New("invalid api key")
+	// ErrNotFound is returned for unknown key IDs
+	ErrNotFound = errors.New("api key not found")
+)
+
+// APIKey is the stored metadata of an API key. Only a SHA-256 hash of the
+// secret is stored; the plaintext key is shown once on creation.
+type APIKey struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Tenant      string     `json:"tenant"`
+	Scopes      []Scope    `json:"scopes"`
+	Hash        string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Revoked     bool       `json:"revoked"`
+	RotatedFrom string     `json:"rotated_from,omitempty"`
+	RotatedTo   string     `json:"rotated_to,omitempty"`
+}
+
+// HasScope reports whether the key grants the scope; admin grants all
+func (k *APIKey) HasScope(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessTenant reports whether the key may act on the tenant
+func (k *APIKey) CanAccessTenant(tenant string) bool {
+	return k.Tenant == SystemTenant || k.Tenant == tenant
+}
+
+// Active reports whether the key can be used at the given time
+func (k *APIKey) Active(now time.Time) bool {
+	return !k.Revoked && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Store persists API keys, indexed by ID, secret hash and tenant
+type Store interface {
+	Save(ctx context.Context, key *APIKey) error
+	Get(ctx context.Context, id string) (*APIKey, error)
+	GetByHash(ctx context.Context, hash string) (*APIKey, error)
+	List(ctx context.Context, tenant string) ([]*APIKey, error)
+}
+
+// HashKey returns the hex encoded SHA-256 hash a key is stored under
+func HashKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate creates a new key of the form pk_<id>_<secret> and its metadata
+func Generate(name, tenant string, scopes []Scope) (string, *APIKey, error) {
+	if tenant == "" {
+		return "", nil, fmt.Errorf("tenant is required")
+	}
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !scope.IsValid() {
+			return "", nil, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, fmt.Errorf("failed to generate key id: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("failed to generate key secret: %w", err)
+	}
+
+	key := &APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Tenant:    tenant,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	plaintext := fmt.Sprintf("%s_%s_%s", keyPrefix, key.ID, base64.RawURLEncoding.EncodeToString(secret))
+	key.Hash = HashKey(plaintext)
+
+	return plaintext, key, nil
+}
+
+// Authenticator verifies API keys and manages their lifecycle
+type Authenticator struct {
+	store Store
+
+	// bootstrapHash identifies an in-memory system admin key from
+	// configuration, used to create the first stored keys
+	bootstrapHash string
+}
+
+// NewAuthenticator creates a new authenticator backed by the store
+func NewAuthenticator(store Store) *Authenticator {
+	return &Authenticator{store: store}
+}
+
+// SetBootstrapKey accepts plaintext as a system admin key without storing it
+func (a *Authenticator) SetBootstrapKey(plaintext string) {
+	if plaintext == "" {
+		a.bootstrapHash = ""
+		return
+	}
+	a.bootstrapHash = HashKey(plaintext)
+}
+
+// Authenticate returns the active key matching plaintext
+func (a *Authenticator) Authenticate(ctx context.Context, plaintext string) (*APIKey, error) {
+	if plaintext == "" {
+		return nil, ErrInvalidKey
+	}
+	hash := HashKey(plaintext)
+
+	if a.bootstrapHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(a.bootstrapHash)) == 1 {
+		return &APIKey{
+			ID:     "bootstrap",
+			Name:   "bootstrap",
+			Tenant: SystemTenant,
+			Scopes: []Scope{ScopeAdmin},
+		}, nil
+	}
+
+	key, err := a.store.GetByHash(ctx, hash)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("api key lookup failed: %w", err)
+	}
+	if !key.Active(time.Now()) {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// Create generates and stores a new key, returning its plaintext once
+func (a *Authenticator) Create(ctx context.Context, name, tenant string, scopes []Scope) (string, *APIKey, error) {
+	plaintext, key, err := Generate(name, tenant, scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := a.store.Save(ctx, key); err != nil {
+		return "", nil, fmt.Errorf("failed to store api key: %w", err)
+	}
+	return plaintext, key, nil
+}
+
+// Rotate replaces a key with a new one of the same name, tenant and scopes.
+// The old key keeps working for the grace period so clients can switch over.
+func (a *Authenticator) Rotate(ctx context.Context, id string, grace time.Duration) (string, *APIKey, error) {
+	old, err := a.store.Get(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if !old.Active(time.Now()) {
+		return "", nil, fmt.Errorf("api key %s is no longer active", id)
+	}
+
+	plaintext, key, err := Generate(old.Name, old.Tenant, old.Scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	key.RotatedFrom = old.ID
+	if err := a.store.Save(ctx, key); err != nil {
+		return "", nil, fmt.Errorf("failed to store api key: %w", err)
+	}
+
+	expiresAt := time.Now().UTC().Add(grace)
+	if old.ExpiresAt == nil || expiresAt.Before(*old.ExpiresAt) {
+		old.ExpiresAt = &expiresAt
+	}
+	old.RotatedTo = key.ID
+	if err := a.store.Save(ctx, old); err != nil {
+		return "", nil, fmt.Errorf("failed to expire rotated api key: %w", err)
+	}
+
+	return plaintext, key, nil
+}
+
+// Revoke disables a key immediately
+func (a *Authenticator) Revoke(ctx context.Context, id string) (*APIKey, error) {
+	key, err := a.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	key.Revoked = true
+	if err := a.store.Save(ctx, key); err != nil {
+		return nil, fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	return key, nil
+}
+
+// Get returns the metadata of a key
+func (a *Authenticator) Get(ctx context.Context, id string) (*APIKey, error) {
+	return a.store.Get(ctx, id)
+}
+
+// List returns the keys of a tenant
+func (a *Authenticator) List(ctx context.Context, tenant string) ([]*APIKey, error) {
+	return a.store.List(ctx, tenant)
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// contextKey is the type of the request context keys set by the middleware
+type contextKey int
+
+const (
+	keyContextKey contextKey = iota
+	auditContextKey
+)
+
+// AuditEntry records which key made a request and what it affected
+type AuditEntry struct {
+	KeyID   string            `json:"key_id"`
+	Tenant  string            `json:"tenant"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Status  int               `json:"status"`
+	Details map[string]string `json:"details,omitempty"`
+	Time    time.Time         `json:"time"`
+
+	mu sync.Mutex
+}
+
+// AuditLog persists audit entries
+type AuditLog interface {
+	Record(ctx context.Context, entry *AuditEntry) error
+}
+
+// ScopeFunc returns the scope a request needs, or "" for public endpoints
+type ScopeFunc func(r *http.Request) Scope
+
+// KeyFromContext returns the API key that authenticated the request
+func KeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(keyContextKey).(*APIKey)
+	return key
+}
+
+// WithKey returns a context carrying the authenticated key
+func WithKey(ctx context.Context, key *APIKey) context.Context {
+	return context.WithValue(ctx, keyContextKey, key)
+}
+
+// ResolveTenant returns the tenant a request with the key acts on: the key's
+// own, or the requested one for system keys and without a key. It returns
+// "" if nothing was requested and the key does not fix the tenant.
+func ResolveTenant(key *APIKey, requested string) (string, error) {
+	if key == nil || key.Tenant == SystemTenant {
+		return requested, nil
+	}
+	if requested != "" && requested != key.Tenant {
+		return "", fmt.Errorf("api key cannot act on tenant %s", requested)
+	}
+	return key.Tenant, nil
+}
+
+// NewAuditEntry starts the audit entry of a request made with the key
+func NewAuditEntry(key *APIKey, method, path string) *AuditEntry {
+	return &AuditEntry{
+		KeyID:  key.ID,
+		Tenant: key.Tenant,
+		Method: method,
+		Path:   path,
+		Time:   time.Now().UTC(),
+	}
+}
+
+// WithAuditEntry returns a context whose Annotate calls add to entry
+func WithAuditEntry(ctx context.Context, entry *AuditEntry) context.Context {
+	return context.WithValue(ctx, auditContextKey, entry)
+}
+
+// Annotate adds a detail such as a notification ID to the audit entry of
+// the request; it is a no-op for unauthenticated requests
+func Annotate(ctx context.Context, name, value string) {
+	entry, ok := ctx.Value(auditContextKey).(*AuditEntry)
+	if !ok {
+		return
+	}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.Details == nil {
+		entry.Details = make(map[string]string)
+	}
+	entry.Details[name] = value
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the flushing, deadlines and
+// hijacking of the wrapped writer, which streams need
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Hijack hands over the connection of the wrapped writer for upgrades to
+// WebSocket, which look for an http.Hijacker rather than unwrapping
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(sr.ResponseWriter).Hijack()
+}
+
+// Middleware authenticates requests with an API key from the Authorization
+// bearer token or the X-API-Key header, enforces the scope required by the
+// route and records an audit entry for every authenticated change; reads
+// are not audited
+func Middleware(authn *Authenticator, required ScopeFunc, audit AuditLog) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := required(r)
+			if scope == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, err := authn.Authenticate(r.Context(), credentials(r))
+			if errors.Is(err, ErrInvalidKey) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="notification-service"`)
+				http.Error(w, "invalid or missing api key", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !key.HasScope(scope) {
+				http.Error(w, "api key lacks scope "+string(scope), http.StatusForbidden)
+				return
+			}
+
+			entry := NewAuditEntry(key, r.Method, r.URL.Path)
+			ctx := WithAuditEntry(WithKey(r.Context(), key), entry)
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+
+			entry.Status = recorder.status
+			if audit != nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				if err := audit.Record(context.Background(), entry); err != nil {
+					log.Printf("Failed to record audit entry for key %s: %v", key.ID, err)
+				}
+			}
+		})
+	}
+}
+
+// credentials extracts the API key from the request
+func credentials(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
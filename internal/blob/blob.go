@@ -0,0 +1,17 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned for blobs that do not exist or have expired
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps payloads too large to travel inline, such as offloaded Kafka
+// message values, for a limited time
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, ttl time.Duration) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
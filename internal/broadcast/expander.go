@@ -0,0 +1,324 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// DataKeyBroadcastID is added to the data of every fanned-out message
+const DataKeyBroadcastID = "broadcast_id"
+
+// Audience resolves the users targeted by a broadcast. Scan pages through
+// the audience with an opaque cursor; a returned cursor of 0 ends the scan.
+type Audience interface {
+	Size(ctx context.Context, b *pkg.BroadcastMessage) (int64, error)
+	Scan(ctx context.Context, b *pkg.BroadcastMessage, cursor uint64, count int64) ([]string, uint64, error)
+}
+
+// Publisher re-publishes fanned-out messages, typically to Kafka
+type Publisher interface {
+	SendBatch(notifications []*pkg.NotificationMessage) error
+}
+
+// ProgressStore persists broadcast progress and cancellation requests so they
+// are visible to every instance
+type ProgressStore interface {
+	Save(ctx context.Context, progress *pkg.BroadcastProgress) error
+	Get(ctx context.Context, id string) (*pkg.BroadcastProgress, error)
+	AddEnqueued(ctx context.Context, id string, n int64) error
+	RequestCancel(ctx context.Context, id string) error
+	CancelRequested(ctx context.Context, id string) (bool, error)
+}
+
+// ErrNotFound is returned for unknown broadcasts
+var ErrNotFound = errors.New("broadcast not found")
+
+// Expander fans broadcasts out into per-user messages. Chunks are published
+// by a bounded number of goroutines and paced so a large broadcast is
+// interleaved with regular traffic instead of flooding the topic.
+type Expander struct {
+	audience  Audience
+	publisher Publisher
+	progress  ProgressStore
+
+	chunkSize     int
+	concurrency   int
+	chunkInterval time.Duration
+
+	running map[string]context.CancelFunc // keyed by tenant and broadcast ID
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+}
+
+// NewExpander creates a new broadcast expander. concurrency bounds the chunks
+// in flight per broadcast and chunkInterval is the minimum delay between
+// chunks handed to the publishers.
+func NewExpander(audience Audience, publisher Publisher, progress ProgressStore, chunkSize, concurrency int, chunkInterval time.Duration) *Expander {
+	if chunkSize <= 0 {
+		chunkSize = 500
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &Expander{
+		audience:      audience,
+		publisher:     publisher,
+		progress:      progress,
+		chunkSize:     chunkSize,
+		concurrency:   concurrency,
+		chunkInterval: chunkInterval,
+		running:       make(map[string]context.CancelFunc),
+	}
+}
+
+// Start validates the broadcast and begins fanning it out in the background
+func (e *Expander) Start(ctx context.Context, b *pkg.BroadcastMessage) (*pkg.BroadcastProgress, error) {
+	if b.ID == "" {
+		return nil, fmt.Errorf("broadcast id is required")
+	}
+	if b.Topic == "" && len(b.Segment) == 0 {
+		return nil, fmt.Errorf("broadcast %s needs a topic or a segment", b.ID)
+	}
+
+	if existing, err := e.progress.Get(ctx, b.ID); err == nil && existing != nil {
+		return nil, fmt.Errorf("broadcast %s already exists", b.ID)
+	}
+
+	total, err := e.audience.Size(ctx, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to size audience: %w", err)
+	}
+
+	progress := &pkg.BroadcastProgress{
+		ID:        b.ID,
+		State:     pkg.BroadcastRunning,
+		Total:     total,
+		StartedAt: time.Now().UTC(),
+	}
+	if err := e.progress.Save(ctx, progress); err != nil {
+		return nil, fmt.Errorf("failed to save progress: %w", err)
+	}
+
+	// The fan-out outlives the request but keeps its values, such as the tenant
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	key := tenant.ContextKey(ctx, b.ID)
+	e.mu.Lock()
+	e.running[key] = cancel
+	e.mu.Unlock()
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer cancel()
+		e.run(runCtx, b, progress)
+
+		e.mu.Lock()
+		delete(e.running, key)
+		e.mu.Unlock()
+	}()
+
+	return progress, nil
+}
+
+// Cancel stops a broadcast on whichever instance is fanning it out
+func (e *Expander) Cancel(ctx context.Context, id string) error {
+	progress, err := e.progress.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if progress == nil {
+		return ErrNotFound
+	}
+
+	if err := e.progress.RequestCancel(ctx, id); err != nil {
+		return fmt.Errorf("failed to request cancellation: %w", err)
+	}
+
+	e.mu.Lock()
+	if cancel, ok := e.running[tenant.ContextKey(ctx, id)]; ok {
+		cancel()
+	}
+	e.mu.Unlock()
+
+	return nil
+}
+
+// Progress returns the progress of a broadcast
+func (e *Expander) Progress(ctx context.Context, id string) (*pkg.BroadcastProgress, error) {
+	progress, err := e.progress.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if progress == nil {
+		return nil, ErrNotFound
+	}
+	return progress, nil
+}
+
+// Stop cancels all local fan-outs and waits for them to finish
+func (e *Expander) Stop() {
+	e.mu.Lock()
+	for _, cancel := range e.running {
+		cancel()
+	}
+	e.mu.Unlock()
+	e.wg.Wait()
+}
+
+// run scans the audience and publishes chunks until done, cancelled or failed
+func (e *Expander) run(ctx context.Context, b *pkg.BroadcastMessage, progress *pkg.BroadcastProgress) {
+	chunks := make(chan []string)
+	var publishErr error
+	var errOnce sync.Once
+	fail := func(err error) {
+		errOnce.Do(func() { publishErr = err })
+	}
+
+	// Bounded set of publishers
+	publishCtx, stopPublishing := context.WithCancel(ctx)
+	defer stopPublishing()
+
+	var publishers sync.WaitGroup
+	for i := 0; i < e.concurrency; i++ {
+		publishers.Add(1)
+		go func() {
+			defer publishers.Done()
+			for chunk := range chunks {
+				if publishCtx.Err() != nil {
+					continue // Drain without publishing once stopped
+				}
+				if err := e.publish(publishCtx, b, chunk); err != nil {
+					fail(err)
+					stopPublishing()
+				}
+			}
+		}()
+	}
+
+	scanErr := e.scan(publishCtx, b, chunks)
+	close(chunks)
+	publishers.Wait()
+
+	// Determine the final state; a cancellation requested elsewhere shows up
+	// as a cancelled publish context as well
+	bg := context.WithoutCancel(ctx)
+	cancelled, _ := e.progress.CancelRequested(bg, b.ID)
+	final, err := e.progress.Get(bg, b.ID)
+	if err != nil || final == nil {
+		final = progress
+	}
+
+	now := time.Now().UTC()
+	final.FinishedAt = &now
+	switch {
+	case cancelled || (ctx.Err() != nil && publishErr == nil):
+		final.State = pkg.BroadcastCancelled
+	case publishErr != nil:
+		final.State = pkg.BroadcastFailed
+		final.Error = publishErr.Error()
+	case scanErr != nil && !errors.Is(scanErr, context.Canceled):
+		final.State = pkg.BroadcastFailed
+		final.Error = scanErr.Error()
+	default:
+		final.State = pkg.BroadcastCompleted
+	}
+
+	if err := e.progress.Save(bg, final); err != nil {
+		log.Printf("Failed to save final progress for broadcast %s: %v", b.ID, err)
+	}
+	log.Printf("Broadcast %s %s: %d/%d messages enqueued", b.ID, final.State, final.Enqueued, final.Total)
+}
+
+// scan pages through the audience, pacing chunks and honouring cancellation
+func (e *Expander) scan(ctx context.Context, b *pkg.BroadcastMessage, chunks chan<- []string) error {
+	var cursor uint64
+	var pending []string
+	var last time.Time
+
+	emit := func(chunk []string) error {
+		if wait := e.chunkInterval - time.Since(last); !last.IsZero() && wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		last = time.Now()
+
+		if cancelled, err := e.progress.CancelRequested(ctx, b.ID); err == nil && cancelled {
+			return context.Canceled
+		}
+
+		select {
+		case chunks <- chunk:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for {
+		users, next, err := e.audience.Scan(ctx, b, cursor, int64(e.chunkSize))
+		if err != nil {
+			return fmt.Errorf("audience scan failed: %w", err)
+		}
+
+		pending = append(pending, users...)
+		for len(pending) >= e.chunkSize {
+			if err := emit(pending[:e.chunkSize]); err != nil {
+				return err
+			}
+			pending = append([]string(nil), pending[e.chunkSize:]...)
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if len(pending) > 0 {
+		return emit(pending)
+	}
+	return nil
+}
+
+// publish builds and publishes the per-user messages of a chunk
+func (e *Expander) publish(ctx context.Context, b *pkg.BroadcastMessage, userIDs []string) error {
+	messages := make([]*pkg.NotificationMessage, 0, len(userIDs))
+	for _, userID := range userIDs {
+		messages = append(messages, Expand(b, userID))
+	}
+
+	if err := e.publisher.SendBatch(messages); err != nil {
+		return fmt.Errorf("failed to publish chunk: %w", err)
+	}
+	return e.progress.AddEnqueued(ctx, b.ID, int64(len(messages)))
+}
+
+// Expand builds the per-user message of a broadcast
+func Expand(b *pkg.BroadcastMessage, userID string) *pkg.NotificationMessage {
+	msg := b.Notification
+	msg.ID = fmt.Sprintf("%s:%s", b.ID, userID)
+	msg.UserID = userID
+	msg.Retry = 0
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = b.CreatedAt
+	}
+
+	msg.Data = make(map[string]interface{}, len(b.Notification.Data)+1)
+	for k, v := range b.Notification.Data {
+		msg.Data[k] = v
+	}
+	msg.Data[DataKeyBroadcastID] = b.ID
+
+	return &msg
+}
@@ -0,0 +1,246 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// sliceAudience serves a fixed list of users, pageSize at a time
+type sliceAudience struct {
+	users    []string
+	pageSize int
+}
+
+func (a *sliceAudience) Size(ctx context.Context, b *pkg.BroadcastMessage) (int64, error) {
+	return int64(len(a.users)), nil
+}
+
+func (a *sliceAudience) Scan(ctx context.Context, b *pkg.BroadcastMessage, cursor uint64, count int64) ([]string, uint64, error) {
+	start := int(cursor)
+	end := start + a.pageSize
+	if end >= len(a.users) {
+		return a.users[start:], 0, nil
+	}
+	return a.users[start:end], uint64(end), nil
+}
+
+// recordingPublisher collects published messages and can block until released
+type recordingPublisher struct {
+	mu       sync.Mutex
+	messages []*pkg.NotificationMessage
+	batches  int
+	gate     chan struct{}
+}
+
+func (p *recordingPublisher) SendBatch(notifications []*pkg.NotificationMessage) error {
+	if p.gate != nil {
+		<-p.gate
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, notifications...)
+	p.batches++
+	return nil
+}
+
+// memoryProgress is an in-memory ProgressStore, scoped by tenant like the
+// Redis store
+type memoryProgress struct {
+	mu        sync.Mutex
+	progress  map[string]pkg.BroadcastProgress
+	cancelled map[string]bool
+}
+
+func newMemoryProgress() *memoryProgress {
+	return &memoryProgress{progress: make(map[string]pkg.BroadcastProgress), cancelled: make(map[string]bool)}
+}
+
+func (m *memoryProgress) Save(ctx context.Context, progress *pkg.BroadcastProgress) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := tenant.ContextKey(ctx, progress.ID)
+	current := m.progress[key]
+	saved := *progress
+	saved.Enqueued = current.Enqueued
+	m.progress[key] = saved
+	return nil
+}
+
+func (m *memoryProgress) Get(ctx context.Context, id string) (*pkg.BroadcastProgress, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.progress[tenant.ContextKey(ctx, id)]
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+func (m *memoryProgress) AddEnqueued(ctx context.Context, id string, n int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := tenant.ContextKey(ctx, id)
+	p := m.progress[key]
+	p.Enqueued += n
+	m.progress[key] = p
+	return nil
+}
+
+func (m *memoryProgress) RequestCancel(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cancelled[tenant.ContextKey(ctx, id)] = true
+	return nil
+}
+
+func (m *memoryProgress) CancelRequested(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cancelled[tenant.ContextKey(ctx, id)], nil
+}
+
+func waitForState(t *testing.T, ctx context.Context, store *memoryProgress, id string, state pkg.BroadcastState) *pkg.BroadcastProgress {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if p, _ := store.Get(ctx, id); p != nil && p.State == state {
+			return p
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	p, _ := store.Get(ctx, id)
+	t.Fatalf("Broadcast %s did not reach state %s, last progress %+v", id, state, p)
+	return nil
+}
+
+func users(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("user-%03d", i)
+	}
+	return ids
+}
+
+func TestExpanderFansOutInChunks(t *testing.T) {
+	audience := &sliceAudience{users: users(250), pageSize: 70}
+	publisher := &recordingPublisher{}
+	store := newMemoryProgress()
+	expander := NewExpander(audience, publisher, store, 100, 3, 0)
+
+	b := &pkg.BroadcastMessage{
+		ID:    "bcast-1",
+		Topic: "sports",
+		Notification: pkg.NotificationMessage{
+			Title: "Goal!",
+			Data:  map[string]interface{}{"match": "final"},
+		},
+	}
+
+	progress, err := expander.Start(context.Background(), b)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if progress.Total != 250 {
+		t.Errorf("Expected total 250, got %d", progress.Total)
+	}
+
+	final := waitForState(t, context.Background(), store, "bcast-1", pkg.BroadcastCompleted)
+	if final.Enqueued != 250 {
+		t.Errorf("Expected 250 enqueued, got %d", final.Enqueued)
+	}
+
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+	if publisher.batches != 3 {
+		t.Errorf("Expected 3 chunks of at most 100, got %d", publisher.batches)
+	}
+
+	seen := make(map[string]bool)
+	for _, msg := range publisher.messages {
+		if seen[msg.UserID] {
+			t.Errorf("User %s received the broadcast twice", msg.UserID)
+		}
+		seen[msg.UserID] = true
+		if msg.ID != "bcast-1:"+msg.UserID || msg.Title != "Goal!" || msg.Data[DataKeyBroadcastID] != "bcast-1" || msg.Data["match"] != "final" {
+			t.Errorf("Unexpected fanned-out message %+v", msg)
+		}
+	}
+	if len(seen) != 250 {
+		t.Errorf("Expected 250 distinct users, got %d", len(seen))
+	}
+
+	if _, err := expander.Start(context.Background(), b); err == nil {
+		t.Errorf("Expected duplicate broadcast to be rejected")
+	}
+}
+
+func TestExpanderCancel(t *testing.T) {
+	audience := &sliceAudience{users: users(1000), pageSize: 100}
+	publisher := &recordingPublisher{gate: make(chan struct{})}
+	store := newMemoryProgress()
+	expander := NewExpander(audience, publisher, store, 10, 1, 0)
+
+	if _, err := expander.Start(context.Background(), &pkg.BroadcastMessage{ID: "bcast-2", Topic: "news"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Let two chunks through, then cancel while the third is in flight
+	publisher.gate <- struct{}{}
+	publisher.gate <- struct{}{}
+	if err := expander.Cancel(context.Background(), "bcast-2"); err != nil {
+		t.Fatalf("Expected no error cancelling, got %v", err)
+	}
+	close(publisher.gate)
+
+	final := waitForState(t, context.Background(), store, "bcast-2", pkg.BroadcastCancelled)
+	if final.Enqueued >= 1000 {
+		t.Errorf("Expected cancellation to stop the fan-out early, got %d enqueued", final.Enqueued)
+	}
+
+	if err := expander.Cancel(context.Background(), "unknown"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for unknown broadcast, got %v", err)
+	}
+	expander.Stop()
+}
+
+func TestExpanderCancelIsScopedByTenant(t *testing.T) {
+	audience := &sliceAudience{users: users(30), pageSize: 10}
+	publisher := &recordingPublisher{gate: make(chan struct{})}
+	store := newMemoryProgress()
+	expander := NewExpander(audience, publisher, store, 10, 1, 0)
+
+	ctxA := tenant.WithID(context.Background(), "tenant-a")
+	ctxB := tenant.WithID(context.Background(), "tenant-b")
+	if _, err := expander.Start(ctxA, &pkg.BroadcastMessage{ID: "bcast-4", Topic: "news"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Tenant B owns a broadcast with the same ID, so its cancellation passes
+	// the progress lookup but must not reach tenant A's fan-out
+	if err := store.Save(ctxB, &pkg.BroadcastProgress{ID: "bcast-4", State: pkg.BroadcastRunning}); err != nil {
+		t.Fatalf("Expected no error saving progress, got %v", err)
+	}
+	if err := expander.Cancel(ctxB, "bcast-4"); err != nil {
+		t.Fatalf("Expected no error cancelling, got %v", err)
+	}
+	close(publisher.gate)
+
+	final := waitForState(t, ctxA, store, "bcast-4", pkg.BroadcastCompleted)
+	if final.Enqueued != 30 {
+		t.Errorf("Expected tenant A's broadcast to enqueue 30 messages, got %d", final.Enqueued)
+	}
+	expander.Stop()
+}
+
+func TestStartValidation(t *testing.T) {
+	expander := NewExpander(&sliceAudience{}, &recordingPublisher{}, newMemoryProgress(), 10, 1, 0)
+	if _, err := expander.Start(context.Background(), &pkg.BroadcastMessage{ID: "bcast-3"}); err == nil {
+		t.Errorf("Expected error for broadcast without topic or segment")
+	}
+}
@@ -0,0 +1,145 @@
+package channel
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/provider"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// Router dispatches notifications to channel-specific provider managers.
+// Tenants with their own provider credentials get their own managers, which
+// take precedence over the shared ones for their channels.
+type Router struct {
+	managers map[pkg.Channel]*provider.ProviderManager
+	tenants  map[string]map[pkg.Channel]*provider.ProviderManager
+	mu       sync.RWMutex
+}
+
+// NewRouter creates a new channel router with no registered channels
+func NewRouter() *Router {
+	return &Router{
+		managers: make(map[pkg.Channel]*provider.ProviderManager),
+		tenants:  make(map[string]map[pkg.Channel]*provider.ProviderManager),
+	}
+}
+
+// RegisterTenant assigns a provider manager to a channel for one tenant only
+func (r *Router) RegisterTenant(tenantID string, channel pkg.Channel, manager *provider.ProviderManager) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	managers, ok := r.tenants[tenantID]
+	if !ok {
+		managers = make(map[pkg.Channel]*provider.ProviderManager)
+		r.tenants[tenantID] = managers
+	}
+	managers[channel] = manager
+}
+
+// Register assigns a provider manager to a channel, replacing any previous one
+func (r *Router) Register(channel pkg.Channel, manager *provider.ProviderManager) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.managers[channel] = manager
+}
+
+// Manager returns the provider manager registered for a channel
+func (r *Router) Manager(channel pkg.Channel) (*provider.ProviderManager, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	manager, ok := r.managers[channel]
+	if !ok {
+		return nil, fmt.Errorf("no providers registered for channel %s", channel)
+	}
+	return manager, nil
+}
+
+// TenantManager returns the provider manager serving a channel for a
+// tenant, falling back to the shared one
+func (r *Router) TenantManager(tenantID string, channel pkg.Channel) (*provider.ProviderManager, error) {
+	r.mu.RLock()
+	manager, ok := r.tenants[tenantID][channel]
+	r.mu.RUnlock()
+	if ok {
+		return manager, nil
+	}
+	return r.Manager(channel)
+}
+
+// GetProvider selects a provider for the given channel and the tenant of ctx
+func (r *Router) GetProvider(ctx context.Context, channel pkg.Channel) (provider.Provider, error) {
+	manager, err := r.TenantManager(tenant.FromContext(ctx), channel)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := manager.GetProvider(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("channel %s: %w", channel, err)
+	}
+	return selected, nil
+}
+
+// GetProviderFor selects a provider for a notification on the given channel,
+// preferring providers that accept it such as a live connection gateway
+func (r *Router) GetProviderFor(ctx context.Context, channel pkg.Channel, notification *pkg.NotificationMessage) (provider.Provider, error) {
+	manager, err := r.TenantManager(tenant.FromContext(ctx), channel)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := manager.GetProviderFor(ctx, notification)
+	if err != nil {
+		return nil, fmt.Errorf("channel %s: %w", channel, err)
+	}
+	return selected, nil
+}
+
+// GetAlternative selects a provider for the given channel and the tenant of
+// ctx other than exclude
+func (r *Router) GetAlternative(ctx context.Context, channel pkg.Channel, exclude provider.Provider) (provider.Provider, error) {
+	manager, err := r.TenantManager(tenant.FromContext(ctx), channel)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := manager.Alternative(ctx, exclude)
+	if err != nil {
+		return nil, fmt.Errorf("channel %s: %w", channel, err)
+	}
+	return selected, nil
+}
+
+// Channels returns the registered channels in a stable order
+func (r *Router) Channels() []pkg.Channel {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	channels := make([]pkg.Channel, 0, len(r.managers))
+	for channel := range r.managers {
+		channels = append(channels, channel)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i] < channels[j] })
+	return channels
+}
+
+// HealthCheckAll performs health checks on every provider of every channel
+func (r *Router) HealthCheckAll(ctx context.Context) map[pkg.Channel]map[string]error {
+	results := make(map[pkg.Channel]map[string]error)
+
+	for _, channel := range r.Channels() {
+		manager, err := r.Manager(channel)
+		if err != nil {
+			continue
+		}
+		results[channel] = manager.HealthCheckAll(ctx)
+	}
+
+	return results
+}
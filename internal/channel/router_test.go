@@ -0,0 +1,77 @@
+package channel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/provider"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+func TestRouterDispatchesByChannel(t *testing.T) {
+	router := NewRouter()
+
+	push := provider.NewProviderManager(provider.Random)
+	push.AddProvider(provider.NewMockProvider("fcm", 1.0, time.Millisecond, 0))
+
+	email := provider.NewProviderManager(provider.Random)
+	email.AddProvider(provider.NewMockProvider("smtp", 1.0, time.Millisecond, 0))
+
+	router.Register(pkg.ChannelPush, push)
+	router.Register(pkg.ChannelEmail, email)
+
+	selected, err := router.GetProvider(context.Background(), pkg.ChannelEmail)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if selected.Name() != "smtp" {
+		t.Errorf("Expected smtp provider for email channel, got %s", selected.Name())
+	}
+
+	selected, err = router.GetProvider(context.Background(), pkg.ChannelPush)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if selected.Name() != "fcm" {
+		t.Errorf("Expected fcm provider for push channel, got %s", selected.Name())
+	}
+
+	if _, err := router.GetProvider(context.Background(), pkg.ChannelSMS); err == nil {
+		t.Errorf("Expected error for unregistered channel")
+	}
+
+	channels := router.Channels()
+	if len(channels) != 2 || channels[0] != pkg.ChannelEmail || channels[1] != pkg.ChannelPush {
+		t.Errorf("Expected channels [email push], got %v", channels)
+	}
+}
+
+func TestRouterTenantProviders(t *testing.T) {
+	router := NewRouter()
+
+	shared := provider.NewProviderManager(provider.Random)
+	shared.AddProvider(provider.NewMockProvider("smtp", 1.0, time.Millisecond, 0))
+	router.Register(pkg.ChannelEmail, shared)
+
+	acme := provider.NewProviderManager(provider.Random)
+	acme.AddProvider(provider.NewMockProvider("acme-smtp", 1.0, time.Millisecond, 0))
+	router.RegisterTenant("acme", pkg.ChannelEmail, acme)
+
+	selected, err := router.GetProvider(tenant.WithID(context.Background(), "acme"), pkg.ChannelEmail)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if selected.Name() != "acme-smtp" {
+		t.Errorf("Expected the tenant's own provider, got %s", selected.Name())
+	}
+
+	selected, err = router.GetProvider(tenant.WithID(context.Background(), "globex"), pkg.ChannelEmail)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if selected.Name() != "smtp" {
+		t.Errorf("Expected other tenants to use the shared provider, got %s", selected.Name())
+	}
+}
@@ -0,0 +1,784 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// NotificationSchema is the Avro schema notifications are written with.
+// Readers match fields by name, so messages written with older or newer
+// versions of it, or by other producers, decode as long as the names agree.
+// Nested data values are written as JSON strings.
+const NotificationSchema = `{
+  "type": "record",
+  "name": "NotificationMessage",
+  "namespace": "notification.v1",
+  "fields": [
+    {"name": "id", "type": "string"},
+    {"name": "tenant_id", "type": "string", "default": ""},
+    {"name": "user_id", "type": "string"},
+    {"name": "type", "type": "string", "default": ""},
+    {"name": "title", "type": "string", "default": ""},
+    {"name": "body", "type": "string", "default": ""},
+    {"name": "data", "type": ["null", {"type": "map", "values": ["null", "boolean", "long", "double", "string"]}], "default": null},
+    {"name": "priority", "type": "int", "default": 1},
+    {"name": "created_at", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "expires_at", "type": ["null", {"type": "long", "logicalType": "timestamp-millis"}], "default": null},
+    {"name": "retry", "type": "int", "default": 0},
+    {"name": "channels", "type": {"type": "array", "items": "string"}, "default": []},
+    {"name": "template_id", "type": "string", "default": ""},
+    {"name": "template_version", "type": "int", "default": 0},
+    {"name": "collapse_key", "type": "string", "default": ""},
+    {"name": "collapse_mode", "type": "string", "default": ""},
+    {"name": "badge", "type": ["null", "int"], "default": null}
+  ]
+}`
+
+// avroMagic starts every message in the Confluent wire format, followed by
+// the big-endian schema ID and the Avro binary encoding
+const avroMagic = 0
+
+// Avro encodes notifications in the Confluent wire format, registering
+// NotificationSchema under the "<topic>-value" subject and reading any
+// registered schema by ID
+type Avro struct {
+	registry *SchemaRegistry
+	writer   *avroSchema
+
+	mu      sync.Mutex
+	readers map[int]*avroSchema
+}
+
+// NewAvro creates an Avro codec backed by a schema registry
+func NewAvro(registry *SchemaRegistry) *Avro {
+	writer, err := parseAvroSchema(NotificationSchema)
+	if err != nil {
+		panic(fmt.Sprintf("invalid notification schema: %v", err))
+	}
+	return &Avro{
+		registry: registry,
+		writer:   writer,
+		readers:  make(map[int]*avroSchema),
+	}
+}
+
+// ContentType returns the Avro content type
+func (a *Avro) ContentType() string {
+	return ContentTypeAvro
+}
+
+// Encode writes the notification with NotificationSchema
+func (a *Avro) Encode(topic string, notification *pkg.NotificationMessage) ([]byte, error) {
+	id, err := a.registry.Register(topic+"-value", NotificationSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(avroMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(id))
+	if err := encodeAvro(&buf, a.writer, notificationToAvro(notification)); err != nil {
+		return nil, fmt.Errorf("failed to encode notification: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode reads a notification written with any registered schema
+func (a *Avro) Decode(topic string, data []byte) (*pkg.NotificationMessage, error) {
+	if len(data) < 5 || data[0] != avroMagic {
+		return nil, errors.New("not in the confluent avro wire format")
+	}
+	id := int(binary.BigEndian.Uint32(data[1:5]))
+
+	schema, err := a.reader(id)
+	if err != nil {
+		return nil, err
+	}
+	r := &avroReader{data: data[5:]}
+	value, err := decodeAvro(r, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode message with schema %d: %w", id, err)
+	}
+	record, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema %d is not a record", id)
+	}
+	return notificationFromAvro(record), nil
+}
+
+// reader returns the parsed schema with an ID
+func (a *Avro) reader(id int) (*avroSchema, error) {
+	a.mu.Lock()
+	schema, ok := a.readers[id]
+	a.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	text, err := a.registry.Schema(id)
+	if err != nil {
+		return nil, err
+	}
+	schema, err = parseAvroSchema(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %d: %w", id, err)
+	}
+
+	a.mu.Lock()
+	a.readers[id] = schema
+	a.mu.Unlock()
+	return schema, nil
+}
+
+// notificationToAvro converts a notification into a record of
+// NotificationSchema
+func notificationToAvro(n *pkg.NotificationMessage) map[string]interface{} {
+	channels := make([]interface{}, len(n.Channels))
+	for i, ch := range n.Channels {
+		channels[i] = string(ch)
+	}
+	record := map[string]interface{}{
+		"id":               n.ID,
+		"tenant_id":        n.TenantID,
+		"user_id":          n.UserID,
+		"type":             n.Type,
+		"title":            n.Title,
+		"body":             n.Body,
+		"data":             nil,
+		"priority":         int64(n.Priority),
+		"created_at":       n.CreatedAt,
+		"expires_at":       nil,
+		"retry":            int64(n.Retry),
+		"channels":         channels,
+		"template_id":      n.TemplateID,
+		"template_version": int64(n.TemplateVersion),
+		"collapse_key":     n.CollapseKey,
+		"collapse_mode":    string(n.CollapseMode),
+		"badge":            nil,
+	}
+	if n.Data != nil {
+		data := make(map[string]interface{}, len(n.Data))
+		for key, value := range n.Data {
+			data[key] = scalar(value)
+		}
+		record["data"] = data
+	}
+	if n.ExpiresAt != nil {
+		record["expires_at"] = *n.ExpiresAt
+	}
+	if n.Badge != nil {
+		record["badge"] = int64(*n.Badge)
+	}
+	return record
+}
+
+// scalar returns a data value as one the data map can hold, encoding
+// nested values as JSON
+func scalar(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string, float64, float32, int, int32, int64:
+		return v
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
+
+// notificationFromAvro converts a decoded record into a notification,
+// leaving fields the writer's schema lacks empty
+func notificationFromAvro(record map[string]interface{}) *pkg.NotificationMessage {
+	str := func(name string) string {
+		s, _ := record[name].(string)
+		return s
+	}
+	integer := func(name string) int {
+		i, _ := record[name].(int64)
+		return int(i)
+	}
+
+	n := &pkg.NotificationMessage{
+		ID:              str("id"),
+		TenantID:        str("tenant_id"),
+		UserID:          str("user_id"),
+		Type:            str("type"),
+		Title:           str("title"),
+		Body:            str("body"),
+		Priority:        pkg.Priority(integer("priority")),
+		Retry:           integer("retry"),
+		TemplateID:      str("template_id"),
+		TemplateVersion: integer("template_version"),
+		CollapseKey:     str("collapse_key"),
+		CollapseMode:    pkg.CollapseMode(str("collapse_mode")),
+	}
+	if _, ok := record["priority"]; !ok {
+		n.Priority = pkg.PriorityNormal
+	}
+	if createdAt, ok := avroTime(record["created_at"]); ok {
+		n.CreatedAt = createdAt
+	}
+	if expiresAt, ok := avroTime(record["expires_at"]); ok {
+		n.ExpiresAt = &expiresAt
+	}
+	if data, ok := record["data"].(map[string]interface{}); ok {
+		n.Data = data
+	}
+	if channels, ok := record["channels"].([]interface{}); ok {
+		for _, ch := range channels {
+			if s, ok := ch.(string); ok {
+				n.Channels = append(n.Channels, pkg.Channel(s))
+			}
+		}
+	}
+	if badge, ok := record["badge"].(int64); ok {
+		b := int(badge)
+		n.Badge = &b
+	}
+	return n
+}
+
+// avroTime reads a timestamp, taking plain longs as milliseconds
+func avroTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case int64:
+		return time.UnixMilli(v), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// avroSchema is a parsed Avro schema
+type avroSchema struct {
+	Type     string
+	Logical  string
+	Name     string
+	Fields   []avroField
+	Symbols  []string
+	Items    *avroSchema
+	Values   *avroSchema
+	Branches []*avroSchema
+	Size     int
+}
+
+type avroField struct {
+	Name string
+	Type *avroSchema
+}
+
+var avroPrimitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// parseAvroSchema parses the JSON form of a schema
+func parseAvroSchema(text string) (*avroSchema, error) {
+	var raw interface{}
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return nil, fmt.Errorf("invalid schema JSON: %w", err)
+	}
+	return parseAvroType(raw, make(map[string]*avroSchema), "")
+}
+
+func parseAvroType(raw interface{}, names map[string]*avroSchema, namespace string) (*avroSchema, error) {
+	switch t := raw.(type) {
+	case string:
+		if avroPrimitives[t] {
+			return &avroSchema{Type: t}, nil
+		}
+		if named, ok := names[fullName(t, namespace)]; ok {
+			return named, nil
+		}
+		if named, ok := names[t]; ok {
+			return named, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", t)
+
+	case []interface{}:
+		union := &avroSchema{Type: "union"}
+		for _, branch := range t {
+			parsed, err := parseAvroType(branch, names, namespace)
+			if err != nil {
+				return nil, err
+			}
+			union.Branches = append(union.Branches, parsed)
+		}
+		return union, nil
+
+	case map[string]interface{}:
+		typeName, ok := t["type"].(string)
+		if !ok {
+			// {"type": {...}} wraps another schema
+			return parseAvroType(t["type"], names, namespace)
+		}
+		logical, _ := t["logicalType"].(string)
+
+		switch typeName {
+		case "record", "error":
+			schema := &avroSchema{Type: "record"}
+			if err := nameSchema(schema, t, names, &namespace); err != nil {
+				return nil, err
+			}
+			fields, _ := t["fields"].([]interface{})
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				if name == "" {
+					return nil, fmt.Errorf("field of record %s has no name", schema.Name)
+				}
+				fieldType, err := parseAvroType(field["type"], names, namespace)
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %w", name, err)
+				}
+				schema.Fields = append(schema.Fields, avroField{Name: name, Type: fieldType})
+			}
+			return schema, nil
+
+		case "enum":
+			schema := &avroSchema{Type: "enum"}
+			if err := nameSchema(schema, t, names, &namespace); err != nil {
+				return nil, err
+			}
+			symbols, _ := t["symbols"].([]interface{})
+			for _, symbol := range symbols {
+				s, _ := symbol.(string)
+				schema.Symbols = append(schema.Symbols, s)
+			}
+			return schema, nil
+
+		case "fixed":
+			schema := &avroSchema{Type: "fixed", Logical: logical}
+			if err := nameSchema(schema, t, names, &namespace); err != nil {
+				return nil, err
+			}
+			size, _ := t["size"].(float64)
+			schema.Size = int(size)
+			return schema, nil
+
+		case "array":
+			items, err := parseAvroType(t["items"], names, namespace)
+			if err != nil {
+				return nil, fmt.Errorf("array items: %w", err)
+			}
+			return &avroSchema{Type: "array", Items: items}, nil
+
+		case "map":
+			values, err := parseAvroType(t["values"], names, namespace)
+			if err != nil {
+				return nil, fmt.Errorf("map values: %w", err)
+			}
+			return &avroSchema{Type: "map", Values: values}, nil
+
+		default:
+			schema, err := parseAvroType(typeName, names, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if logical == "" {
+				return schema, nil
+			}
+			annotated := *schema
+			annotated.Logical = logical
+			return &annotated, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid schema %v", raw)
+	}
+}
+
+// nameSchema registers a named schema, updating the enclosing namespace
+func nameSchema(schema *avroSchema, raw map[string]interface{}, names map[string]*avroSchema, namespace *string) error {
+	name, _ := raw["name"].(string)
+	if name == "" {
+		return fmt.Errorf("%s has no name", schema.Type)
+	}
+	if ns, ok := raw["namespace"].(string); ok {
+		*namespace = ns
+	}
+	schema.Name = fullName(name, *namespace)
+	names[schema.Name] = schema
+	return nil
+}
+
+func fullName(name, namespace string) string {
+	if namespace == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// encodeAvro writes a value in the Avro binary encoding of a schema
+func encodeAvro(buf *bytes.Buffer, schema *avroSchema, value interface{}) error {
+	switch schema.Type {
+	case "null":
+		if value != nil {
+			return fmt.Errorf("expected null, got %T", value)
+		}
+	case "boolean":
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected boolean, got %T", value)
+		}
+		if b {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case "int", "long":
+		i, ok := avroLong(schema, value)
+		if !ok {
+			return fmt.Errorf("expected %s, got %T", schema.Type, value)
+		}
+		writeLong(buf, i)
+	case "float":
+		f, ok := avroDouble(value)
+		if !ok {
+			return fmt.Errorf("expected float, got %T", value)
+		}
+		binary.Write(buf, binary.LittleEndian, math.Float32bits(float32(f)))
+	case "double":
+		f, ok := avroDouble(value)
+		if !ok {
+			return fmt.Errorf("expected double, got %T", value)
+		}
+		binary.Write(buf, binary.LittleEndian, math.Float64bits(f))
+	case "string", "bytes":
+		var data []byte
+		switch v := value.(type) {
+		case string:
+			data = []byte(v)
+		case []byte:
+			data = v
+		default:
+			return fmt.Errorf("expected %s, got %T", schema.Type, value)
+		}
+		writeLong(buf, int64(len(data)))
+		buf.Write(data)
+	case "fixed":
+		data, ok := value.([]byte)
+		if !ok || len(data) != schema.Size {
+			return fmt.Errorf("expected %d fixed bytes", schema.Size)
+		}
+		buf.Write(data)
+	case "enum":
+		symbol, _ := value.(string)
+		for i, s := range schema.Symbols {
+			if s == symbol {
+				writeLong(buf, int64(i))
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown symbol %q of enum %s", symbol, schema.Name)
+	case "record":
+		record, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected record %s, got %T", schema.Name, value)
+		}
+		for _, field := range schema.Fields {
+			if err := encodeAvro(buf, field.Type, record[field.Name]); err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected array, got %T", value)
+		}
+		if len(items) > 0 {
+			writeLong(buf, int64(len(items)))
+			for _, item := range items {
+				if err := encodeAvro(buf, schema.Items, item); err != nil {
+					return err
+				}
+			}
+		}
+		writeLong(buf, 0)
+	case "map":
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected map, got %T", value)
+		}
+		if len(entries) > 0 {
+			writeLong(buf, int64(len(entries)))
+			for key, entry := range entries {
+				writeLong(buf, int64(len(key)))
+				buf.WriteString(key)
+				if err := encodeAvro(buf, schema.Values, entry); err != nil {
+					return fmt.Errorf("key %s: %w", key, err)
+				}
+			}
+		}
+		writeLong(buf, 0)
+	case "union":
+		for i, branch := range schema.Branches {
+			if avroMatches(branch, value) {
+				writeLong(buf, int64(i))
+				return encodeAvro(buf, branch, value)
+			}
+		}
+		return fmt.Errorf("no union branch for %T", value)
+	default:
+		return fmt.Errorf("unsupported type %s", schema.Type)
+	}
+	return nil
+}
+
+// avroMatches reports whether a value can be written as a union branch
+func avroMatches(schema *avroSchema, value interface{}) bool {
+	switch schema.Type {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "int", "long":
+		_, ok := avroLong(schema, value)
+		return ok
+	case "float", "double":
+		switch value.(type) {
+		case float32, float64:
+			return true
+		}
+		return false
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "bytes", "fixed":
+		_, ok := value.([]byte)
+		return ok
+	case "enum":
+		_, ok := value.(string)
+		return ok
+	case "record", "map":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	}
+	return false
+}
+
+// avroLong converts an integer, or a time for timestamp logical types
+func avroLong(schema *avroSchema, value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case time.Time:
+		switch schema.Logical {
+		case "timestamp-millis":
+			return v.UnixMilli(), true
+		case "timestamp-micros":
+			return v.UnixMicro(), true
+		}
+	}
+	return 0, false
+}
+
+func avroDouble(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// writeLong writes a zig-zag encoded variable length integer
+func writeLong(buf *bytes.Buffer, i int64) {
+	var scratch [binary.MaxVarintLen64]byte
+	buf.Write(scratch[:binary.PutVarint(scratch[:], i)])
+}
+
+// avroReader reads the Avro binary encoding
+type avroReader struct {
+	data []byte
+	pos  int
+}
+
+var errAvroShort = errors.New("unexpected end of avro data")
+
+func (r *avroReader) readLong() (int64, error) {
+	i, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		return 0, errAvroShort
+	}
+	r.pos += n
+	return i, nil
+}
+
+func (r *avroReader) readBytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.pos {
+		return nil, errAvroShort
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// readCount reads the item count of an array or map block, skipping the
+// byte size that follows negative counts
+func (r *avroReader) readCount() (int64, error) {
+	count, err := r.readLong()
+	if err != nil {
+		return 0, err
+	}
+	if count < 0 {
+		count = -count
+		if _, err := r.readLong(); err != nil {
+			return 0, err
+		}
+	}
+	// Every item takes at least a byte, which bounds allocations
+	if count > int64(len(r.data)-r.pos)+1 {
+		return 0, errAvroShort
+	}
+	return count, nil
+}
+
+// decodeAvro reads a value written with a schema
+func decodeAvro(r *avroReader, schema *avroSchema) (interface{}, error) {
+	switch schema.Type {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := r.readBytes(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case "int", "long":
+		i, err := r.readLong()
+		if err != nil {
+			return nil, err
+		}
+		switch schema.Logical {
+		case "timestamp-millis":
+			return time.UnixMilli(i), nil
+		case "timestamp-micros":
+			return time.UnixMicro(i), nil
+		}
+		return i, nil
+	case "float":
+		b, err := r.readBytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+	case "double":
+		b, err := r.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case "string", "bytes":
+		n, err := r.readLong()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.readBytes(int(n))
+		if err != nil {
+			return nil, err
+		}
+		if schema.Type == "string" {
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+	case "fixed":
+		b, err := r.readBytes(schema.Size)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case "enum":
+		i, err := r.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(schema.Symbols) {
+			return nil, fmt.Errorf("enum %s has no symbol %d", schema.Name, i)
+		}
+		return schema.Symbols[i], nil
+	case "record":
+		record := make(map[string]interface{}, len(schema.Fields))
+		for _, field := range schema.Fields {
+			value, err := decodeAvro(r, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			record[field.Name] = value
+		}
+		return record, nil
+	case "array":
+		items := []interface{}{}
+		for {
+			count, err := r.readCount()
+			if err != nil || count == 0 {
+				return items, err
+			}
+			for ; count > 0; count-- {
+				item, err := decodeAvro(r, schema.Items)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+		}
+	case "map":
+		entries := map[string]interface{}{}
+		for {
+			count, err := r.readCount()
+			if err != nil || count == 0 {
+				return entries, err
+			}
+			for ; count > 0; count-- {
+				n, err := r.readLong()
+				if err != nil {
+					return nil, err
+				}
+				key, err := r.readBytes(int(n))
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeAvro(r, schema.Values)
+				if err != nil {
+					return nil, err
+				}
+				entries[string(key)] = value
+			}
+		}
+	case "union":
+		i, err := r.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(schema.Branches) {
+			return nil, fmt.Errorf("union has no branch %d", i)
+		}
+		return decodeAvro(r, schema.Branches[i])
+	default:
+		return nil, fmt.Errorf("unsupported type %s", schema.Type)
+	}
+}
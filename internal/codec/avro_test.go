@@ -0,0 +1,179 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// fakeRegistry implements the schema registry endpoints the client uses
+type fakeRegistry struct {
+	mu       sync.Mutex
+	schemas  []string
+	requests int
+}
+
+func (fr *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.requests++
+
+	w.Header().Set("Content-Type", registryContentType)
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/subjects/"):
+		var req registrySchema
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(registryError{ErrorCode: 42201, Message: "invalid schema"})
+			return
+		}
+		json.NewEncoder(w).Encode(registrySchema{ID: fr.add(req.Schema)})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/schemas/ids/"):
+		id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/schemas/ids/"))
+		if id < 1 || id > len(fr.schemas) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(registryError{ErrorCode: 40403, Message: "Schema not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(registrySchema{Schema: fr.schemas[id-1]})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// add stores a schema and returns its ID; callers hold the lock
+func (fr *fakeRegistry) add(schema string) int {
+	for i, s := range fr.schemas {
+		if s == schema {
+			return i + 1
+		}
+	}
+	fr.schemas = append(fr.schemas, schema)
+	return len(fr.schemas)
+}
+
+func newTestRegistry(t *testing.T) (*fakeRegistry, *SchemaRegistry) {
+	fr := &fakeRegistry{}
+	server := httptest.NewServer(fr)
+	t.Cleanup(server.Close)
+	return fr, NewSchemaRegistry(server.URL, time.Second)
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	fr, registry := newTestRegistry(t)
+	avro := NewAvro(registry)
+
+	notification := sampleNotification()
+	notification.Data["count"] = int64(7)
+	roundTrip(t, avro, notification)
+
+	data, err := avro.Encode("notifications", notification)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if data[0] != 0 || data[4] != 1 {
+		t.Errorf("expected magic byte and schema ID 1, got % x", data[:5])
+	}
+
+	// A second reader fetches the schema by ID once
+	reader := NewAvro(NewSchemaRegistry(registry.url, time.Second))
+	for i := 0; i < 2; i++ {
+		if _, err := reader.Decode("notifications", data); err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if fr.requests != 2 {
+		t.Errorf("expected one registration and one lookup, got %d requests", fr.requests)
+	}
+}
+
+func TestAvroNestedData(t *testing.T) {
+	_, registry := newTestRegistry(t)
+	avro := NewAvro(registry)
+
+	notification := sampleNotification()
+	notification.Data = map[string]interface{}{"items": []interface{}{"a", "b"}}
+	data, err := avro.Encode("notifications", notification)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	decoded, err := avro.Decode("notifications", data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if decoded.Data["items"] != `["a","b"]` {
+		t.Errorf("expected nested data as JSON, got %v", decoded.Data["items"])
+	}
+}
+
+func TestAvroForeignWriterSchema(t *testing.T) {
+	fr, registry := newTestRegistry(t)
+
+	// Another producer writes an older layout with an extra field and
+	// without most optional ones
+	writer := `{"type": "record", "name": "Alert", "namespace": "billing", "fields": [
+		{"name": "user_id", "type": "string"},
+		{"name": "id", "type": "string"},
+		{"name": "source", "type": {"type": "enum", "name": "Source", "symbols": ["billing", "crm"]}},
+		{"name": "title", "type": ["null", "string"]},
+		{"name": "channels", "type": {"type": "array", "items": "string"}}
+	]}`
+	fr.mu.Lock()
+	id := fr.add(writer)
+	fr.mu.Unlock()
+
+	schema, err := parseAvroSchema(writer)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	record := map[string]interface{}{
+		"user_id":  "user-1",
+		"id":       "n1",
+		"source":   "crm",
+		"title":    "Invoice due",
+		"channels": []interface{}{"email"},
+	}
+	buf := bytes.NewBuffer([]byte{0, 0, 0, 0, byte(id)})
+	if err := encodeAvro(buf, schema, record); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	decoded, err := NewAvro(registry).Decode("notifications", buf.Bytes())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if decoded.ID != "n1" || decoded.UserID != "user-1" || decoded.Title != "Invoice due" ||
+		len(decoded.Channels) != 1 || decoded.Channels[0] != pkg.ChannelEmail || decoded.Priority != pkg.PriorityNormal {
+		t.Errorf("unexpected notification %+v", decoded)
+	}
+}
+
+func TestAvroInvalid(t *testing.T) {
+	_, registry := newTestRegistry(t)
+	avro := NewAvro(registry)
+
+	if _, err := avro.Decode("notifications", []byte(`{"id": "n1"}`)); err == nil {
+		t.Errorf("expected JSON to be rejected")
+	}
+	if _, err := avro.Decode("notifications", []byte{0, 0, 0, 0, 9, 2}); err == nil {
+		t.Errorf("expected an unknown schema ID to be rejected")
+	}
+
+	data, err := avro.Encode("notifications", sampleNotification())
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if _, err := avro.Decode("notifications", data[:len(data)/2]); err == nil {
+		t.Errorf("expected a truncated message to be rejected")
+	}
+}
@@ -0,0 +1,130 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg/notificationpb"
+)
+
+// HeaderContentType is the record header naming the wire format of a Kafka
+// message; messages without it are read with the default codec
+const HeaderContentType = "content-type"
+
+// Content types of the built-in codecs
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/vnd.confluent.avro"
+)
+
+// ErrUnknownContentType is returned for messages in a wire format without a
+// codec
+var ErrUnknownContentType = errors.New("unknown content type")
+
+// Codec converts notifications to and from the value of a Kafka message on
+// a topic
+type Codec interface {
+	ContentType() string
+	Encode(topic string, notification *pkg.NotificationMessage) ([]byte, error)
+	Decode(topic string, data []byte) (*pkg.NotificationMessage, error)
+}
+
+// Codecs selects the codec of a message by its content type
+type Codecs struct {
+	fallback Codec
+	byType   map[string]Codec
+}
+
+// NewCodecs creates a codec set reading messages without a content type
+// with fallback
+func NewCodecs(fallback Codec, codecs ...Codec) *Codecs {
+	c := &Codecs{
+		fallback: fallback,
+		byType:   map[string]Codec{fallback.ContentType(): fallback},
+	}
+	for _, codec := range codecs {
+		c.byType[codec.ContentType()] = codec
+	}
+	return c
+}
+
+// Lookup returns the codec of a content type, ignoring its parameters, or
+// the fallback codec for an empty one
+func (c *Codecs) Lookup(contentType string) (Codec, error) {
+	if strings.TrimSpace(contentType) == "" {
+		return c.fallback, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownContentType, contentType)
+	}
+	codec, ok := c.byType[mediaType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownContentType, mediaType)
+	}
+	return codec, nil
+}
+
+// JSON is the default wire format, the JSON encoding of the message
+type JSON struct{}
+
+// ContentType returns the JSON content type
+func (JSON) ContentType() string {
+	return ContentTypeJSON
+}
+
+// Encode marshals the notification to JSON
+func (JSON) Encode(topic string, notification *pkg.NotificationMessage) ([]byte, error) {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	return data, nil
+}
+
+// Decode unmarshals a JSON notification
+func (JSON) Decode(topic string, data []byte) (*pkg.NotificationMessage, error) {
+	var notification pkg.NotificationMessage
+	if err := json.Unmarshal(data, &notification); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	return &notification, nil
+}
+
+// Protobuf encodes notifications as the notification.v1.Notification
+// message of the gRPC API
+type Protobuf struct{}
+
+// ContentType returns the Protobuf content type
+func (Protobuf) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+// Encode marshals the notification to Protobuf
+func (Protobuf) Encode(topic string, notification *pkg.NotificationMessage) ([]byte, error) {
+	message, err := notificationpb.FromMessage(notification)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert notification: %w", err)
+	}
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	return data, nil
+}
+
+// Decode unmarshals a Protobuf notification
+func (Protobuf) Decode(topic string, data []byte) (*pkg.NotificationMessage, error) {
+	var message notificationpb.Notification
+	if err := proto.Unmarshal(data, &message); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	return message.ToMessage(), nil
+}
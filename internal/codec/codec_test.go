@@ -0,0 +1,85 @@
+package codec
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// sampleNotification sets every field a codec carries
+func sampleNotification() *pkg.NotificationMessage {
+	createdAt := time.UnixMilli(1700000000000).UTC()
+	expiresAt := createdAt.Add(time.Hour)
+	badge := 3
+	return &pkg.NotificationMessage{
+		ID:              "n1",
+		TenantID:        "acme",
+		UserID:          "user-1",
+		Type:            "order",
+		Title:           "Shipped",
+		Body:            "Your order is on its way",
+		Data:            map[string]interface{}{"order": "42", "express": true},
+		Priority:        pkg.PriorityHigh,
+		CreatedAt:       createdAt,
+		ExpiresAt:       &expiresAt,
+		Retry:           2,
+		Channels:        []pkg.Channel{pkg.ChannelPush, pkg.ChannelEmail},
+		TemplateID:      "shipped",
+		TemplateVersion: 4,
+		CollapseKey:     "order-42",
+		CollapseMode:    pkg.CollapseMerge,
+		Badge:           &badge,
+	}
+}
+
+// roundTrip encodes and decodes a notification and compares the result
+func roundTrip(t *testing.T, codec Codec, notification *pkg.NotificationMessage) {
+	t.Helper()
+	data, err := codec.Encode("notifications", notification)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	decoded, err := codec.Decode("notifications", data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	decoded.CreatedAt = decoded.CreatedAt.UTC()
+	if decoded.ExpiresAt != nil {
+		expiresAt := decoded.ExpiresAt.UTC()
+		decoded.ExpiresAt = &expiresAt
+	}
+	if !reflect.DeepEqual(decoded, notification) {
+		t.Errorf("%s round trip changed the notification:\n got %+v\nwant %+v", codec.ContentType(), decoded, notification)
+	}
+}
+
+func TestJSONAndProtobuf(t *testing.T) {
+	for _, codec := range []Codec{JSON{}, Protobuf{}} {
+		roundTrip(t, codec, sampleNotification())
+	}
+}
+
+func TestCodecsLookup(t *testing.T) {
+	codecs := NewCodecs(JSON{}, Protobuf{})
+
+	cases := map[string]string{
+		"":                                ContentTypeJSON,
+		"application/json":                ContentTypeJSON,
+		"application/json; charset=utf-8": ContentTypeJSON,
+		"application/x-protobuf":          ContentTypeProtobuf,
+	}
+	for contentType, want := range cases {
+		codec, err := codecs.Lookup(contentType)
+		if err != nil || codec.ContentType() != want {
+			t.Errorf("Lookup(%q) = %v, %v, want %s", contentType, codec, err, want)
+		}
+	}
+
+	if _, err := codecs.Lookup(ContentTypeAvro); !errors.Is(err, ErrUnknownContentType) {
+		t.Errorf("expected ErrUnknownContentType for a codec that is not set, got %v", err)
+	}
+}
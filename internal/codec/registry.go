@@ -0,0 +1,130 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// registryContentType is the media type of the schema registry REST API
+const registryContentType = "application/vnd.schemaregistry.v1+json"
+
+// SchemaRegistry is a client of a Confluent compatible schema registry.
+// Schemas never change once registered, so lookups are cached for good.
+type SchemaRegistry struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	schemas map[int]string
+	ids     map[string]int
+}
+
+// registrySchema is the body of schema requests and responses
+type registrySchema struct {
+	Schema string `json:"schema,omitempty"`
+	ID     int    `json:"id,omitempty"`
+}
+
+// registryError is the body of registry error responses
+type registryError struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// NewSchemaRegistry creates a client of the registry at baseURL
+func NewSchemaRegistry(baseURL string, timeout time.Duration) *SchemaRegistry {
+	return &SchemaRegistry{
+		url:     strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+		schemas: make(map[int]string),
+		ids:     make(map[string]int),
+	}
+}
+
+// Register registers a schema under a subject, or finds it if it already is,
+// and returns its ID
+func (sr *SchemaRegistry) Register(subject, schema string) (int, error) {
+	key := subject + "\x00" + schema
+	sr.mu.Lock()
+	id, ok := sr.ids[key]
+	sr.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	body, err := json.Marshal(registrySchema{Schema: schema})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	var registered registrySchema
+	if err := sr.do(http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", body, &registered); err != nil {
+		return 0, fmt.Errorf("failed to register schema for %s: %w", subject, err)
+	}
+
+	sr.mu.Lock()
+	sr.ids[key] = registered.ID
+	sr.schemas[registered.ID] = schema
+	sr.mu.Unlock()
+	return registered.ID, nil
+}
+
+// Schema returns the schema with an ID
+func (sr *SchemaRegistry) Schema(id int) (string, error) {
+	sr.mu.Lock()
+	schema, ok := sr.schemas[id]
+	sr.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	var found registrySchema
+	if err := sr.do(http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &found); err != nil {
+		return "", fmt.Errorf("failed to get schema %d: %w", id, err)
+	}
+
+	sr.mu.Lock()
+	sr.schemas[id] = found.Schema
+	sr.mu.Unlock()
+	return found.Schema, nil
+}
+
+// do sends a registry request and decodes the JSON response into out
+func (sr *SchemaRegistry) do(method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, sr.url+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create registry request: %w", err)
+	}
+	req.Header.Set("Accept", registryContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", registryContentType)
+	}
+
+	resp, err := sr.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("registry request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return fmt.Errorf("failed to read registry response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var regErr registryError
+		if json.Unmarshal(respBody, &regErr) == nil && regErr.Message != "" {
+			return fmt.Errorf("registry returned %d: %s (error code %d)", resp.StatusCode, regErr.Message, regErr.ErrorCode)
+		}
+		return fmt.Errorf("registry returned %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("invalid registry response: %w", err)
+	}
+	return nil
+}
@@ -3,16 +3,42 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config holds all configuration for the notification service
 type Config struct {
-	// Kafka configuration
+	// Kafka configuration: KafkaTopic is the topic accepted notifications are
+	// published to and KafkaTopics the topics consumed, by default only
+	// KafkaTopic
 	KafkaBrokers  []string
 	KafkaTopic    string
+	KafkaTopics   []string
+	KafkaDLQTopic string
 	ConsumerGroup string
 
+	// Delays of the retry topics failed deliveries go through, named
+	// <KafkaTopic>.retry.<delay>; "none" retries in the workers instead
+	KafkaRetryDelays string
+
+	// Processing policies of consumed topics, as "topic:key=value,..."
+	// entries separated by semicolons
+	TopicPolicies string
+
+	// Wire format of produced messages (json, protobuf or avro) and the
+	// schema registry Avro messages are read and written with
+	KafkaCodec            string
+	SchemaRegistryURL     string
+	SchemaRegistryTimeout time.Duration
+
+	// Compression codec of produced messages, and the size above which
+	// encoded notifications are offloaded to Redis (0 disables) and for how
+	// long they are kept there
+	KafkaCompression string
+	OffloadThreshold int
+	OffloadTTL       time.Duration
+
 	// Redis configuration
 	RedisAddr     string
 	RedisPassword string
@@ -28,9 +54,125 @@ type Config struct {
 	RetryAttempts int
 	RetryDelay    time.Duration
 
-	// External provider configuration
-	ProviderTimeout time.Duration
-	ProviderRetries int
+	// Retries back off exponentially from RetryDelay up to RetryMaxDelay;
+	// failed provider responses are retried when their error code is one of
+	// RetryableCodes, by default retry.DefaultRetryableCodes
+	RetryMaxDelay  time.Duration
+	RetryableCodes []string
+
+	// CoalesceWindow holds notifications with a collapse key so later ones can
+	// replace or merge with them; 0 disables coalescing
+	CoalesceWindow time.Duration
+
+	// External provider configuration: ProviderTimeout bounds each send and
+	// ProviderRetries is how many transient failures a provider is retried
+	// before failing over to another provider of the channel;
+	// ProviderTimeouts and ProviderRetryLimits override them per provider
+	ProviderTimeout     time.Duration
+	ProviderRetries     int
+	ProviderTimeouts    map[string]time.Duration
+	ProviderRetryLimits map[string]int
+
+	// HedgePercentile hedges sends of urgent notifications slower than this
+	// percentile of the provider's latencies to a second provider; 0
+	// disables hedging
+	HedgePercentile float64
+
+	// Email channel configuration (disabled when SMTPAddr is empty)
+	SMTPAddr     string
+	SMTPFrom     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// SMS channel configuration (disabled when SMSGatewayURL is empty)
+	SMSGatewayURL string
+	SMSAPIKey     string
+	SMSSender     string
+
+	// Web Push channel configuration (disabled when VAPIDPrivateKey is empty)
+	VAPIDPrivateKey string
+	VAPIDSubject    string
+
+	// Delivery status and deferral configuration
+	StatusRetention      time.Duration
+	DeferredPollInterval time.Duration
+
+	// Digest configuration, as "type:interval[:template]" entries
+	DigestPolicies     string
+	DigestPollInterval time.Duration
+
+	// In-app inbox configuration: InboxTypes limits the kept notifications to
+	// some types (empty keeps all); inboxes hold at most InboxMaxItems and
+	// expire InboxRetention after their last new item
+	InboxEnabled   bool
+	InboxTypes     []string
+	InboxMaxItems  int
+	InboxRetention time.Duration
+
+	// Broadcast fan-out configuration
+	BroadcastChunkSize     int
+	BroadcastConcurrency   int
+	BroadcastChunkInterval time.Duration // minimum delay between published chunks
+
+	// Multi-tenancy: TenantMaxQueueSize bounds the queued notifications of one
+	// tenant (0 for no bound) and TenantProvidersFile holds per-tenant
+	// provider credentials
+	TenantMaxQueueSize  int
+	TenantProvidersFile string
+
+	// Default tenant throughput quota (0 for unlimited), applied to tenants
+	// without their own policy; QuotaMode is "reject" or "queue"
+	QuotaPerSecond      int
+	QuotaPerDay         int
+	QuotaMode           string
+	QuotaUsageRetention time.Duration
+
+	// Bulk submission through /send/batch: limits per request and how the
+	// async producer batches messages
+	BatchMaxItems       int
+	BatchMaxBytes       int64
+	BatchFlushFrequency time.Duration
+	BatchFlushMessages  int
+
+	// Outbound rate limiting per provider, shared across instances.
+	// ProviderRateLimit is the highest sends per second of each provider (0
+	// disables limiting) and ProviderRateLimits overrides it per provider
+	// name. Throttling responses multiply the rate by ProviderRateDecrease
+	// and pause sends for their Retry-After or ProviderThrottleBackoff; each
+	// success adds ProviderRateIncrease back.
+	ProviderRateLimit       float64
+	ProviderRateLimits      map[string]float64
+	ProviderRateBurst       float64
+	ProviderMinRate         float64
+	ProviderRateIncrease    float64
+	ProviderRateDecrease    float64
+	ProviderThrottleBackoff time.Duration
+	ProviderMaxWait         time.Duration // longer waits defer the send
+
+	// API authentication; BootstrapAPIKey is an admin key for every tenant
+	// used to create the first stored keys
+	AuthEnabled     bool
+	BootstrapAPIKey string
+	AuditLogMaxLen  int64
+
+	// gRPC API port ("" disables it), the results buffered per live
+	// result watcher before results are dropped for it and how often idle
+	// SSE and WebSocket result streams are kept alive
+	GRPCPort              string
+	ResultStreamBuffer    int
+	ResultStreamHeartbeat time.Duration
+
+	// Live connection gateway: InstanceID names this instance to the others
+	// (default: host name and process ID); clients are pinged every
+	// GatewayHeartbeat and unacknowledged deliveries fall back to the push
+	// providers after GatewayAckTimeout. Clients connect with tokens signed
+	// with GatewayTokenSecret that are valid for GatewayTokenTTL.
+	GatewayEnabled     bool
+	InstanceID         string
+	GatewayHeartbeat   time.Duration
+	GatewayAckTimeout  time.Duration
+	GatewayTokenSecret string
+	GatewayTokenTTL    time.Duration
 
 	// Service configuration
 	Port            string
@@ -44,7 +186,20 @@ func LoadConfig() *Config {
 		// Kafka defaults
 		KafkaBrokers:  getStringSlice("KAFKA_BROKERS", []string{"localhost:9092"}),
 		KafkaTopic:    getEnv("KAFKA_TOPIC", "notifications"),
+		KafkaTopics:   getEnvAsList("KAFKA_TOPICS"),
+		KafkaDLQTopic: getEnv("KAFKA_DLQ_TOPIC", "notifications.dlq"),
 		ConsumerGroup: getEnv("CONSUMER_GROUP", "notification-service"),
+		TopicPolicies: getEnv("TOPIC_POLICIES", ""),
+
+		KafkaRetryDelays: getEnv("KAFKA_RETRY_DELAYS", "5s,1m,10m"),
+
+		KafkaCodec:            getEnv("KAFKA_CODEC", "json"),
+		SchemaRegistryURL:     getEnv("SCHEMA_REGISTRY_URL", ""),
+		SchemaRegistryTimeout: getEnvAsDuration("SCHEMA_REGISTRY_TIMEOUT", 5*time.Second),
+
+		KafkaCompression: getEnv("KAFKA_COMPRESSION", "none"),
+		OffloadThreshold: getEnvAsInt("OFFLOAD_THRESHOLD", 262144),
+		OffloadTTL:       getEnvAsDuration("OFFLOAD_TTL", 7*24*time.Hour),
 
 		// Redis defaults
 		RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
@@ -61,9 +216,96 @@ func LoadConfig() *Config {
 		RetryAttempts: getEnvAsInt("RETRY_ATTEMPTS", 3),
 		RetryDelay:    getEnvAsDuration("RETRY_DELAY", 1*time.Second),
 
+		RetryMaxDelay:  getEnvAsDuration("RETRY_MAX_DELAY", 30*time.Second),
+		RetryableCodes: getEnvAsList("RETRY_CODES"),
+
+		// Coalescing defaults
+		CoalesceWindow: getEnvAsDuration("COALESCE_WINDOW", 2*time.Second),
+
 		// External provider defaults
-		ProviderTimeout: getEnvAsDuration("PROVIDER_TIMEOUT", 10*time.Second),
-		ProviderRetries: getEnvAsInt("PROVIDER_RETRIES", 2),
+		ProviderTimeout:     getEnvAsDuration("PROVIDER_TIMEOUT", 10*time.Second),
+		ProviderRetries:     getEnvAsInt("PROVIDER_RETRIES", 2),
+		ProviderTimeouts:    getEnvAsDurationMap("PROVIDER_TIMEOUTS"),
+		ProviderRetryLimits: getEnvAsIntMap("PROVIDER_RETRY_LIMITS"),
+		HedgePercentile:     getEnvAsFloat("HEDGE_PERCENTILE", 0),
+
+		// Email channel defaults
+		SMTPAddr:     getEnv("SMTP_ADDR", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "notifications@localhost"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+
+		// SMS channel defaults
+		SMSGatewayURL: getEnv("SMS_GATEWAY_URL", ""),
+		SMSAPIKey:     getEnv("SMS_API_KEY", ""),
+		SMSSender:     getEnv("SMS_SENDER", ""),
+
+		// Web Push channel defaults
+		VAPIDPrivateKey: getEnv("VAPID_PRIVATE_KEY", ""),
+		VAPIDSubject:    getEnv("VAPID_SUBJECT", "mailto:admin@localhost"),
+
+		// Delivery status and deferral defaults
+		StatusRetention:      getEnvAsDuration("STATUS_RETENTION", 72*time.Hour),
+		DeferredPollInterval: getEnvAsDuration("DEFERRED_POLL_INTERVAL", 1*time.Second),
+
+		// Digest defaults
+		DigestPolicies:     getEnv("DIGEST_POLICIES", ""),
+		DigestPollInterval: getEnvAsDuration("DIGEST_POLL_INTERVAL", 30*time.Second),
+
+		// In-app inbox defaults
+		InboxEnabled:   getEnvAsBool("INBOX_ENABLED", false),
+		InboxTypes:     getEnvAsList("INBOX_TYPES"),
+		InboxMaxItems:  getEnvAsInt("INBOX_MAX_ITEMS", 500),
+		InboxRetention: getEnvAsDuration("INBOX_RETENTION", 30*24*time.Hour),
+
+		// Broadcast fan-out defaults
+		BroadcastChunkSize:     getEnvAsInt("BROADCAST_CHUNK_SIZE", 500),
+		BroadcastConcurrency:   getEnvAsInt("BROADCAST_CONCURRENCY", 4),
+		BroadcastChunkInterval: getEnvAsDuration("BROADCAST_CHUNK_INTERVAL", 100*time.Millisecond),
+
+		// Multi-tenancy defaults
+		TenantMaxQueueSize:  getEnvAsInt("TENANT_MAX_QUEUE_SIZE", 0),
+		TenantProvidersFile: getEnv("TENANT_PROVIDERS_FILE", ""),
+
+		// Tenant quota defaults
+		QuotaPerSecond:      getEnvAsInt("QUOTA_PER_SECOND", 0),
+		QuotaPerDay:         getEnvAsInt("QUOTA_PER_DAY", 0),
+		QuotaMode:           getEnv("QUOTA_MODE", "reject"),
+		QuotaUsageRetention: getEnvAsDuration("QUOTA_USAGE_RETENTION", 90*24*time.Hour),
+
+		// Bulk submission defaults
+		BatchMaxItems:       getEnvAsInt("BATCH_MAX_ITEMS", 10000),
+		BatchMaxBytes:       int64(getEnvAsInt("BATCH_MAX_BYTES", 10<<20)),
+		BatchFlushFrequency: getEnvAsDuration("BATCH_FLUSH_FREQUENCY", 10*time.Millisecond),
+		BatchFlushMessages:  getEnvAsInt("BATCH_FLUSH_MESSAGES", 500),
+
+		// Provider rate limiting defaults
+		ProviderRateLimit:       getEnvAsFloat("PROVIDER_RATE_LIMIT", 0),
+		ProviderRateLimits:      getEnvAsFloatMap("PROVIDER_RATE_LIMITS"),
+		ProviderRateBurst:       getEnvAsFloat("PROVIDER_RATE_BURST", 0),
+		ProviderMinRate:         getEnvAsFloat("PROVIDER_MIN_RATE", 1),
+		ProviderRateIncrease:    getEnvAsFloat("PROVIDER_RATE_INCREASE", 1),
+		ProviderRateDecrease:    getEnvAsFloat("PROVIDER_RATE_DECREASE", 0.5),
+		ProviderThrottleBackoff: getEnvAsDuration("PROVIDER_THROTTLE_BACKOFF", time.Second),
+		ProviderMaxWait:         getEnvAsDuration("PROVIDER_MAX_WAIT", 2*time.Second),
+
+		// API authentication defaults
+		AuthEnabled:     getEnvAsBool("AUTH_ENABLED", true),
+		BootstrapAPIKey: getEnv("BOOTSTRAP_API_KEY", ""),
+		AuditLogMaxLen:  int64(getEnvAsInt("AUDIT_LOG_MAX_LEN", 100000)),
+
+		// gRPC and result streaming defaults
+		GRPCPort:              getEnv("GRPC_PORT", "9090"),
+		ResultStreamBuffer:    getEnvAsInt("RESULT_STREAM_BUFFER", 256),
+		ResultStreamHeartbeat: getEnvAsDuration("RESULT_STREAM_HEARTBEAT", 15*time.Second),
+
+		// Live connection gateway defaults
+		GatewayEnabled:     getEnvAsBool("GATEWAY_ENABLED", false),
+		InstanceID:         getEnv("INSTANCE_ID", ""),
+		GatewayHeartbeat:   getEnvAsDuration("GATEWAY_HEARTBEAT", 30*time.Second),
+		GatewayAckTimeout:  getEnvAsDuration("GATEWAY_ACK_TIMEOUT", 5*time.Second),
+		GatewayTokenSecret: getEnv("GATEWAY_TOKEN_SECRET", ""),
+		GatewayTokenTTL:    getEnvAsDuration("GATEWAY_TOKEN_TTL", 15*time.Minute),
 
 		// Service defaults
 		Port:            getEnv("PORT", "8080"),
@@ -71,6 +313,10 @@ func LoadConfig() *Config {
 		ShutdownTimeout: getEnvAsDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
 	}
 
+	if len(cfg.KafkaTopics) == 0 {
+		cfg.KafkaTopics = []string{cfg.KafkaTopic}
+	}
+
 	return cfg
 }
 
@@ -90,6 +336,72 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsFloatMap parses a list of name=value pairs such as
+// "sms-gateway=50,webpush=200", skipping malformed entries
+func getEnvAsFloatMap(key string) map[string]float64 {
+	values := make(map[string]float64)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			continue
+		}
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			values[name] = floatValue
+		}
+	}
+	return values
+}
+
+// getEnvAsIntMap parses a list of name=value pairs such as
+// "sms-gateway=0,apns=3", skipping malformed entries
+func getEnvAsIntMap(key string) map[string]int {
+	values := make(map[string]int)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			continue
+		}
+		if intValue, err := strconv.Atoi(value); err == nil {
+			values[name] = intValue
+		}
+	}
+	return values
+}
+
+// getEnvAsDurationMap parses a list of name=duration pairs such as
+// "apns=5s,smtp=30s", skipping malformed entries
+func getEnvAsDurationMap(key string) map[string]time.Duration {
+	values := make(map[string]time.Duration)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(value); err == nil {
+			values[name] = duration
+		}
+	}
+	return values
+}
+
 func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -99,6 +411,17 @@ func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// getEnvAsList parses a comma-separated list, skipping empty entries
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getStringSlice(key string, defaultValue []string) []string {
 	if value := os.Getenv(key); value != "" {
 		// Simple comma-separated parsing - could be enhanced
@@ -94,6 +94,10 @@ func TestLoadConfigWithEnvironment(t *testing.T) {
 		t.Errorf("Expected KafkaTopic to be 'test-topic', got %s", cfg.KafkaTopic)
 	}
 
+	if len(cfg.KafkaTopics) != 1 || cfg.KafkaTopics[0] != "test-topic" {
+		t.Errorf("Expected KafkaTopics to default to [test-topic], got %v", cfg.KafkaTopics)
+	}
+
 	if cfg.RateLimitPerUser != 20 {
 		t.Errorf("Expected RateLimitPerUser to be 20, got %d", cfg.RateLimitPerUser)
 	}
@@ -106,3 +110,24 @@ func TestLoadConfigWithEnvironment(t *testing.T) {
 		t.Errorf("Expected Port to be '9090', got %s", cfg.Port)
 	}
 }
+
+func TestGetEnvAsList(t *testing.T) {
+	t.Setenv("INBOX_TYPES", " message, ,mention,")
+
+	types := getEnvAsList("INBOX_TYPES")
+	if len(types) != 2 || types[0] != "message" || types[1] != "mention" {
+		t.Errorf("Expected [message mention], got %v", types)
+	}
+	if values := getEnvAsList("UNSET_LIST"); len(values) != 0 {
+		t.Errorf("Expected no values for unset variable, got %v", values)
+	}
+}
+
+func TestGetEnvAsDurationMap(t *testing.T) {
+	t.Setenv("PROVIDER_TIMEOUTS", "apns=5s, smtp=30s,sms,fcm=soon")
+
+	timeouts := getEnvAsDurationMap("PROVIDER_TIMEOUTS")
+	if len(timeouts) != 2 || timeouts["apns"] != 5*time.Second || timeouts["smtp"] != 30*time.Second {
+		t.Errorf("Expected apns=5s and smtp=30s, got %v", timeouts)
+	}
+}
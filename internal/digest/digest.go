@@ -0,0 +1,246 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// Data keys of a digest notification, available as template variables
+const (
+	DataKeyCount = "count"
+	DataKeyItems = "items"
+	DataKeyType  = "type"
+	DataKeySince = "since"
+)
+
+// maxSummaryLines bounds the item titles listed in an untemplated digest body
+const maxSummaryLines = 5
+
+// Policy batches low priority notifications of one type into a digest that
+// is flushed every Interval, rendered from Template when set
+type Policy struct {
+	Type     string
+	Interval time.Duration
+	Template string
+}
+
+// MarshalJSON renders the interval as a duration string such as "1h0m0s"
+func (p Policy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"type":     p.Type,
+		"interval": p.Interval.String(),
+		"template": p.Template,
+	})
+}
+
+// NextFlush returns when a digest started at t is due. Flushes are aligned
+// to the interval so an hourly digest goes out on the hour and a daily one
+// at midnight UTC.
+func (p Policy) NextFlush(t time.Time) time.Time {
+	return t.UTC().Truncate(p.Interval).Add(p.Interval)
+}
+
+// ParsePolicies parses "type:interval[:template]" entries separated by commas,
+// e.g. "social:1h:social_digest,marketing:24h"
+func ParsePolicies(spec string) (map[string]Policy, error) {
+	policies := make(map[string]Policy)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid digest policy %q, expected type:interval[:template]", entry)
+		}
+		interval, err := time.ParseDuration(parts[1])
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid digest interval in %q", entry)
+		}
+
+		policy := Policy{Type: parts[0], Interval: interval}
+		if len(parts) == 3 {
+			policy.Template = parts[2]
+		}
+		policies[policy.Type] = policy
+	}
+	return policies, nil
+}
+
+// Ref identifies the pending digest of one user and type. Tenant is empty
+// for the default tenant.
+type Ref struct {
+	Tenant string `json:"tenant,omitempty"`
+	UserID string `json:"user_id"`
+	Type   string `json:"type"`
+}
+
+// NewRef returns the Ref of a tenant's user digest
+func NewRef(tenantID, userID, digestType string) Ref {
+	if tenantID == pkg.DefaultTenant {
+		tenantID = ""
+	}
+	return Ref{Tenant: tenantID, UserID: userID, Type: digestType}
+}
+
+// Pending is the inspectable content of a digest that was not flushed yet
+type Pending struct {
+	Ref
+	Items []*pkg.NotificationMessage `json:"items"`
+	DueAt time.Time                  `json:"due_at"`
+}
+
+// Store accumulates digest items per user and type and tracks when each
+// digest is due. PopDue and Take must be atomic so a digest is flushed by
+// one instance only.
+type Store interface {
+	Add(ctx context.Context, ref Ref, n *pkg.NotificationMessage, dueAt time.Time) error
+	PopDue(ctx context.Context, now time.Time, limit int) ([]Ref, error)
+	Take(ctx context.Context, ref Ref) ([]*pkg.NotificationMessage, error)
+	Peek(ctx context.Context, userID string) ([]*Pending, error)
+}
+
+// Digester applies digest policies to notifications and builds summaries
+type Digester struct {
+	store    Store
+	policies map[string]Policy
+}
+
+// NewDigester creates a digester for the given policies keyed by type
+func NewDigester(store Store, policies map[string]Policy) *Digester {
+	return &Digester{
+		store:    store,
+		policies: policies,
+	}
+}
+
+// Policies returns the configured digest policies
+func (d *Digester) Policies() map[string]Policy {
+	return d.policies
+}
+
+// Accumulate adds a low priority notification with a digest policy to the
+// user's pending digest. It reports false for notifications to deliver now.
+func (d *Digester) Accumulate(ctx context.Context, n *pkg.NotificationMessage) (bool, error) {
+	if n.Priority != pkg.PriorityLow {
+		return false, nil
+	}
+	policy, ok := d.policies[n.Type]
+	if !ok {
+		return false, nil
+	}
+
+	ref := NewRef(n.TenantID, n.UserID, n.Type)
+	if err := d.store.Add(ctx, ref, n, policy.NextFlush(time.Now())); err != nil {
+		return false, fmt.Errorf("failed to add to digest: %w", err)
+	}
+	return true, nil
+}
+
+// Flush takes the pending digest of a user and type and returns its summary,
+// or nil if nothing is pending
+func (d *Digester) Flush(ctx context.Context, ref Ref) (*pkg.NotificationMessage, error) {
+	items, err := d.store.Take(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take digest: %w", err)
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return d.Summarize(ref, items), nil
+}
+
+// FlushDue takes every digest due at now and returns their summaries
+func (d *Digester) FlushDue(ctx context.Context, now time.Time, limit int) ([]*pkg.NotificationMessage, error) {
+	refs, err := d.store.PopDue(ctx, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch due digests: %w", err)
+	}
+
+	summaries := make([]*pkg.NotificationMessage, 0, len(refs))
+	for _, ref := range refs {
+		summary, err := d.Flush(ctx, ref)
+		if err != nil {
+			return summaries, err
+		}
+		if summary != nil {
+			summaries = append(summaries, summary)
+		}
+	}
+	return summaries, nil
+}
+
+// Pending returns the digests of a user that have not been flushed yet
+func (d *Digester) Pending(ctx context.Context, userID string) ([]*Pending, error) {
+	return d.store.Peek(ctx, userID)
+}
+
+// Summarize builds one notification standing for the digest items. The
+// summary has normal priority so it is never captured by a digest again;
+// its channels are the union of the items' channels.
+func (d *Digester) Summarize(ref Ref, items []*pkg.NotificationMessage) *pkg.NotificationMessage {
+	now := time.Now().UTC()
+	since := items[0].CreatedAt
+
+	var channels []pkg.Channel
+	seen := make(map[pkg.Channel]bool)
+	entries := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		for _, ch := range item.Channels {
+			if !seen[ch] {
+				seen[ch] = true
+				channels = append(channels, ch)
+			}
+		}
+		if item.CreatedAt.Before(since) {
+			since = item.CreatedAt
+		}
+		entries = append(entries, map[string]interface{}{
+			"id":         item.ID,
+			"title":      item.Title,
+			"body":       item.Body,
+			"data":       item.Data,
+			"created_at": item.CreatedAt,
+		})
+	}
+
+	summary := &pkg.NotificationMessage{
+		ID:       fmt.Sprintf("digest:%s:%s:%d", ref.Type, ref.UserID, now.Unix()),
+		TenantID: ref.Tenant,
+		UserID:   ref.UserID,
+		Type:     ref.Type,
+		Priority: pkg.PriorityNormal,
+		Channels: channels,
+		Data: map[string]interface{}{
+			DataKeyCount: len(items),
+			DataKeyItems: entries,
+			DataKeyType:  ref.Type,
+			DataKeySince: since,
+		},
+		CreatedAt: now,
+	}
+
+	if policy, ok := d.policies[ref.Type]; ok && policy.Template != "" {
+		summary.TemplateID = policy.Template
+		return summary
+	}
+
+	// Without a template, list the first few titles
+	summary.Title = fmt.Sprintf("%d new %s notifications", len(items), ref.Type)
+	lines := make([]string, 0, maxSummaryLines+1)
+	for i, item := range items {
+		if i == maxSummaryLines {
+			lines = append(lines, fmt.Sprintf("and %d more", len(items)-maxSummaryLines))
+			break
+		}
+		lines = append(lines, item.Title)
+	}
+	summary.Body = strings.Join(lines, "\n")
+	return summary
+}
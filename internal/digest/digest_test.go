@@ -0,0 +1,180 @@
+package digest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// memoryStore is an in-memory Store for tests
+type memoryStore struct {
+	items map[Ref][]*pkg.NotificationMessage
+	due   map[Ref]time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{items: make(map[Ref][]*pkg.NotificationMessage), due: make(map[Ref]time.Time)}
+}
+
+func (m *memoryStore) Add(ctx context.Context, ref Ref, n *pkg.NotificationMessage, dueAt time.Time) error {
+	m.items[ref] = append(m.items[ref], n)
+	if _, ok := m.due[ref]; !ok {
+		m.due[ref] = dueAt
+	}
+	return nil
+}
+
+func (m *memoryStore) PopDue(ctx context.Context, now time.Time, limit int) ([]Ref, error) {
+	var refs []Ref
+	for ref, due := range m.due {
+		if !due.After(now) && len(refs) < limit {
+			refs = append(refs, ref)
+			delete(m.due, ref)
+		}
+	}
+	return refs, nil
+}
+
+func (m *memoryStore) Take(ctx context.Context, ref Ref) ([]*pkg.NotificationMessage, error) {
+	items := m.items[ref]
+	delete(m.items, ref)
+	delete(m.due, ref)
+	return items, nil
+}
+
+func (m *memoryStore) Peek(ctx context.Context, userID string) ([]*Pending, error) {
+	var pending []*Pending
+	for ref, items := range m.items {
+		if ref.UserID == userID {
+			pending = append(pending, &Pending{Ref: ref, Items: items, DueAt: m.due[ref]})
+		}
+	}
+	return pending, nil
+}
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := ParsePolicies("social:1h:social_digest, marketing:24h")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if p := policies["social"]; p.Interval != time.Hour || p.Template != "social_digest" {
+		t.Errorf("Unexpected social policy %+v", p)
+	}
+	if p := policies["marketing"]; p.Interval != 24*time.Hour || p.Template != "" {
+		t.Errorf("Unexpected marketing policy %+v", p)
+	}
+
+	for _, spec := range []string{"social", "social:soon", "social:0s", ":1h"} {
+		if _, err := ParsePolicies(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestNextFlush(t *testing.T) {
+	at := time.Date(2024, 3, 10, 14, 25, 0, 0, time.UTC)
+	if next := (Policy{Interval: time.Hour}).NextFlush(at); !next.Equal(time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected hourly digest on the hour, got %s", next)
+	}
+	if next := (Policy{Interval: 24 * time.Hour}).NextFlush(at); !next.Equal(time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected daily digest at midnight, got %s", next)
+	}
+}
+
+func TestDigesterAccumulateAndFlush(t *testing.T) {
+	store := newMemoryStore()
+	digester := NewDigester(store, map[string]Policy{"social": {Type: "social", Interval: time.Hour}})
+	ctx := context.Background()
+
+	low := func(id, title string) *pkg.NotificationMessage {
+		return &pkg.NotificationMessage{ID: id, UserID: "user-1", Type: "social", Title: title, Priority: pkg.PriorityLow, Channels: []pkg.Channel{pkg.ChannelPush}}
+	}
+
+	for i, title := range []string{"Ada liked your post", "Bob followed you", "Cy commented", "Di liked your post", "Ed followed you", "Flo commented"} {
+		if digested, err := digester.Accumulate(ctx, low(string(rune('a'+i)), title)); err != nil || !digested {
+			t.Fatalf("Expected low priority social notification to be digested, got %v (%v)", digested, err)
+		}
+	}
+
+	normal := low("n", "Urgent-ish")
+	normal.Priority = pkg.PriorityNormal
+	if digested, _ := digester.Accumulate(ctx, normal); digested {
+		t.Errorf("Expected normal priority notification to be delivered directly")
+	}
+	other := low("o", "Sale")
+	other.Type = "marketing"
+	if digested, _ := digester.Accumulate(ctx, other); digested {
+		t.Errorf("Expected notification without a policy to be delivered directly")
+	}
+
+	pending, _ := digester.Pending(ctx, "user-1")
+	if len(pending) != 1 || len(pending[0].Items) != 6 {
+		t.Fatalf("Expected one pending digest of 6 items, got %+v", pending)
+	}
+
+	if summaries, _ := digester.FlushDue(ctx, time.Now(), 10); len(summaries) != 0 {
+		t.Errorf("Expected nothing due yet, got %d summaries", len(summaries))
+	}
+
+	summaries, err := digester.FlushDue(ctx, time.Now().Add(2*time.Hour), 10)
+	if err != nil || len(summaries) != 1 {
+		t.Fatalf("Expected one due digest, got %d (%v)", len(summaries), err)
+	}
+
+	summary := summaries[0]
+	if summary.UserID != "user-1" || summary.Priority != pkg.PriorityNormal || summary.Data[DataKeyCount] != 6 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	if summary.Title != "6 new social notifications" || !strings.HasSuffix(summary.Body, "and 1 more") {
+		t.Errorf("Unexpected summary text %q / %q", summary.Title, summary.Body)
+	}
+	if len(summary.Channels) != 1 || summary.Channels[0] != pkg.ChannelPush {
+		t.Errorf("Expected summary on the items' channels, got %v", summary.Channels)
+	}
+
+	if pending, _ := digester.Pending(ctx, "user-1"); len(pending) != 0 {
+		t.Errorf("Expected digest to be emptied by the flush")
+	}
+}
+
+func TestSummarizeWithTemplate(t *testing.T) {
+	digester := NewDigester(newMemoryStore(), map[string]Policy{"social": {Type: "social", Interval: time.Hour, Template: "social_digest"}})
+
+	summary := digester.Summarize(Ref{UserID: "user-1", Type: "social"}, []*pkg.NotificationMessage{{ID: "a", Title: "Ada liked your post"}})
+	if summary.TemplateID != "social_digest" || summary.Title != "" {
+		t.Errorf("Expected summary to be rendered from the policy template, got %+v", summary)
+	}
+	items, ok := summary.Data[DataKeyItems].([]map[string]interface{})
+	if !ok || len(items) != 1 || items[0]["title"] != "Ada liked your post" {
+		t.Errorf("Expected items as template variables, got %v", summary.Data[DataKeyItems])
+	}
+}
+
+func TestDigestsAreKeptPerTenant(t *testing.T) {
+	store := newMemoryStore()
+	digester := NewDigester(store, map[string]Policy{"social": {Type: "social", Interval: time.Hour}})
+	ctx := context.Background()
+
+	for _, tenantID := range []string{"", pkg.DefaultTenant, "acme"} {
+		n := &pkg.NotificationMessage{ID: "n-" + tenantID, TenantID: tenantID, UserID: "user-1", Type: "social", Priority: pkg.PriorityLow}
+		if ok, err := digester.Accumulate(ctx, n); !ok || err != nil {
+			t.Fatalf("Expected notification to be digested, got %v, %v", ok, err)
+		}
+	}
+
+	// The default tenant, named or not, shares one digest
+	if len(store.items) != 2 {
+		t.Fatalf("Expected one digest per tenant, got %d", len(store.items))
+	}
+
+	summary, err := digester.Flush(ctx, NewRef("acme", "user-1", "social"))
+	if err != nil || summary == nil {
+		t.Fatalf("Expected a summary, got %v, %v", summary, err)
+	}
+	if summary.TenantID != "acme" || summary.Data[DataKeyCount] != 1 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+}
@@ -0,0 +1,425 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/provider"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// Frame types exchanged with clients
+const (
+	FrameNotification = "notification"
+	FrameAck          = "ack"
+)
+
+// Envelope types exchanged between instances
+const (
+	EnvelopeDeliver = "deliver"
+	EnvelopeAck     = "ack"
+)
+
+// Frame is a WebSocket message. The server sends notifications, which the
+// client acknowledges with an ack frame carrying the same ID.
+type Frame struct {
+	Type         string                   `json:"type"`
+	ID           string                   `json:"id"`
+	Notification *pkg.NotificationMessage `json:"notification,omitempty"`
+}
+
+// Envelope carries a delivery to the instance holding the user's connection,
+// or an acknowledgement back to the instance that sent the delivery with
+// the tenant and user of the connection that acknowledged it
+type Envelope struct {
+	Type         string                   `json:"type"`
+	DeliveryID   string                   `json:"delivery_id"`
+	TenantID     string                   `json:"tenant_id,omitempty"`
+	UserID       string                   `json:"user_id,omitempty"`
+	Notification *pkg.NotificationMessage `json:"notification,omitempty"`
+}
+
+// Presence records which instances hold live connections of each user of
+// the context's tenant. Entries expire after ttl unless joined again.
+type Presence interface {
+	Join(ctx context.Context, userID, instanceID string, ttl time.Duration) error
+	Leave(ctx context.Context, userID, instanceID string) error
+	Instances(ctx context.Context, userID string) ([]string, error)
+}
+
+// Bus carries envelopes between gateway instances. Subscribe delivers the
+// envelopes published to an instance until ctx is done.
+type Bus interface {
+	Publish(ctx context.Context, instanceID string, envelope *Envelope) error
+	Subscribe(ctx context.Context, instanceID string) (<-chan *Envelope, error)
+}
+
+// connKey identifies the connections of one user
+type connKey struct {
+	tenantID string
+	userID   string
+}
+
+// conn is a live client connection. sent holds the deliveries queued on it
+// that it may acknowledge, with when they were queued; it is guarded by the
+// gateway's mutex.
+type conn struct {
+	ws   *websocket.Conn
+	out  chan Frame
+	sent map[string]time.Time
+}
+
+// pendingDelivery is a Send waiting for the user it delivered to
+type pendingDelivery struct {
+	key   connKey
+	acked chan struct{}
+}
+
+// Gateway is a provider delivering notifications over the WebSocket
+// connections of online users. Connections may live on any instance: the
+// presence store tells where, and deliveries and acknowledgements travel
+// over the bus. A notification counts as sent once a client acknowledges it.
+type Gateway struct {
+	name       string
+	instanceID string
+	presence   Presence
+	bus        Bus
+	heartbeat  time.Duration
+	ackTimeout time.Duration
+
+	mu      sync.Mutex
+	conns   map[connKey]map[*conn]struct{}
+	pending map[string]*pendingDelivery
+	seq     uint64
+	running int32
+}
+
+// NewGateway creates a gateway for this instance. Clients are pinged every
+// heartbeat and deliveries fail over to the other providers when no
+// acknowledgement arrives within ackTimeout.
+func NewGateway(name, instanceID string, presence Presence, bus Bus, heartbeat, ackTimeout time.Duration) *Gateway {
+	return &Gateway{
+		name:       name,
+		instanceID: instanceID,
+		presence:   presence,
+		bus:        bus,
+		heartbeat:  heartbeat,
+		ackTimeout: ackTimeout,
+		conns:      make(map[connKey]map[*conn]struct{}),
+		pending:    make(map[string]*pendingDelivery),
+	}
+}
+
+// Name returns the provider name
+func (g *Gateway) Name() string {
+	return g.name
+}
+
+// presenceTTL is how long a connection counts as online without a heartbeat
+func (g *Gateway) presenceTTL() time.Duration {
+	return 3 * g.heartbeat
+}
+
+// Run handles the envelopes sent to this instance until ctx is done
+func (g *Gateway) Run(ctx context.Context) error {
+	envelopes, err := g.bus.Subscribe(ctx, g.instanceID)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to gateway bus: %w", err)
+	}
+
+	atomic.StoreInt32(&g.running, 1)
+	defer atomic.StoreInt32(&g.running, 0)
+
+	for envelope := range envelopes {
+		switch envelope.Type {
+		case EnvelopeDeliver:
+			g.deliverLocal(connKey{envelope.TenantID, envelope.UserID}, envelope.DeliveryID, envelope.Notification)
+		case EnvelopeAck:
+			g.resolve(connKey{envelope.TenantID, envelope.UserID}, envelope.DeliveryID)
+		}
+	}
+	return nil
+}
+
+// HealthCheck reports whether the gateway is receiving from the bus
+func (g *Gateway) HealthCheck(ctx context.Context) error {
+	if atomic.LoadInt32(&g.running) == 0 {
+		return fmt.Errorf("gateway %s is not running", g.name)
+	}
+	return nil
+}
+
+// Accepts reports whether the recipient has a live connection
+func (g *Gateway) Accepts(ctx context.Context, notification *pkg.NotificationMessage) bool {
+	instances, err := g.presence.Instances(ctx, notification.UserID)
+	return err == nil && len(instances) > 0
+}
+
+// Send delivers the notification to every live connection of the user and
+// waits for the first acknowledgement. It returns provider.ErrRecipientOffline
+// when the user has no connection or none acknowledges in time.
+func (g *Gateway) Send(ctx context.Context, notification *pkg.NotificationMessage) (*pkg.ProviderResponse, error) {
+	instances, err := g.presence.Instances(ctx, notification.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("presence lookup failed: %w", err)
+	}
+
+	key := connKey{notification.Tenant(), notification.UserID}
+	id := fmt.Sprintf("%s/%d", g.instanceID, atomic.AddUint64(&g.seq, 1))
+	acked := make(chan struct{}, 1)
+	g.mu.Lock()
+	g.pending[id] = &pendingDelivery{key: key, acked: acked}
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.pending, id)
+		g.mu.Unlock()
+	}()
+
+	sent := 0
+	for _, instanceID := range instances {
+		if instanceID == g.instanceID {
+			sent += g.deliverLocal(key, id, notification)
+			continue
+		}
+		err := g.bus.Publish(ctx, instanceID, &Envelope{
+			Type:         EnvelopeDeliver,
+			DeliveryID:   id,
+			TenantID:     key.tenantID,
+			UserID:       key.userID,
+			Notification: notification,
+		})
+		if err != nil {
+			log.Printf("Gateway %s: failed to forward notification %s to instance %s: %v", g.name, notification.ID, instanceID, err)
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		return nil, fmt.Errorf("%w: user %s has no live connection", provider.ErrRecipientOffline, notification.UserID)
+	}
+
+	timer := time.NewTimer(g.ackTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-acked:
+		return &pkg.ProviderResponse{Success: true, MessageID: id}, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%w: no acknowledgement from user %s within %s", provider.ErrRecipientOffline, notification.UserID, g.ackTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// deliverLocal queues the notification on the user's connections to this
+// instance and returns how many took it. Each connection may acknowledge
+// the delivery until the ack timeout.
+func (g *Gateway) deliverLocal(key connKey, id string, notification *pkg.NotificationMessage) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	sent := 0
+	for c := range g.conns[key] {
+		select {
+		case c.out <- Frame{Type: FrameNotification, ID: id, Notification: notification}:
+			for earlier, at := range c.sent {
+				if now.Sub(at) > g.ackTimeout {
+					delete(c.sent, earlier)
+				}
+			}
+			c.sent[id] = now
+			sent++
+		default:
+			// The connection is backed up; leave it to the others or the ack timeout
+		}
+	}
+	return sent
+}
+
+// acknowledge routes a client's acknowledgement to the instance that sent
+// the delivery, named by the delivery ID. Only deliveries queued on the
+// connection are acknowledged; acks of any other ID are dropped.
+func (g *Gateway) acknowledge(ctx context.Context, key connKey, c *conn, id string) {
+	g.mu.Lock()
+	_, ok := c.sent[id]
+	delete(c.sent, id)
+	g.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	i := strings.LastIndex(id, "/")
+	if i < 0 {
+		return
+	}
+	origin := id[:i]
+	if origin == g.instanceID {
+		g.resolve(key, id)
+		return
+	}
+	envelope := &Envelope{Type: EnvelopeAck, DeliveryID: id, TenantID: key.tenantID, UserID: key.userID}
+	if err := g.bus.Publish(ctx, origin, envelope); err != nil {
+		log.Printf("Gateway %s: failed to forward acknowledgement %s to instance %s: %v", g.name, id, origin, err)
+	}
+}
+
+// resolve wakes the Send waiting for a delivery to the acknowledging user
+func (g *Gateway) resolve(key connKey, id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if pending, ok := g.pending[id]; ok && pending.key == key {
+		select {
+		case pending.acked <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// add registers a connection and marks the user online on this instance
+func (g *Gateway) add(ctx context.Context, key connKey, c *conn) error {
+	g.mu.Lock()
+	conns, ok := g.conns[key]
+	if !ok {
+		conns = make(map[*conn]struct{})
+		g.conns[key] = conns
+	}
+	conns[c] = struct{}{}
+	g.mu.Unlock()
+
+	return g.presence.Join(ctx, key.userID, g.instanceID, g.presenceTTL())
+}
+
+// remove unregisters a connection, marking the user offline on this
+// instance with the last one
+func (g *Gateway) remove(ctx context.Context, key connKey, c *conn) {
+	g.mu.Lock()
+	delete(g.conns[key], c)
+	last := len(g.conns[key]) == 0
+	if last {
+		delete(g.conns, key)
+	}
+	g.mu.Unlock()
+
+	if last {
+		if err := g.presence.Leave(ctx, key.userID, g.instanceID); err != nil {
+			log.Printf("Gateway %s: failed to clear presence of user %s: %v", g.name, key.userID, err)
+		}
+	}
+}
+
+// Connections returns the number of live connections to this instance
+func (g *Gateway) Connections() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := 0
+	for _, conns := range g.conns {
+		n += len(conns)
+	}
+	return n
+}
+
+// upgrader upgrades client connections to the gateway
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// Handler upgrades connections that present a connect token in the token
+// query parameter and serves them as the token's user until the client
+// goes away or ctx is done
+func (g *Gateway) Handler(ctx context.Context, tokens *Tokens) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID, userID, err := tokens.Verify(r.URL.Query().Get("token"), time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		// Upgrade writes the error response itself
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		// The connection outlives the request, so it ends with ctx
+		if err := g.Serve(tenant.WithID(ctx, tenantID), ws, userID); err != nil {
+			log.Printf("Gateway connection of user %s ended: %v", userID, err)
+		}
+	})
+}
+
+// Serve delivers notifications for a user of the context's tenant over an
+// upgraded connection until the client disconnects, stops answering pings
+// or ctx is done. It closes ws when done.
+func (g *Gateway) Serve(ctx context.Context, ws *websocket.Conn, userID string) error {
+	defer ws.Close()
+
+	key := connKey{tenant.FromContext(ctx), userID}
+	c := &conn{ws: ws, out: make(chan Frame, 16), sent: make(map[string]time.Time)}
+	if err := g.add(ctx, key, c); err != nil {
+		g.remove(context.Background(), key, c)
+		return fmt.Errorf("failed to register presence: %w", err)
+	}
+	// ctx may be done by now, so presence is cleared without it
+	defer g.remove(tenant.WithID(context.Background(), key.tenantID), key, c)
+
+	// Read acknowledgements until the client goes away; pongs keep the
+	// connection alive
+	gone := make(chan struct{})
+	ws.SetReadLimit(4096)
+	ws.SetReadDeadline(time.Now().Add(g.presenceTTL()))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(g.presenceTTL()))
+	})
+	go func() {
+		defer close(gone)
+		for {
+			var frame Frame
+			if err := ws.ReadJSON(&frame); err != nil {
+				return
+			}
+			if frame.Type == FrameAck && frame.ID != "" {
+				g.acknowledge(ctx, key, c, frame.ID)
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(g.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gone:
+			return nil
+		case <-ctx.Done():
+			ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(time.Second))
+			return nil
+		case frame := <-c.out:
+			ws.SetWriteDeadline(time.Now().Add(g.heartbeat))
+			if err := ws.WriteJSON(frame); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(g.heartbeat)); err != nil {
+				return err
+			}
+			if err := g.presence.Join(ctx, key.userID, g.instanceID, g.presenceTTL()); err != nil {
+				log.Printf("Gateway %s: failed to refresh presence of user %s: %v", g.name, key.userID, err)
+			}
+		}
+	}
+}
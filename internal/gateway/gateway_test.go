@@ -0,0 +1,333 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/provider"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// memoryPresence keeps presence per tenant and user without expiry
+type memoryPresence struct {
+	mu        sync.Mutex
+	instances map[string]map[string]bool
+}
+
+func newMemoryPresence() *memoryPresence {
+	return &memoryPresence{instances: make(map[string]map[string]bool)}
+}
+
+func (mp *memoryPresence) Join(ctx context.Context, userID, instanceID string, ttl time.Duration) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	key := tenant.ContextKey(ctx, userID)
+	if mp.instances[key] == nil {
+		mp.instances[key] = make(map[string]bool)
+	}
+	mp.instances[key][instanceID] = true
+	return nil
+}
+
+func (mp *memoryPresence) Leave(ctx context.Context, userID, instanceID string) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	delete(mp.instances[tenant.ContextKey(ctx, userID)], instanceID)
+	return nil
+}
+
+func (mp *memoryPresence) Instances(ctx context.Context, userID string) ([]string, error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	var instances []string
+	for instanceID := range mp.instances[tenant.ContextKey(ctx, userID)] {
+		instances = append(instances, instanceID)
+	}
+	return instances, nil
+}
+
+// memoryBus delivers envelopes through a channel per instance
+type memoryBus struct {
+	mu       sync.Mutex
+	channels map[string]chan *Envelope
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{channels: make(map[string]chan *Envelope)}
+}
+
+func (mb *memoryBus) channel(instanceID string) chan *Envelope {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	ch, ok := mb.channels[instanceID]
+	if !ok {
+		ch = make(chan *Envelope, 16)
+		mb.channels[instanceID] = ch
+	}
+	return ch
+}
+
+func (mb *memoryBus) Publish(ctx context.Context, instanceID string, envelope *Envelope) error {
+	mb.channel(instanceID) <- envelope
+	return nil
+}
+
+func (mb *memoryBus) Subscribe(ctx context.Context, instanceID string) (<-chan *Envelope, error) {
+	in := mb.channel(instanceID)
+	out := make(chan *Envelope)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case envelope := <-in:
+				out <- envelope
+			}
+		}
+	}()
+	return out, nil
+}
+
+// testTokens signs the connect tokens of every test gateway
+var testTokens = NewTokens([]byte("test-secret"), time.Minute)
+
+// startGateway runs a gateway and serves its WebSocket endpoint
+func startGateway(t *testing.T, ctx context.Context, instanceID string, presence Presence, bus Bus) (*Gateway, string) {
+	t.Helper()
+	g := NewGateway("gateway", instanceID, presence, bus, time.Minute, time.Second)
+	go g.Run(ctx)
+
+	server := httptest.NewServer(g.Handler(ctx, testTokens))
+	t.Cleanup(server.Close)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for g.HealthCheck(ctx) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("gateway %s did not start", instanceID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return g, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// connect opens a client connection for a user of acme and waits until the
+// gateway holds it
+func connect(t *testing.T, g *Gateway, url, userID string) *websocket.Conn {
+	t.Helper()
+	token, _, err := testTokens.Issue("acme", userID, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	before := g.Connections()
+	ws, _, err := websocket.DefaultDialer.Dial(url+"?token="+token, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	deadline := time.Now().Add(2 * time.Second)
+	for g.Connections() == before {
+		if time.Now().After(deadline) {
+			t.Fatalf("connection of %s was not registered", userID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return ws
+}
+
+// receiveAndAck reads a notification frame and acknowledges it
+func receiveAndAck(t *testing.T, ws *websocket.Conn) Frame {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var frame Frame
+	if err := ws.ReadJSON(&frame); err != nil {
+		t.Errorf("unexpected error reading frame: %v", err)
+		return frame
+	}
+	if err := ws.WriteJSON(Frame{Type: FrameAck, ID: frame.ID}); err != nil {
+		t.Errorf("unexpected error writing ack: %v", err)
+	}
+	return frame
+}
+
+func TestGatewayDeliversAcrossInstances(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	presence, bus := newMemoryPresence(), newMemoryBus()
+	local, localURL := startGateway(t, ctx, "instance-a", presence, bus)
+	remote, remoteURL := startGateway(t, ctx, "instance-b", presence, bus)
+
+	sendCtx := tenant.WithID(ctx, "acme")
+	cases := []struct {
+		name string
+		g    *Gateway
+		url  string
+	}{
+		{"local", local, localURL},
+		{"remote", remote, remoteURL},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			userID := "user-" + tc.name
+			ws := connect(t, tc.g, tc.url, userID)
+
+			notification := &pkg.NotificationMessage{ID: "n-" + tc.name, TenantID: "acme", UserID: userID, Title: "Hi"}
+			if !local.Accepts(sendCtx, notification) {
+				t.Fatalf("expected gateway to accept notification for online user")
+			}
+
+			frames := make(chan Frame, 1)
+			go func() { frames <- receiveAndAck(t, ws) }()
+
+			response, err := local.Send(sendCtx, notification)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !response.Success || !strings.HasPrefix(response.MessageID, "instance-a/") {
+				t.Errorf("unexpected response %+v", response)
+			}
+			if frame := <-frames; frame.Type != FrameNotification || frame.Notification.ID != notification.ID {
+				t.Errorf("unexpected frame %+v", frame)
+			}
+		})
+	}
+}
+
+func TestGatewayOffline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	g, url := startGateway(t, ctx, "instance-a", newMemoryPresence(), newMemoryBus())
+	sendCtx := tenant.WithID(ctx, "acme")
+	notification := &pkg.NotificationMessage{ID: "n1", TenantID: "acme", UserID: "user1"}
+
+	if g.Accepts(sendCtx, notification) {
+		t.Errorf("expected gateway not to accept notification for offline user")
+	}
+	if _, err := g.Send(sendCtx, notification); !errors.Is(err, provider.ErrRecipientOffline) {
+		t.Errorf("expected ErrRecipientOffline, got %v", err)
+	}
+
+	// A client that never acknowledges is treated as offline after the timeout
+	ws := connect(t, g, url, "user1")
+	if _, err := g.Send(sendCtx, notification); !errors.Is(err, provider.ErrRecipientOffline) {
+		t.Errorf("expected ErrRecipientOffline without acknowledgement, got %v", err)
+	}
+
+	// Disconnecting clears presence
+	ws.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for g.Accepts(sendCtx, notification) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected user to be offline after disconnecting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestGatewayConnectTokens(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	g := NewGateway("gateway", "instance-a", newMemoryPresence(), newMemoryBus(), time.Minute, time.Second)
+	go g.Run(ctx)
+
+	// The endpoint behind the auth middleware, whose response writer wraps
+	// the server's
+	authn := auth.NewAuthenticator(nil)
+	authn.SetBootstrapKey("pk_test")
+	scopes := func(r *http.Request) auth.Scope { return auth.ScopeReadStatus }
+	server := httptest.NewServer(auth.Middleware(authn, scopes, nil)(g.Handler(ctx, testTokens)))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	header := http.Header{"X-API-Key": []string{"pk_test"}}
+
+	now := time.Now()
+	valid, _, _ := testTokens.Issue("acme", "user1", now)
+	expired, _, _ := testTokens.Issue("acme", "user1", now.Add(-2*time.Minute))
+	forged, _, _ := NewTokens([]byte("other-secret"), time.Minute).Issue("acme", "user1", now)
+	for name, token := range map[string]string{"missing": "", "expired": expired, "forged": forged, "tampered": "x" + valid} {
+		if _, resp, err := websocket.DefaultDialer.Dial(url+"?user_id=user1&token="+token, header); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s token: expected 401, got %v", name, err)
+		}
+	}
+
+	// The connection is bound to the token's user, not the user_id parameter
+	ws, _, err := websocket.DefaultDialer.Dial(url+"?user_id=user2&token="+valid, header)
+	if err != nil {
+		t.Fatalf("expected the upgrade to succeed through the middleware, got %v", err)
+	}
+	defer ws.Close()
+
+	sendCtx := tenant.WithID(ctx, "acme")
+	deadline := time.Now().Add(2 * time.Second)
+	for !g.Accepts(sendCtx, &pkg.NotificationMessage{UserID: "user1"}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the token's user to be online")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if g.Accepts(sendCtx, &pkg.NotificationMessage{UserID: "user2"}) {
+		t.Errorf("expected the user_id parameter to be ignored")
+	}
+}
+
+func TestGatewayAcksOnlyFromRecipient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus := newMemoryBus()
+	g, url := startGateway(t, ctx, "instance-a", newMemoryPresence(), bus)
+	a := connect(t, g, url, "user1")
+	b := connect(t, g, url, "user2")
+
+	sendCtx := tenant.WithID(ctx, "acme")
+	responses := make(chan error, 1)
+	go func() {
+		_, err := g.Send(sendCtx, &pkg.NotificationMessage{ID: "n1", TenantID: "acme", UserID: "user2"})
+		responses <- err
+	}()
+
+	b.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var frame Frame
+	if err := b.ReadJSON(&frame); err != nil {
+		t.Fatalf("unexpected error reading frame: %v", err)
+	}
+
+	// Connection A acks B's delivery and names another instance as origin
+	for _, id := range []string{frame.ID, "instance-x/1"} {
+		if err := a.WriteJSON(Frame{Type: FrameAck, ID: id}); err != nil {
+			t.Fatalf("unexpected error writing ack: %v", err)
+		}
+	}
+	select {
+	case err := <-responses:
+		t.Fatalf("expected the delivery to wait for its recipient, got %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	bus.mu.Lock()
+	_, forwarded := bus.channels["instance-x"]
+	bus.mu.Unlock()
+	if forwarded {
+		t.Errorf("expected an ack of an unknown delivery not to be forwarded")
+	}
+
+	if err := b.WriteJSON(Frame{Type: FrameAck, ID: frame.ID}); err != nil {
+		t.Fatalf("unexpected error writing ack: %v", err)
+	}
+	if err := <-responses; err != nil {
+		t.Errorf("expected the recipient's ack to complete the delivery, got %v", err)
+	}
+}
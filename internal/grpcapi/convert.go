@@ -0,0 +1,48 @@
+package grpcapi
+
+import (
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg/notificationpb"
+)
+
+// resultToProto converts a processing result
+func resultToProto(r *pkg.ProcessingResult) *notificationpb.Result {
+	result := &notificationpb.Result{
+		MessageId:     r.MessageID,
+		TenantId:      r.TenantID,
+		UserId:        r.UserID,
+		Success:       r.Success,
+		Outcome:       string(r.Outcome),
+		Channel:       string(r.Channel),
+		Provider:      r.Provider,
+		ProcessedAt:   timestamppb.New(r.ProcessedAt),
+		Attempts:      int32(r.Attempts),
+		DeferredUntil: notificationpb.Timestamp(r.DeferredUntil),
+	}
+	if r.Error != nil {
+		result.Error = r.Error.Error()
+	}
+	return result
+}
+
+// statusToProto converts a delivery status
+func statusToProto(s *pkg.DeliveryStatus) *notificationpb.DeliveryStatus {
+	status := &notificationpb.DeliveryStatus{
+		MessageId: s.MessageID,
+		UserId:    s.UserID,
+		Channels:  make(map[string]*notificationpb.ChannelStatus, len(s.Channels)),
+	}
+	for ch, cs := range s.Channels {
+		status.Channels[string(ch)] = &notificationpb.ChannelStatus{
+			Outcome:       string(cs.Outcome),
+			Provider:      cs.Provider,
+			Error:         cs.Error,
+			Attempts:      int32(cs.Attempts),
+			DeferredUntil: notificationpb.Timestamp(cs.DeferredUntil),
+			UpdatedAt:     timestamppb.New(cs.UpdatedAt),
+		}
+	}
+	return status
+}
@@ -0,0 +1,292 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/ingest"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/quota"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/results"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/validation"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg/notificationpb"
+)
+
+// Publisher publishes single notifications into the pipeline
+type Publisher interface {
+	Send(notification *pkg.NotificationMessage) error
+}
+
+// BatchPublisher publishes many notifications at once, returning the error
+// of each one
+type BatchPublisher interface {
+	SendAll(notifications []*pkg.NotificationMessage) []error
+}
+
+// StatusReader returns the delivery status of a notification of the tenant
+// in ctx, or nil if it is unknown
+type StatusReader interface {
+	Get(ctx context.Context, messageID string) (*pkg.DeliveryStatus, error)
+}
+
+// QuotaAdmitter decides whether a tenant may submit more notifications
+type QuotaAdmitter interface {
+	Admit(ctx context.Context, tenantID string, n int64) (quota.Decision, error)
+}
+
+// Server implements the gRPC NotificationService on the same pipeline,
+// validation and authentication as the HTTP API
+type Server struct {
+	notificationpb.UnimplementedNotificationServiceServer
+
+	publisher     Publisher
+	batches       BatchPublisher
+	maxBatchItems int
+	statuses      StatusReader
+	hub           *results.Hub
+	watchBuffer   int
+	quotas        QuotaAdmitter
+
+	authn *auth.Authenticator
+	audit auth.AuditLog
+}
+
+// NewServer creates a new gRPC server reading statuses from statuses and
+// streaming results from hub with watchBuffer results buffered per watcher
+func NewServer(statuses StatusReader, hub *results.Hub, watchBuffer int) *Server {
+	return &Server{
+		statuses:    statuses,
+		hub:         hub,
+		watchBuffer: watchBuffer,
+	}
+}
+
+// SetPublisher enables Send
+func (s *Server) SetPublisher(publisher Publisher) {
+	s.publisher = publisher
+}
+
+// SetBatchPublisher enables SendBatch for up to maxItems notifications per call
+func (s *Server) SetBatchPublisher(publisher BatchPublisher, maxItems int) {
+	s.batches = publisher
+	s.maxBatchItems = maxItems
+}
+
+// SetQuota enforces tenant quotas on submissions
+func (s *Server) SetQuota(quotas QuotaAdmitter) {
+	s.quotas = quotas
+}
+
+// SetAuth requires API keys and records changes in the audit log; without
+// it every call is accepted for the tenant in its x-tenant-id metadata
+func (s *Server) SetAuth(authn *auth.Authenticator, audit auth.AuditLog) {
+	s.authn = authn
+	s.audit = audit
+}
+
+// NewGRPCServer returns a grpc.Server serving s with authentication
+func (s *Server) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	)
+	gs := grpc.NewServer(opts...)
+	notificationpb.RegisterNotificationServiceServer(gs, s)
+	return gs
+}
+
+// admit rejects submissions over the tenant's quota
+func (s *Server) admit(ctx context.Context, tenantID string, n int64) error {
+	if s.quotas == nil {
+		return nil
+	}
+	decision, err := s.quotas.Admit(ctx, tenantID, n)
+	if err != nil {
+		return status.Errorf(codes.Internal, "error checking quota: %v", err)
+	}
+	if !decision.Allowed {
+		return status.Errorf(codes.ResourceExhausted, "quota of tenant %s exceeded, retry after %ds",
+			tenantID, int(math.Ceil(decision.RetryAfter.Seconds())))
+	}
+	return nil
+}
+
+// Send publishes a single notification
+func (s *Server) Send(ctx context.Context, req *notificationpb.SendRequest) (*notificationpb.SendResponse, error) {
+	if s.publisher == nil {
+		return nil, status.Error(codes.Unavailable, "kafka producer not available")
+	}
+	if req.GetNotification() == nil {
+		return nil, status.Error(codes.InvalidArgument, "notification is required")
+	}
+
+	notification := toMessage(req.GetNotification())
+	if err := ingest.Prepare(notification, fmt.Sprintf("grpc_%d", time.Now().UnixNano())); err != nil {
+		return nil, invalidArgument(err)
+	}
+	if err := ingest.BindTenant(ctx, notification); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if err := s.admit(ctx, notification.Tenant(), 1); err != nil {
+		return nil, err
+	}
+
+	if err := s.publisher.Send(notification); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to send notification: %v", err)
+	}
+	auth.Annotate(ctx, "notification_id", notification.ID)
+	auth.Annotate(ctx, "user_id", notification.UserID)
+
+	return &notificationpb.SendResponse{
+		NotificationId: notification.ID,
+		UserId:         notification.UserID,
+	}, nil
+}
+
+// invalidArgument converts a rejected notification into an InvalidArgument
+// status, attaching the invalid fields as BadRequest details
+func invalidArgument(err error) error {
+	st := status.New(codes.InvalidArgument, err.Error())
+	var invalid *validation.Error
+	if !errors.As(err, &invalid) {
+		return st.Err()
+	}
+
+	violations := make([]*errdetails.BadRequest_FieldViolation, len(invalid.Fields))
+	for i, field := range invalid.Fields {
+		violations[i] = &errdetails.BadRequest_FieldViolation{
+			Field:       field.Field,
+			Description: field.Message,
+			Reason:      strings.ToUpper(field.Code),
+		}
+	}
+	detailed, detailErr := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if detailErr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// SendBatch reads the whole stream, then validates and publishes it like
+// POST /send/batch
+func (s *Server) SendBatch(stream notificationpb.NotificationService_SendBatchServer) error {
+	if s.batches == nil {
+		return status.Error(codes.Unavailable, "kafka batch producer not available")
+	}
+	ctx := stream.Context()
+
+	var items []ingest.Item
+	for {
+		n, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(items) == s.maxBatchItems {
+			return status.Errorf(codes.InvalidArgument, "batch exceeds %d notifications", s.maxBatchItems)
+		}
+		items = append(items, ingest.Item{Notification: toMessage(n)})
+	}
+
+	batchID := fmt.Sprintf("batch_%d", time.Now().UnixNano())
+	batch := ingest.NewBatch(ctx, items, batchID)
+	if len(batch.Valid) > 0 {
+		if err := s.admit(ctx, batch.Valid[0].Tenant(), int64(len(batch.Valid))); err != nil {
+			return err
+		}
+		batch.Published(s.batches.SendAll(batch.Valid))
+	}
+
+	accepted := batch.Accepted()
+	auth.Annotate(ctx, "batch_id", batchID)
+	auth.Annotate(ctx, "accepted", fmt.Sprint(accepted))
+
+	response := &notificationpb.SendBatchResponse{
+		Accepted: int32(accepted),
+		Rejected: int32(len(batch.Results) - accepted),
+		Results:  make([]*notificationpb.BatchItemResult, len(batch.Results)),
+	}
+	for i, result := range batch.Results {
+		response.Results[i] = &notificationpb.BatchItemResult{
+			Index:          int32(result.Index),
+			NotificationId: result.NotificationID,
+			Status:         result.Status,
+			Error:          result.Error,
+		}
+	}
+	return stream.SendAndClose(response)
+}
+
+// GetStatus returns the latest delivery status of a notification
+func (s *Server) GetStatus(ctx context.Context, req *notificationpb.GetStatusRequest) (*notificationpb.DeliveryStatus, error) {
+	if req.GetNotificationId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "notification_id is required")
+	}
+
+	deliveryStatus, err := s.statuses.Get(ctx, req.GetNotificationId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "error getting status: %v", err)
+	}
+	if deliveryStatus == nil {
+		return nil, status.Error(codes.NotFound, "notification not found")
+	}
+	return statusToProto(deliveryStatus), nil
+}
+
+// WatchResults streams matching results until the client goes away. Keys of
+// a single tenant only see their own tenant's results.
+func (s *Server) WatchResults(req *notificationpb.WatchResultsRequest, stream notificationpb.NotificationService_WatchResultsServer) error {
+	ctx := stream.Context()
+
+	filter := results.Filter{
+		TenantID: req.GetTenantId(),
+		UserID:   req.GetUserId(),
+		Provider: req.GetProvider(),
+		Outcome:  pkg.Outcome(req.GetOutcome()),
+	}
+	tenantID, err := auth.ResolveTenant(auth.KeyFromContext(ctx), filter.TenantID)
+	if err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	filter.TenantID = tenantID
+
+	sub := s.hub.Subscribe(filter, s.watchBuffer)
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case result, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(resultToProto(result)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toMessage converts a submitted notification, giving it normal priority
+// unless it sets one
+func toMessage(n *notificationpb.Notification) *pkg.NotificationMessage {
+	notification := n.ToMessage()
+	if n.Priority == nil {
+		notification.Priority = pkg.PriorityNormal
+	}
+	return notification
+}
@@ -0,0 +1,363 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/quota"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/results"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg/notificationpb"
+)
+
+// keyStore is an in-memory auth.Store
+type keyStore struct {
+	mu   sync.Mutex
+	keys map[string]auth.APIKey
+}
+
+func (ks *keyStore) Save(ctx context.Context, key *auth.APIKey) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys[key.ID] = *key
+	return nil
+}
+
+func (ks *keyStore) Get(ctx context.Context, id string) (*auth.APIKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key, ok := ks.keys[id]
+	if !ok {
+		return nil, auth.ErrNotFound
+	}
+	return &key, nil
+}
+
+func (ks *keyStore) GetByHash(ctx context.Context, hash string) (*auth.APIKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for _, key := range ks.keys {
+		if key.Hash == hash {
+			return &key, nil
+		}
+	}
+	return nil, auth.ErrNotFound
+}
+
+func (ks *keyStore) List(ctx context.Context, tenantID string) ([]*auth.APIKey, error) {
+	return nil, nil
+}
+
+// auditLog collects audit entries
+type auditLog struct {
+	mu      sync.Mutex
+	entries []*auth.AuditEntry
+}
+
+func (al *auditLog) Record(ctx context.Context, entry *auth.AuditEntry) error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.entries = append(al.entries, entry)
+	return nil
+}
+
+// publisher records published notifications
+type publisher struct {
+	mu            sync.Mutex
+	notifications []*pkg.NotificationMessage
+}
+
+func (p *publisher) Send(notification *pkg.NotificationMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.notifications = append(p.notifications, notification)
+	return nil
+}
+
+func (p *publisher) SendAll(notifications []*pkg.NotificationMessage) []error {
+	for _, notification := range notifications {
+		p.Send(notification)
+	}
+	return make([]error, len(notifications))
+}
+
+// statusReader serves statuses keyed by tenant and message ID
+type statusReader map[string]*pkg.DeliveryStatus
+
+func (sr statusReader) Get(ctx context.Context, messageID string) (*pkg.DeliveryStatus, error) {
+	return sr[tenant.ContextKey(ctx, messageID)], nil
+}
+
+// quotaLimit admits up to limit notifications in total
+type quotaLimit struct {
+	limit int64
+	used  int64
+}
+
+func (q *quotaLimit) Admit(ctx context.Context, tenantID string, n int64) (quota.Decision, error) {
+	if q.used+n > q.limit {
+		return quota.Decision{RetryAfter: time.Second}, nil
+	}
+	q.used += n
+	return quota.Decision{Allowed: true}, nil
+}
+
+type testEnv struct {
+	client    notificationpb.NotificationServiceClient
+	published *publisher
+	audit     *auditLog
+	hub       *results.Hub
+	keys      map[string]string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	authn := auth.NewAuthenticator(&keyStore{keys: make(map[string]auth.APIKey)})
+	keys := make(map[string]string)
+	for name, spec := range map[string]struct {
+		tenant string
+		scope  auth.Scope
+	}{
+		"acme-sender": {"acme", auth.ScopeSend},
+		"acme-reader": {"acme", auth.ScopeReadStatus},
+		"globex":      {"globex", auth.ScopeAdmin},
+	} {
+		plaintext, _, err := authn.Create(context.Background(), name, spec.tenant, []auth.Scope{spec.scope})
+		if err != nil {
+			t.Fatalf("failed to create key: %v", err)
+		}
+		keys[name] = plaintext
+	}
+
+	env := &testEnv{
+		published: &publisher{},
+		audit:     &auditLog{},
+		hub:       results.NewHub(),
+		keys:      keys,
+	}
+	statuses := statusReader{
+		tenant.Key("acme", "n1"): {
+			MessageID: "n1",
+			UserID:    "user-1",
+			Channels:  map[pkg.Channel]pkg.ChannelStatus{pkg.ChannelPush: {Outcome: pkg.OutcomeDelivered, Attempts: 1}},
+		},
+	}
+
+	server := NewServer(statuses, env.hub, 16)
+	server.SetPublisher(env.published)
+	server.SetBatchPublisher(env.published, 3)
+	server.SetQuota(&quotaLimit{limit: 5})
+	server.SetAuth(authn, env.audit)
+
+	listener := bufconn.Listen(1 << 20)
+	gs := server.NewGRPCServer()
+	go gs.Serve(listener)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	env.client = notificationpb.NewNotificationServiceClient(conn)
+	return env
+}
+
+// as returns a context authenticating with the named key
+func (env *testEnv) as(name string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+env.keys[name])
+}
+
+func TestSendAuthentication(t *testing.T) {
+	env := newTestEnv(t)
+	req := &notificationpb.SendRequest{Notification: &notificationpb.Notification{UserId: "user-1", Title: "hi"}}
+
+	if _, err := env.client.Send(context.Background(), req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated without a key, got %v", err)
+	}
+	if _, err := env.client.Send(env.as("acme-reader"), req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied without the send scope, got %v", err)
+	}
+
+	resp, err := env.client.Send(env.as("acme-sender"), req)
+	if err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if resp.GetNotificationId() == "" {
+		t.Errorf("expected a generated notification ID")
+	}
+	if len(env.published.notifications) != 1 || env.published.notifications[0].TenantID != "acme" {
+		t.Fatalf("expected notification to be published for acme, got %+v", env.published.notifications)
+	}
+	if env.published.notifications[0].Priority != pkg.PriorityNormal {
+		t.Errorf("expected defaults to be applied")
+	}
+
+	env.audit.mu.Lock()
+	defer env.audit.mu.Unlock()
+	if len(env.audit.entries) != 1 || env.audit.entries[0].Details["notification_id"] != resp.GetNotificationId() {
+		t.Errorf("expected the send to be audited, got %+v", env.audit.entries)
+	}
+}
+
+func TestSendExplicitLowPriority(t *testing.T) {
+	env := newTestEnv(t)
+	req := &notificationpb.SendRequest{Notification: &notificationpb.Notification{UserId: "user-1", Title: "hi", Priority: proto.Int32(0)}}
+	if _, err := env.client.Send(env.as("acme-sender"), req); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if len(env.published.notifications) != 1 || env.published.notifications[0].Priority != pkg.PriorityLow {
+		t.Errorf("expected the explicit low priority to be kept, got %+v", env.published.notifications)
+	}
+}
+
+func TestSendValidation(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.as("acme-sender")
+
+	invalid := &notificationpb.Notification{UserId: "user-1", Channels: []string{"pigeon"}}
+	_, err := env.client.Send(ctx, &notificationpb.SendRequest{Notification: invalid})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for unknown channel, got %v", err)
+	}
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, detail := range status.Convert(err).Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			violations = badRequest.GetFieldViolations()
+		}
+	}
+	if len(violations) != 1 || violations[0].GetField() != "channels[0]" || violations[0].GetReason() != "INVALID" {
+		t.Errorf("expected a field violation for the channel, got %v", violations)
+	}
+
+	otherTenant := &notificationpb.Notification{UserId: "user-1", TenantId: "globex"}
+	if _, err := env.client.Send(ctx, &notificationpb.SendRequest{Notification: otherTenant}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied for another tenant, got %v", err)
+	}
+}
+
+func TestSendBatch(t *testing.T) {
+	env := newTestEnv(t)
+
+	stream, err := env.client.SendBatch(env.as("acme-sender"))
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	for _, n := range []*notificationpb.Notification{
+		{UserId: "user-1"},
+		{UserId: "user-2", CollapseMode: "sometimes"},
+		{UserId: "user-3"},
+	} {
+		if err := stream.Send(n); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("batch failed: %v", err)
+	}
+
+	if resp.GetAccepted() != 2 || resp.GetRejected() != 1 {
+		t.Errorf("expected 2 accepted and 1 rejected, got %d and %d", resp.GetAccepted(), resp.GetRejected())
+	}
+	if resp.GetResults()[1].GetStatus() != "rejected" || resp.GetResults()[1].GetError() == "" {
+		t.Errorf("expected second item to be rejected with an error, got %+v", resp.GetResults()[1])
+	}
+
+	// Batches over the item limit are refused as a whole
+	stream, _ = env.client.SendBatch(env.as("acme-sender"))
+	for i := 0; i < 4; i++ {
+		stream.Send(&notificationpb.Notification{UserId: "user-1"})
+	}
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for an oversized batch, got %v", err)
+	}
+}
+
+func TestSendQuota(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.as("acme-sender")
+	req := &notificationpb.SendRequest{Notification: &notificationpb.Notification{UserId: "user-1"}}
+
+	for i := 0; i < 5; i++ {
+		if _, err := env.client.Send(ctx, req); err != nil {
+			t.Fatalf("send %d failed: %v", i, err)
+		}
+	}
+	if _, err := env.client.Send(ctx, req); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted over quota, got %v", err)
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp, err := env.client.GetStatus(env.as("acme-reader"), &notificationpb.GetStatusRequest{NotificationId: "n1"})
+	if err != nil {
+		t.Fatalf("get status failed: %v", err)
+	}
+	if resp.GetChannels()["push"].GetOutcome() != string(pkg.OutcomeDelivered) {
+		t.Errorf("expected delivered push status, got %+v", resp)
+	}
+
+	// Statuses are scoped to the key's tenant
+	_, err = env.client.GetStatus(env.as("globex"), &notificationpb.GetStatusRequest{NotificationId: "n1"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for another tenant, got %v", err)
+	}
+}
+
+func TestWatchResults(t *testing.T) {
+	env := newTestEnv(t)
+	ctx, cancel := context.WithCancel(env.as("acme-reader"))
+	defer cancel()
+
+	if stream, err := env.client.WatchResults(ctx, &notificationpb.WatchResultsRequest{TenantId: "globex"}); err == nil {
+		if _, err := stream.Recv(); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("expected PermissionDenied watching another tenant, got %v", err)
+		}
+	}
+
+	stream, err := env.client.WatchResults(ctx, &notificationpb.WatchResultsRequest{Outcome: string(pkg.OutcomeDelivered)})
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+
+	// Publish once the subscription is registered
+	deadline := time.Now().Add(2 * time.Second)
+	for env.hub.Subscribers() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	env.hub.Publish(&pkg.ProcessingResult{MessageID: "other", TenantID: "globex", Outcome: pkg.OutcomeDelivered})
+	env.hub.Publish(&pkg.ProcessingResult{MessageID: "failed", TenantID: "acme", Outcome: pkg.OutcomeFailed})
+	env.hub.Publish(&pkg.ProcessingResult{MessageID: "n1", TenantID: "acme", Outcome: pkg.OutcomeDelivered, Provider: "fcm"})
+
+	result, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if result.GetMessageId() != "n1" || result.GetProvider() != "fcm" {
+		t.Errorf("expected only acme's delivered result, got %+v", result)
+	}
+}
@@ -0,0 +1,149 @@
+package inbox
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// ErrNotFound is returned for items that are not in the user's inbox
+var ErrNotFound = errors.New("inbox item not found")
+
+// State is the read state of an inbox item
+type State string
+
+const (
+	StateUnread   State = "unread"
+	StateRead     State = "read"
+	StateArchived State = "archived"
+)
+
+// ParseState parses a list filter; empty selects the unarchived items
+func ParseState(s string) (State, error) {
+	switch State(s) {
+	case "", StateUnread, StateArchived:
+		return State(s), nil
+	default:
+		return "", fmt.Errorf("unknown inbox state: %s", s)
+	}
+}
+
+// Item is a notification kept in a user's inbox. Its ID is the ID of the
+// notification.
+type Item struct {
+	ID        string                 `json:"id"`
+	UserID    string                 `json:"user_id"`
+	Type      string                 `json:"type,omitempty"`
+	Title     string                 `json:"title"`
+	Body      string                 `json:"body"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	State     State                  `json:"state"`
+	CreatedAt time.Time              `json:"created_at"`
+	ReadAt    *time.Time             `json:"read_at,omitempty"`
+}
+
+// NewItem returns the unread inbox item of a notification
+func NewItem(n *pkg.NotificationMessage) *Item {
+	createdAt := n.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	return &Item{
+		ID:        n.ID,
+		UserID:    n.UserID,
+		Type:      n.Type,
+		Title:     n.Title,
+		Body:      n.Body,
+		Data:      n.Data,
+		State:     StateUnread,
+		CreatedAt: createdAt.UTC(),
+	}
+}
+
+// Query selects a page of a user's inbox, newest first. Cursor is the
+// NextCursor of the previous page.
+type Query struct {
+	State  State
+	Cursor string
+	Limit  int
+}
+
+// Page is a page of inbox items; NextCursor is empty on the last page
+type Page struct {
+	Items      []*Item `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// Store persists the inbox of each user of the context's tenant. Add keeps
+// an existing item untouched so redelivered notifications are stored once.
+type Store interface {
+	Add(ctx context.Context, item *Item) (int64, error)
+	List(ctx context.Context, userID string, query Query) (*Page, error)
+	MarkRead(ctx context.Context, userID, id string) error
+	MarkAllRead(ctx context.Context, userID string) (int64, error)
+	Archive(ctx context.Context, userID, id string) error
+	UnreadCount(ctx context.Context, userID string) (int64, error)
+}
+
+// Inbox stores the notifications handed to the providers in the users'
+// inboxes, optionally only those of some types
+type Inbox struct {
+	store Store
+	types map[string]bool
+}
+
+// NewInbox creates an inbox keeping notifications of the given types, or of
+// every type when none are given
+func NewInbox(store Store, types []string) *Inbox {
+	inbox := &Inbox{store: store}
+	if len(types) > 0 {
+		inbox.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			inbox.types[t] = true
+		}
+	}
+	return inbox
+}
+
+// Keeps reports whether the notification belongs in the inbox
+func (i *Inbox) Keeps(n *pkg.NotificationMessage) bool {
+	return i.types == nil || i.types[n.Type]
+}
+
+// Add stores the notification if the inbox keeps it and returns the user's
+// unread count, which becomes the notification's badge
+func (i *Inbox) Add(ctx context.Context, n *pkg.NotificationMessage) (int64, error) {
+	if !i.Keeps(n) {
+		return i.store.UnreadCount(ctx, n.UserID)
+	}
+	return i.store.Add(ctx, NewItem(n))
+}
+
+// EncodeCursor returns the cursor continuing after the item with the given
+// sort score
+func EncodeCursor(score int64, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(score, 10) + ":" + id))
+}
+
+// DecodeCursor parses a cursor returned by EncodeCursor
+func DecodeCursor(cursor string) (int64, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid cursor")
+	}
+	score, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return 0, "", fmt.Errorf("invalid cursor")
+	}
+	n, err := strconv.ParseInt(score, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid cursor")
+	}
+	return n, id, nil
+}
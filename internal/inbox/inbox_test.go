@@ -0,0 +1,81 @@
+package inbox
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// countingStore records added items and counts them all as unread
+type countingStore struct {
+	Store
+	items map[string]*Item
+}
+
+func (s *countingStore) Add(ctx context.Context, item *Item) (int64, error) {
+	if _, ok := s.items[item.ID]; !ok {
+		s.items[item.ID] = item
+	}
+	return int64(len(s.items)), nil
+}
+
+func (s *countingStore) UnreadCount(ctx context.Context, userID string) (int64, error) {
+	return int64(len(s.items)), nil
+}
+
+func TestInboxAdd(t *testing.T) {
+	store := &countingStore{items: make(map[string]*Item)}
+	inbox := NewInbox(store, []string{"message", "mention"})
+	ctx := context.Background()
+
+	unread, err := inbox.Add(ctx, &pkg.NotificationMessage{ID: "n1", UserID: "user1", Type: "message", Title: "Hi"})
+	if err != nil || unread != 1 {
+		t.Fatalf("expected 1 unread item, got %d (%v)", unread, err)
+	}
+	// Redelivery does not add the item twice
+	if unread, _ = inbox.Add(ctx, &pkg.NotificationMessage{ID: "n1", UserID: "user1", Type: "message"}); unread != 1 {
+		t.Errorf("expected redelivered notification to be stored once, got %d unread", unread)
+	}
+	// Other types are not kept but still get the unread count
+	if unread, _ = inbox.Add(ctx, &pkg.NotificationMessage{ID: "n2", UserID: "user1", Type: "marketing"}); unread != 1 {
+		t.Errorf("expected unread count 1, got %d", unread)
+	}
+	if _, ok := store.items["n2"]; ok {
+		t.Errorf("expected marketing notification not to be kept")
+	}
+
+	item := store.items["n1"]
+	if item.State != StateUnread || item.Title != "Hi" || item.CreatedAt.IsZero() {
+		t.Errorf("unexpected item %+v", item)
+	}
+
+	if !NewInbox(store, nil).Keeps(&pkg.NotificationMessage{Type: "marketing"}) {
+		t.Errorf("expected an inbox without types to keep every notification")
+	}
+}
+
+func TestParseState(t *testing.T) {
+	for _, s := range []string{"", "unread", "archived"} {
+		if _, err := ParseState(s); err != nil {
+			t.Errorf("expected %q to be valid: %v", s, err)
+		}
+	}
+	if _, err := ParseState("deleted"); err == nil {
+		t.Errorf("expected unknown state to be rejected")
+	}
+}
+
+func TestCursor(t *testing.T) {
+	cursor := EncodeCursor(1700000000123, "notif:42")
+	score, id, err := DecodeCursor(cursor)
+	if err != nil || score != 1700000000123 || id != "notif:42" {
+		t.Errorf("expected cursor to round trip, got %d %q %v", score, id, err)
+	}
+
+	for _, invalid := range []string{"not base64!", EncodeCursor(0, "")[:2], "bm9jb2xvbg"} {
+		if _, _, err := DecodeCursor(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
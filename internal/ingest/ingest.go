@@ -0,0 +1,234 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/validation"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// ErrTooManyItems is returned when a batch holds more items than allowed
+var ErrTooManyItems = errors.New("batch has too many items")
+
+// Prepare fills in the defaults of a submitted notification, using id if it
+// has none, and validates it. Invalid notifications fail with a
+// *validation.Error. The priority is defaulted when decoding, see Decode.
+func Prepare(notification *pkg.NotificationMessage, id string) error {
+	if notification.ID == "" {
+		notification.ID = id
+	}
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+	return validation.Validate(notification, time.Now())
+}
+
+// Decode decodes a submitted JSON notification, giving it normal priority
+// unless it sets one
+func Decode(data []byte) (*pkg.NotificationMessage, error) {
+	var notification pkg.NotificationMessage
+	if err := json.Unmarshal(data, &notification); err != nil {
+		return nil, err
+	}
+	DefaultPriority(&notification, data)
+	return &notification, nil
+}
+
+// DefaultPriority gives a notification decoded from data normal priority
+// unless data sets one. Low is the zero value, so an explicit 0 is told
+// apart from an omitted priority by the field's presence.
+func DefaultPriority(notification *pkg.NotificationMessage, data []byte) {
+	var fields struct {
+		Priority json.RawMessage `json:"priority"`
+	}
+	if json.Unmarshal(data, &fields) == nil && len(fields.Priority) > 0 && string(fields.Priority) != "null" {
+		return
+	}
+	notification.Priority = pkg.PriorityNormal
+}
+
+// BindTenant binds a notification to the tenant of ctx, rejecting
+// notifications that name another one
+func BindTenant(ctx context.Context, notification *pkg.NotificationMessage) error {
+	tenantID := tenant.FromContext(ctx)
+	if notification.TenantID != "" && notification.TenantID != tenantID {
+		return fmt.Errorf("api key cannot send for tenant %s", notification.TenantID)
+	}
+	notification.TenantID = tenantID
+	return nil
+}
+
+// Status values of batch items
+const (
+	StatusAccepted = "accepted"
+	StatusRejected = "rejected"
+)
+
+// Result reports whether one notification of a batch was accepted. Fields
+// lists the invalid fields of a notification rejected by validation.
+type Result struct {
+	Index          int                     `json:"index"`
+	NotificationID string                  `json:"notification_id,omitempty"`
+	Status         string                  `json:"status"`
+	Error          string                  `json:"error,omitempty"`
+	Fields         []validation.FieldError `json:"fields,omitempty"`
+}
+
+// Batch is a validated batch: a result for every item and the valid
+// notifications, which are accepted once they are published
+type Batch struct {
+	Results []Result
+	Valid   []*pkg.NotificationMessage
+
+	indexes []int
+}
+
+// NewBatch validates the items for the tenant of ctx. Notifications without
+// an ID are given idPrefix followed by their index.
+func NewBatch(ctx context.Context, items []Item, idPrefix string) *Batch {
+	batch := &Batch{
+		Results: make([]Result, len(items)),
+		Valid:   make([]*pkg.NotificationMessage, 0, len(items)),
+		indexes: make([]int, 0, len(items)),
+	}
+
+	for i, item := range items {
+		batch.Results[i] = Result{Index: i, Status: StatusRejected}
+		if item.Err != nil {
+			batch.Results[i].Error = item.Err.Error()
+			continue
+		}
+
+		notification := item.Notification
+		err := Prepare(notification, idPrefix+"_"+strconv.Itoa(i))
+		if err == nil {
+			err = BindTenant(ctx, notification)
+		}
+		batch.Results[i].NotificationID = notification.ID
+		if err != nil {
+			batch.Results[i].Error = err.Error()
+			var invalid *validation.Error
+			if errors.As(err, &invalid) {
+				batch.Results[i].Fields = invalid.Fields
+			}
+			continue
+		}
+
+		batch.Valid = append(batch.Valid, notification)
+		batch.indexes = append(batch.indexes, i)
+	}
+	return batch
+}
+
+// Published records the outcome of publishing Valid: errs holds the error of
+// each valid notification, nil when it was published
+func (b *Batch) Published(errs []error) {
+	for i, err := range errs {
+		result := &b.Results[b.indexes[i]]
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		result.Status = StatusAccepted
+	}
+}
+
+// Accepted returns the number of accepted notifications
+func (b *Batch) Accepted() int {
+	accepted := 0
+	for _, result := range b.Results {
+		if result.Status == StatusAccepted {
+			accepted++
+		}
+	}
+	return accepted
+}
+
+// Item is one entry of a batch: a decoded notification, or the error that
+// kept it from being decoded
+type Item struct {
+	Notification *pkg.NotificationMessage
+	Err          error
+}
+
+// DecodeBatch reads a JSON array of notifications, or newline delimited
+// JSON objects when ndjson is set, without buffering the whole body. An
+// entry that is not a valid notification becomes an Item with Err; a
+// malformed body fails the whole batch, as does exceeding maxItems.
+func DecodeBatch(body io.Reader, ndjson bool, maxItems int) ([]Item, error) {
+	if ndjson {
+		return decodeNDJSON(body, maxItems)
+	}
+	return decodeArray(body, maxItems)
+}
+
+func decodeArray(body io.Reader, maxItems int) ([]Item, error) {
+	dec := json.NewDecoder(body)
+	token, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("invalid JSON: expected an array of notifications")
+	}
+
+	var items []Item
+	for dec.More() {
+		if len(items) == maxItems {
+			return nil, ErrTooManyItems
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("invalid JSON at item %d: %w", len(items), err)
+		}
+		notification, err := Decode(raw)
+		if err != nil {
+			items = append(items, Item{Err: fmt.Errorf("invalid notification: %w", err)})
+			continue
+		}
+		items = append(items, Item{Notification: notification})
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return items, nil
+}
+
+func decodeNDJSON(body io.Reader, maxItems int) ([]Item, error) {
+	reader := bufio.NewReader(body)
+
+	var items []Item
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if len(items) == maxItems {
+				return nil, ErrTooManyItems
+			}
+
+			if notification, jsonErr := Decode(line); jsonErr != nil {
+				items = append(items, Item{Err: fmt.Errorf("invalid notification: %w", jsonErr)})
+			} else {
+				items = append(items, Item{Notification: notification})
+			}
+		}
+
+		if err == io.EOF {
+			return items, nil
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package ingest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+func TestPrepare(t *testing.T) {
+	notification := &pkg.NotificationMessage{UserID: "user-1"}
+	if err := Prepare(notification, "generated"); err != nil {
+		t.Fatalf("expected notification to be valid, got %v", err)
+	}
+	if notification.ID != "generated" || notification.CreatedAt.IsZero() {
+		t.Errorf("expected defaults to be filled in, got %+v", notification)
+	}
+
+	invalid := &pkg.NotificationMessage{UserID: "user-1", Channels: []pkg.Channel{"pigeon"}}
+	if err := Prepare(invalid, "generated"); err == nil {
+		t.Errorf("expected unknown channel to be rejected")
+	}
+}
+
+func TestDecodePriority(t *testing.T) {
+	for body, want := range map[string]pkg.Priority{
+		`{"user_id": "a"}`:                   pkg.PriorityNormal,
+		`{"user_id": "a", "priority": null}`: pkg.PriorityNormal,
+		`{"user_id": "a", "priority": 0}`:    pkg.PriorityLow,
+		`{"user_id": "a", "priority": 3}`:    pkg.PriorityUrgent,
+	} {
+		notification, err := Decode([]byte(body))
+		if err != nil {
+			t.Fatalf("decode of %s failed: %v", body, err)
+		}
+		if notification.Priority != want {
+			t.Errorf("expected %s to have priority %v, got %v", body, want, notification.Priority)
+		}
+	}
+
+	// Batches keep an explicit low priority too
+	items, err := DecodeBatch(strings.NewReader(`[{"user_id": "a", "priority": 0}, {"user_id": "b"}]`), false, 10)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if items[0].Notification.Priority != pkg.PriorityLow || items[1].Notification.Priority != pkg.PriorityNormal {
+		t.Errorf("expected low and normal priority, got %v and %v", items[0].Notification.Priority, items[1].Notification.Priority)
+	}
+}
+
+func TestDecodeBatchArray(t *testing.T) {
+	body := `[{"user_id": "a"}, {"user_id": 42}, {"user_id": "c"}]`
+	items, err := DecodeBatch(strings.NewReader(body), false, 10)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(items))
+	}
+	if items[0].Err != nil || items[0].Notification.UserID != "a" {
+		t.Errorf("expected first item to decode, got %+v", items[0])
+	}
+	if items[1].Err == nil {
+		t.Errorf("expected second item to be rejected")
+	}
+	if items[2].Err != nil || items[2].Notification.UserID != "c" {
+		t.Errorf("expected decoding to go on after a bad item, got %+v", items[2])
+	}
+
+	if _, err := DecodeBatch(strings.NewReader(`{"user_id": "a"}`), false, 10); err == nil {
+		t.Errorf("expected a single object to be rejected")
+	}
+	if _, err := DecodeBatch(strings.NewReader(`[{"user_id": "a"},`), false, 10); err == nil {
+		t.Errorf("expected a truncated array to be rejected")
+	}
+}
+
+func TestDecodeBatchNDJSON(t *testing.T) {
+	body := "{\"user_id\": \"a\"}\n\nnot json\n{\"user_id\": \"c\"}"
+	items, err := DecodeBatch(strings.NewReader(body), true, 10)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("expected blank lines to be skipped and 3 items, got %d", len(items))
+	}
+	if items[1].Err == nil {
+		t.Errorf("expected malformed line to be rejected")
+	}
+	if items[2].Notification == nil || items[2].Notification.UserID != "c" {
+		t.Errorf("expected last line without newline to decode, got %+v", items[2])
+	}
+}
+
+func TestDecodeBatchMaxItems(t *testing.T) {
+	array := `[{"user_id": "a"}, {"user_id": "b"}, {"user_id": "c"}]`
+	if _, err := DecodeBatch(strings.NewReader(array), false, 2); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("expected ErrTooManyItems for array, got %v", err)
+	}
+
+	ndjson := "{\"user_id\": \"a\"}\n{\"user_id\": \"b\"}\n{\"user_id\": \"c\"}\n"
+	if _, err := DecodeBatch(strings.NewReader(ndjson), true, 2); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("expected ErrTooManyItems for ndjson, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package kafka
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/codec"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// AsyncProducer publishes notifications through a batching producer: sarama
+// collects messages for up to flushFrequency or flushMessages before sending
+// them, so large submissions need far fewer round trips than Producer
+type AsyncProducer struct {
+	producer sarama.AsyncProducer
+	encoder
+	wg sync.WaitGroup
+}
+
+// delivery tracks one message of a SendAll call
+type delivery struct {
+	index int
+	acks  chan<- ack
+}
+
+type ack struct {
+	index int
+	err   error
+}
+
+// NewAsyncProducer creates a new batching Kafka producer compressing message
+// batches with the given codec
+func NewAsyncProducer(brokers []string, topic string, compression sarama.CompressionCodec, flushFrequency time.Duration, flushMessages int) (*AsyncProducer, error) {
+	config := sarama.NewConfig()
+	config.Producer.Compression = compression
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 3
+	config.Producer.Flush.Frequency = flushFrequency
+	config.Producer.Flush.Messages = flushMessages
+
+	producer, err := sarama.NewAsyncProducer(brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create async producer: %w", err)
+	}
+
+	ap := &AsyncProducer{
+		producer: producer,
+		encoder:  encoder{topic: topic, codec: codec.JSON{}},
+	}
+
+	// Route every acknowledgement back to the call that produced it
+	ap.wg.Add(2)
+	go func() {
+		defer ap.wg.Done()
+		for msg := range producer.Successes() {
+			d := msg.Metadata.(*delivery)
+			d.acks <- ack{index: d.index}
+		}
+	}()
+	go func() {
+		defer ap.wg.Done()
+		for perr := range producer.Errors() {
+			d := perr.Msg.Metadata.(*delivery)
+			d.acks <- ack{index: d.index, err: perr.Err}
+		}
+	}()
+
+	return ap, nil
+}
+
+// SetCodec sets the wire format notifications are sent in, JSON by default.
+// Must be called before SendAll.
+func (ap *AsyncProducer) SetCodec(c codec.Codec) {
+	ap.codec = c
+}
+
+// SetOffloader moves values over the offloader's threshold to its blob
+// store. Must be called before SendAll.
+func (ap *AsyncProducer) SetOffloader(offloader *Offloader) {
+	ap.offloader = offloader
+}
+
+// SendAll publishes the notifications and waits until each was acknowledged.
+// The returned slice holds the error of each notification, nil when it was
+// published.
+func (ap *AsyncProducer) SendAll(notifications []*pkg.NotificationMessage) []error {
+	errs := make([]error, len(notifications))
+	acks := make(chan ack, len(notifications))
+
+	pending := 0
+	for i, notification := range notifications {
+		message, err := ap.message(notification)
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to encode notification: %w", err)
+			continue
+		}
+
+		message.Metadata = &delivery{index: i, acks: acks}
+		ap.producer.Input() <- message
+		pending++
+	}
+
+	for ; pending > 0; pending-- {
+		a := <-acks
+		if a.err != nil {
+			errs[a.index] = fmt.Errorf("failed to send message: %w", a.err)
+		}
+	}
+	return errs
+}
+
+// Close flushes buffered messages and closes the producer
+func (ap *AsyncProducer) Close() error {
+	ap.producer.AsyncClose()
+	ap.wg.Wait()
+	return nil
+}
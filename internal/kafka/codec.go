@@ -0,0 +1,89 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/IBM/sarama"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/codec"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// encoder turns notifications into messages for a topic
+type encoder struct {
+	topic     string
+	codec     codec.Codec
+	offloader *Offloader
+}
+
+// message encodes a notification, naming the codec in the content type
+// header and offloading large values. Messages are keyed by user so each
+// user's notifications stay in order.
+func (e *encoder) message(notification *pkg.NotificationMessage) (*sarama.ProducerMessage, error) {
+	value, err := e.codec.Encode(e.topic, notification)
+	if err != nil {
+		return nil, err
+	}
+	message := &sarama.ProducerMessage{
+		Topic: e.topic,
+		Key:   sarama.StringEncoder(notification.UserID),
+		Value: sarama.ByteEncoder(value),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(codec.HeaderContentType), Value: []byte(e.codec.ContentType())},
+		},
+	}
+	if e.offloader != nil {
+		if err := e.offloader.offload(message, value); err != nil {
+			return nil, err
+		}
+	}
+	return message, nil
+}
+
+// decodeMessage decodes a consumed message with the codec named by its
+// content type header, fetching offloaded values first, and tags it with
+// its topic. Notifications that leave out their priority get the default
+// priority of the topic, if it has one.
+func decodeMessage(ctx context.Context, codecs *codec.Codecs, offloader *Offloader, priorities map[string]pkg.Priority, message *sarama.ConsumerMessage) (*pkg.NotificationMessage, error) {
+	c, err := codecs.Lookup(header(message, codec.HeaderContentType))
+	if err != nil {
+		return nil, err
+	}
+	value, err := offloader.resolve(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	notification, err := c.Decode(message.Topic, value)
+	if err != nil {
+		return nil, err
+	}
+	notification.Source = message.Topic
+	if priority, ok := priorities[message.Topic]; ok && !prioritySet(c, value, notification) {
+		notification.Priority = priority
+	}
+	return notification, nil
+}
+
+// prioritySet reports whether a message's value sets the notification's
+// priority. JSON tells by the presence of the field; in the other formats
+// low, the zero value, cannot be told apart from unset.
+func prioritySet(c codec.Codec, value []byte, notification *pkg.NotificationMessage) bool {
+	if c.ContentType() == codec.ContentTypeJSON {
+		var fields struct {
+			Priority json.RawMessage `json:"priority"`
+		}
+		return json.Unmarshal(value, &fields) == nil && len(fields.Priority) > 0 && string(fields.Priority) != "null"
+	}
+	return notification.Priority != pkg.PriorityLow
+}
+
+// header returns the value of a header of a consumed message
+func header(message *sarama.ConsumerMessage, key string) string {
+	for _, h := range message.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
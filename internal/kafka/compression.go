@@ -0,0 +1,17 @@
+package kafka
+
+import (
+	"fmt"
+
+	"github.com/IBM/sarama"
+)
+
+// ParseCompression returns the compression codec with a name: none, gzip,
+// snappy, lz4 or zstd. Consumers decompress every codec on their own.
+func ParseCompression(name string) (sarama.CompressionCodec, error) {
+	var compression sarama.CompressionCodec
+	if err := compression.UnmarshalText([]byte(name)); err != nil {
+		return sarama.CompressionNone, fmt.Errorf("unknown compression codec %q", name)
+	}
+	return compression, nil
+}
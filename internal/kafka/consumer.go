@@ -2,12 +2,13 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/codec"
 	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
 )
 
@@ -25,6 +26,12 @@ type Consumer struct {
 type ConsumerGroupHandler struct {
 	messageChan chan *pkg.NotificationMessage
 	errorChan   chan error
+	codecs      *codec.Codecs
+	offloader   *Offloader
+	priorities  map[string]pkg.Priority
+	retryWaits  map[string]time.Duration
+	validate    func(*pkg.NotificationMessage) error
+	deadLetter  DeadLetterer
 }
 
 // NewConsumer creates a new Kafka consumer
@@ -45,6 +52,7 @@ func NewConsumer(brokers []string, groupID string, topics []string, messageChan
 	handler := &ConsumerGroupHandler{
 		messageChan: messageChan,
 		errorChan:   errorChan,
+		codecs:      codec.NewCodecs(codec.JSON{}),
 	}
 
 	return &Consumer{
@@ -56,6 +64,47 @@ func NewConsumer(brokers []string, groupID string, topics []string, messageChan
 	}, nil
 }
 
+// SetCodecs sets the wire formats messages are read in, chosen by their
+// content type header; by default only JSON is read. Must be called before
+// Start.
+func (c *Consumer) SetCodecs(codecs *codec.Codecs) {
+	c.handler.codecs = codecs
+}
+
+// SetOffloader resolves messages whose values were offloaded to a blob
+// store. Must be called before Start.
+func (c *Consumer) SetOffloader(offloader *Offloader) {
+	c.handler.offloader = offloader
+}
+
+// SetDefaultPriorities gives notifications consumed from a topic without a
+// priority the topic's default. Must be called before Start.
+func (c *Consumer) SetDefaultPriorities(priorities map[string]pkg.Priority) {
+	c.handler.priorities = priorities
+}
+
+// SetRetryTiers marks the retry topics among the consumed ones. Only their
+// messages are read as retries, held until due but no longer than up to
+// the next tier's delay, or maxDelay after the last tier's; the retry
+// headers of messages on other topics are ignored. Must be called before
+// Start.
+func (c *Consumer) SetRetryTiers(tiers []RetryTier, maxDelay time.Duration) {
+	c.handler.retryWaits = retryWaits(tiers, maxDelay)
+}
+
+// SetValidator checks every consumed notification before it is processed.
+// Must be called before Start.
+func (c *Consumer) SetValidator(validate func(*pkg.NotificationMessage) error) {
+	c.handler.validate = validate
+}
+
+// SetDeadLetter routes messages that cannot be decoded or fail validation
+// to a dead letter queue instead of only reporting them. Must be called
+// before Start.
+func (c *Consumer) SetDeadLetter(deadLetter DeadLetterer) {
+	c.handler.deadLetter = deadLetter
+}
+
 // Start starts consuming messages from Kafka
 func (c *Consumer) Start() error {
 	c.wg.Add(1)
@@ -120,20 +169,42 @@ func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession,
 				return nil
 			}
 
-			// Parse the notification message
-			var notification pkg.NotificationMessage
-			if err := json.Unmarshal(message.Value, &notification); err != nil {
+			// Decode and validate the notification message
+			var due time.Time
+			notification, err := decodeMessage(session.Context(), h.codecs, h.offloader, h.priorities, message)
+			longest, retried := h.retryWaits[message.Topic]
+			if err == nil && retried {
+				due, err = retryState(message, notification)
+			}
+			if err != nil {
+				err = fmt.Errorf("failed to decode message at %s/%d/%d: %w", message.Topic, message.Partition, message.Offset, err)
+			} else if h.validate != nil {
+				if err = h.validate(notification); err != nil {
+					err = fmt.Errorf("invalid message at %s/%d/%d: %w", message.Topic, message.Partition, message.Offset, err)
+				}
+			}
+			if err != nil {
+				if !h.reject(session, message, err) {
+					return nil
+				}
+				continue
+			}
+
+			// Retries wait for their due time; a retry topic holds delays
+			// from its own up to the next tier's, so the messages behind
+			// are not held much past theirs. A due time past the tier's
+			// longest delay cannot come from the service and is cut short.
+			if wait := min(time.Until(due), longest); wait > 0 {
 				select {
-				case h.errorChan <- fmt.Errorf("failed to unmarshal message: %w", err):
+				case <-time.After(wait):
 				case <-session.Context().Done():
 					return nil
 				}
-				continue
 			}
 
 			// Send to message channel for processing
 			select {
-			case h.messageChan <- &notification:
+			case h.messageChan <- notification:
 				// Mark message as processed
 				session.MarkMessage(message, "")
 			case <-session.Context().Done():
@@ -146,15 +217,37 @@ func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession,
 	}
 }
 
+// reject reports a message that cannot be processed, moving it to the dead
+// letter queue if there is one. It returns false once the session is over.
+func (h *ConsumerGroupHandler) reject(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage, err error) bool {
+	if h.deadLetter != nil {
+		if dlqErr := h.deadLetter.DeadLetter(message, err); dlqErr != nil {
+			err = fmt.Errorf("%v; dead lettering failed: %w", err, dlqErr)
+		} else {
+			session.MarkMessage(message, "")
+			err = fmt.Errorf("%w; moved to dead letter queue", err)
+		}
+	}
+
+	select {
+	case h.errorChan <- err:
+		return true
+	case <-session.Context().Done():
+		return false
+	}
+}
+
 // Producer represents a Kafka producer for testing purposes
 type Producer struct {
 	producer sarama.SyncProducer
-	topic    string
+	encoder
 }
 
-// NewProducer creates a new Kafka producer
-func NewProducer(brokers []string, topic string) (*Producer, error) {
+// NewProducer creates a new Kafka producer compressing message batches with
+// the given codec
+func NewProducer(brokers []string, topic string, compression sarama.CompressionCodec) (*Producer, error) {
 	config := sarama.NewConfig()
+	config.Producer.Compression = compression
 	config.Producer.Return.Successes = true
 	config.Producer.RequiredAcks = sarama.WaitForAll
 	config.Producer.Retry.Max = 3
@@ -166,21 +259,25 @@ func NewProducer(brokers []string, topic string) (*Producer, error) {
 
 	return &Producer{
 		producer: producer,
-		topic:    topic,
+		encoder:  encoder{topic: topic, codec: codec.JSON{}},
 	}, nil
 }
 
+// SetCodec sets the wire format notifications are sent in, JSON by default
+func (p *Producer) SetCodec(c codec.Codec) {
+	p.codec = c
+}
+
+// SetOffloader moves values over the offloader's threshold to its blob store
+func (p *Producer) SetOffloader(offloader *Offloader) {
+	p.offloader = offloader
+}
+
 // Send sends a notification message to Kafka
 func (p *Producer) Send(notification *pkg.NotificationMessage) error {
-	messageBytes, err := json.Marshal(notification)
+	message, err := p.message(notification)
 	if err != nil {
-		return fmt.Errorf("failed to marshal notification: %w", err)
-	}
-
-	message := &sarama.ProducerMessage{
-		Topic: p.topic,
-		Key:   sarama.StringEncoder(notification.UserID), // Use UserID as partition key
-		Value: sarama.ByteEncoder(messageBytes),
+		return fmt.Errorf("failed to encode notification: %w", err)
 	}
 
 	_, _, err = p.producer.SendMessage(message)
@@ -191,6 +288,24 @@ func (p *Producer) Send(notification *pkg.NotificationMessage) error {
 	return nil
 }
 
+// SendBatch sends several notification messages to Kafka in one request
+func (p *Producer) SendBatch(notifications []*pkg.NotificationMessage) error {
+	messages := make([]*sarama.ProducerMessage, 0, len(notifications))
+	for _, notification := range notifications {
+		message, err := p.message(notification)
+		if err != nil {
+			return fmt.Errorf("failed to encode notification %s: %w", notification.ID, err)
+		}
+		messages = append(messages, message)
+	}
+
+	if err := p.producer.SendMessages(messages); err != nil {
+		return fmt.Errorf("failed to send batch: %w", err)
+	}
+
+	return nil
+}
+
 // Close closes the producer
 func (p *Producer) Close() error {
 	return p.producer.Close()
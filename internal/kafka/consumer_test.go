@@ -0,0 +1,252 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/codec"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// fakeSession records the marked messages of a session
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx context.Context
+
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+// fakeClaim serves messages from a channel
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// recordingDeadLetter keeps the messages it is given
+type recordingDeadLetter struct {
+	messages []*sarama.ProducerMessage
+	err      error
+}
+
+func (d *recordingDeadLetter) DeadLetter(message *sarama.ConsumerMessage, reason error) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.messages = append(d.messages, DeadLetterMessage("notifications.dlq", message, reason))
+	return nil
+}
+
+func producerHeader(message *sarama.ProducerMessage, key string) string {
+	for _, h := range message.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// message builds a consumed message, with a content type header unless it
+// is empty
+func message(value []byte, contentType string) *sarama.ConsumerMessage {
+	m := &sarama.ConsumerMessage{Topic: "notifications", Partition: 2, Key: []byte("user-1"), Value: value}
+	if contentType != "" {
+		m.Headers = []*sarama.RecordHeader{{Key: []byte(codec.HeaderContentType), Value: []byte(contentType)}}
+	}
+	return m
+}
+
+// consume runs ConsumeClaim over the given messages, numbering their offsets
+func consume(t *testing.T, h *ConsumerGroupHandler, messages ...*sarama.ConsumerMessage) *fakeSession {
+	t.Helper()
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(messages)+1)}
+	for i, m := range messages {
+		m.Offset = int64(i)
+		claim.messages <- m
+	}
+	claim.messages <- nil
+
+	if err := h.ConsumeClaim(session, claim); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return session
+}
+
+func TestConsumeClaimDeadLetters(t *testing.T) {
+	deadLetter := &recordingDeadLetter{}
+	h := &ConsumerGroupHandler{
+		messageChan: make(chan *pkg.NotificationMessage, 10),
+		errorChan:   make(chan error, 10),
+		codecs:      codec.NewCodecs(codec.JSON{}),
+		validate: func(n *pkg.NotificationMessage) error {
+			if n.UserID == "" {
+				return errors.New("user_id is required")
+			}
+			return nil
+		},
+		deadLetter: deadLetter,
+	}
+
+	session := consume(t, h,
+		message([]byte(`{"id": "n1", "user_id": "user-1"}`), ""),
+		message([]byte(`not json`), ""),
+		message([]byte(`{"id": "n3"}`), ""))
+
+	if len(h.messageChan) != 1 || (<-h.messageChan).ID != "n1" {
+		t.Errorf("expected only the valid message to be processed")
+	}
+	if len(session.marked) != 3 {
+		t.Errorf("expected every message to be marked, got offsets %v", session.marked)
+	}
+	if len(h.errorChan) != 2 {
+		t.Errorf("expected both rejections to be reported, got %d", len(h.errorChan))
+	}
+	if len(deadLetter.messages) != 2 {
+		t.Fatalf("expected 2 dead-lettered messages, got %d", len(deadLetter.messages))
+	}
+
+	dead := deadLetter.messages[1]
+	if dead.Topic != "notifications.dlq" || producerHeader(dead, HeaderDLQTopic) != "notifications" ||
+		producerHeader(dead, HeaderDLQPartition) != "2" || producerHeader(dead, HeaderDLQOffset) != "2" {
+		t.Errorf("unexpected dead letter message %+v", dead)
+	}
+	if value, _ := dead.Value.Encode(); string(value) != `{"id": "n3"}` {
+		t.Errorf("expected the original value to be kept, got %s", value)
+	}
+	if reason := producerHeader(dead, HeaderDLQReason); reason == "" {
+		t.Errorf("expected the rejection reason in the headers")
+	}
+}
+
+func TestConsumeClaimDeadLetterFailure(t *testing.T) {
+	h := &ConsumerGroupHandler{
+		messageChan: make(chan *pkg.NotificationMessage, 10),
+		errorChan:   make(chan error, 10),
+		codecs:      codec.NewCodecs(codec.JSON{}),
+		deadLetter:  &recordingDeadLetter{err: errors.New("broker down")},
+	}
+
+	session := consume(t, h, message([]byte(`not json`), ""))
+	if len(session.marked) != 0 {
+		t.Errorf("expected a message that could not be dead-lettered to stay unmarked")
+	}
+	if len(h.errorChan) != 1 {
+		t.Errorf("expected the failure to be reported")
+	}
+}
+
+func TestConsumeClaimCodecs(t *testing.T) {
+	deadLetter := &recordingDeadLetter{}
+	h := &ConsumerGroupHandler{
+		messageChan: make(chan *pkg.NotificationMessage, 10),
+		errorChan:   make(chan error, 10),
+		codecs:      codec.NewCodecs(codec.JSON{}, codec.Protobuf{}),
+		deadLetter:  deadLetter,
+	}
+
+	notification := &pkg.NotificationMessage{ID: "n1", UserID: "user-1", Title: "Hi"}
+	encoded, err := codec.Protobuf{}.Encode("notifications", notification)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	consume(t, h,
+		message(encoded, codec.ContentTypeProtobuf),
+		message([]byte(`{"id": "n2", "user_id": "user-1"}`), "application/json; charset=utf-8"),
+		message(encoded, "application/x-thrift"))
+
+	if len(h.messageChan) != 2 {
+		t.Fatalf("expected 2 decoded messages, got %d", len(h.messageChan))
+	}
+	if n := <-h.messageChan; n.ID != "n1" || n.Title != "Hi" || n.Source != "notifications" {
+		t.Errorf("unexpected protobuf notification %+v", n)
+	}
+	if n := <-h.messageChan; n.ID != "n2" {
+		t.Errorf("unexpected json notification %+v", n)
+	}
+	if len(deadLetter.messages) != 1 || producerHeader(deadLetter.messages[0], codec.HeaderContentType) != "application/x-thrift" {
+		t.Errorf("expected the unknown content type to be dead-lettered with its headers, got %+v", deadLetter.messages)
+	}
+}
+
+func TestConsumeClaimDefaultPriority(t *testing.T) {
+	h := &ConsumerGroupHandler{
+		messageChan: make(chan *pkg.NotificationMessage, 10),
+		errorChan:   make(chan error, 10),
+		codecs:      codec.NewCodecs(codec.JSON{}, codec.Protobuf{}),
+		priorities:  map[string]pkg.Priority{"notifications": pkg.PriorityHigh},
+	}
+
+	low, err := codec.Protobuf{}.Encode("notifications", &pkg.NotificationMessage{ID: "n4", UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	other := message([]byte(`{"id": "n5", "user_id": "user-1"}`), "")
+	other.Topic = "marketing"
+
+	consume(t, h,
+		message([]byte(`{"id": "n1", "user_id": "user-1"}`), ""),
+		message([]byte(`{"id": "n2", "user_id": "user-1", "priority": 0}`), ""),
+		message([]byte(`{"id": "n3", "user_id": "user-1", "priority": 3}`), ""),
+		message(low, codec.ContentTypeProtobuf),
+		other)
+
+	want := map[string]pkg.Priority{
+		"n1": pkg.PriorityHigh,
+		"n2": pkg.PriorityLow,
+		"n3": pkg.PriorityUrgent,
+		"n4": pkg.PriorityHigh,
+		"n5": pkg.PriorityLow,
+	}
+	if len(h.messageChan) != len(want) {
+		t.Fatalf("expected %d decoded messages, got %d", len(want), len(h.messageChan))
+	}
+	for range want {
+		n := <-h.messageChan
+		if n.Priority != want[n.ID] {
+			t.Errorf("expected %s to have priority %v, got %v", n.ID, want[n.ID], n.Priority)
+		}
+	}
+}
+
+func TestProducerCodec(t *testing.T) {
+	mock := mocks.NewSyncProducer(t, nil)
+	defer mock.Close()
+
+	var sent *sarama.ProducerMessage
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(m *sarama.ProducerMessage) error {
+		sent = m
+		return nil
+	})
+
+	p := &Producer{producer: mock, encoder: encoder{topic: "notifications", codec: codec.JSON{}}}
+	p.SetCodec(codec.Protobuf{})
+	if err := p.Send(&pkg.NotificationMessage{ID: "n1", UserID: "user-1"}); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	if len(sent.Headers) != 1 || string(sent.Headers[0].Value) != codec.ContentTypeProtobuf {
+		t.Errorf("expected a protobuf content type header, got %+v", sent.Headers)
+	}
+	value, _ := sent.Value.Encode()
+	decoded, err := codec.Protobuf{}.Decode("notifications", value)
+	if err != nil || decoded.ID != "n1" {
+		t.Errorf("expected a protobuf value, got %v, %v", decoded, err)
+	}
+}
@@ -0,0 +1,88 @@
+package kafka
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/IBM/sarama"
+)
+
+// Headers added to dead-lettered messages
+const (
+	HeaderDLQReason    = "dlq-reason"
+	HeaderDLQTopic     = "dlq-source-topic"
+	HeaderDLQPartition = "dlq-source-partition"
+	HeaderDLQOffset    = "dlq-source-offset"
+)
+
+// DeadLetterer takes messages the consumer cannot process
+type DeadLetterer interface {
+	DeadLetter(message *sarama.ConsumerMessage, reason error) error
+}
+
+// DeadLetterQueue publishes unprocessable messages unchanged to a topic,
+// with headers telling where they came from and why they were rejected
+type DeadLetterQueue struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+// NewDeadLetterQueue creates a dead letter queue publishing to topic with
+// the given compression codec
+func NewDeadLetterQueue(brokers []string, topic string, compression sarama.CompressionCodec) (*DeadLetterQueue, error) {
+	config := sarama.NewConfig()
+	config.Producer.Compression = compression
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 3
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dead letter producer: %w", err)
+	}
+
+	return &DeadLetterQueue{
+		producer: producer,
+		topic:    topic,
+	}, nil
+}
+
+// DeadLetter publishes a consumed message to the dead letter topic
+func (q *DeadLetterQueue) DeadLetter(message *sarama.ConsumerMessage, reason error) error {
+	if _, _, err := q.producer.SendMessage(DeadLetterMessage(q.topic, message, reason)); err != nil {
+		return fmt.Errorf("failed to send message to %s: %w", q.topic, err)
+	}
+	return nil
+}
+
+// Close closes the dead letter producer
+func (q *DeadLetterQueue) Close() error {
+	return q.producer.Close()
+}
+
+// DeadLetterMessage builds the dead letter copy of a consumed message,
+// keeping its key, value and headers
+func DeadLetterMessage(topic string, message *sarama.ConsumerMessage, reason error) *sarama.ProducerMessage {
+	headers := make([]sarama.RecordHeader, 0, len(message.Headers)+4)
+	for _, header := range message.Headers {
+		if header != nil {
+			headers = append(headers, *header)
+		}
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderDLQReason), Value: []byte(reason.Error())},
+		sarama.RecordHeader{Key: []byte(HeaderDLQTopic), Value: []byte(message.Topic)},
+		sarama.RecordHeader{Key: []byte(HeaderDLQPartition), Value: []byte(strconv.FormatInt(int64(message.Partition), 10))},
+		sarama.RecordHeader{Key: []byte(HeaderDLQOffset), Value: []byte(strconv.FormatInt(message.Offset, 10))},
+	)
+
+	dead := &sarama.ProducerMessage{
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: headers,
+	}
+	if message.Key != nil {
+		dead.Key = sarama.ByteEncoder(message.Key)
+	}
+	return dead
+}
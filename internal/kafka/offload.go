@@ -0,0 +1,80 @@
+package kafka
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/blob"
+)
+
+// HeaderPayloadRef names the blob holding the value of an offloaded message,
+// whose own value is then empty
+const HeaderPayloadRef = "payload-ref"
+
+// offloadTimeout bounds a blob store call
+const offloadTimeout = 5 * time.Second
+
+// Offloader moves encoded values over a size threshold to a blob store,
+// leaving only a reference on the message. Blobs are keyed by the hash of
+// their content, so sending the same payload twice stores it once.
+type Offloader struct {
+	store     blob.Store
+	threshold int
+	ttl       time.Duration
+}
+
+// NewOffloader creates an offloader for values larger than threshold bytes.
+// Blobs expire after ttl, which should outlast the topic's retention.
+func NewOffloader(store blob.Store, threshold int, ttl time.Duration) *Offloader {
+	return &Offloader{
+		store:     store,
+		threshold: threshold,
+		ttl:       ttl,
+	}
+}
+
+// offload stores the message value if it is over the threshold and replaces
+// it with a reference
+func (o *Offloader) offload(message *sarama.ProducerMessage, value []byte) error {
+	if len(value) <= o.threshold {
+		return nil
+	}
+
+	sum := sha256.Sum256(value)
+	key := "payload:" + hex.EncodeToString(sum[:])
+
+	ctx, cancel := context.WithTimeout(context.Background(), offloadTimeout)
+	defer cancel()
+	if err := o.store.Put(ctx, key, value, o.ttl); err != nil {
+		return fmt.Errorf("failed to offload %d byte payload: %w", len(value), err)
+	}
+
+	message.Value = sarama.ByteEncoder(nil)
+	message.Headers = append(message.Headers, sarama.RecordHeader{Key: []byte(HeaderPayloadRef), Value: []byte(key)})
+	return nil
+}
+
+// resolve returns the value of a consumed message, fetching it from the
+// blob store if it was offloaded
+func (o *Offloader) resolve(ctx context.Context, message *sarama.ConsumerMessage) ([]byte, error) {
+	key := header(message, HeaderPayloadRef)
+	if key == "" {
+		return message.Value, nil
+	}
+	if o == nil {
+		return nil, fmt.Errorf("payload offloaded to %s but no blob store is configured", key)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, offloadTimeout)
+	defer cancel()
+	value, err := o.store.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch offloaded payload %s: %w", key, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,124 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/blob"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/codec"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// memoryBlobs keeps blobs in a map, ignoring their TTL
+type memoryBlobs struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func (mb *memoryBlobs) Put(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.blobs[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (mb *memoryBlobs) Get(ctx context.Context, key string) ([]byte, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	data, ok := mb.blobs[key]
+	if !ok {
+		return nil, blob.ErrNotFound
+	}
+	return data, nil
+}
+
+// consumed turns a produced message into the message a consumer sees
+func consumed(t *testing.T, m *sarama.ProducerMessage) *sarama.ConsumerMessage {
+	t.Helper()
+	value, err := m.Value.Encode()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := &sarama.ConsumerMessage{Topic: m.Topic, Value: value}
+	for i := range m.Headers {
+		c.Headers = append(c.Headers, &m.Headers[i])
+	}
+	return c
+}
+
+func TestOffload(t *testing.T) {
+	blobs := &memoryBlobs{blobs: make(map[string][]byte)}
+	offloader := NewOffloader(blobs, 1024, time.Hour)
+
+	mock := mocks.NewSyncProducer(t, nil)
+	defer mock.Close()
+	var sent []*sarama.ProducerMessage
+	record := func(m *sarama.ProducerMessage) error {
+		sent = append(sent, m)
+		return nil
+	}
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(record)
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(record)
+
+	p := &Producer{producer: mock, encoder: encoder{topic: "notifications", codec: codec.JSON{}}}
+	p.SetOffloader(offloader)
+
+	small := &pkg.NotificationMessage{ID: "n1", UserID: "user-1", Title: "Hi"}
+	large := &pkg.NotificationMessage{ID: "n2", UserID: "user-1", Channels: []pkg.Channel{pkg.ChannelEmail},
+		Data: map[string]interface{}{"report": strings.Repeat("x", 4096)}}
+	for _, n := range []*pkg.NotificationMessage{small, large} {
+		if err := p.Send(n); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+
+	if producerHeader(sent[0], HeaderPayloadRef) != "" {
+		t.Errorf("expected a small payload to travel inline")
+	}
+	ref := producerHeader(sent[1], HeaderPayloadRef)
+	if value, _ := sent[1].Value.Encode(); ref == "" || len(value) != 0 {
+		t.Fatalf("expected a large payload to be replaced by a reference, got %q and %d bytes", ref, len(value))
+	}
+
+	codecs := codec.NewCodecs(codec.JSON{})
+	decoded, err := decodeMessage(context.Background(), codecs, offloader, nil, consumed(t, sent[1]))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if decoded.ID != "n2" || decoded.Data["report"] != large.Data["report"] {
+		t.Errorf("expected the offloaded notification to be resolved, got %+v", decoded.ID)
+	}
+
+	// Without a blob store or once the blob has expired the message cannot be read
+	if _, err := decodeMessage(context.Background(), codecs, nil, nil, consumed(t, sent[1])); err == nil {
+		t.Errorf("expected an error without a blob store")
+	}
+	delete(blobs.blobs, ref)
+	if _, err := decodeMessage(context.Background(), codecs, offloader, nil, consumed(t, sent[1])); !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an expired blob, got %v", err)
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for name, want := range map[string]sarama.CompressionCodec{
+		"none":   sarama.CompressionNone,
+		"gzip":   sarama.CompressionGZIP,
+		"snappy": sarama.CompressionSnappy,
+		"lz4":    sarama.CompressionLZ4,
+		"zstd":   sarama.CompressionZSTD,
+	} {
+		if got, err := ParseCompression(name); err != nil || got != want {
+			t.Errorf("ParseCompression(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParseCompression("brotli"); err == nil {
+		t.Errorf("expected an unknown codec to be rejected")
+	}
+}
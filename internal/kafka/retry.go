@@ -0,0 +1,239 @@
+package kafka
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/codec"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// Headers added to messages on retry topics
+const (
+	HeaderRetryAttempt = "retry-attempt"
+	HeaderRetryDue     = "retry-due" // Unix milliseconds
+	HeaderRetryReason  = "retry-reason"
+	HeaderRetryTopic   = "retry-source-topic"
+
+	// The provider the attempt failed on and its failures in a row there
+	HeaderRetryProvider         = "retry-provider"
+	HeaderRetryProviderFailures = "retry-provider-failures"
+)
+
+// RetryTier is a retry topic whose messages are processed Delay after they
+// were published
+type RetryTier struct {
+	Topic string
+	Delay time.Duration
+}
+
+// ParseRetryTiers parses comma-separated delays such as "5s,1m,10m" into
+// tiers named <topic>.retry.<delay>; "none" or an empty spec gives none
+func ParseRetryTiers(topic, spec string) ([]RetryTier, error) {
+	if strings.TrimSpace(spec) == "none" {
+		return nil, nil
+	}
+
+	var tiers []RetryTier
+	for _, label := range strings.Split(spec, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		delay, err := time.ParseDuration(label)
+		if err != nil || delay <= 0 {
+			return nil, fmt.Errorf("invalid retry delay %q", label)
+		}
+		if len(tiers) > 0 && delay <= tiers[len(tiers)-1].Delay {
+			return nil, fmt.Errorf("retry delays must increase, %q does not", label)
+		}
+		tiers = append(tiers, RetryTier{Topic: topic + ".retry." + label, Delay: delay})
+	}
+	return tiers, nil
+}
+
+// RetryQueue publishes notifications whose delivery failed to the retry
+// topic of their attempt, so they are retried later without holding up a
+// worker, and notifications out of retries to the dead letter topic
+type RetryQueue struct {
+	producer        sarama.SyncProducer
+	tiers           []RetryTier
+	deadLetterTopic string
+	codec           codec.Codec
+	offloader       *Offloader
+}
+
+// NewRetryQueue creates a retry queue over tiers of increasing delay
+func NewRetryQueue(brokers []string, tiers []RetryTier, deadLetterTopic string, compression sarama.CompressionCodec) (*RetryQueue, error) {
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("no retry tiers")
+	}
+
+	config := sarama.NewConfig()
+	config.Producer.Compression = compression
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 3
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create retry producer: %w", err)
+	}
+
+	return &RetryQueue{
+		producer:        producer,
+		tiers:           tiers,
+		deadLetterTopic: deadLetterTopic,
+		codec:           codec.JSON{},
+	}, nil
+}
+
+// SetCodec sets the wire format notifications are sent in, JSON by default
+func (q *RetryQueue) SetCodec(c codec.Codec) {
+	q.codec = c
+}
+
+// SetOffloader moves values over the offloader's threshold to its blob store
+func (q *RetryQueue) SetOffloader(offloader *Offloader) {
+	q.offloader = offloader
+}
+
+// Tiers returns the retry tiers, shortest delay first
+func (q *RetryQueue) Tiers() []RetryTier {
+	return q.tiers
+}
+
+// Retry publishes the next attempt of a notification, due after delay, to
+// the longest tier whose delay does not exceed it and returns when it is due
+func (q *RetryQueue) Retry(notification *pkg.NotificationMessage, reason error, delay time.Duration) (time.Time, error) {
+	retried := *notification
+	retried.Retry++
+	tier := q.tier(delay)
+	due := time.Now().Add(delay)
+
+	message, err := q.message(tier.Topic, &retried)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to encode notification: %w", err)
+	}
+	message.Headers = append(message.Headers,
+		sarama.RecordHeader{Key: []byte(HeaderRetryAttempt), Value: []byte(strconv.Itoa(retried.Retry))},
+		sarama.RecordHeader{Key: []byte(HeaderRetryDue), Value: []byte(strconv.FormatInt(due.UnixMilli(), 10))},
+		sarama.RecordHeader{Key: []byte(HeaderRetryReason), Value: []byte(reason.Error())},
+	)
+	if notification.Source != "" {
+		message.Headers = append(message.Headers, sarama.RecordHeader{Key: []byte(HeaderRetryTopic), Value: []byte(notification.Source)})
+	}
+	if notification.RetryProvider != "" {
+		message.Headers = append(message.Headers,
+			sarama.RecordHeader{Key: []byte(HeaderRetryProvider), Value: []byte(notification.RetryProvider)},
+			sarama.RecordHeader{Key: []byte(HeaderRetryProviderFailures), Value: []byte(strconv.Itoa(notification.ProviderFailures))},
+		)
+	}
+
+	if _, _, err := q.producer.SendMessage(message); err != nil {
+		return time.Time{}, fmt.Errorf("failed to send message to %s: %w", tier.Topic, err)
+	}
+	return due, nil
+}
+
+// DeadLetter publishes a notification out of retries to the dead letter topic
+func (q *RetryQueue) DeadLetter(notification *pkg.NotificationMessage, reason error) error {
+	message, err := q.message(q.deadLetterTopic, notification)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	message.Headers = append(message.Headers,
+		sarama.RecordHeader{Key: []byte(HeaderDLQReason), Value: []byte(reason.Error())},
+		sarama.RecordHeader{Key: []byte(HeaderRetryAttempt), Value: []byte(strconv.Itoa(notification.Retry))},
+	)
+	if notification.Source != "" {
+		message.Headers = append(message.Headers, sarama.RecordHeader{Key: []byte(HeaderDLQTopic), Value: []byte(notification.Source)})
+	}
+
+	if _, _, err := q.producer.SendMessage(message); err != nil {
+		return fmt.Errorf("failed to send message to %s: %w", q.deadLetterTopic, err)
+	}
+	return nil
+}
+
+// Close closes the retry producer
+func (q *RetryQueue) Close() error {
+	return q.producer.Close()
+}
+
+// tier returns the longest tier whose delay does not exceed delay, or the
+// shortest tier for delays shorter than all. Retries are held until due, so
+// a tier never delivers them early.
+func (q *RetryQueue) tier(delay time.Duration) RetryTier {
+	tier := q.tiers[0]
+	for _, t := range q.tiers[1:] {
+		if t.Delay > delay {
+			break
+		}
+		tier = t
+	}
+	return tier
+}
+
+// message encodes a notification for a topic
+func (q *RetryQueue) message(topic string, notification *pkg.NotificationMessage) (*sarama.ProducerMessage, error) {
+	e := encoder{topic: topic, codec: q.codec, offloader: q.offloader}
+	return e.message(notification)
+}
+
+// retryWaits returns the longest a message of each retry tier waits: up to
+// the next tier's delay, or the larger of maxDelay and its own after the
+// last tier
+func retryWaits(tiers []RetryTier, maxDelay time.Duration) map[string]time.Duration {
+	waits := make(map[string]time.Duration, len(tiers))
+	for i, tier := range tiers {
+		if i+1 < len(tiers) {
+			waits[tier.Topic] = tiers[i+1].Delay
+		} else {
+			waits[tier.Topic] = max(maxDelay, tier.Delay)
+		}
+	}
+	return waits
+}
+
+// retryState applies the retry headers of a consumed message to its
+// notification, restoring the attempt count, the provider it failed on and
+// the topic it was first consumed from, and returns when the message is due. Retries are marked
+// admitted, as they passed admission before their first attempt; messages
+// that are not retries are due at once.
+func retryState(message *sarama.ConsumerMessage, notification *pkg.NotificationMessage) (time.Time, error) {
+	if value := header(message, HeaderRetryAttempt); value != "" {
+		attempt, err := strconv.Atoi(value)
+		if err != nil || attempt < 0 {
+			return time.Time{}, fmt.Errorf("invalid %s header %q", HeaderRetryAttempt, value)
+		}
+		notification.Retry = attempt
+		notification.Admitted = true
+	}
+	if source := header(message, HeaderRetryTopic); source != "" {
+		notification.Source = source
+	}
+	if name := header(message, HeaderRetryProvider); name != "" {
+		value := header(message, HeaderRetryProviderFailures)
+		failures, err := strconv.Atoi(value)
+		if err != nil || failures < 0 {
+			return time.Time{}, fmt.Errorf("invalid %s header %q", HeaderRetryProviderFailures, value)
+		}
+		notification.RetryProvider = name
+		notification.ProviderFailures = failures
+	}
+
+	value := header(message, HeaderRetryDue)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s header %q", HeaderRetryDue, value)
+	}
+	return time.UnixMilli(millis), nil
+}
@@ -0,0 +1,177 @@
+package kafka
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/codec"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+func TestParseRetryTiers(t *testing.T) {
+	tiers, err := ParseRetryTiers("notifications", "5s, 1m,10m")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(tiers) != 3 || tiers[0].Topic != "notifications.retry.5s" || tiers[2].Topic != "notifications.retry.10m" || tiers[1].Delay != time.Minute {
+		t.Errorf("unexpected tiers %+v", tiers)
+	}
+
+	if tiers, err := ParseRetryTiers("notifications", "none"); err != nil || len(tiers) != 0 {
+		t.Errorf("expected none to disable retry topics, got %v, %v", tiers, err)
+	}
+	for _, spec := range []string{"5", "1m,5s", "-1s"} {
+		if _, err := ParseRetryTiers("notifications", spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestRetryQueue(t *testing.T) {
+	mock := mocks.NewSyncProducer(t, nil)
+	defer mock.Close()
+
+	var sent []*sarama.ProducerMessage
+	record := func(m *sarama.ProducerMessage) error {
+		sent = append(sent, m)
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(record)
+	}
+
+	tiers, _ := ParseRetryTiers("notifications", "5s,1m")
+	q := &RetryQueue{producer: mock, tiers: tiers, deadLetterTopic: "notifications.dlq", codec: codec.JSON{}}
+	reason := errors.New("provider unavailable")
+	notification := &pkg.NotificationMessage{ID: "n1", UserID: "user-1", Source: "notifications.marketing", RetryProvider: "fcm", ProviderFailures: 2}
+
+	due, err := q.Retry(notification, reason, 30*time.Second)
+	if err != nil || time.Until(due) < 29*time.Second || time.Until(due) > 30*time.Second {
+		t.Fatalf("expected a retry due in 30s, got %v, %v", due, err)
+	}
+	notification.Retry = 4
+	if _, err := q.Retry(notification, reason, 2*time.Hour); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if err := q.DeadLetter(notification, reason); err != nil {
+		t.Fatalf("dead letter failed: %v", err)
+	}
+
+	first := sent[0]
+	if first.Topic != "notifications.retry.5s" || producerHeader(first, HeaderRetryAttempt) != "1" ||
+		producerHeader(first, HeaderRetryTopic) != "notifications.marketing" || producerHeader(first, HeaderRetryReason) != reason.Error() ||
+		producerHeader(first, HeaderRetryDue) != strconv.FormatInt(due.UnixMilli(), 10) ||
+		producerHeader(first, HeaderRetryProvider) != "fcm" || producerHeader(first, HeaderRetryProviderFailures) != "2" {
+		t.Errorf("unexpected first retry %+v", first)
+	}
+	value, _ := first.Value.Encode()
+	if decoded, err := (codec.JSON{}).Decode(first.Topic, value); err != nil || decoded.Retry != 1 {
+		t.Errorf("expected the retry count in the message, got %v, %v", decoded, err)
+	}
+	if sent[1].Topic != "notifications.retry.1m" || producerHeader(sent[1], HeaderRetryAttempt) != "5" {
+		t.Errorf("expected delays past the tiers on the last tier, got %s attempt %s", sent[1].Topic, producerHeader(sent[1], HeaderRetryAttempt))
+	}
+	if sent[2].Topic != "notifications.dlq" || producerHeader(sent[2], HeaderDLQTopic) != "notifications.marketing" || producerHeader(sent[2], HeaderDLQReason) != reason.Error() {
+		t.Errorf("unexpected dead letter %+v", sent[2])
+	}
+}
+
+func TestConsumeClaimRetry(t *testing.T) {
+	tiers, _ := ParseRetryTiers("notifications", "5s,1m")
+	h := &ConsumerGroupHandler{
+		messageChan: make(chan *pkg.NotificationMessage, 10),
+		errorChan:   make(chan error, 10),
+		codecs:      codec.NewCodecs(codec.JSON{}),
+		retryWaits:  retryWaits(tiers, time.Minute),
+	}
+
+	due := time.Now().Add(100 * time.Millisecond).Truncate(time.Millisecond)
+	retry := message([]byte(`{"id": "n1", "user_id": "user-1"}`), "")
+	retry.Topic = "notifications.retry.5s"
+	retry.Headers = append(retry.Headers,
+		&sarama.RecordHeader{Key: []byte(HeaderRetryAttempt), Value: []byte("2")},
+		&sarama.RecordHeader{Key: []byte(HeaderRetryDue), Value: []byte(strconv.FormatInt(due.UnixMilli(), 10))},
+		&sarama.RecordHeader{Key: []byte(HeaderRetryTopic), Value: []byte("notifications.marketing")},
+		&sarama.RecordHeader{Key: []byte(HeaderRetryProvider), Value: []byte("fcm")},
+		&sarama.RecordHeader{Key: []byte(HeaderRetryProviderFailures), Value: []byte("1")},
+	)
+	invalid := message([]byte(`{"id": "n2", "user_id": "user-1"}`), "")
+	invalid.Topic = "notifications.retry.1m"
+	invalid.Headers = append(invalid.Headers, &sarama.RecordHeader{Key: []byte(HeaderRetryDue), Value: []byte("soon")})
+
+	consume(t, h, retry, invalid)
+
+	if time.Now().Before(due) {
+		t.Errorf("expected the retry to be held until it is due")
+	}
+	if len(h.messageChan) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(h.messageChan))
+	}
+	if n := <-h.messageChan; n.Retry != 2 || n.Source != "notifications.marketing" || !n.Admitted {
+		t.Errorf("expected the attempt and source topic to be restored on an admitted retry, got retry %d from %s, admitted %v", n.Retry, n.Source, n.Admitted)
+	} else if n.RetryProvider != "fcm" || n.ProviderFailures != 1 {
+		t.Errorf("expected the failed provider to be restored, got %q with %d failures", n.RetryProvider, n.ProviderFailures)
+	}
+	if len(h.errorChan) != 1 {
+		t.Errorf("expected the malformed retry header to be reported")
+	}
+}
+
+func TestRetryWaits(t *testing.T) {
+	tiers, _ := ParseRetryTiers("notifications", "5s,1m")
+	waits := retryWaits(tiers, 30*time.Second)
+	if waits["notifications.retry.5s"] != time.Minute || waits["notifications.retry.1m"] != time.Minute || len(waits) != 2 {
+		t.Errorf("unexpected waits %v", waits)
+	}
+	if waits := retryWaits(tiers, time.Hour); waits["notifications.retry.1m"] != time.Hour {
+		t.Errorf("expected the last tier to wait up to the longest backoff, got %v", waits)
+	}
+}
+
+func TestConsumeClaimRetryHeadersOnlyOnRetryTopics(t *testing.T) {
+	h := &ConsumerGroupHandler{
+		messageChan: make(chan *pkg.NotificationMessage, 10),
+		errorChan:   make(chan error, 10),
+		codecs:      codec.NewCodecs(codec.JSON{}),
+		retryWaits:  map[string]time.Duration{"notifications.retry.5s": 50 * time.Millisecond},
+	}
+
+	// A producer on the main topic cannot pass a message off as a retry
+	farFuture := strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)
+	forged := message([]byte(`{"id": "n1", "user_id": "user-1"}`), "")
+	forged.Headers = append(forged.Headers,
+		&sarama.RecordHeader{Key: []byte(HeaderRetryAttempt), Value: []byte("1")},
+		&sarama.RecordHeader{Key: []byte(HeaderRetryDue), Value: []byte(farFuture)},
+		&sarama.RecordHeader{Key: []byte(HeaderRetryTopic), Value: []byte("notifications.transactional")},
+		&sarama.RecordHeader{Key: []byte(HeaderRetryProvider), Value: []byte("fcm")},
+		&sarama.RecordHeader{Key: []byte(HeaderRetryProviderFailures), Value: []byte("9")},
+	)
+	// and a retry due far in the future waits no longer than its tier
+	late := message([]byte(`{"id": "n2", "user_id": "user-1"}`), "")
+	late.Topic = "notifications.retry.5s"
+	late.Headers = append(late.Headers,
+		&sarama.RecordHeader{Key: []byte(HeaderRetryAttempt), Value: []byte("1")},
+		&sarama.RecordHeader{Key: []byte(HeaderRetryDue), Value: []byte(farFuture)},
+	)
+
+	start := time.Now()
+	consume(t, h, forged, late)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the due wait to be cut short, took %v", elapsed)
+	}
+
+	if len(h.messageChan) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(h.messageChan))
+	}
+	if n := <-h.messageChan; n.Admitted || n.Retry != 0 || n.Source != "notifications" || n.RetryProvider != "" || n.ProviderFailures != 0 {
+		t.Errorf("expected the retry headers on the main topic to be ignored, got %+v", n)
+	}
+	if n := <-h.messageChan; !n.Admitted || n.Retry != 1 {
+		t.Errorf("expected the message on the retry topic to be a retry, got %+v", n)
+	}
+}
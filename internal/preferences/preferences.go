@@ -0,0 +1,104 @@
+package preferences
+
+import (
+	"context"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// Preferences holds a user's delivery preferences. Types and channels that are
+// not listed are allowed; only an explicit false opts the user out.
+type Preferences struct {
+	UserID     string               `json:"user_id"`
+	Muted      bool                 `json:"muted"`
+	Types      map[string]bool      `json:"types,omitempty"`
+	Channels   map[pkg.Channel]bool `json:"channels,omitempty"`
+	Locale     string               `json:"locale,omitempty"`
+	QuietHours *QuietHours          `json:"quiet_hours,omitempty"`
+	UpdatedAt  time.Time            `json:"updated_at"`
+}
+
+// Store persists user preferences. Get returns default preferences for users
+// that never stored any.
+type Store interface {
+	Get(ctx context.Context, userID string) (*Preferences, error)
+	Save(ctx context.Context, prefs *Preferences) error
+	Delete(ctx context.Context, userID string) error
+}
+
+// Default returns the preferences of a user that has not configured anything
+func Default(userID string) *Preferences {
+	return &Preferences{UserID: userID}
+}
+
+// Decision is the outcome of applying preferences to a notification
+type Decision struct {
+	Allowed    []pkg.Channel
+	Suppressed []pkg.Channel
+	Reason     string
+}
+
+// Apply splits the notification's target channels into allowed and
+// suppressed ones. Muting and type opt-outs suppress every channel.
+func (p *Preferences) Apply(notification *pkg.NotificationMessage) Decision {
+	channels := notification.TargetChannels()
+
+	if p.Muted {
+		return Decision{Suppressed: channels, Reason: "user has muted notifications"}
+	}
+	if notification.Type != "" {
+		if enabled, ok := p.Types[notification.Type]; ok && !enabled {
+			return Decision{Suppressed: channels, Reason: "user opted out of " + notification.Type + " notifications"}
+		}
+	}
+
+	var decision Decision
+	for _, ch := range channels {
+		if enabled, ok := p.Channels[ch]; ok && !enabled {
+			decision.Suppressed = append(decision.Suppressed, ch)
+			continue
+		}
+		decision.Allowed = append(decision.Allowed, ch)
+	}
+	if len(decision.Suppressed) > 0 {
+		decision.Reason = "user disabled the channel"
+	}
+
+	return decision
+}
+
+// Merge applies a partial update on top of the current preferences
+func (p *Preferences) Merge(update *Patch) {
+	if update.Muted != nil {
+		p.Muted = *update.Muted
+	}
+	if update.Locale != nil {
+		p.Locale = *update.Locale
+	}
+	if update.QuietHours != nil {
+		p.QuietHours = update.QuietHours
+	}
+	for t, enabled := range update.Types {
+		if p.Types == nil {
+			p.Types = make(map[string]bool)
+		}
+		p.Types[t] = enabled
+	}
+	for ch, enabled := range update.Channels {
+		if p.Channels == nil {
+			p.Channels = make(map[pkg.Channel]bool)
+		}
+		p.Channels[ch] = enabled
+	}
+}
+
+// Patch is a partial preferences update; nil fields are left unchanged and
+// map entries are merged key by key
+type Patch struct {
+	Muted      *bool                `json:"muted,omitempty"`
+	Types      map[string]bool      `json:"types,omitempty"`
+	Channels   map[pkg.Channel]bool `json:"channels,omitempty"`
+	Locale     *string              `json:"locale,omitempty"`
+	QuietHours *QuietHours          `json:"quiet_hours,omitempty"`
+}
@@ -0,0 +1,67 @@
+package preferences
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+func TestApply(t *testing.T) {
+	notification := &pkg.NotificationMessage{
+		ID:       "test-123",
+		UserID:   "user-456",
+		Type:     "marketing",
+		Channels: []pkg.Channel{pkg.ChannelPush, pkg.ChannelEmail},
+	}
+
+	// Defaults allow everything
+	decision := Default("user-456").Apply(notification)
+	if len(decision.Allowed) != 2 || len(decision.Suppressed) != 0 {
+		t.Errorf("Expected all channels allowed by default, got %+v", decision)
+	}
+
+	// Opting out of the type suppresses every channel
+	prefs := &Preferences{UserID: "user-456", Types: map[string]bool{"marketing": false, "security": true}}
+	decision = prefs.Apply(notification)
+	if len(decision.Allowed) != 0 || len(decision.Suppressed) != 2 || decision.Reason == "" {
+		t.Errorf("Expected type opt-out to suppress all channels, got %+v", decision)
+	}
+
+	// Disabling a channel only suppresses that channel
+	prefs = &Preferences{UserID: "user-456", Channels: map[pkg.Channel]bool{pkg.ChannelEmail: false}}
+	decision = prefs.Apply(notification)
+	if !reflect.DeepEqual(decision.Allowed, []pkg.Channel{pkg.ChannelPush}) || !reflect.DeepEqual(decision.Suppressed, []pkg.Channel{pkg.ChannelEmail}) {
+		t.Errorf("Expected only email to be suppressed, got %+v", decision)
+	}
+
+	// Global mute wins over everything
+	prefs = &Preferences{UserID: "user-456", Muted: true, Types: map[string]bool{"marketing": true}}
+	decision = prefs.Apply(notification)
+	if len(decision.Allowed) != 0 {
+		t.Errorf("Expected mute to suppress all channels, got %+v", decision)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	prefs := &Preferences{UserID: "user-456", Types: map[string]bool{"marketing": false}}
+	muted := true
+	locale := "fr"
+
+	prefs.Merge(&Patch{
+		Muted:    &muted,
+		Locale:   &locale,
+		Types:    map[string]bool{"social": false},
+		Channels: map[pkg.Channel]bool{pkg.ChannelSMS: false},
+	})
+
+	if !prefs.Muted || prefs.Locale != "fr" {
+		t.Errorf("Expected muted French preferences, got %+v", prefs)
+	}
+	if prefs.Types["marketing"] || prefs.Types["social"] || len(prefs.Types) != 2 {
+		t.Errorf("Expected type opt-outs to be merged, got %v", prefs.Types)
+	}
+	if enabled, ok := prefs.Channels[pkg.ChannelSMS]; !ok || enabled {
+		t.Errorf("Expected sms to be disabled, got %v", prefs.Channels)
+	}
+}
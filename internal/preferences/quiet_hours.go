@@ -0,0 +1,84 @@
+package preferences
+
+import (
+	"fmt"
+	"time"
+)
+
+// QuietHours is a daily window in the user's timezone during which
+// non-urgent notifications are held back. Windows may span midnight.
+type QuietHours struct {
+	Enabled  bool   `json:"enabled"`
+	Start    string `json:"start"`    // "22:00"
+	End      string `json:"end"`      // "07:00"
+	Timezone string `json:"timezone"` // IANA name, e.g. "Europe/Paris"
+}
+
+// Validate checks the clock times and timezone
+func (q *QuietHours) Validate() error {
+	if _, _, err := parseClock(q.Start); err != nil {
+		return fmt.Errorf("invalid quiet hours start: %w", err)
+	}
+	if _, _, err := parseClock(q.End); err != nil {
+		return fmt.Errorf("invalid quiet hours end: %w", err)
+	}
+	if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return fmt.Errorf("invalid quiet hours timezone: %w", err)
+	}
+	return nil
+}
+
+// Until reports whether t falls inside the quiet window and, if so, when the
+// window ends
+func (q *QuietHours) Until(t time.Time) (time.Time, bool) {
+	if q == nil || !q.Enabled {
+		return time.Time{}, false
+	}
+
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+	startHour, startMinute, err := parseClock(q.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	endHour, endMinute, err := parseClock(q.End)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	local := t.In(loc)
+	year, month, day := local.Date()
+	start := time.Date(year, month, day, startHour, startMinute, 0, 0, loc)
+	end := time.Date(year, month, day, endHour, endMinute, 0, 0, loc)
+
+	switch {
+	case start.Equal(end):
+		return time.Time{}, false
+	case start.Before(end):
+		// Same-day window, e.g. 13:00-15:00
+		if !local.Before(start) && local.Before(end) {
+			return end, true
+		}
+	default:
+		// Overnight window, e.g. 22:00-07:00
+		if !local.Before(start) {
+			return time.Date(year, month, day+1, endHour, endMinute, 0, 0, loc), true
+		}
+		if local.Before(end) {
+			return end, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// parseClock parses a 24h "HH:MM" time of day
+func parseClock(clock string) (hour, minute int, err error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, 0, fmt.Errorf("expected HH:MM, got %q", clock)
+	}
+	return parsed.Hour(), parsed.Minute(), nil
+}
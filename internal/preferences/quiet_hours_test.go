@@ -0,0 +1,70 @@
+package preferences
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHoursUntil(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	overnight := &QuietHours{Enabled: true, Start: "22:00", End: "07:00", Timezone: "Europe/Paris"}
+	tests := []struct {
+		name     string
+		at       time.Time
+		active   bool
+		expected time.Time
+	}{
+		{"late evening", time.Date(2024, 3, 10, 23, 30, 0, 0, paris), true, time.Date(2024, 3, 11, 7, 0, 0, 0, paris)},
+		{"early morning", time.Date(2024, 3, 11, 3, 0, 0, 0, paris), true, time.Date(2024, 3, 11, 7, 0, 0, 0, paris)},
+		{"window end is exclusive", time.Date(2024, 3, 11, 7, 0, 0, 0, paris), false, time.Time{}},
+		{"daytime", time.Date(2024, 3, 11, 12, 0, 0, 0, paris), false, time.Time{}},
+		// 02:00 UTC is 03:00 in Paris, so the UTC instant is inside the window
+		{"other timezone input", time.Date(2024, 3, 11, 2, 0, 0, 0, time.UTC), true, time.Date(2024, 3, 11, 7, 0, 0, 0, paris)},
+	}
+
+	for _, test := range tests {
+		end, active := overnight.Until(test.at)
+		if active != test.active {
+			t.Errorf("%s: expected active=%v, got %v", test.name, test.active, active)
+			continue
+		}
+		if active && !end.Equal(test.expected) {
+			t.Errorf("%s: expected window end %v, got %v", test.name, test.expected, end)
+		}
+	}
+
+	sameDay := &QuietHours{Enabled: true, Start: "13:00", End: "15:00", Timezone: "Europe/Paris"}
+	if _, active := sameDay.Until(time.Date(2024, 3, 11, 14, 0, 0, 0, paris)); !active {
+		t.Errorf("Expected same-day window to be active at 14:00")
+	}
+	if _, active := sameDay.Until(time.Date(2024, 3, 11, 16, 0, 0, 0, paris)); active {
+		t.Errorf("Expected same-day window to be inactive at 16:00")
+	}
+
+	disabled := &QuietHours{Enabled: false, Start: "00:00", End: "23:59", Timezone: "UTC"}
+	if _, active := disabled.Until(time.Now()); active {
+		t.Errorf("Expected disabled quiet hours to be inactive")
+	}
+}
+
+func TestQuietHoursValidate(t *testing.T) {
+	valid := &QuietHours{Enabled: true, Start: "22:00", End: "07:00", Timezone: "America/New_York"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected valid quiet hours, got %v", err)
+	}
+
+	invalid := []*QuietHours{
+		{Start: "25:00", End: "07:00", Timezone: "UTC"},
+		{Start: "22:00", End: "7", Timezone: "UTC"},
+		{Start: "22:00", End: "07:00", Timezone: "Mars/Olympus_Mons"},
+	}
+	for _, q := range invalid {
+		if err := q.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", q)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// minLatencySamples is how many sends of a provider are observed before its
+// latency percentiles are reported
+const minLatencySamples = 20
+
+// LatencyTracker keeps the latencies of the most recent sends to each
+// provider
+type LatencyTracker struct {
+	window  int
+	samples map[string]*latencyWindow
+	mu      sync.Mutex
+}
+
+// latencyWindow is a ring of the latest latencies of a provider
+type latencyWindow struct {
+	values []time.Duration
+	next   int
+}
+
+// NewLatencyTracker creates a tracker keeping the last window latencies of
+// each provider
+func NewLatencyTracker(window int) *LatencyTracker {
+	return &LatencyTracker{
+		window:  max(window, minLatencySamples),
+		samples: make(map[string]*latencyWindow),
+	}
+}
+
+// Observe records the latency of a send to a provider
+func (lt *LatencyTracker) Observe(name string, latency time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	w, ok := lt.samples[name]
+	if !ok {
+		w = &latencyWindow{values: make([]time.Duration, 0, lt.window)}
+		lt.samples[name] = w
+	}
+	if len(w.values) < lt.window {
+		w.values = append(w.values, latency)
+		return
+	}
+	w.values[w.next] = latency
+	w.next = (w.next + 1) % lt.window
+}
+
+// Percentile returns the latency under which the given percentage of the
+// provider's recent sends completed, or false while too few were observed
+func (lt *LatencyTracker) Percentile(name string, percentile float64) (time.Duration, bool) {
+	lt.mu.Lock()
+	w, ok := lt.samples[name]
+	if !ok || len(w.values) < minLatencySamples {
+		lt.mu.Unlock()
+		return 0, false
+	}
+	values := append([]time.Duration(nil), w.values...)
+	lt.mu.Unlock()
+
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	rank := int(math.Ceil(percentile/100*float64(len(values)))) - 1
+	return values[min(max(rank, 0), len(values)-1)], true
+}
@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	tracker := NewLatencyTracker(50)
+
+	for i := 1; i < minLatencySamples; i++ {
+		tracker.Observe("apns", time.Duration(i)*time.Millisecond)
+	}
+	if _, ok := tracker.Percentile("apns", 95); ok {
+		t.Fatalf("Expected no percentile before %d samples", minLatencySamples)
+	}
+
+	tracker.Observe("apns", 20*time.Millisecond)
+	if p95, ok := tracker.Percentile("apns", 95); !ok || p95 != 19*time.Millisecond {
+		t.Errorf("Expected a p95 of 19ms, got %v", p95)
+	}
+	if p50, _ := tracker.Percentile("apns", 50); p50 != 10*time.Millisecond {
+		t.Errorf("Expected a p50 of 10ms, got %v", p50)
+	}
+
+	// Old samples leave the window
+	for i := 0; i < 50; i++ {
+		tracker.Observe("apns", time.Second)
+	}
+	if p50, _ := tracker.Percentile("apns", 50); p50 != time.Second {
+		t.Errorf("Expected only recent samples to count, got a p50 of %v", p50)
+	}
+	if _, ok := tracker.Percentile("fcm", 95); ok {
+		t.Errorf("Expected no percentile for an unobserved provider")
+	}
+}
+
+func TestSettingsTable(t *testing.T) {
+	table := NewSettingsTable(Settings{Timeout: 5 * time.Second, Retries: 2})
+	table.Set("sms-gateway", Settings{Timeout: time.Second})
+
+	if s := table.For("apns"); s.Timeout != 5*time.Second || s.Retries != 2 {
+		t.Errorf("Expected the defaults, got %+v", s)
+	}
+	if s := table.For("sms-gateway"); s.Timeout != time.Second || s.Retries != 0 {
+		t.Errorf("Expected the override, got %+v", s)
+	}
+
+	var unset *SettingsTable
+	if s := unset.For("apns"); s.Timeout != DefaultTimeout || s.Retries != 0 {
+		t.Errorf("Expected a nil table to apply the default timeout, got %+v", s)
+	}
+}
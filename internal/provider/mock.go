@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"time"
@@ -16,6 +17,19 @@ type Provider interface {
 	HealthCheck(ctx context.Context) error
 }
 
+// ErrRecipientOffline is returned by providers that can only reach online
+// users when the recipient is not reachable; the notification should go
+// through the other providers instead
+var ErrRecipientOffline = errors.New("recipient is offline")
+
+// Preferrer is a provider that can serve only some notifications, such as a
+// live connection gateway that reaches users with the app open. Managers
+// pick it ahead of their other providers for notifications it Accepts.
+type Preferrer interface {
+	Provider
+	Accepts(ctx context.Context, notification *pkg.NotificationMessage) bool
+}
+
 // MockProvider simulates an external notification provider
 type MockProvider struct {
 	name          string
@@ -65,18 +79,25 @@ func (mp *MockProvider) Send(ctx context.Context, notification *pkg.Notification
 	}
 
 	if success {
-		// Generate a mock message ID
-		response.MessageID = fmt.Sprintf("%s_%d_%s", mp.name, time.Now().Unix(), notification.ID[:8])
+		// Generate a mock message ID from the first characters of the ID
+		id := notification.ID
+		if len(id) > 8 {
+			id = id[:8]
+		}
+		response.MessageID = fmt.Sprintf("%s_%d_%s", mp.name, time.Now().Unix(), id)
 	} else {
 		// Simulate different types of failures
-		failures := []string{
-			"network timeout",
-			"rate limit exceeded",
-			"invalid token",
-			"service unavailable",
-			"message too large",
+		failures := []struct{ message, code string }{
+			{"network timeout", pkg.ErrorCodeTimeout},
+			{"rate limit exceeded", pkg.ErrorCodeThrottled},
+			{"invalid token", pkg.ErrorCodeUnregistered},
+			{"service unavailable", pkg.ErrorCodeUnavailable},
+			{"message too large", pkg.ErrorCodePayloadTooLarge},
 		}
-		response.Error = failures[rand.Intn(len(failures))]
+		failure := failures[rand.Intn(len(failures))]
+		response.Error = failure.message
+		response.Code = failure.code
+		response.Throttled = failure.code == pkg.ErrorCodeThrottled
 	}
 
 	return response, nil
@@ -112,6 +133,7 @@ func (mp *MockProvider) SetHealthStatus(healthy bool) {
 // ProviderManager manages multiple providers and provides load balancing
 type ProviderManager struct {
 	providers []Provider
+	preferred []Preferrer
 	strategy  LoadBalanceStrategy
 }
 
@@ -137,6 +159,23 @@ func (pm *ProviderManager) AddProvider(provider Provider) {
 	pm.providers = append(pm.providers, provider)
 }
 
+// AddPreferred adds a provider that is picked ahead of the others for the
+// notifications it accepts
+func (pm *ProviderManager) AddPreferred(provider Preferrer) {
+	pm.preferred = append(pm.preferred, provider)
+}
+
+// GetProviderFor returns the first preferred provider accepting the
+// notification, or a provider based on the load balancing strategy
+func (pm *ProviderManager) GetProviderFor(ctx context.Context, notification *pkg.NotificationMessage) (Provider, error) {
+	for _, provider := range pm.preferred {
+		if provider.Accepts(ctx, notification) {
+			return provider, nil
+		}
+	}
+	return pm.GetProvider(ctx)
+}
+
 // GetProvider returns a provider based on the load balancing strategy
 func (pm *ProviderManager) GetProvider(ctx context.Context) (Provider, error) {
 	if len(pm.providers) == 0 {
@@ -168,6 +207,36 @@ func (pm *ProviderManager) GetProvider(ctx context.Context) (Provider, error) {
 	}
 }
 
+// Alternative returns a provider other than exclude, chosen by the load
+// balancing strategy, to fail over or hedge a send to exclude
+func (pm *ProviderManager) Alternative(ctx context.Context, exclude Provider) (Provider, error) {
+	candidates := make([]Provider, 0, len(pm.providers))
+	for _, provider := range pm.providers {
+		if provider != exclude {
+			candidates = append(candidates, provider)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no alternative to provider %s", exclude.Name())
+	}
+
+	switch pm.strategy {
+	case RoundRobin, Random:
+		return candidates[rand.Intn(len(candidates))], nil
+
+	case HealthBased:
+		for _, provider := range candidates {
+			if err := provider.HealthCheck(ctx); err == nil {
+				return provider, nil
+			}
+		}
+		return candidates[0], nil
+
+	default:
+		return candidates[0], nil
+	}
+}
+
 // GetAllProviders returns all registered providers
 func (pm *ProviderManager) GetAllProviders() []Provider {
 	return pm.providers
@@ -180,6 +249,9 @@ func (pm *ProviderManager) HealthCheckAll(ctx context.Context) map[string]error
 	for _, provider := range pm.providers {
 		results[provider.Name()] = provider.HealthCheck(ctx)
 	}
+	for _, provider := range pm.preferred {
+		results[provider.Name()] = provider.HealthCheck(ctx)
+	}
 
 	return results
 }
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -38,6 +39,13 @@ func TestMockProvider(t *testing.T) {
 		t.Errorf("Expected message ID to be set")
 	}
 
+	// IDs shorter than the part used in the message ID are used whole
+	notification.ID = "n1"
+	response, err = provider.Send(ctx, notification)
+	if err != nil || !strings.HasSuffix(response.MessageID, "_n1") {
+		t.Errorf("Expected message ID ending in the short ID, got %+v, %v", response, err)
+	}
+
 	// Test health check
 	err = provider.HealthCheck(ctx)
 	if err != nil {
@@ -132,3 +140,46 @@ func TestProviderManagerHealthBased(t *testing.T) {
 		t.Errorf("Expected healthy provider, got %s", provider.Name())
 	}
 }
+
+// onlineProvider accepts notifications of one user only
+type onlineProvider struct {
+	*MockProvider
+	userID string
+}
+
+func (op *onlineProvider) Accepts(ctx context.Context, notification *pkg.NotificationMessage) bool {
+	return notification.UserID == op.userID
+}
+
+func TestProviderManagerPreferred(t *testing.T) {
+	manager := NewProviderManager(Random)
+	manager.AddProvider(NewMockProvider("apns", 1.0, 0, 0))
+	manager.AddPreferred(&onlineProvider{MockProvider: NewMockProvider("gateway", 1.0, 0, 0), userID: "online"})
+
+	selected, err := manager.GetProviderFor(context.Background(), &pkg.NotificationMessage{UserID: "online"})
+	if err != nil || selected.Name() != "gateway" {
+		t.Errorf("Expected gateway for online user, got %v (%v)", selected, err)
+	}
+	selected, err = manager.GetProviderFor(context.Background(), &pkg.NotificationMessage{UserID: "offline"})
+	if err != nil || selected.Name() != "apns" {
+		t.Errorf("Expected apns for offline user, got %v (%v)", selected, err)
+	}
+}
+
+func TestProviderManagerAlternative(t *testing.T) {
+	manager := NewProviderManager(HealthBased)
+	primary := NewMockProvider("primary", 1.0, 0, 0)
+	manager.AddProvider(primary)
+
+	ctx := context.Background()
+	if _, err := manager.Alternative(ctx, primary); err == nil {
+		t.Errorf("Expected no alternative with a single provider")
+	}
+
+	secondary := NewMockProvider("secondary", 1.0, 0, 0)
+	manager.AddProvider(secondary)
+	alternative, err := manager.Alternative(ctx, primary)
+	if err != nil || alternative != secondary {
+		t.Errorf("Expected secondary as the alternative, got %v: %v", alternative, err)
+	}
+}
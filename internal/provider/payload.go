@@ -0,0 +1,206 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// Identifier limits imposed by the push services
+const (
+	apnsCollapseIDMaxLen = 64
+	webPushTopicMaxLen   = 32
+)
+
+// APNsPayload is the JSON body of an APNs request
+type APNsPayload struct {
+	Aps  APNsAps                `json:"aps"`
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// APNsAps is the Apple-defined part of an APNs payload
+type APNsAps struct {
+	Alert    APNsAlert `json:"alert"`
+	Badge    *int      `json:"badge,omitempty"`
+	Sound    string    `json:"sound,omitempty"`
+	ThreadID string    `json:"thread-id,omitempty"`
+}
+
+// APNsAlert is the visible part of an APNs notification
+type APNsAlert struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+// BuildAPNs builds the headers and payload of an APNs request. The collapse
+// key becomes the apns-collapse-id, so the device replaces the previous
+// notification, and the thread-id that groups them.
+func BuildAPNs(notification *pkg.NotificationMessage) (http.Header, *APNsPayload) {
+	headers := http.Header{}
+	headers.Set("apns-push-type", "alert")
+	headers.Set("apns-priority", apnsPriority(notification.Priority))
+	headers.Set("apns-expiration", expiration(notification.ExpiresAt))
+
+	payload := &APNsPayload{
+		Aps: APNsAps{
+			Alert: APNsAlert{Title: notification.Title, Body: notification.Body},
+			Badge: notification.Badge,
+			Sound: "default",
+		},
+		Data: notification.Data,
+	}
+
+	if notification.CollapseKey != "" {
+		headers.Set("apns-collapse-id", apnsCollapseID(notification.CollapseKey))
+		payload.Aps.ThreadID = notification.CollapseKey
+	}
+
+	return headers, payload
+}
+
+// FCMMessage is an FCM HTTP v1 message
+type FCMMessage struct {
+	Token        string            `json:"token"`
+	Notification *FCMNotification  `json:"notification,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      *FCMAndroidConfig `json:"android,omitempty"`
+	APNs         *FCMAPNsConfig    `json:"apns,omitempty"`
+}
+
+// FCMNotification is the visible part of an FCM message
+type FCMNotification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+// FCMAndroidConfig holds the Android specific options of an FCM message
+type FCMAndroidConfig struct {
+	CollapseKey string `json:"collapse_key,omitempty"`
+	Priority    string `json:"priority"`
+	TTL         string `json:"ttl,omitempty"`
+}
+
+// FCMAPNsConfig holds the APNs headers and payload FCM forwards to iOS devices
+type FCMAPNsConfig struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Payload *FCMAPNsPayload   `json:"payload,omitempty"`
+}
+
+// FCMAPNsPayload is the part of the APNs payload set through FCM
+type FCMAPNsPayload struct {
+	Aps FCMAps `json:"aps"`
+}
+
+// FCMAps holds the aps fields set through FCM
+type FCMAps struct {
+	Badge *int `json:"badge,omitempty"`
+}
+
+// BuildFCM builds an FCM message for a device token. The collapse key maps to
+// the Android collapse_key and to apns-collapse-id for iOS devices.
+func BuildFCM(notification *pkg.NotificationMessage, token string) *FCMMessage {
+	msg := &FCMMessage{
+		Token:        token,
+		Notification: &FCMNotification{Title: notification.Title, Body: notification.Body},
+		Data:         stringData(notification.Data),
+		Android:      &FCMAndroidConfig{Priority: "normal"},
+		APNs: &FCMAPNsConfig{Headers: map[string]string{
+			"apns-priority": apnsPriority(notification.Priority),
+		}},
+	}
+
+	if notification.Priority >= pkg.PriorityHigh {
+		msg.Android.Priority = "high"
+	}
+	if notification.ExpiresAt != nil {
+		ttl := time.Until(*notification.ExpiresAt)
+		if ttl < 0 {
+			ttl = 0
+		}
+		msg.Android.TTL = fmt.Sprintf("%ds", int(ttl.Seconds()))
+	}
+	if notification.Badge != nil {
+		msg.APNs.Payload = &FCMAPNsPayload{Aps: FCMAps{Badge: notification.Badge}}
+	}
+	if notification.CollapseKey != "" {
+		msg.Android.CollapseKey = notification.CollapseKey
+		msg.APNs.Headers["apns-collapse-id"] = apnsCollapseID(notification.CollapseKey)
+	}
+
+	return msg
+}
+
+// apnsPriority maps notification priority to apns-priority: 10 delivers
+// immediately, 5 lets the device save power
+func apnsPriority(priority pkg.Priority) string {
+	if priority >= pkg.PriorityHigh {
+		return "10"
+	}
+	return "5"
+}
+
+// expiration returns the apns-expiration value; 0 means deliver once or drop
+func expiration(expiresAt *time.Time) string {
+	if expiresAt == nil {
+		return "0"
+	}
+	return strconv.FormatInt(expiresAt.Unix(), 10)
+}
+
+// apnsCollapseID returns the collapse key, hashed when it exceeds the APNs limit
+func apnsCollapseID(key string) string {
+	if len(key) <= apnsCollapseIDMaxLen {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// webPushTopic returns the RFC 8030 Topic for a collapse key. Topics are at
+// most 32 characters of the base64url alphabet, so other keys are hashed.
+func webPushTopic(key string) string {
+	if len(key) <= webPushTopicMaxLen && isBase64URL(key) {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:webPushTopicMaxLen]
+}
+
+func isBase64URL(s string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// stringData converts notification data to the string map FCM requires
+func stringData(data map[string]interface{}) map[string]string {
+	if len(data) == 0 {
+		return nil
+	}
+
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		if s, ok := v.(string); ok {
+			values[k] = s
+			continue
+		}
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		values[k] = string(encoded)
+	}
+	return values
+}
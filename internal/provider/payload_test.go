@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+func TestBuildAPNs(t *testing.T) {
+	expires := time.Unix(1700000000, 0)
+	badge := 3
+	headers, payload := BuildAPNs(&pkg.NotificationMessage{
+		Title:       "New message",
+		Body:        "Hi",
+		Priority:    pkg.PriorityHigh,
+		ExpiresAt:   &expires,
+		CollapseKey: "chat-42",
+		Badge:       &badge,
+	})
+
+	if headers.Get("apns-collapse-id") != "chat-42" || payload.Aps.ThreadID != "chat-42" {
+		t.Errorf("Expected collapse key to map to apns-collapse-id and thread-id, got %v / %q", headers, payload.Aps.ThreadID)
+	}
+	if headers.Get("apns-priority") != "10" || headers.Get("apns-expiration") != "1700000000" {
+		t.Errorf("Unexpected headers %v", headers)
+	}
+	if payload.Aps.Alert.Title != "New message" || payload.Aps.Alert.Body != "Hi" {
+		t.Errorf("Unexpected alert %+v", payload.Aps.Alert)
+	}
+	if payload.Aps.Badge == nil || *payload.Aps.Badge != 3 {
+		t.Errorf("Expected badge 3, got %v", payload.Aps.Badge)
+	}
+
+	long := strings.Repeat("k", 100)
+	headers, _ = BuildAPNs(&pkg.NotificationMessage{CollapseKey: long})
+	if id := headers.Get("apns-collapse-id"); len(id) != apnsCollapseIDMaxLen || id == long[:apnsCollapseIDMaxLen] {
+		t.Errorf("Expected long collapse key to be hashed to %d bytes, got %q", apnsCollapseIDMaxLen, id)
+	}
+}
+
+func TestBuildFCM(t *testing.T) {
+	msg := BuildFCM(&pkg.NotificationMessage{
+		Title:       "New message",
+		Data:        map[string]interface{}{"chat": "42", "count": 3},
+		CollapseKey: "chat-42",
+	}, "device-token")
+
+	if msg.Token != "device-token" || msg.Android.CollapseKey != "chat-42" || msg.APNs.Headers["apns-collapse-id"] != "chat-42" {
+		t.Errorf("Expected collapse key to map to collapse_key and apns-collapse-id, got %+v", msg)
+	}
+	if msg.Android.Priority != "normal" {
+		t.Errorf("Expected normal priority, got %s", msg.Android.Priority)
+	}
+	if msg.Data["chat"] != "42" || msg.Data["count"] != "3" {
+		t.Errorf("Expected data values as strings, got %v", msg.Data)
+	}
+	if msg.APNs.Payload != nil {
+		t.Errorf("Expected no APNs payload without a badge, got %+v", msg.APNs.Payload)
+	}
+
+	badge := 0
+	msg = BuildFCM(&pkg.NotificationMessage{Title: "All read", Badge: &badge}, "device-token")
+	if msg.APNs.Payload == nil || msg.APNs.Payload.Aps.Badge == nil || *msg.APNs.Payload.Aps.Badge != 0 {
+		t.Errorf("Expected APNs badge 0 to be forwarded, got %+v", msg.APNs.Payload)
+	}
+}
+
+func TestWebPushTopic(t *testing.T) {
+	if topic := webPushTopic("chat-42"); topic != "chat-42" {
+		t.Errorf("Expected valid topic unchanged, got %s", topic)
+	}
+
+	topic := webPushTopic("chat:42 with spaces")
+	if len(topic) != webPushTopicMaxLen || !isBase64URL(topic) {
+		t.Errorf("Expected hashed base64url topic, got %q", topic)
+	}
+}
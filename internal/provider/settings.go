@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a send to providers without a configured timeout
+const DefaultTimeout = 10 * time.Second
+
+// Settings tune the calls to a provider. Timeout bounds a single send and
+// Retries is how many times a transient failure is retried on the provider
+// before the delivery fails over to another provider of the channel.
+type Settings struct {
+	Timeout time.Duration
+	Retries int
+}
+
+// SettingsTable holds the default settings of providers and overrides for
+// providers by name
+type SettingsTable struct {
+	defaults  Settings
+	overrides map[string]Settings
+	mu        sync.RWMutex
+}
+
+// NewSettingsTable creates a table applying defaults to every provider
+// without an override
+func NewSettingsTable(defaults Settings) *SettingsTable {
+	return &SettingsTable{
+		defaults:  defaults,
+		overrides: make(map[string]Settings),
+	}
+}
+
+// Set overrides the settings of a provider
+func (t *SettingsTable) Set(name string, settings Settings) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.overrides[name] = settings
+}
+
+// For returns the settings of a provider. A nil table, or a timeout that is
+// not positive, gives DefaultTimeout.
+func (t *SettingsTable) For(name string) Settings {
+	var settings Settings
+	if t != nil {
+		t.mu.RLock()
+		var ok bool
+		if settings, ok = t.overrides[name]; !ok {
+			settings = t.defaults
+		}
+		t.mu.RUnlock()
+	}
+	if settings.Timeout <= 0 {
+		settings.Timeout = DefaultTimeout
+	}
+	return settings
+}
@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// DataKeyPhone is the notification data key holding the recipient number for SMS delivery
+const DataKeyPhone = "phone"
+
+// SMSProvider delivers notifications as text messages through an HTTP SMS gateway
+type SMSProvider struct {
+	name     string
+	endpoint string
+	apiKey   string
+	sender   string
+	client   *http.Client
+}
+
+// smsRequest is the JSON body posted to the gateway
+type smsRequest struct {
+	To        string `json:"to"`
+	From      string `json:"from,omitempty"`
+	Text      string `json:"text"`
+	Reference string `json:"reference"`
+}
+
+// smsResponse is the JSON body returned by the gateway
+type smsResponse struct {
+	MessageID string `json:"message_id"`
+	Error     string `json:"error"`
+}
+
+// NewSMSProvider creates a new SMS provider posting to the given gateway endpoint
+func NewSMSProvider(name, endpoint, apiKey, sender string) *SMSProvider {
+	return &SMSProvider{
+		name:     name,
+		endpoint: endpoint,
+		apiKey:   apiKey,
+		sender:   sender,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name returns the provider name
+func (sp *SMSProvider) Name() string {
+	return sp.name
+}
+
+// Send delivers the notification to the number stored in Data["phone"]
+func (sp *SMSProvider) Send(ctx context.Context, notification *pkg.NotificationMessage) (*pkg.ProviderResponse, error) {
+	to, err := recipientFromData(notification, DataKeyPhone)
+	if err != nil {
+		return &pkg.ProviderResponse{Success: false, Error: err.Error(), Code: pkg.ErrorCodeInvalidRecipient}, nil
+	}
+
+	text := notification.Body
+	if notification.Title != "" {
+		text = notification.Title + ": " + notification.Body
+	}
+
+	body, err := json.Marshal(smsRequest{
+		To:        to,
+		From:      sp.sender,
+		Text:      text,
+		Reference: notification.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sms request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sp.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sms request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sp.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+sp.apiKey)
+	}
+
+	resp, err := sp.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sms gateway request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var gatewayResp smsResponse
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	json.Unmarshal(respBody, &gatewayResp)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return &pkg.ProviderResponse{
+			Success:   true,
+			MessageID: gatewayResp.MessageID,
+		}, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, &ThrottledError{
+			Provider:   sp.name,
+			RetryAfter: retryAfter(resp.Header, time.Now()),
+			Err:        fmt.Errorf("sms gateway returned %d: %s", resp.StatusCode, gatewayError(gatewayResp, respBody)),
+		}
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("sms gateway returned %d: %s", resp.StatusCode, gatewayError(gatewayResp, respBody))
+	default:
+		return &pkg.ProviderResponse{
+			Success: false,
+			Error:   fmt.Sprintf("sms gateway returned %d: %s", resp.StatusCode, gatewayError(gatewayResp, respBody)),
+			Code:    pkg.ErrorCodeRejected,
+		}, nil
+	}
+}
+
+// HealthCheck verifies that the gateway is reachable and not failing
+func (sp *SMSProvider) HealthCheck(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, sp.endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("provider %s is unhealthy: %w", sp.name, err)
+	}
+
+	resp, err := sp.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("provider %s is unhealthy: %w", sp.name, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("provider %s is unhealthy: status %d", sp.name, resp.StatusCode)
+	}
+	return nil
+}
+
+// gatewayError returns the most descriptive error text available
+func gatewayError(resp smsResponse, body []byte) string {
+	if resp.Error != "" {
+		return resp.Error
+	}
+	return string(bytes.TrimSpace(body))
+}
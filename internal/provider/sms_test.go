@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+func TestSMSProviderSend(t *testing.T) {
+	var received smsRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		json.NewEncoder(w).Encode(map[string]string{"message_id": "sms-1"})
+	}))
+	defer server.Close()
+
+	provider := NewSMSProvider("sms", server.URL, "secret", "ACME")
+	notification := &pkg.NotificationMessage{
+		ID:    "test-123",
+		Title: "Code",
+		Body:  "Your code is 1234",
+		Data:  map[string]interface{}{DataKeyPhone: "+15550100"},
+	}
+
+	response, err := provider.Send(context.Background(), notification)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !response.Success || response.MessageID != "sms-1" {
+		t.Errorf("Expected success with message ID sms-1, got %+v", response)
+	}
+	if received.To != "+15550100" || received.From != "ACME" || received.Text != "Code: Your code is 1234" {
+		t.Errorf("Unexpected gateway request %+v", received)
+	}
+}
+
+func TestSMSProviderGatewayErrors(t *testing.T) {
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid number"})
+	}))
+	defer server.Close()
+
+	provider := NewSMSProvider("sms", server.URL, "", "")
+	notification := &pkg.NotificationMessage{
+		ID:   "test-123",
+		Body: "hello",
+		Data: map[string]interface{}{DataKeyPhone: "not-a-number"},
+	}
+
+	// Client errors are permanent failures
+	response, err := provider.Send(context.Background(), notification)
+	if err != nil {
+		t.Fatalf("Expected no error for 4xx, got %v", err)
+	}
+	if response.Success || response.Error == "" || response.Code != pkg.ErrorCodeRejected {
+		t.Errorf("Expected failed response with error, got %+v", response)
+	}
+
+	// Server errors are returned as errors so they are retried
+	status = http.StatusServiceUnavailable
+	if _, err := provider.Send(context.Background(), notification); err == nil {
+		t.Errorf("Expected error for 5xx response")
+	}
+}
+
+func TestSMSProviderThrottled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "slow down"})
+	}))
+	defer server.Close()
+
+	provider := NewSMSProvider("sms", server.URL, "", "")
+	notification := &pkg.NotificationMessage{
+		ID:   "test-123",
+		Body: "hello",
+		Data: map[string]interface{}{DataKeyPhone: "+15555550100"},
+	}
+
+	response, err := provider.Send(context.Background(), notification)
+	retryAfter, throttled := Throttled(response, err)
+	if !throttled {
+		t.Fatalf("Expected 429 to be reported as throttling, got %v", err)
+	}
+	if retryAfter != 30*time.Second {
+		t.Errorf("Expected Retry-After of 30s, got %v", retryAfter)
+	}
+}
+
+func TestThrottledResponse(t *testing.T) {
+	if _, throttled := Throttled(&pkg.ProviderResponse{Error: "rate limit exceeded", Throttled: true}, nil); !throttled {
+		t.Errorf("Expected throttled response to be detected")
+	}
+	if _, throttled := Throttled(&pkg.ProviderResponse{Error: "invalid token"}, nil); throttled {
+		t.Errorf("Expected other failures not to count as throttling")
+	}
+
+	now := time.Now()
+	header := http.Header{}
+	header.Set("Retry-After", now.Add(time.Minute).UTC().Format(http.TimeFormat))
+	if wait := retryAfter(header, now); wait < 58*time.Second || wait > time.Minute {
+		t.Errorf("Expected Retry-After date about a minute away, got %v", wait)
+	}
+}
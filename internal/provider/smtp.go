@@ -0,0 +1,192 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// DataKeyEmail is the notification data key holding the recipient address for email delivery
+const DataKeyEmail = "email"
+
+// SMTPProvider delivers notifications as plain-text email through an SMTP relay
+type SMTPProvider struct {
+	name     string
+	addr     string
+	from     string
+	username string
+	password string
+	dialer   *net.Dialer
+}
+
+// NewSMTPProvider creates a new SMTP email provider. Authentication is only
+// attempted when a username is set.
+func NewSMTPProvider(name, addr, from, username, password string) *SMTPProvider {
+	return &SMTPProvider{
+		name:     name,
+		addr:     addr,
+		from:     from,
+		username: username,
+		password: password,
+		dialer:   &net.Dialer{Timeout: 10 * time.Second},
+	}
+}
+
+// Name returns the provider name
+func (sp *SMTPProvider) Name() string {
+	return sp.name
+}
+
+// Send delivers the notification to the address stored in Data["email"]
+func (sp *SMTPProvider) Send(ctx context.Context, notification *pkg.NotificationMessage) (*pkg.ProviderResponse, error) {
+	to, err := recipientFromData(notification, DataKeyEmail)
+	if err != nil {
+		return &pkg.ProviderResponse{Success: false, Error: err.Error(), Code: pkg.ErrorCodeInvalidRecipient}, nil
+	}
+
+	client, err := sp.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	messageID := fmt.Sprintf("%s.%d@%s", notification.ID, time.Now().UnixNano(), sp.name)
+
+	if err := client.Mail(sp.from); err != nil {
+		return smtpResponse(err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return smtpResponse(err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return smtpResponse(err)
+	}
+	if _, err := w.Write(sp.buildMessage(notification, to, messageID)); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to write message body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return smtpResponse(err)
+	}
+
+	// The message is accepted once DATA completes; a failed QUIT is not a delivery failure
+	client.Quit()
+
+	return &pkg.ProviderResponse{
+		Success:   true,
+		MessageID: messageID,
+	}, nil
+}
+
+// HealthCheck verifies that the SMTP relay accepts connections
+func (sp *SMTPProvider) HealthCheck(ctx context.Context) error {
+	client, err := sp.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("provider %s is unhealthy: %w", sp.name, err)
+	}
+	defer client.Close()
+
+	if err := client.Noop(); err != nil {
+		return fmt.Errorf("provider %s is unhealthy: %w", sp.name, err)
+	}
+	return client.Quit()
+}
+
+// dial connects to the relay, upgrades to TLS when offered and authenticates
+func (sp *SMTPProvider) dial(ctx context.Context) (*smtp.Client, error) {
+	conn, err := sp.dialer.DialContext(ctx, "tcp", sp.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, err := net.SplitHostPort(sp.addr)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("invalid smtp address %q: %w", sp.addr, err)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("smtp handshake failed: %w", err)
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("smtp starttls failed: %w", err)
+		}
+	}
+
+	if sp.username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtp.PlainAuth("", sp.username, sp.password, host)); err != nil {
+				client.Close()
+				return nil, fmt.Errorf("smtp authentication failed: %w", err)
+			}
+		}
+	}
+
+	return client, nil
+}
+
+// buildMessage renders the RFC 5322 message for a notification
+func (sp *SMTPProvider) buildMessage(notification *pkg.NotificationMessage, to, messageID string) []byte {
+	var b strings.Builder
+
+	b.WriteString("From: " + sp.from + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", stripNewlines(notification.Title)) + "\r\n")
+	b.WriteString("Date: " + time.Now().UTC().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("Message-ID: <" + messageID + ">\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(notification.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
+
+// smtpResponse maps permanent (5xx) SMTP replies to a failed provider response
+// and everything else to an error so the worker retries it
+func smtpResponse(err error) (*pkg.ProviderResponse, error) {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return &pkg.ProviderResponse{
+			Success: false,
+			Error:   fmt.Sprintf("smtp %d: %s", protoErr.Code, protoErr.Msg),
+			Code:    pkg.ErrorCodeRejected,
+		}, nil
+	}
+	return nil, fmt.Errorf("smtp error: %w", err)
+}
+
+// recipientFromData extracts a non-empty string recipient from notification data
+func recipientFromData(notification *pkg.NotificationMessage, key string) (string, error) {
+	value, ok := notification.Data[key].(string)
+	if !ok || strings.TrimSpace(value) == "" {
+		return "", fmt.Errorf("notification %s has no %s recipient", notification.ID, key)
+	}
+	return stripNewlines(strings.TrimSpace(value)), nil
+}
+
+// stripNewlines prevents header injection through user supplied values
+func stripNewlines(s string) string {
+	return strings.NewReplacer("\r", "", "\n", " ").Replace(s)
+}
@@ -0,0 +1,192 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// smtpStandIn is a minimal local SMTP server that records received messages
+type smtpStandIn struct {
+	listener   net.Listener
+	rejectRcpt bool
+
+	mu       sync.Mutex
+	from     string
+	rcpts    []string
+	messages []string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	s := &smtpStandIn{listener: listener}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *smtpStandIn) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *smtpStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP stand-in")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = strings.TrimSpace(line[len("MAIL FROM:"):])
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			if s.rejectRcpt {
+				reply("550 mailbox unavailable")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.TrimSpace(line[len("RCPT TO:"):]))
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 OK queued")
+		case cmd == "NOOP", cmd == "RSET":
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+func TestSMTPProviderSend(t *testing.T) {
+	server := newSMTPStandIn(t)
+	provider := NewSMTPProvider("smtp", server.addr(), "noreply@example.com", "", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	notification := &pkg.NotificationMessage{
+		ID:     "test-123",
+		UserID: "user-456",
+		Title:  "Weekly report",
+		Body:   "Your report is ready",
+		Data:   map[string]interface{}{DataKeyEmail: "user@example.com"},
+	}
+
+	response, err := provider.Send(ctx, notification)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !response.Success {
+		t.Fatalf("Expected successful response, got error %s", response.Error)
+	}
+	if response.MessageID == "" {
+		t.Errorf("Expected message ID to be set")
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if server.from != "<noreply@example.com>" {
+		t.Errorf("Expected sender <noreply@example.com>, got %s", server.from)
+	}
+	if len(server.rcpts) != 1 || server.rcpts[0] != "<user@example.com>" {
+		t.Errorf("Expected recipient <user@example.com>, got %v", server.rcpts)
+	}
+	if len(server.messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(server.messages))
+	}
+	if !strings.Contains(server.messages[0], "Subject: Weekly report") {
+		t.Errorf("Expected subject header in message, got %q", server.messages[0])
+	}
+	if !strings.Contains(server.messages[0], "Your report is ready") {
+		t.Errorf("Expected body in message, got %q", server.messages[0])
+	}
+
+	if err := provider.HealthCheck(ctx); err != nil {
+		t.Errorf("Expected health check to pass, got %v", err)
+	}
+}
+
+func TestSMTPProviderPermanentFailure(t *testing.T) {
+	server := newSMTPStandIn(t)
+	server.rejectRcpt = true
+	provider := NewSMTPProvider("smtp", server.addr(), "noreply@example.com", "", "")
+
+	notification := &pkg.NotificationMessage{
+		ID:   "test-123",
+		Data: map[string]interface{}{DataKeyEmail: "missing@example.com"},
+	}
+
+	response, err := provider.Send(context.Background(), notification)
+	if err != nil {
+		t.Fatalf("Expected rejection as a failed response, got error %v", err)
+	}
+	if response.Success {
+		t.Errorf("Expected failed response")
+	}
+	if !strings.Contains(response.Error, "550") {
+		t.Errorf("Expected error to contain SMTP code, got %s", response.Error)
+	}
+}
+
+func TestSMTPProviderMissingRecipient(t *testing.T) {
+	provider := NewSMTPProvider("smtp", "127.0.0.1:1", "noreply@example.com", "", "")
+
+	response, err := provider.Send(context.Background(), &pkg.NotificationMessage{ID: "test-123"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.Success || response.Code != pkg.ErrorCodeInvalidRecipient {
+		t.Errorf("Expected failed response when recipient is missing, got %+v", response)
+	}
+}
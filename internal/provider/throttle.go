@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// ThrottledError is returned when a provider rejects a request because we
+// exceeded its rate limit. RetryAfter is the wait the provider asked for, or
+// 0 if it gave none.
+type ThrottledError struct {
+	Provider   string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ThrottledError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("provider %s throttled, retry after %v: %v", e.Provider, e.RetryAfter, e.Err)
+	}
+	return fmt.Sprintf("provider %s throttled: %v", e.Provider, e.Err)
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return e.Err
+}
+
+// Throttled reports whether the result of a Send means the provider is
+// throttling us, and how long it asked us to wait
+func Throttled(response *pkg.ProviderResponse, err error) (time.Duration, bool) {
+	var throttled *ThrottledError
+	if errors.As(err, &throttled) {
+		return throttled.RetryAfter, true
+	}
+	if err == nil && response != nil && response.Throttled {
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
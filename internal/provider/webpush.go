@@ -0,0 +1,204 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/webpush"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// SubscriptionStore provides the Web Push subscriptions registered for a user
+type SubscriptionStore interface {
+	Subscriptions(ctx context.Context, userID string) ([]pkg.PushSubscription, error)
+	RemoveSubscription(ctx context.Context, userID, endpoint string) error
+}
+
+// errSubscriptionGone signals a subscription the push service no longer
+// accepts (404/410) or one whose stored keys are unusable
+var errSubscriptionGone = errors.New("subscription is no longer valid")
+
+// WebPushProvider delivers notifications to browsers through their push
+// services using VAPID authentication and RFC 8291 payload encryption
+type WebPushProvider struct {
+	name    string
+	keys    *webpush.VAPIDKeys
+	subject string
+	store   SubscriptionStore
+	client  *http.Client
+	ttl     time.Duration
+}
+
+// webPushPayload is the JSON document encrypted for the service worker
+type webPushPayload struct {
+	ID    string                 `json:"id"`
+	Title string                 `json:"title"`
+	Body  string                 `json:"body"`
+	Data  map[string]interface{} `json:"data,omitempty"`
+}
+
+// NewWebPushProvider creates a new Web Push provider. subject is the VAPID
+// contact URI (mailto: or https:) sent to push services.
+func NewWebPushProvider(name string, keys *webpush.VAPIDKeys, subject string, store SubscriptionStore) *WebPushProvider {
+	return &WebPushProvider{
+		name:    name,
+		keys:    keys,
+		subject: subject,
+		store:   store,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		ttl:     24 * time.Hour,
+	}
+}
+
+// Name returns the provider name
+func (wp *WebPushProvider) Name() string {
+	return wp.name
+}
+
+// Send encrypts the notification for every subscription of the user and posts
+// it to the respective push services. Subscriptions rejected with 404 or 410
+// are permanently invalid and removed from the store.
+func (wp *WebPushProvider) Send(ctx context.Context, notification *pkg.NotificationMessage) (*pkg.ProviderResponse, error) {
+	subscriptions, err := wp.store.Subscriptions(ctx, notification.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load subscriptions: %w", err)
+	}
+	if len(subscriptions) == 0 {
+		return &pkg.ProviderResponse{
+			Success: false,
+			Error:   fmt.Sprintf("no web push subscriptions for user %s", notification.UserID),
+			Code:    pkg.ErrorCodeInvalidRecipient,
+		}, nil
+	}
+
+	payload, err := json.Marshal(webPushPayload{
+		ID:    notification.ID,
+		Title: notification.Title,
+		Body:  notification.Body,
+		Data:  notification.Data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal web push payload: %w", err)
+	}
+
+	var delivered, invalid int
+	var lastErr error
+	var messageID string
+
+	for _, sub := range subscriptions {
+		location, err := wp.push(ctx, sub, payload, notification)
+		switch {
+		case err == nil:
+			delivered++
+			if messageID == "" {
+				messageID = location
+			}
+		case errors.Is(err, errSubscriptionGone):
+			invalid++
+			if err := wp.store.RemoveSubscription(ctx, notification.UserID, sub.Endpoint); err != nil {
+				log.Printf("Failed to remove expired subscription for user %s: %v", notification.UserID, err)
+			}
+		default:
+			lastErr = err
+		}
+	}
+
+	if delivered > 0 {
+		return &pkg.ProviderResponse{Success: true, MessageID: messageID}, nil
+	}
+	if lastErr != nil {
+		// Transient failures are returned as errors so the worker retries them
+		return nil, lastErr
+	}
+	return &pkg.ProviderResponse{
+		Success: false,
+		Error:   fmt.Sprintf("all %d web push subscriptions are invalid", invalid),
+		Code:    pkg.ErrorCodeUnregistered,
+	}, nil
+}
+
+// push sends one encrypted message and returns the push service message location
+func (wp *WebPushProvider) push(ctx context.Context, sub pkg.PushSubscription, payload []byte, notification *pkg.NotificationMessage) (string, error) {
+	p256dh, err := webpush.DecodeKey(sub.Keys.P256dh)
+	if err != nil {
+		return "", errSubscriptionGone
+	}
+	auth, err := webpush.DecodeKey(sub.Keys.Auth)
+	if err != nil {
+		return "", errSubscriptionGone
+	}
+
+	body, err := webpush.Encrypt(payload, p256dh, auth)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt payload: %w", err)
+	}
+
+	authorization, err := wp.keys.AuthorizationHeader(sub.Endpoint, wp.subject, time.Now().Add(12*time.Hour))
+	if err != nil {
+		return "", errSubscriptionGone
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create push request: %w", err)
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(wp.ttl.Seconds())))
+	req.Header.Set("Urgency", urgency(notification.Priority))
+	if notification.CollapseKey != "" {
+		// The push service replaces an undelivered message with the same topic
+		req.Header.Set("Topic", webPushTopic(notification.CollapseKey))
+	}
+
+	resp, err := wp.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("push service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.Header.Get("Location"), nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return "", errSubscriptionGone
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return "", &ThrottledError{
+			Provider:   wp.name,
+			RetryAfter: retryAfter(resp.Header, time.Now()),
+			Err:        fmt.Errorf("push service returned %d: %s", resp.StatusCode, bytes.TrimSpace(respBody)),
+		}
+	default:
+		return "", fmt.Errorf("push service returned %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+}
+
+// HealthCheck verifies that the subscription store is reachable
+func (wp *WebPushProvider) HealthCheck(ctx context.Context) error {
+	if _, err := wp.store.Subscriptions(ctx, "healthcheck"); err != nil {
+		return fmt.Errorf("provider %s is unhealthy: %w", wp.name, err)
+	}
+	return nil
+}
+
+// urgency maps notification priority to the RFC 8030 Urgency header
+func urgency(priority pkg.Priority) string {
+	switch priority {
+	case pkg.PriorityLow:
+		return "low"
+	case pkg.PriorityHigh, pkg.PriorityUrgent:
+		return "high"
+	default:
+		return "normal"
+	}
+}
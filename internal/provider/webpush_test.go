@@ -0,0 +1,218 @@
+package provider
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/webpush"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// memorySubscriptionStore is an in-memory SubscriptionStore for tests
+type memorySubscriptionStore struct {
+	mu   sync.Mutex
+	subs map[string][]pkg.PushSubscription
+}
+
+func (m *memorySubscriptionStore) Subscriptions(ctx context.Context, userID string) ([]pkg.PushSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]pkg.PushSubscription(nil), m.subs[userID]...), nil
+}
+
+func (m *memorySubscriptionStore) RemoveSubscription(ctx context.Context, userID, endpoint string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.subs[userID][:0]
+	for _, sub := range m.subs[userID] {
+		if sub.Endpoint != endpoint {
+			kept = append(kept, sub)
+		}
+	}
+	m.subs[userID] = kept
+	return nil
+}
+
+// browser holds the user agent side keys of a subscription
+type browser struct {
+	private *ecdh.PrivateKey
+	auth    []byte
+}
+
+func newBrowser(t *testing.T) *browser {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate browser key: %v", err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	return &browser{private: key, auth: auth}
+}
+
+func (b *browser) subscription(endpoint string) pkg.PushSubscription {
+	return pkg.PushSubscription{
+		Endpoint: endpoint,
+		Keys: pkg.PushSubscriptionKeys{
+			P256dh: base64.RawURLEncoding.EncodeToString(b.private.PublicKey().Bytes()),
+			Auth:   base64.RawURLEncoding.EncodeToString(b.auth),
+		},
+	}
+}
+
+// verifyVAPID checks the Authorization header the way a push service does
+func verifyVAPID(t *testing.T, r *http.Request, expectedKey string) {
+	t.Helper()
+	header := strings.TrimPrefix(r.Header.Get("Authorization"), "vapid ")
+
+	var token, key string
+	for _, part := range strings.Split(header, ", ") {
+		if strings.HasPrefix(part, "t=") {
+			token = part[2:]
+		} else if strings.HasPrefix(part, "k=") {
+			key = part[2:]
+		}
+	}
+	if key != expectedKey {
+		t.Errorf("Expected VAPID key %s, got %s", expectedKey, key)
+	}
+
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		t.Fatalf("Expected compact JWT, got %q", token)
+	}
+
+	rawKey, _ := base64.RawURLEncoding.DecodeString(key)
+	publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(rawKey[1:33]), Y: new(big.Int).SetBytes(rawKey[33:])}
+	signature, _ := base64.RawURLEncoding.DecodeString(segments[2])
+	digest := sha256.Sum256([]byte(segments[0] + "." + segments[1]))
+	if len(signature) != 64 || !ecdsa.Verify(publicKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		t.Errorf("VAPID JWT signature did not verify")
+	}
+
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(segments[1])
+	var claims map[string]interface{}
+	json.Unmarshal(claimsJSON, &claims)
+	if claims["aud"] != "http://"+r.Host {
+		t.Errorf("Expected aud http://%s, got %v", r.Host, claims["aud"])
+	}
+}
+
+func TestWebPushProviderSend(t *testing.T) {
+	keys, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("Failed to generate VAPID keys: %v", err)
+	}
+	ua := newBrowser(t)
+
+	var received webPushPayload
+	var urgencyHeader, topicHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verifyVAPID(t, r, keys.PublicKey())
+		if r.Header.Get("Content-Encoding") != "aes128gcm" {
+			t.Errorf("Expected aes128gcm content encoding, got %s", r.Header.Get("Content-Encoding"))
+		}
+		if r.Header.Get("TTL") == "" {
+			t.Errorf("Expected TTL header")
+		}
+		urgencyHeader = r.Header.Get("Urgency")
+		topicHeader = r.Header.Get("Topic")
+
+		body, _ := io.ReadAll(r.Body)
+		plaintext, err := webpush.Decrypt(body, ua.private, ua.auth)
+		if err != nil {
+			t.Errorf("Push service failed to decrypt payload: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.Unmarshal(plaintext, &received)
+
+		w.Header().Set("Location", "/messages/42")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	store := &memorySubscriptionStore{subs: map[string][]pkg.PushSubscription{
+		"user-456": {ua.subscription(server.URL + "/push/abc")},
+	}}
+	provider := NewWebPushProvider("webpush", keys, "mailto:ops@example.com", store)
+
+	response, err := provider.Send(context.Background(), &pkg.NotificationMessage{
+		ID:          "test-123",
+		UserID:      "user-456",
+		Title:       "Hello",
+		Body:        "From the browser",
+		Priority:    pkg.PriorityUrgent,
+		CollapseKey: "chat-42",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !response.Success || response.MessageID != "/messages/42" {
+		t.Errorf("Expected success with message location, got %+v", response)
+	}
+	if received.ID != "test-123" || received.Title != "Hello" || received.Body != "From the browser" {
+		t.Errorf("Unexpected decrypted payload %+v", received)
+	}
+	if urgencyHeader != "high" {
+		t.Errorf("Expected urgency high, got %s", urgencyHeader)
+	}
+	if topicHeader != "chat-42" {
+		t.Errorf("Expected topic chat-42, got %s", topicHeader)
+	}
+}
+
+func TestWebPushProviderRemovesGoneSubscriptions(t *testing.T) {
+	keys, _ := webpush.GenerateVAPIDKeys()
+	ua := newBrowser(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/push/gone":
+			w.WriteHeader(http.StatusGone)
+		case "/push/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	store := &memorySubscriptionStore{subs: map[string][]pkg.PushSubscription{
+		"user-456": {ua.subscription(server.URL + "/push/gone"), ua.subscription(server.URL + "/push/missing")},
+	}}
+	provider := NewWebPushProvider("webpush", keys, "mailto:ops@example.com", store)
+	notification := &pkg.NotificationMessage{ID: "test-123", UserID: "user-456", Title: "Hi"}
+
+	response, err := provider.Send(context.Background(), notification)
+	if err != nil {
+		t.Fatalf("Expected invalid subscriptions to be a failed response, got error %v", err)
+	}
+	if response.Success {
+		t.Errorf("Expected failed response")
+	}
+	if subs, _ := store.Subscriptions(context.Background(), "user-456"); len(subs) != 0 {
+		t.Errorf("Expected gone subscriptions to be removed, %d remain", len(subs))
+	}
+
+	// Transient push service errors surface as errors so they are retried
+	store.subs["user-456"] = []pkg.PushSubscription{ua.subscription(server.URL + "/push/busy")}
+	if _, err := provider.Send(context.Background(), notification); err == nil {
+		t.Errorf("Expected error for unavailable push service")
+	}
+	if subs, _ := store.Subscriptions(context.Background(), "user-456"); len(subs) != 1 {
+		t.Errorf("Expected subscription to be kept on transient error")
+	}
+}
@@ -0,0 +1,210 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Mode decides what happens to notifications of a tenant over its quota
+type Mode string
+
+const (
+	// ModeReject drops over-quota notifications; /send answers 429
+	ModeReject Mode = "reject"
+	// ModeQueue holds over-quota notifications until the quota allows them
+	ModeQueue Mode = "queue"
+)
+
+// IsValid reports whether the mode is known; empty means ModeReject
+func (m Mode) IsValid() bool {
+	switch m {
+	case "", ModeReject, ModeQueue:
+		return true
+	default:
+		return false
+	}
+}
+
+// Policy is the aggregate throughput quota of a tenant. A limit of 0 means
+// unlimited.
+type Policy struct {
+	PerSecond int64 `json:"per_second"`
+	PerDay    int64 `json:"per_day"`
+	Mode      Mode  `json:"mode"`
+}
+
+// Validate checks the policy's limits and mode
+func (p Policy) Validate() error {
+	if p.PerSecond < 0 || p.PerDay < 0 {
+		return fmt.Errorf("quota limits must not be negative")
+	}
+	if !p.Mode.IsValid() {
+		return fmt.Errorf("unknown quota mode %q", p.Mode)
+	}
+	return nil
+}
+
+// Unlimited reports whether the policy sets no limit at all
+func (p Policy) Unlimited() bool {
+	return p.PerSecond == 0 && p.PerDay == 0
+}
+
+// Decision is the result of checking or charging a quota
+type Decision struct {
+	Allowed bool `json:"allowed"`
+	Mode    Mode `json:"mode"`
+	// RetryAfter is how long until the exhausted window reopens
+	RetryAfter time.Duration `json:"-"`
+	// Usage of the current second and day, including the charge if allowed
+	Second int64 `json:"second"`
+	Day    int64 `json:"day"`
+}
+
+// RetryAt returns when an over-quota notification may be retried
+func (d Decision) RetryAt(now time.Time) time.Time {
+	return now.Add(d.RetryAfter)
+}
+
+// Usage is the traffic of a tenant on one UTC day, for billing
+type Usage struct {
+	Date     string `json:"date,omitempty"`
+	Accepted int64  `json:"accepted"`
+	Rejected int64  `json:"rejected"`
+	Queued   int64  `json:"queued"`
+}
+
+// Store keeps quota policies and counters. Charge must check and count
+// atomically across instances.
+type Store interface {
+	Policy(ctx context.Context, tenantID string) (*Policy, error)
+	SetPolicy(ctx context.Context, tenantID string, policy Policy) error
+	Charge(ctx context.Context, tenantID string, policy Policy, n int64, now time.Time) (Decision, error)
+	Peek(ctx context.Context, tenantID string, policy Policy, now time.Time) (Decision, error)
+	RecordOverQuota(ctx context.Context, tenantID string, mode Mode, n int64, now time.Time) error
+	Usage(ctx context.Context, tenantID string, from, to time.Time) ([]Usage, error)
+}
+
+// Enforcer applies tenant quota policies, falling back to a default policy
+// for tenants without their own
+type Enforcer struct {
+	store    Store
+	defaults Policy
+}
+
+// NewEnforcer creates a quota enforcer
+func NewEnforcer(store Store, defaults Policy) *Enforcer {
+	if defaults.Mode == "" {
+		defaults.Mode = ModeReject
+	}
+	return &Enforcer{store: store, defaults: defaults}
+}
+
+// Policy returns the effective policy of a tenant
+func (e *Enforcer) Policy(ctx context.Context, tenantID string) (Policy, error) {
+	policy, err := e.store.Policy(ctx, tenantID)
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to load quota policy: %w", err)
+	}
+	if policy == nil {
+		return e.defaults, nil
+	}
+	if policy.Mode == "" {
+		policy.Mode = ModeReject
+	}
+	return *policy, nil
+}
+
+// SetPolicy stores a tenant's own policy
+func (e *Enforcer) SetPolicy(ctx context.Context, tenantID string, policy Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	if policy.Mode == "" {
+		policy.Mode = ModeReject
+	}
+	return e.store.SetPolicy(ctx, tenantID, policy)
+}
+
+// Check reports whether the tenant currently has quota left, without
+// charging it
+func (e *Enforcer) Check(ctx context.Context, tenantID string) (Decision, error) {
+	policy, err := e.Policy(ctx, tenantID)
+	if err != nil {
+		return Decision{}, err
+	}
+	if policy.Unlimited() {
+		return Decision{Allowed: true, Mode: policy.Mode}, nil
+	}
+	return e.store.Peek(ctx, tenantID, policy, time.Now())
+}
+
+// Admit checks at ingress whether n notifications may be accepted. Under
+// ModeReject an exhausted quota refuses them and counts them as rejected;
+// under ModeQueue they are admitted and wait for quota in the pipeline.
+func (e *Enforcer) Admit(ctx context.Context, tenantID string, n int64) (Decision, error) {
+	decision, err := e.Check(ctx, tenantID)
+	if err != nil {
+		return Decision{}, err
+	}
+	if decision.Allowed || decision.Mode == ModeQueue {
+		decision.Allowed = true
+		return decision, nil
+	}
+	if err := e.store.RecordOverQuota(ctx, tenantID, ModeReject, n, time.Now()); err != nil {
+		return decision, fmt.Errorf("failed to record quota usage: %w", err)
+	}
+	return decision, nil
+}
+
+// Charge counts n notifications against the tenant's quota if they fit.
+// Over-quota notifications are counted as rejected or queued by mode.
+func (e *Enforcer) Charge(ctx context.Context, tenantID string, n int64) (Decision, error) {
+	return e.charge(ctx, tenantID, n, true)
+}
+
+// Recharge counts n notifications that were queued for quota against the
+// tenant's quota if they fit. They were counted as queued when first over
+// quota and are not counted again.
+func (e *Enforcer) Recharge(ctx context.Context, tenantID string, n int64) (Decision, error) {
+	return e.charge(ctx, tenantID, n, false)
+}
+
+// charge counts n notifications if they fit, recording them as over quota
+// when they do not and record is set
+func (e *Enforcer) charge(ctx context.Context, tenantID string, n int64, record bool) (Decision, error) {
+	policy, err := e.Policy(ctx, tenantID)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	now := time.Now()
+	decision, err := e.store.Charge(ctx, tenantID, policy, n, now)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to charge quota: %w", err)
+	}
+	if !decision.Allowed && record {
+		if err := e.store.RecordOverQuota(ctx, tenantID, policy.Mode, n, now); err != nil {
+			return decision, fmt.Errorf("failed to record quota usage: %w", err)
+		}
+	}
+	return decision, nil
+}
+
+// Usage returns the daily usage of a tenant between two dates inclusive
+func (e *Enforcer) Usage(ctx context.Context, tenantID string, from, to time.Time) ([]Usage, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("usage range ends before it starts")
+	}
+	return e.store.Usage(ctx, tenantID, from, to)
+}
+
+// RetryAfter returns how long until the window that was exceeded reopens:
+// the next second or the next UTC day
+func RetryAfter(now time.Time, daily bool) time.Duration {
+	now = now.UTC()
+	if daily {
+		return now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+	}
+	return now.Truncate(time.Second).Add(time.Second).Sub(now)
+}
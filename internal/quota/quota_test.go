@@ -0,0 +1,169 @@
+package quota
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// memoryStore is an in-memory Store counting per second and per day
+type memoryStore struct {
+	policies map[string]Policy
+	seconds  map[string]int64
+	usage    map[string]*Usage
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{policies: make(map[string]Policy), seconds: make(map[string]int64), usage: make(map[string]*Usage)}
+}
+
+func (m *memoryStore) day(tenantID string, now time.Time) *Usage {
+	key := tenantID + now.UTC().Format(time.DateOnly)
+	if _, ok := m.usage[key]; !ok {
+		m.usage[key] = &Usage{Date: now.UTC().Format(time.DateOnly)}
+	}
+	return m.usage[key]
+}
+
+func (m *memoryStore) Policy(ctx context.Context, tenantID string) (*Policy, error) {
+	policy, ok := m.policies[tenantID]
+	if !ok {
+		return nil, nil
+	}
+	return &policy, nil
+}
+
+func (m *memoryStore) SetPolicy(ctx context.Context, tenantID string, policy Policy) error {
+	m.policies[tenantID] = policy
+	return nil
+}
+
+func (m *memoryStore) Charge(ctx context.Context, tenantID string, policy Policy, n int64, now time.Time) (Decision, error) {
+	secondKey := tenantID + now.Format(time.RFC3339)
+	usage := m.day(tenantID, now)
+
+	decision := Decision{Allowed: true, Mode: policy.Mode}
+	switch {
+	case policy.PerDay > 0 && usage.Accepted+n > policy.PerDay:
+		decision.Allowed, decision.RetryAfter = false, RetryAfter(now, true)
+	case policy.PerSecond > 0 && m.seconds[secondKey]+n > policy.PerSecond:
+		decision.Allowed, decision.RetryAfter = false, RetryAfter(now, false)
+	default:
+		m.seconds[secondKey] += n
+		usage.Accepted += n
+	}
+	decision.Second, decision.Day = m.seconds[secondKey], usage.Accepted
+	return decision, nil
+}
+
+func (m *memoryStore) Peek(ctx context.Context, tenantID string, policy Policy, now time.Time) (Decision, error) {
+	second := m.seconds[tenantID+now.Format(time.RFC3339)]
+	day := m.day(tenantID, now).Accepted
+	decision := Decision{Allowed: true, Mode: policy.Mode, Second: second, Day: day}
+	switch {
+	case policy.PerDay > 0 && day >= policy.PerDay:
+		decision.Allowed, decision.RetryAfter = false, RetryAfter(now, true)
+	case policy.PerSecond > 0 && second >= policy.PerSecond:
+		decision.Allowed, decision.RetryAfter = false, RetryAfter(now, false)
+	}
+	return decision, nil
+}
+
+func (m *memoryStore) RecordOverQuota(ctx context.Context, tenantID string, mode Mode, n int64, now time.Time) error {
+	if mode == ModeQueue {
+		m.day(tenantID, now).Queued += n
+	} else {
+		m.day(tenantID, now).Rejected += n
+	}
+	return nil
+}
+
+func (m *memoryStore) Usage(ctx context.Context, tenantID string, from, to time.Time) ([]Usage, error) {
+	return []Usage{*m.day(tenantID, from)}, nil
+}
+
+func TestEnforcerDailyQuota(t *testing.T) {
+	store := newMemoryStore()
+	enforcer := NewEnforcer(store, Policy{})
+	ctx := context.Background()
+
+	if err := enforcer.SetPolicy(ctx, "acme", Policy{PerDay: 2}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if d, err := enforcer.Charge(ctx, "acme", 1); err != nil || !d.Allowed {
+			t.Fatalf("Expected charge %d to be allowed, got %+v, %v", i, d, err)
+		}
+	}
+
+	d, err := enforcer.Charge(ctx, "acme", 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if d.Allowed || d.Mode != ModeReject || d.RetryAfter <= 0 || d.RetryAfter > 24*time.Hour {
+		t.Errorf("Expected rejection until the next day, got %+v", d)
+	}
+
+	if d, _ := enforcer.Admit(ctx, "acme", 1); d.Allowed {
+		t.Errorf("Expected ingress to be refused under the reject mode")
+	}
+
+	usage, _ := enforcer.Usage(ctx, "acme", time.Now(), time.Now())
+	if usage[0].Accepted != 2 || usage[0].Rejected != 2 {
+		t.Errorf("Unexpected usage %+v", usage[0])
+	}
+
+	// Tenants without a policy get the unlimited default
+	if d, _ := enforcer.Charge(ctx, "globex", 100); !d.Allowed {
+		t.Errorf("Expected the default policy to be unlimited")
+	}
+}
+
+func TestEnforcerQueueMode(t *testing.T) {
+	store := newMemoryStore()
+	enforcer := NewEnforcer(store, Policy{PerDay: 1, Mode: ModeQueue})
+	ctx := context.Background()
+
+	enforcer.Charge(ctx, "acme", 1)
+	d, _ := enforcer.Charge(ctx, "acme", 1)
+	if d.Allowed || d.Mode != ModeQueue || d.RetryAfter > 24*time.Hour {
+		t.Errorf("Expected the notification to wait for the next day, got %+v", d)
+	}
+
+	// Ingress still admits queued traffic
+	if d, _ := enforcer.Admit(ctx, "acme", 1); !d.Allowed {
+		t.Errorf("Expected ingress to admit traffic under the queue mode")
+	}
+
+	// A queued notification coming back to an exhausted quota waits again
+	// without being counted as queued again
+	for i := 0; i < 2; i++ {
+		if d, _ := enforcer.Recharge(ctx, "acme", 1); d.Allowed {
+			t.Errorf("Expected the quota to stay exhausted")
+		}
+	}
+	usage, _ := enforcer.Usage(ctx, "acme", time.Now(), time.Now())
+	if usage[0].Accepted != 1 || usage[0].Queued != 1 {
+		t.Errorf("Expected one accepted and one queued notification, got %+v", usage[0])
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	if err := (Policy{PerSecond: -1}).Validate(); err == nil {
+		t.Errorf("Expected error for negative limit")
+	}
+	if err := (Policy{Mode: "drop"}).Validate(); err == nil {
+		t.Errorf("Expected error for unknown mode")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 10, 23, 59, 30, 250e6, time.UTC)
+	if got := RetryAfter(now, false); got != 750*time.Millisecond {
+		t.Errorf("Expected 750ms to the next second, got %v", got)
+	}
+	if got := RetryAfter(now, true); got != 29*time.Second+750*time.Millisecond {
+		t.Errorf("Expected 29.75s to midnight, got %v", got)
+	}
+}
@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+)
+
+// storedAPIKey is the persisted form of a key, including its secret hash
+type storedAPIKey struct {
+	*auth.APIKey
+	Hash string `json:"hash"`
+}
+
+// APIKeyStore keeps API key metadata under apikey:{id} with a lookup from the
+// secret hash to the ID and a per-tenant index. Plaintext keys are never stored.
+type APIKeyStore struct {
+	client       *redis.Client
+	keyPrefix    string
+	hashPrefix   string
+	tenantPrefix string
+}
+
+// NewAPIKeyStore creates a new Redis-backed API key store
+func NewAPIKeyStore(client *redis.Client) *APIKeyStore {
+	return &APIKeyStore{
+		client:       client,
+		keyPrefix:    "apikey:",
+		hashPrefix:   "apikey_hash:",
+		tenantPrefix: "tenant_apikeys:",
+	}
+}
+
+// Save stores or updates a key
+func (ks *APIKeyStore) Save(ctx context.Context, key *auth.APIKey) error {
+	data, err := json.Marshal(storedAPIKey{APIKey: key, Hash: key.Hash})
+	if err != nil {
+		return fmt.Errorf("failed to marshal api key: %w", err)
+	}
+
+	pipe := ks.client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("%s%s", ks.keyPrefix, key.ID), data, 0)
+	pipe.Set(ctx, fmt.Sprintf("%s%s", ks.hashPrefix, key.Hash), key.ID, 0)
+	pipe.SAdd(ctx, fmt.Sprintf("%s%s", ks.tenantPrefix, key.Tenant), key.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return nil
+}
+
+// Get returns a key by ID
+func (ks *APIKeyStore) Get(ctx context.Context, id string) (*auth.APIKey, error) {
+	data, err := ks.client.Get(ctx, fmt.Sprintf("%s%s", ks.keyPrefix, id)).Bytes()
+	if err == redis.Nil {
+		return nil, auth.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis get error: %w", err)
+	}
+
+	stored := storedAPIKey{APIKey: &auth.APIKey{}}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal api key: %w", err)
+	}
+	stored.APIKey.Hash = stored.Hash
+	return stored.APIKey, nil
+}
+
+// GetByHash returns the key whose secret hashes to hash
+func (ks *APIKeyStore) GetByHash(ctx context.Context, hash string) (*auth.APIKey, error) {
+	id, err := ks.client.Get(ctx, fmt.Sprintf("%s%s", ks.hashPrefix, hash)).Result()
+	if err == redis.Nil {
+		return nil, auth.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis get error: %w", err)
+	}
+	return ks.Get(ctx, id)
+}
+
+// List returns the keys of a tenant, oldest first
+func (ks *APIKeyStore) List(ctx context.Context, tenant string) ([]*auth.APIKey, error) {
+	ids, err := ks.client.SMembers(ctx, fmt.Sprintf("%s%s", ks.tenantPrefix, tenant)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis smembers error: %w", err)
+	}
+
+	keys := make([]*auth.APIKey, 0, len(ids))
+	for _, id := range ids {
+		key, err := ks.Get(ctx, id)
+		if err == auth.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
@@ -0,0 +1,169 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// audienceTTL bounds how long a materialized segment intersection is kept
+const audienceTTL = 24 * time.Hour
+
+// AudienceStore resolves broadcast audiences from topic member sets and
+// per-attribute segment index sets. Users are indexed into
+// segment:{key}:{value} whenever their attributes are set.
+type AudienceStore struct {
+	client          *redis.Client
+	topicPrefix     string
+	segmentPrefix   string
+	attributePrefix string
+	audiencePrefix  string
+}
+
+// NewAudienceStore creates a new Redis-backed broadcast audience
+func NewAudienceStore(client *redis.Client) *AudienceStore {
+	return &AudienceStore{
+		client:          client,
+		topicPrefix:     "topic:",
+		segmentPrefix:   "segment:",
+		attributePrefix: "user_attributes:",
+		audiencePrefix:  "broadcast:",
+	}
+}
+
+func (as *AudienceStore) topicKey(ctx context.Context, topic string) string {
+	return tenant.ContextKey(ctx, fmt.Sprintf("%s%s:members", as.topicPrefix, topic))
+}
+
+func (as *AudienceStore) segmentKey(ctx context.Context, key, value string) string {
+	return tenant.ContextKey(ctx, fmt.Sprintf("%s%s:%s", as.segmentPrefix, key, value))
+}
+
+func (as *AudienceStore) audienceKey(ctx context.Context, id string) string {
+	return tenant.ContextKey(ctx, fmt.Sprintf("%s%s:audience", as.audiencePrefix, id))
+}
+
+func (as *AudienceStore) attributesKey(ctx context.Context, userID string) string {
+	return tenant.ContextKey(ctx, fmt.Sprintf("%s%s", as.attributePrefix, userID))
+}
+
+// sourceKeys lists the sets whose intersection is the broadcast audience
+func (as *AudienceStore) sourceKeys(ctx context.Context, b *pkg.BroadcastMessage) []string {
+	var keys []string
+	if b.Topic != "" {
+		keys = append(keys, as.topicKey(ctx, b.Topic))
+	}
+
+	// Sorted so the same segment always produces the same intersection
+	attrs := make([]string, 0, len(b.Segment))
+	for key := range b.Segment {
+		attrs = append(attrs, key)
+	}
+	sort.Strings(attrs)
+	for _, key := range attrs {
+		keys = append(keys, as.segmentKey(ctx, key, b.Segment[key]))
+	}
+	return keys
+}
+
+// resolve returns the set holding the audience, intersecting several sources
+// into a temporary per-broadcast set when needed
+func (as *AudienceStore) resolve(ctx context.Context, b *pkg.BroadcastMessage) (string, error) {
+	keys := as.sourceKeys(ctx, b)
+	if len(keys) == 0 {
+		return "", fmt.Errorf("broadcast %s has no audience", b.ID)
+	}
+	if len(keys) == 1 {
+		return keys[0], nil
+	}
+
+	dest := as.audienceKey(ctx, b.ID)
+	pipe := as.client.TxPipeline()
+	pipe.SInterStore(ctx, dest, keys...)
+	pipe.Expire(ctx, dest, audienceTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return dest, nil
+}
+
+// Size returns the number of users targeted by a broadcast
+func (as *AudienceStore) Size(ctx context.Context, b *pkg.BroadcastMessage) (int64, error) {
+	key, err := as.resolve(ctx, b)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := as.client.SCard(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis scard error: %w", err)
+	}
+	return size, nil
+}
+
+// Scan pages through the audience with SSCAN. Like SSCAN it may return a user
+// more than once; fanned-out message IDs are deterministic so duplicates can
+// be recognised downstream.
+func (as *AudienceStore) Scan(ctx context.Context, b *pkg.BroadcastMessage, cursor uint64, count int64) ([]string, uint64, error) {
+	// The intersection is refreshed when a scan starts and reused after that
+	var key string
+	if cursor == 0 {
+		resolved, err := as.resolve(ctx, b)
+		if err != nil {
+			return nil, 0, err
+		}
+		key = resolved
+	} else if keys := as.sourceKeys(ctx, b); len(keys) == 1 {
+		key = keys[0]
+	} else {
+		key = as.audienceKey(ctx, b.ID)
+	}
+
+	users, next, err := as.client.SScan(ctx, key, cursor, "", count).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("redis sscan error: %w", err)
+	}
+	return users, next, nil
+}
+
+// UserAttributes returns the segmentation attributes of a user
+func (as *AudienceStore) UserAttributes(ctx context.Context, userID string) (map[string]string, error) {
+	attrs, err := as.client.HGetAll(ctx, as.attributesKey(ctx, userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis hgetall error: %w", err)
+	}
+	return attrs, nil
+}
+
+// SetUserAttributes replaces a user's attributes and re-indexes the user
+// into the matching segment sets
+func (as *AudienceStore) SetUserAttributes(ctx context.Context, userID string, attrs map[string]string) error {
+	previous, err := as.UserAttributes(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	key := as.attributesKey(ctx, userID)
+	pipe := as.client.TxPipeline()
+	for k, v := range previous {
+		pipe.SRem(ctx, as.segmentKey(ctx, k, v), userID)
+	}
+	pipe.Del(ctx, key)
+	if len(attrs) > 0 {
+		values := make([]interface{}, 0, len(attrs)*2)
+		for k, v := range attrs {
+			values = append(values, k, v)
+			pipe.SAdd(ctx, as.segmentKey(ctx, k, v), userID)
+		}
+		pipe.HSet(ctx, key, values...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return nil
+}
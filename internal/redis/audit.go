@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+)
+
+// AuditLog appends audit entries to a capped Redis stream
+type AuditLog struct {
+	client *redis.Client
+	key    string
+	maxLen int64
+}
+
+// NewAuditLog creates a new Redis-backed audit log keeping about maxLen entries
+func NewAuditLog(client *redis.Client, maxLen int64) *AuditLog {
+	return &AuditLog{
+		client: client,
+		key:    "audit_log",
+		maxLen: maxLen,
+	}
+}
+
+// Record appends an entry to the audit log
+func (al *AuditLog) Record(ctx context.Context, entry *auth.AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	err = al.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: al.key,
+		MaxLen: al.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{"key_id": entry.KeyID, "tenant": entry.Tenant, "entry": data},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("redis xadd error: %w", err)
+	}
+	return nil
+}
+
+// Recent returns up to limit of the newest entries, optionally only those of
+// one tenant and/or key
+func (al *AuditLog) Recent(ctx context.Context, tenant, keyID string, limit int) ([]*auth.AuditEntry, error) {
+	// Read in pages from the newest entry until enough entries match
+	const pageSize = 500
+	entries := make([]*auth.AuditEntry, 0, limit)
+	end := "+"
+
+	for len(entries) < limit {
+		messages, err := al.client.XRevRangeN(ctx, al.key, end, "-", pageSize).Result()
+		if err != nil {
+			return nil, fmt.Errorf("redis xrevrange error: %w", err)
+		}
+
+		for _, msg := range messages {
+			if msg.ID == end {
+				continue // The range is inclusive of the previous page's last entry
+			}
+			if (tenant != "" && msg.Values["tenant"] != tenant) || (keyID != "" && msg.Values["key_id"] != keyID) {
+				continue
+			}
+			data, _ := msg.Values["entry"].(string)
+			var entry auth.AuditEntry
+			if err := json.Unmarshal([]byte(data), &entry); err != nil {
+				continue
+			}
+			entries = append(entries, &entry)
+			if len(entries) == limit {
+				break
+			}
+		}
+
+		if len(messages) < pageSize {
+			break
+		}
+		end = messages[len(messages)-1].ID
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,44 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/blob"
+)
+
+// BlobStore keeps blobs as plain Redis strings that expire on their own
+type BlobStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewBlobStore creates a new Redis-backed blob store
+func NewBlobStore(client *redis.Client) *BlobStore {
+	return &BlobStore{
+		client:    client,
+		keyPrefix: "blob:",
+	}
+}
+
+// Put stores a blob for ttl
+func (bs *BlobStore) Put(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	if err := bs.client.Set(ctx, bs.keyPrefix+key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("redis set error: %w", err)
+	}
+	return nil
+}
+
+// Get returns a blob, or blob.ErrNotFound once it has expired
+func (bs *BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := bs.client.Get(ctx, bs.keyPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, blob.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis get error: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// BroadcastStore keeps broadcast progress in a Redis hash. The enqueued
+// counter and the cancellation flag are separate fields so publishers can
+// update them atomically while the state is rewritten.
+type BroadcastStore struct {
+	client    *redis.Client
+	keyPrefix string
+	retention time.Duration
+}
+
+// NewBroadcastStore creates a new Redis-backed broadcast progress store
+func NewBroadcastStore(client *redis.Client, retention time.Duration) *BroadcastStore {
+	return &BroadcastStore{
+		client:    client,
+		keyPrefix: "broadcast:",
+		retention: retention,
+	}
+}
+
+// Save stores the broadcast state; the enqueued counter is left untouched
+func (bs *BroadcastStore) Save(ctx context.Context, progress *pkg.BroadcastProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("failed to marshal progress: %w", err)
+	}
+
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", bs.keyPrefix, progress.ID))
+	pipe := bs.client.TxPipeline()
+	pipe.HSet(ctx, key, "progress", data)
+	pipe.Expire(ctx, key, bs.retention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return nil
+}
+
+// Get returns the progress of a broadcast, or nil if unknown
+func (bs *BroadcastStore) Get(ctx context.Context, id string) (*pkg.BroadcastProgress, error) {
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", bs.keyPrefix, id))
+
+	fields, err := bs.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis hgetall error: %w", err)
+	}
+	data, ok := fields["progress"]
+	if !ok {
+		return nil, nil
+	}
+
+	var progress pkg.BroadcastProgress
+	if err := json.Unmarshal([]byte(data), &progress); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal progress: %w", err)
+	}
+	if enqueued, err := strconv.ParseInt(fields["enqueued"], 10, 64); err == nil {
+		progress.Enqueued = enqueued
+	}
+	return &progress, nil
+}
+
+// AddEnqueued adds to the number of messages published for a broadcast
+func (bs *BroadcastStore) AddEnqueued(ctx context.Context, id string, n int64) error {
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", bs.keyPrefix, id))
+	if err := bs.client.HIncrBy(ctx, key, "enqueued", n).Err(); err != nil {
+		return fmt.Errorf("redis hincrby error: %w", err)
+	}
+	return nil
+}
+
+// RequestCancel flags a broadcast for cancellation
+func (bs *BroadcastStore) RequestCancel(ctx context.Context, id string) error {
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", bs.keyPrefix, id))
+	if err := bs.client.HSet(ctx, key, "cancel_requested", 1).Err(); err != nil {
+		return fmt.Errorf("redis hset error: %w", err)
+	}
+	return nil
+}
+
+// CancelRequested reports whether a broadcast has been flagged for cancellation
+func (bs *BroadcastStore) CancelRequested(ctx context.Context, id string) (bool, error) {
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", bs.keyPrefix, id))
+	exists, err := bs.client.HExists(ctx, key, "cancel_requested").Result()
+	if err != nil {
+		return false, fmt.Errorf("redis hexists error: %w", err)
+	}
+	return exists, nil
+}
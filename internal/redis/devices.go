@@ -0,0 +1,121 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// DeviceStore is the device registry. Devices are stored as JSON under
+// device:{id} and indexed per user; unregistering a device also removes its
+// topic subscriptions.
+type DeviceStore struct {
+	client     *redis.Client
+	keyPrefix  string
+	userPrefix string
+	topics     *TopicStore
+}
+
+// NewDeviceStore creates a new Redis-backed device registry
+func NewDeviceStore(client *redis.Client, topics *TopicStore) *DeviceStore {
+	return &DeviceStore{
+		client:     client,
+		keyPrefix:  "device:",
+		userPrefix: "user_devices:",
+		topics:     topics,
+	}
+}
+
+// Register stores or replaces a device. A device moving to another user
+// loses the subscriptions it held for the previous one.
+func (ds *DeviceStore) Register(ctx context.Context, device *pkg.Device) error {
+	previous, err := ds.Get(ctx, device.ID)
+	if err != nil {
+		return err
+	}
+	if previous != nil && previous.UserID != device.UserID {
+		if err := ds.Unregister(ctx, device.ID); err != nil {
+			return err
+		}
+	}
+
+	if device.CreatedAt.IsZero() {
+		device.CreatedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(device)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device: %w", err)
+	}
+
+	pipe := ds.client.TxPipeline()
+	pipe.Set(ctx, tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ds.keyPrefix, device.ID)), data, 0)
+	pipe.SAdd(ctx, tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ds.userPrefix, device.UserID)), device.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return nil
+}
+
+// Get returns a registered device, or nil if unknown
+func (ds *DeviceStore) Get(ctx context.Context, deviceID string) (*pkg.Device, error) {
+	data, err := ds.client.Get(ctx, tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ds.keyPrefix, deviceID))).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis get error: %w", err)
+	}
+
+	var device pkg.Device
+	if err := json.Unmarshal(data, &device); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device: %w", err)
+	}
+	return &device, nil
+}
+
+// UserDevices lists the devices registered for a user
+func (ds *DeviceStore) UserDevices(ctx context.Context, userID string) ([]*pkg.Device, error) {
+	ids, err := ds.client.SMembers(ctx, tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ds.userPrefix, userID))).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis smembers error: %w", err)
+	}
+	sort.Strings(ids)
+
+	devices := make([]*pkg.Device, 0, len(ids))
+	for _, id := range ids {
+		device, err := ds.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if device != nil {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+// Unregister removes a device together with its topic subscriptions
+func (ds *DeviceStore) Unregister(ctx context.Context, deviceID string) error {
+	device, err := ds.Get(ctx, deviceID)
+	if err != nil || device == nil {
+		return err
+	}
+
+	if err := ds.topics.UnsubscribeDevice(ctx, device.UserID, deviceID); err != nil {
+		return fmt.Errorf("failed to remove device subscriptions: %w", err)
+	}
+
+	pipe := ds.client.TxPipeline()
+	pipe.Del(ctx, tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ds.keyPrefix, deviceID)))
+	pipe.SRem(ctx, tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ds.userPrefix, device.UserID)), deviceID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return nil
+}
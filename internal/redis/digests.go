@@ -0,0 +1,149 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/digest"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// takeDigestScript atomically returns and removes a digest's items together
+// with its schedule entries.
+// KEYS: items, user index, due set
+// ARGV: type, due set member
+var takeDigestScript = redis.NewScript(`
+local items = redis.call('LRANGE', KEYS[1], 0, -1)
+redis.call('DEL', KEYS[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[2])
+return items
+`)
+
+// DigestStore accumulates digest items in a Redis list per user and type.
+// A sorted set scored by due time schedules the flushes and a hash per user
+// indexes the pending digests for inspection.
+type DigestStore struct {
+	client     *redis.Client
+	keyPrefix  string
+	userPrefix string
+	dueKey     string
+}
+
+// NewDigestStore creates a new Redis-backed digest store
+func NewDigestStore(client *redis.Client) *DigestStore {
+	return &DigestStore{
+		client:     client,
+		keyPrefix:  "digest:",
+		userPrefix: "digest_user:",
+		dueKey:     "digest_due",
+	}
+}
+
+func (ds *DigestStore) itemsKey(ref digest.Ref) string {
+	return tenant.Key(ref.Tenant, fmt.Sprintf("%s%s:%s", ds.keyPrefix, ref.Type, ref.UserID))
+}
+
+func (ds *DigestStore) userKey(tenantID, userID string) string {
+	return tenant.Key(tenantID, fmt.Sprintf("%s%s", ds.userPrefix, userID))
+}
+
+func dueMember(ref digest.Ref) string {
+	member, _ := json.Marshal(ref)
+	return string(member)
+}
+
+// Add appends a notification to a digest. The due time is only recorded for
+// the first item so later items do not postpone the flush.
+func (ds *DigestStore) Add(ctx context.Context, ref digest.Ref, n *pkg.NotificationMessage, dueAt time.Time) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	pipe := ds.client.TxPipeline()
+	pipe.RPush(ctx, ds.itemsKey(ref), data)
+	pipe.ZAddNX(ctx, ds.dueKey, &redis.Z{Score: float64(dueAt.Unix()), Member: dueMember(ref)})
+	pipe.HSetNX(ctx, ds.userKey(ref.Tenant, ref.UserID), ref.Type, dueAt.Unix())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return nil
+}
+
+// PopDue removes and returns up to limit digests due at now
+func (ds *DigestStore) PopDue(ctx context.Context, now time.Time, limit int) ([]digest.Ref, error) {
+	members, err := popDueScript.Run(ctx, ds.client, []string{ds.dueKey}, strconv.FormatInt(now.Unix(), 10), limit).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("redis pop due error: %w", err)
+	}
+
+	refs := make([]digest.Ref, 0, len(members))
+	for _, member := range members {
+		var ref digest.Ref
+		if err := json.Unmarshal([]byte(member), &ref); err != nil {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// Take removes and returns the items of a digest
+func (ds *DigestStore) Take(ctx context.Context, ref digest.Ref) ([]*pkg.NotificationMessage, error) {
+	keys := []string{ds.itemsKey(ref), ds.userKey(ref.Tenant, ref.UserID), ds.dueKey}
+	values, err := takeDigestScript.Run(ctx, ds.client, keys, ref.Type, dueMember(ref)).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("redis take digest error: %w", err)
+	}
+	return decodeNotifications(values), nil
+}
+
+// Peek returns the pending digests of a user of the context's tenant without
+// removing them
+func (ds *DigestStore) Peek(ctx context.Context, userID string) ([]*digest.Pending, error) {
+	tenantID := tenant.FromContext(ctx)
+	types, err := ds.client.HGetAll(ctx, ds.userKey(tenantID, userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis hgetall error: %w", err)
+	}
+
+	pending := make([]*digest.Pending, 0, len(types))
+	for digestType, due := range types {
+		ref := digest.NewRef(tenantID, userID, digestType)
+		values, err := ds.client.LRange(ctx, ds.itemsKey(ref), 0, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("redis lrange error: %w", err)
+		}
+		dueUnix, _ := strconv.ParseInt(due, 10, 64)
+
+		pending = append(pending, &digest.Pending{
+			Ref:   ref,
+			Items: decodeNotifications(values),
+			DueAt: time.Unix(dueUnix, 0).UTC(),
+		})
+	}
+
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Type < pending[j].Type })
+	return pending, nil
+}
+
+// decodeNotifications unmarshals stored notifications, dropping corrupt entries
+// rather than blocking the queue they are read from
+func decodeNotifications(values []string) []*pkg.NotificationMessage {
+	notifications := make([]*pkg.NotificationMessage, 0, len(values))
+	for _, value := range values {
+		var n pkg.NotificationMessage
+		if err := json.Unmarshal([]byte(value), &n); err != nil {
+			continue
+		}
+		notifications = append(notifications, &n)
+	}
+	return notifications
+}
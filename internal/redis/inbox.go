@@ -0,0 +1,292 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/inbox"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+)
+
+// addInboxItemScript stores an item unless it exists, trims the inbox to its
+// size limit, dropping the oldest archived items first, and returns the
+// unread count.
+// KEYS: items, read, active, unread, archived
+// ARGV: id, item, score, max items, ttl in ms
+var addInboxItemScript = redis.NewScript(`
+if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2]) == 1 then
+	redis.call('ZADD', KEYS[3], ARGV[3], ARGV[1])
+	redis.call('ZADD', KEYS[4], ARGV[3], ARGV[1])
+
+	local excess = redis.call('ZCARD', KEYS[3]) + redis.call('ZCARD', KEYS[5]) - tonumber(ARGV[4])
+	for _, zset in ipairs({KEYS[5], KEYS[3]}) do
+		if excess > 0 then
+			local oldest = redis.call('ZRANGE', zset, 0, excess - 1)
+			for _, id in ipairs(oldest) do
+				redis.call('HDEL', KEYS[1], id)
+				redis.call('HDEL', KEYS[2], id)
+				redis.call('ZREM', KEYS[4], id)
+				redis.call('ZREM', zset, id)
+			end
+			excess = excess - #oldest
+		end
+	end
+end
+for _, key in ipairs(KEYS) do
+	redis.call('PEXPIRE', key, ARGV[5])
+end
+return redis.call('ZCARD', KEYS[4])
+`)
+
+// listInboxScript returns a page of a sorted set, newest first, as groups of
+// id, score, item, read time and unread flag. The page starts after the
+// cursor item, or after its score if the item left the set meanwhile.
+// KEYS: zset, items, read, unread
+// ARGV: cursor score, cursor id, limit
+var listInboxScript = redis.NewScript(`
+local start = 0
+if ARGV[2] ~= '' then
+	local rank = redis.call('ZREVRANK', KEYS[1], ARGV[2])
+	if rank then
+		start = rank + 1
+	else
+		start = redis.call('ZCOUNT', KEYS[1], '(' .. ARGV[1], '+inf')
+	end
+end
+
+local entries = redis.call('ZREVRANGE', KEYS[1], start, start + tonumber(ARGV[3]) - 1, 'WITHSCORES')
+local page = {}
+for i = 1, #entries, 2 do
+	local id = entries[i]
+	table.insert(page, id)
+	table.insert(page, entries[i + 1])
+	table.insert(page, redis.call('HGET', KEYS[2], id) or '')
+	table.insert(page, redis.call('HGET', KEYS[3], id) or '')
+	table.insert(page, redis.call('ZSCORE', KEYS[4], id) and '1' or '0')
+end
+return page
+`)
+
+// markInboxReadScript marks an item read; it returns 0 if there is no such item.
+// KEYS: items, read, unread
+// ARGV: id, now in ms, ttl in ms
+var markInboxReadScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return 1
+`)
+
+// markAllInboxReadScript marks every unread item read and returns how many.
+// KEYS: read, unread
+// ARGV: now in ms, ttl in ms
+var markAllInboxReadScript = redis.NewScript(`
+local ids = redis.call('ZRANGE', KEYS[2], 0, -1)
+for _, id in ipairs(ids) do
+	redis.call('HSETNX', KEYS[1], id, ARGV[1])
+end
+if #ids > 0 then
+	redis.call('DEL', KEYS[2])
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return #ids
+`)
+
+// archiveInboxScript moves an item to the archive, marking it read; it
+// returns 0 if there is no such item.
+// KEYS: read, active, unread, archived
+// ARGV: id, now in ms, ttl in ms
+var archiveInboxScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[2], ARGV[1])
+if not score then
+	if redis.call('ZSCORE', KEYS[4], ARGV[1]) then
+		return 1
+	end
+	return 0
+end
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('ZADD', KEYS[4], score, ARGV[1])
+redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[4], ARGV[3])
+return 1
+`)
+
+// InboxStore keeps each user's inbox in Redis: a hash of item contents, a
+// hash of read times and sorted sets scored by creation time for the
+// unarchived, unread and archived items. Inboxes are trimmed to maxItems
+// and expire retention after their last new item.
+type InboxStore struct {
+	client    *redis.Client
+	keyPrefix string
+	maxItems  int
+	retention time.Duration
+}
+
+// NewInboxStore creates a new Redis-backed inbox store
+func NewInboxStore(client *redis.Client, maxItems int, retention time.Duration) *InboxStore {
+	return &InboxStore{
+		client:    client,
+		keyPrefix: "inbox",
+		maxItems:  maxItems,
+		retention: retention,
+	}
+}
+
+// inboxKeys holds the keys of one user's inbox
+type inboxKeys struct {
+	items, read, active, unread, archived string
+}
+
+func (is *InboxStore) keys(ctx context.Context, userID string) inboxKeys {
+	key := func(kind string) string {
+		return tenant.ContextKey(ctx, fmt.Sprintf("%s%s:%s", is.keyPrefix, kind, userID))
+	}
+	return inboxKeys{
+		items:    key(""),
+		read:     key("_read"),
+		active:   key("_active"),
+		unread:   key("_unread"),
+		archived: key("_archived"),
+	}
+}
+
+// Add stores an unread item unless it exists and returns the unread count
+func (is *InboxStore) Add(ctx context.Context, item *inbox.Item) (int64, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal inbox item: %w", err)
+	}
+
+	k := is.keys(ctx, item.UserID)
+	unread, err := addInboxItemScript.Run(ctx, is.client,
+		[]string{k.items, k.read, k.active, k.unread, k.archived},
+		item.ID, data, item.CreatedAt.UnixMilli(), is.maxItems, is.retention.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("redis add inbox item error: %w", err)
+	}
+	return unread, nil
+}
+
+// List returns a page of a user's inbox, newest first
+func (is *InboxStore) List(ctx context.Context, userID string, query inbox.Query) (*inbox.Page, error) {
+	var cursorScore int64
+	var cursorID string
+	if query.Cursor != "" {
+		var err error
+		if cursorScore, cursorID, err = inbox.DecodeCursor(query.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	k := is.keys(ctx, userID)
+	zset := k.active
+	switch query.State {
+	case inbox.StateUnread:
+		zset = k.unread
+	case inbox.StateArchived:
+		zset = k.archived
+	}
+
+	values, err := listInboxScript.Run(ctx, is.client,
+		[]string{zset, k.items, k.read, k.unread},
+		cursorScore, cursorID, query.Limit,
+	).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("redis list inbox error: %w", err)
+	}
+
+	page := &inbox.Page{Items: make([]*inbox.Item, 0, len(values)/5)}
+	var lastScore int64
+	var lastID string
+	for i := 0; i+4 < len(values); i += 5 {
+		lastID = values[i]
+		lastScore, _ = strconv.ParseInt(values[i+1], 10, 64)
+
+		var item inbox.Item
+		if err := json.Unmarshal([]byte(values[i+2]), &item); err != nil {
+			continue
+		}
+		if readAt, err := strconv.ParseInt(values[i+3], 10, 64); err == nil {
+			t := time.UnixMilli(readAt).UTC()
+			item.ReadAt = &t
+		}
+		switch {
+		case query.State == inbox.StateArchived:
+			item.State = inbox.StateArchived
+		case values[i+4] == "1":
+			item.State = inbox.StateUnread
+		default:
+			item.State = inbox.StateRead
+		}
+		page.Items = append(page.Items, &item)
+	}
+
+	if query.Limit > 0 && len(values)/5 == query.Limit {
+		page.NextCursor = inbox.EncodeCursor(lastScore, lastID)
+	}
+	return page, nil
+}
+
+// MarkRead marks an item read
+func (is *InboxStore) MarkRead(ctx context.Context, userID, id string) error {
+	k := is.keys(ctx, userID)
+	found, err := markInboxReadScript.Run(ctx, is.client,
+		[]string{k.items, k.read, k.unread},
+		id, time.Now().UnixMilli(), is.retention.Milliseconds(),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("redis mark inbox item read error: %w", err)
+	}
+	if found == 0 {
+		return inbox.ErrNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks every unread item read and returns how many there were
+func (is *InboxStore) MarkAllRead(ctx context.Context, userID string) (int64, error) {
+	k := is.keys(ctx, userID)
+	marked, err := markAllInboxReadScript.Run(ctx, is.client,
+		[]string{k.read, k.unread},
+		time.Now().UnixMilli(), is.retention.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("redis mark inbox read error: %w", err)
+	}
+	return marked, nil
+}
+
+// Archive moves an item to the archive
+func (is *InboxStore) Archive(ctx context.Context, userID, id string) error {
+	k := is.keys(ctx, userID)
+	found, err := archiveInboxScript.Run(ctx, is.client,
+		[]string{k.read, k.active, k.unread, k.archived},
+		id, time.Now().UnixMilli(), is.retention.Milliseconds(),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("redis archive inbox item error: %w", err)
+	}
+	if found == 0 {
+		return inbox.ErrNotFound
+	}
+	return nil
+}
+
+// UnreadCount returns the number of unread items in a user's inbox
+func (is *InboxStore) UnreadCount(ctx context.Context, userID string) (int64, error) {
+	count, err := is.client.ZCard(ctx, is.keys(ctx, userID).unread).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis zcard error: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/preferences"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+)
+
+// PreferenceStore keeps user preferences as JSON documents in Redis
+type PreferenceStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewPreferenceStore creates a new Redis-backed preference store
+func NewPreferenceStore(client *redis.Client) *PreferenceStore {
+	return &PreferenceStore{
+		client:    client,
+		keyPrefix: "preferences:",
+	}
+}
+
+// Get returns the stored preferences, or defaults when the user has none
+func (ps *PreferenceStore) Get(ctx context.Context, userID string) (*preferences.Preferences, error) {
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ps.keyPrefix, userID))
+
+	data, err := ps.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return preferences.Default(userID), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis get error: %w", err)
+	}
+
+	var prefs preferences.Preferences
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal preferences: %w", err)
+	}
+	return &prefs, nil
+}
+
+// Save replaces the stored preferences of a user
+func (ps *PreferenceStore) Save(ctx context.Context, prefs *preferences.Preferences) error {
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ps.keyPrefix, prefs.UserID))
+
+	prefs.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal preferences: %w", err)
+	}
+
+	if err := ps.client.Set(ctx, key, data, 0).Err(); err != nil {
+		return fmt.Errorf("redis set error: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the stored preferences, restoring the defaults
+func (ps *PreferenceStore) Delete(ctx context.Context, userID string) error {
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ps.keyPrefix, userID))
+
+	if err := ps.client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("redis delete error: %w", err)
+	}
+	return nil
+}
+
+// Locale returns the user's preferred locale for template rendering
+func (ps *PreferenceStore) Locale(ctx context.Context, userID string) (string, error) {
+	prefs, err := ps.Get(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return prefs.Locale, nil
+}
@@ -0,0 +1,132 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/gateway"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+)
+
+// PresenceStore records the gateway instances holding each user's live
+// connections in a sorted set per user scored by expiry time, so instances
+// that die without leaving drop out on their own
+type PresenceStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewPresenceStore creates a new Redis-backed presence store
+func NewPresenceStore(client *redis.Client) *PresenceStore {
+	return &PresenceStore{
+		client:    client,
+		keyPrefix: "presence:",
+	}
+}
+
+func (ps *PresenceStore) key(ctx context.Context, userID string) string {
+	return tenant.ContextKey(ctx, ps.keyPrefix+userID)
+}
+
+// Join marks the user online on an instance for ttl
+func (ps *PresenceStore) Join(ctx context.Context, userID, instanceID string, ttl time.Duration) error {
+	key := ps.key(ctx, userID)
+	expires := time.Now().Add(ttl).UnixMilli()
+
+	pipe := ps.client.TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(expires), Member: instanceID})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	pipe.PExpire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return nil
+}
+
+// Leave marks the user offline on an instance
+func (ps *PresenceStore) Leave(ctx context.Context, userID, instanceID string) error {
+	if err := ps.client.ZRem(ctx, ps.key(ctx, userID), instanceID).Err(); err != nil {
+		return fmt.Errorf("redis zrem error: %w", err)
+	}
+	return nil
+}
+
+// Instances returns the instances the user is online on
+func (ps *PresenceStore) Instances(ctx context.Context, userID string) ([]string, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	instances, err := ps.client.ZRangeByScore(ctx, ps.key(ctx, userID), &redis.ZRangeBy{Min: "(" + now, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis zrangebyscore error: %w", err)
+	}
+	return instances, nil
+}
+
+// GatewayBus carries gateway envelopes over a Redis pub/sub channel per
+// instance
+type GatewayBus struct {
+	client        *redis.Client
+	channelPrefix string
+}
+
+// NewGatewayBus creates a new Redis pub/sub gateway bus
+func NewGatewayBus(client *redis.Client) *GatewayBus {
+	return &GatewayBus{
+		client:        client,
+		channelPrefix: "gateway:",
+	}
+}
+
+// Publish sends an envelope to an instance
+func (gb *GatewayBus) Publish(ctx context.Context, instanceID string, envelope *gateway.Envelope) error {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+	if err := gb.client.Publish(ctx, gb.channelPrefix+instanceID, data).Err(); err != nil {
+		return fmt.Errorf("redis publish error: %w", err)
+	}
+	return nil
+}
+
+// Subscribe returns the envelopes published to an instance until ctx is done
+func (gb *GatewayBus) Subscribe(ctx context.Context, instanceID string) (<-chan *gateway.Envelope, error) {
+	sub := gb.client.Subscribe(ctx, gb.channelPrefix+instanceID)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, fmt.Errorf("redis subscribe error: %w", err)
+	}
+
+	envelopes := make(chan *gateway.Envelope)
+	go func() {
+		defer close(envelopes)
+		defer sub.Close()
+
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var envelope gateway.Envelope
+				if err := json.Unmarshal([]byte(msg.Payload), &envelope); err != nil {
+					log.Printf("Dropping malformed gateway envelope: %v", err)
+					continue
+				}
+				select {
+				case envelopes <- &envelope:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return envelopes, nil
+}
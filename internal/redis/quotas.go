@@ -0,0 +1,190 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/quota"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+)
+
+// usageDateLayout names the daily usage hashes
+const usageDateLayout = "2006-01-02"
+
+// chargeQuotaScript counts n notifications if they fit both the per-second
+// and the per-day limit. It returns {status, second, day} where status is 0
+// when charged, 1 when the second and 2 when the day is exhausted.
+// KEYS: second counter, daily usage hash
+// ARGV: per second limit, per day limit, n, usage TTL in seconds
+var chargeQuotaScript = redis.NewScript(`
+local n = tonumber(ARGV[3])
+local second = tonumber(redis.call('GET', KEYS[1]) or '0')
+local day = tonumber(redis.call('HGET', KEYS[2], 'accepted') or '0')
+local perSecond = tonumber(ARGV[1])
+local perDay = tonumber(ARGV[2])
+if perDay > 0 and day + n > perDay then
+	return {2, second, day}
+end
+if perSecond > 0 and second + n > perSecond then
+	return {1, second, day}
+end
+second = redis.call('INCRBY', KEYS[1], n)
+redis.call('EXPIRE', KEYS[1], 2)
+day = redis.call('HINCRBY', KEYS[2], 'accepted', n)
+redis.call('EXPIRE', KEYS[2], ARGV[4])
+return {0, second, day}
+`)
+
+// QuotaStore keeps tenant quota policies and counts traffic in a counter per
+// second and a usage hash per UTC day, which is kept for billing
+type QuotaStore struct {
+	client         *redis.Client
+	policyKey      string
+	secondPrefix   string
+	usagePrefix    string
+	usageRetention time.Duration
+}
+
+// NewQuotaStore creates a new Redis-backed quota store keeping daily usage
+// for usageRetention
+func NewQuotaStore(client *redis.Client, usageRetention time.Duration) *QuotaStore {
+	return &QuotaStore{
+		client:         client,
+		policyKey:      "quota_policy",
+		secondPrefix:   "quota_second:",
+		usagePrefix:    "usage:",
+		usageRetention: usageRetention,
+	}
+}
+
+func (qs *QuotaStore) secondKey(tenantID string, now time.Time) string {
+	return tenant.Key(tenantID, fmt.Sprintf("%s%d", qs.secondPrefix, now.Unix()))
+}
+
+func (qs *QuotaStore) usageKey(tenantID string, day time.Time) string {
+	return tenant.Key(tenantID, fmt.Sprintf("%s%s", qs.usagePrefix, day.UTC().Format(usageDateLayout)))
+}
+
+// Policy returns the tenant's own policy, or nil if it has none
+func (qs *QuotaStore) Policy(ctx context.Context, tenantID string) (*quota.Policy, error) {
+	data, err := qs.client.Get(ctx, tenant.Key(tenantID, qs.policyKey)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis get error: %w", err)
+	}
+
+	var policy quota.Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal quota policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// SetPolicy stores the tenant's own policy
+func (qs *QuotaStore) SetPolicy(ctx context.Context, tenantID string, policy quota.Policy) error {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to marshal quota policy: %w", err)
+	}
+	if err := qs.client.Set(ctx, tenant.Key(tenantID, qs.policyKey), data, 0).Err(); err != nil {
+		return fmt.Errorf("redis set error: %w", err)
+	}
+	return nil
+}
+
+// Charge atomically counts n notifications if the policy allows them
+func (qs *QuotaStore) Charge(ctx context.Context, tenantID string, policy quota.Policy, n int64, now time.Time) (quota.Decision, error) {
+	keys := []string{qs.secondKey(tenantID, now), qs.usageKey(tenantID, now)}
+	values, err := chargeQuotaScript.Run(ctx, qs.client, keys,
+		policy.PerSecond, policy.PerDay, n, int64(qs.usageRetention.Seconds())).Int64Slice()
+	if err != nil {
+		return quota.Decision{}, fmt.Errorf("redis charge quota error: %w", err)
+	}
+	if len(values) != 3 {
+		return quota.Decision{}, fmt.Errorf("unexpected charge quota reply %v", values)
+	}
+
+	decision := quota.Decision{Allowed: values[0] == 0, Mode: policy.Mode, Second: values[1], Day: values[2]}
+	if !decision.Allowed {
+		decision.RetryAfter = quota.RetryAfter(now, values[0] == 2)
+	}
+	return decision, nil
+}
+
+// Peek reports whether one more notification would fit, without counting it
+func (qs *QuotaStore) Peek(ctx context.Context, tenantID string, policy quota.Policy, now time.Time) (quota.Decision, error) {
+	pipe := qs.client.Pipeline()
+	secondCmd := pipe.Get(ctx, qs.secondKey(tenantID, now))
+	dayCmd := pipe.HGet(ctx, qs.usageKey(tenantID, now), "accepted")
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return quota.Decision{}, fmt.Errorf("redis pipeline error: %w", err)
+	}
+	second, _ := secondCmd.Int64()
+	day, _ := dayCmd.Int64()
+
+	decision := quota.Decision{Allowed: true, Mode: policy.Mode, Second: second, Day: day}
+	switch {
+	case policy.PerDay > 0 && day >= policy.PerDay:
+		decision.Allowed = false
+		decision.RetryAfter = quota.RetryAfter(now, true)
+	case policy.PerSecond > 0 && second >= policy.PerSecond:
+		decision.Allowed = false
+		decision.RetryAfter = quota.RetryAfter(now, false)
+	}
+	return decision, nil
+}
+
+// RecordOverQuota counts notifications rejected or queued for lack of quota
+func (qs *QuotaStore) RecordOverQuota(ctx context.Context, tenantID string, mode quota.Mode, n int64, now time.Time) error {
+	field := "rejected"
+	if mode == quota.ModeQueue {
+		field = "queued"
+	}
+
+	key := qs.usageKey(tenantID, now)
+	pipe := qs.client.Pipeline()
+	pipe.HIncrBy(ctx, key, field, n)
+	pipe.Expire(ctx, key, qs.usageRetention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return nil
+}
+
+// Usage returns the daily usage between two dates inclusive
+func (qs *QuotaStore) Usage(ctx context.Context, tenantID string, from, to time.Time) ([]quota.Usage, error) {
+	from = from.UTC().Truncate(24 * time.Hour)
+	to = to.UTC().Truncate(24 * time.Hour)
+
+	pipe := qs.client.Pipeline()
+	var days []time.Time
+	var cmds []*redis.StringStringMapCmd
+	for day := from; !day.After(to); day = day.Add(24 * time.Hour) {
+		days = append(days, day)
+		cmds = append(cmds, pipe.HGetAll(ctx, qs.usageKey(tenantID, day)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("redis pipeline error: %w", err)
+	}
+
+	usage := make([]quota.Usage, 0, len(days))
+	for i, day := range days {
+		fields := cmds[i].Val()
+		accepted, _ := strconv.ParseInt(fields["accepted"], 10, 64)
+		rejected, _ := strconv.ParseInt(fields["rejected"], 10, 64)
+		queued, _ := strconv.ParseInt(fields["queued"], 10, 64)
+		usage = append(usage, quota.Usage{
+			Date:     day.Format(usageDateLayout),
+			Accepted: accepted,
+			Rejected: rejected,
+			Queued:   queued,
+		})
+	}
+	return usage, nil
+}
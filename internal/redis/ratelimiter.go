@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
 )
 
 // RateLimiter provides Redis-based rate limiting functionality
@@ -26,9 +27,17 @@ func NewRateLimiter(client *redis.Client, limit int, window time.Duration) *Rate
 	}
 }
 
+// NewTopicRateLimiter creates a rate limiter counting the notifications of
+// one topic apart from those of other topics
+func NewTopicRateLimiter(client *redis.Client, topic string, limit int, window time.Duration) *RateLimiter {
+	rl := NewRateLimiter(client, limit, window)
+	rl.keyPrefix = "rate_limit:topic:" + topic + ":"
+	return rl
+}
+
 // IsAllowed checks if a user is allowed to send a notification
 func (rl *RateLimiter) IsAllowed(ctx context.Context, userID string) (bool, error) {
-	key := fmt.Sprintf("%s%s", rl.keyPrefix, userID)
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", rl.keyPrefix, userID))
 
 	// Use Redis pipeline for atomic operations
 	pipe := rl.client.Pipeline()
@@ -52,7 +61,7 @@ func (rl *RateLimiter) IsAllowed(ctx context.Context, userID string) (bool, erro
 
 // GetCurrentCount returns the current count for a user
 func (rl *RateLimiter) GetCurrentCount(ctx context.Context, userID string) (int, error) {
-	key := fmt.Sprintf("%s%s", rl.keyPrefix, userID)
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", rl.keyPrefix, userID))
 
 	count, err := rl.client.Get(ctx, key).Int()
 	if err == redis.Nil {
@@ -82,7 +91,7 @@ func (rl *RateLimiter) GetRemainingCount(ctx context.Context, userID string) (in
 
 // Reset resets the rate limit for a user (useful for testing)
 func (rl *RateLimiter) Reset(ctx context.Context, userID string) error {
-	key := fmt.Sprintf("%s%s", rl.keyPrefix, userID)
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", rl.keyPrefix, userID))
 
 	err := rl.client.Del(ctx, key).Err()
 	if err != nil {
@@ -94,7 +103,7 @@ func (rl *RateLimiter) Reset(ctx context.Context, userID string) error {
 
 // GetTTL returns the remaining time until the rate limit resets
 func (rl *RateLimiter) GetTTL(ctx context.Context, userID string) (time.Duration, error) {
-	key := fmt.Sprintf("%s%s", rl.keyPrefix, userID)
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", rl.keyPrefix, userID))
 
 	ttl, err := rl.client.TTL(ctx, key).Result()
 	if err != nil {
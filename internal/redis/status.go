@@ -0,0 +1,100 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// channelFieldPrefix prefixes the per-channel fields of a status hash
+const channelFieldPrefix = "channel:"
+
+// StatusStore records the latest processing result of each notification per
+// channel in a Redis hash that expires after the retention period
+type StatusStore struct {
+	client    *redis.Client
+	keyPrefix string
+	retention time.Duration
+}
+
+// NewStatusStore creates a new Redis-backed delivery status store
+func NewStatusStore(client *redis.Client, retention time.Duration) *StatusStore {
+	return &StatusStore{
+		client:    client,
+		keyPrefix: "status:",
+		retention: retention,
+	}
+}
+
+// Record stores a processing result as the notification's latest status on
+// its channel, under the result's tenant
+func (ss *StatusStore) Record(ctx context.Context, result *pkg.ProcessingResult) error {
+	key := tenant.Key(result.TenantID, fmt.Sprintf("%s%s", ss.keyPrefix, result.MessageID))
+
+	status := pkg.ChannelStatus{
+		Outcome:       result.Outcome,
+		Provider:      result.Provider,
+		Attempts:      result.Attempts,
+		DeferredUntil: result.DeferredUntil,
+		UpdatedAt:     result.ProcessedAt,
+	}
+	if result.Error != nil {
+		status.Error = result.Error.Error()
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %w", err)
+	}
+
+	channel := result.Channel
+	if channel == "" {
+		channel = pkg.ChannelPush
+	}
+
+	pipe := ss.client.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", result.UserID, channelFieldPrefix+string(channel), data)
+	pipe.Expire(ctx, key, ss.retention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return nil
+}
+
+// Get returns the delivery status of a notification of the context's tenant,
+// or nil if unknown
+func (ss *StatusStore) Get(ctx context.Context, messageID string) (*pkg.DeliveryStatus, error) {
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ss.keyPrefix, messageID))
+
+	fields, err := ss.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis hgetall error: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	status := &pkg.DeliveryStatus{
+		MessageID: messageID,
+		UserID:    fields["user_id"],
+		Channels:  make(map[pkg.Channel]pkg.ChannelStatus),
+	}
+	for field, value := range fields {
+		if !strings.HasPrefix(field, channelFieldPrefix) {
+			continue
+		}
+		var channelStatus pkg.ChannelStatus
+		if err := json.Unmarshal([]byte(value), &channelStatus); err != nil {
+			continue
+		}
+		status.Channels[pkg.Channel(strings.TrimPrefix(field, channelFieldPrefix))] = channelStatus
+	}
+
+	return status, nil
+}
@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// SubscriptionStore keeps Web Push subscriptions per user in a Redis hash
+// keyed by endpoint
+type SubscriptionStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewSubscriptionStore creates a new Redis-backed Web Push subscription store
+func NewSubscriptionStore(client *redis.Client) *SubscriptionStore {
+	return &SubscriptionStore{
+		client:    client,
+		keyPrefix: "webpush_subscriptions:",
+	}
+}
+
+// AddSubscription stores or replaces a subscription for a user
+func (ss *SubscriptionStore) AddSubscription(ctx context.Context, userID string, sub pkg.PushSubscription) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return fmt.Errorf("failed to marshal subscription: %w", err)
+	}
+
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ss.keyPrefix, userID))
+	if err := ss.client.HSet(ctx, key, sub.Endpoint, data).Err(); err != nil {
+		return fmt.Errorf("redis hset error: %w", err)
+	}
+	return nil
+}
+
+// Subscriptions returns all subscriptions registered for a user
+func (ss *SubscriptionStore) Subscriptions(ctx context.Context, userID string) ([]pkg.PushSubscription, error) {
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ss.keyPrefix, userID))
+
+	values, err := ss.client.HVals(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis hvals error: %w", err)
+	}
+
+	subscriptions := make([]pkg.PushSubscription, 0, len(values))
+	for _, value := range values {
+		var sub pkg.PushSubscription
+		if err := json.Unmarshal([]byte(value), &sub); err != nil {
+			continue // Skip corrupt entries rather than failing delivery
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	return subscriptions, nil
+}
+
+// RemoveSubscription deletes a user's subscription by endpoint
+func (ss *SubscriptionStore) RemoveSubscription(ctx context.Context, userID, endpoint string) error {
+	key := tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ss.keyPrefix, userID))
+
+	if err := ss.client.HDel(ctx, key, endpoint).Err(); err != nil {
+		return fmt.Errorf("redis hdel error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/templates"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+)
+
+// TemplateStore keeps every version of a template in a Redis hash and tracks
+// the current version in a separate key so rollbacks are a single write
+type TemplateStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewTemplateStore creates a new Redis-backed template store
+func NewTemplateStore(client *redis.Client) *TemplateStore {
+	return &TemplateStore{
+		client:    client,
+		keyPrefix: "template:",
+	}
+}
+
+func (ts *TemplateStore) versionsKey(ctx context.Context, id string) string {
+	return tenant.ContextKey(ctx, fmt.Sprintf("%s%s:versions", ts.keyPrefix, id))
+}
+
+func (ts *TemplateStore) currentKey(ctx context.Context, id string) string {
+	return tenant.ContextKey(ctx, fmt.Sprintf("%s%s:current", ts.keyPrefix, id))
+}
+
+func (ts *TemplateStore) sequenceKey(ctx context.Context, id string) string {
+	return tenant.ContextKey(ctx, fmt.Sprintf("%s%s:seq", ts.keyPrefix, id))
+}
+
+// Save stores the template as a new version and makes it current
+func (ts *TemplateStore) Save(ctx context.Context, tpl *templates.Template) (*templates.Template, error) {
+	if err := tpl.Validate(); err != nil {
+		return nil, err
+	}
+
+	version, err := ts.client.Incr(ctx, ts.sequenceKey(ctx, tpl.ID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis incr error: %w", err)
+	}
+
+	saved := *tpl
+	saved.Version = int(version)
+	saved.CreatedAt = time.Now().UTC()
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal template: %w", err)
+	}
+
+	pipe := ts.client.TxPipeline()
+	pipe.HSet(ctx, ts.versionsKey(ctx, tpl.ID), strconv.Itoa(saved.Version), data)
+	pipe.Set(ctx, ts.currentKey(ctx, tpl.ID), saved.Version, 0)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("redis pipeline error: %w", err)
+	}
+
+	return &saved, nil
+}
+
+// Get returns the current version of a template
+func (ts *TemplateStore) Get(ctx context.Context, id string) (*templates.Template, error) {
+	version, err := ts.client.Get(ctx, ts.currentKey(ctx, id)).Int()
+	if err == redis.Nil {
+		return nil, templates.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis get error: %w", err)
+	}
+
+	return ts.GetVersion(ctx, id, version)
+}
+
+// GetVersion returns a specific version of a template
+func (ts *TemplateStore) GetVersion(ctx context.Context, id string, version int) (*templates.Template, error) {
+	data, err := ts.client.HGet(ctx, ts.versionsKey(ctx, id), strconv.Itoa(version)).Bytes()
+	if err == redis.Nil {
+		return nil, templates.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis hget error: %w", err)
+	}
+
+	var tpl templates.Template
+	if err := json.Unmarshal(data, &tpl); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal template: %w", err)
+	}
+	return &tpl, nil
+}
+
+// Versions lists the stored versions of a template in ascending order
+func (ts *TemplateStore) Versions(ctx context.Context, id string) ([]int, error) {
+	fields, err := ts.client.HKeys(ctx, ts.versionsKey(ctx, id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis hkeys error: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, templates.ErrNotFound
+	}
+
+	versions := make([]int, 0, len(fields))
+	for _, field := range fields {
+		if v, err := strconv.Atoi(field); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// Rollback makes an existing version current again
+func (ts *TemplateStore) Rollback(ctx context.Context, id string, version int) (*templates.Template, error) {
+	tpl, err := ts.GetVersion(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ts.client.Set(ctx, ts.currentKey(ctx, id), version, 0).Err(); err != nil {
+		return nil, fmt.Errorf("redis set error: %w", err)
+	}
+	return tpl, nil
+}
+
+// Delete removes a template with all of its versions
+func (ts *TemplateStore) Delete(ctx context.Context, id string) error {
+	deleted, err := ts.client.Del(ctx, ts.versionsKey(ctx, id), ts.currentKey(ctx, id), ts.sequenceKey(ctx, id)).Result()
+	if err != nil {
+		return fmt.Errorf("redis delete error: %w", err)
+	}
+	if deleted == 0 {
+		return templates.ErrNotFound
+	}
+	return nil
+}
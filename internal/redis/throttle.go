@@ -0,0 +1,147 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/throttle"
+)
+
+// The bucket scripts keep the state of a provider in a hash with the fields
+// rate, tokens, blocked_until and updated (both in unix milliseconds) and use
+// the Redis clock so every instance sees the same time. They implement the
+// same logic as throttle.Bucket.
+
+// bucketPrelude loads and refills the bucket
+// KEYS: bucket hash
+// ARGV: rate, capacity, ...
+const bucketPrelude = `
+local maxRate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'rate', 'tokens', 'blocked_until', 'updated')
+local rate = tonumber(state[1]) or maxRate
+local tokens = tonumber(state[2]) or capacity
+local blocked = tonumber(state[3]) or 0
+local updated = tonumber(state[4]) or now
+if rate <= 0 or rate > maxRate then
+	rate = maxRate
+end
+if now > updated then
+	tokens = math.min(tokens + (now - updated) / 1000 * rate, capacity)
+	updated = now
+end
+`
+
+// bucketSave stores the bucket and expires idle buckets
+const bucketSave = `
+redis.call('HSET', KEYS[1], 'rate', tostring(rate), 'tokens', tostring(tokens), 'blocked_until', blocked, 'updated', updated)
+redis.call('PEXPIRE', KEYS[1], 3600000)
+`
+
+// takeTokenScript returns 0 when a token was taken, or the milliseconds
+// until one is available
+// ARGV: rate, capacity
+var takeTokenScript = redis.NewScript(bucketPrelude + `
+if now < blocked then
+	return blocked - now
+end
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+` + bucketSave + `
+return wait
+`)
+
+// reportScript adapts the rate: additive increase on success, multiplicative
+// decrease plus a pause of retry_after milliseconds when throttled
+// ARGV: rate, capacity, throttled, retry_after, increase, decrease, min rate
+var reportScript = redis.NewScript(bucketPrelude + `
+if ARGV[3] == '1' then
+	rate = math.max(rate * tonumber(ARGV[6]), tonumber(ARGV[7]))
+	tokens = 0
+	blocked = math.max(blocked, now + tonumber(ARGV[4]))
+else
+	rate = math.min(rate + tonumber(ARGV[5]), maxRate)
+end
+` + bucketSave + `
+return 0
+`)
+
+// ThrottleStore keeps the outbound token buckets of providers, shared by
+// every instance
+type ThrottleStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewThrottleStore creates a new Redis-backed provider bucket store
+func NewThrottleStore(client *redis.Client) *ThrottleStore {
+	return &ThrottleStore{
+		client:    client,
+		keyPrefix: "provider_bucket:",
+	}
+}
+
+// Provider buckets are shared by every tenant using the provider, so their
+// keys are not namespaced
+func (ts *ThrottleStore) key(provider string) string {
+	return fmt.Sprintf("%s%s", ts.keyPrefix, provider)
+}
+
+// Take takes a token from the provider's bucket
+func (ts *ThrottleStore) Take(ctx context.Context, provider string, policy throttle.Policy) (time.Duration, error) {
+	wait, err := takeTokenScript.Run(ctx, ts.client, []string{ts.key(provider)}, policy.Rate, policy.Capacity()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("redis take token error: %w", err)
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+// Report adapts the provider's rate to the result of a send
+func (ts *ThrottleStore) Report(ctx context.Context, provider string, policy throttle.Policy, throttled bool, retryAfter time.Duration) error {
+	flag := "0"
+	if throttled {
+		flag = "1"
+		if retryAfter <= 0 {
+			retryAfter = policy.Backoff
+		}
+	}
+	err := reportScript.Run(ctx, ts.client, []string{ts.key(provider)},
+		policy.Rate, policy.Capacity(), flag, retryAfter.Milliseconds(),
+		policy.Increase, policy.Decrease, policy.Decreased(0),
+	).Err()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("redis report error: %w", err)
+	}
+	return nil
+}
+
+// State returns the provider's bucket, or nil if it has none
+func (ts *ThrottleStore) State(ctx context.Context, provider string) (*throttle.State, error) {
+	values, err := ts.client.HGetAll(ctx, ts.key(provider)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis hgetall error: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	state := &throttle.State{Provider: provider}
+	state.Rate, _ = strconv.ParseFloat(values["rate"], 64)
+	state.Tokens, _ = strconv.ParseFloat(values["tokens"], 64)
+	if ms, _ := strconv.ParseInt(values["blocked_until"], 10, 64); ms > 0 {
+		state.BlockedUntil = time.UnixMilli(ms).UTC()
+	}
+	if ms, _ := strconv.ParseInt(values["updated"], 10, 64); ms > 0 {
+		state.UpdatedAt = time.UnixMilli(ms).UTC()
+	}
+	return state, nil
+}
@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/topics"
+)
+
+// subscribeScript records a subscription handle and makes the user a member
+// of the topic.
+// KEYS: handles, members, user topics, device topics (optional)
+// ARGV: handle, user ID, topic
+var subscribeScript = redis.NewScript(`
+redis.call('SADD', KEYS[1], ARGV[1])
+redis.call('SADD', KEYS[2], ARGV[2])
+redis.call('SADD', KEYS[3], ARGV[3])
+if KEYS[4] then
+	redis.call('SADD', KEYS[4], ARGV[3])
+end
+return 1
+`)
+
+// unsubscribeScript drops a subscription handle and removes the user from
+// the topic once no handle is left
+var unsubscribeScript = redis.NewScript(`
+local removed = redis.call('SREM', KEYS[1], ARGV[1])
+if redis.call('SCARD', KEYS[1]) == 0 then
+	redis.call('SREM', KEYS[2], ARGV[2])
+	redis.call('SREM', KEYS[3], ARGV[3])
+end
+if KEYS[4] then
+	redis.call('SREM', KEYS[4], ARGV[3])
+end
+return removed
+`)
+
+// TopicStore keeps topic membership in Redis sets. topic:{name}:members holds
+// the user IDs read by broadcasts; each user's subscriptions to a topic are
+// tracked as handles (the user itself or one of its devices) so membership
+// survives until the last of them is removed.
+type TopicStore struct {
+	client            *redis.Client
+	topicPrefix       string
+	userTopicsPrefix  string
+	deviceTopicPrefix string
+}
+
+// NewTopicStore creates a new Redis-backed topic subscription store
+func NewTopicStore(client *redis.Client) *TopicStore {
+	return &TopicStore{
+		client:            client,
+		topicPrefix:       "topic:",
+		userTopicsPrefix:  "user_topics:",
+		deviceTopicPrefix: "device_topics:",
+	}
+}
+
+func (ts *TopicStore) keys(ctx context.Context, topic string, sub topics.Subscriber) []string {
+	keys := []string{
+		tenant.ContextKey(ctx, fmt.Sprintf("%s%s:subscriptions:%s", ts.topicPrefix, topic, sub.UserID)),
+		tenant.ContextKey(ctx, fmt.Sprintf("%s%s:members", ts.topicPrefix, topic)),
+		tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ts.userTopicsPrefix, sub.UserID)),
+	}
+	if sub.DeviceID != "" {
+		keys = append(keys, tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ts.deviceTopicPrefix, sub.DeviceID)))
+	}
+	return keys
+}
+
+// Subscribe adds a user or device subscription to a topic
+func (ts *TopicStore) Subscribe(ctx context.Context, topic string, sub topics.Subscriber) error {
+	if err := subscribeScript.Run(ctx, ts.client, ts.keys(ctx, topic, sub), sub.Handle(), sub.UserID, topic).Err(); err != nil {
+		return fmt.Errorf("redis subscribe error: %w", err)
+	}
+	return nil
+}
+
+// SubscribeMany adds several subscriptions to a topic in one round trip
+func (ts *TopicStore) SubscribeMany(ctx context.Context, topic string, subs []topics.Subscriber) error {
+	pipe := ts.client.Pipeline()
+	for _, sub := range subs {
+		// EVAL rather than EVALSHA: a pipeline cannot fall back on NOSCRIPT
+		subscribeScript.Eval(ctx, pipe, ts.keys(ctx, topic, sub), sub.Handle(), sub.UserID, topic)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return nil
+}
+
+// Unsubscribe removes a user or device subscription from a topic
+func (ts *TopicStore) Unsubscribe(ctx context.Context, topic string, sub topics.Subscriber) error {
+	if err := unsubscribeScript.Run(ctx, ts.client, ts.keys(ctx, topic, sub), sub.Handle(), sub.UserID, topic).Err(); err != nil {
+		return fmt.Errorf("redis unsubscribe error: %w", err)
+	}
+	return nil
+}
+
+// UnsubscribeDevice removes every topic subscription held by a device
+func (ts *TopicStore) UnsubscribeDevice(ctx context.Context, userID, deviceID string) error {
+	deviceTopics, err := ts.client.SMembers(ctx, tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ts.deviceTopicPrefix, deviceID))).Result()
+	if err != nil {
+		return fmt.Errorf("redis smembers error: %w", err)
+	}
+
+	sub := topics.Subscriber{UserID: userID, DeviceID: deviceID}
+	for _, topic := range deviceTopics {
+		if err := ts.Unsubscribe(ctx, topic, sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UserTopics lists the topics a user is a member of, sorted by name
+func (ts *TopicStore) UserTopics(ctx context.Context, userID string) ([]string, error) {
+	userTopics, err := ts.client.SMembers(ctx, tenant.ContextKey(ctx, fmt.Sprintf("%s%s", ts.userTopicsPrefix, userID))).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis smembers error: %w", err)
+	}
+	sort.Strings(userTopics)
+	return userTopics, nil
+}
+
+// Count returns the number of users subscribed to a topic
+func (ts *TopicStore) Count(ctx context.Context, topic string) (int64, error) {
+	count, err := ts.client.SCard(ctx, tenant.ContextKey(ctx, fmt.Sprintf("%s%s:members", ts.topicPrefix, topic))).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis scard error: %w", err)
+	}
+	return count, nil
+}
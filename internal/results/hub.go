@@ -0,0 +1,119 @@
+package results
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// Filter selects the results a subscriber receives; empty fields match all
+type Filter struct {
+	TenantID string
+	UserID   string
+	Provider string
+	Outcome  pkg.Outcome
+}
+
+// Match reports whether the result passes the filter
+func (f Filter) Match(result *pkg.ProcessingResult) bool {
+	return (f.TenantID == "" || f.TenantID == result.TenantID) &&
+		(f.UserID == "" || f.UserID == result.UserID) &&
+		(f.Provider == "" || f.Provider == result.Provider) &&
+		(f.Outcome == "" || f.Outcome == result.Outcome)
+}
+
+// Subscription receives the results matching its filter. Its buffer is
+// bounded: results that do not fit are dropped and counted rather than
+// blocking the publisher.
+type Subscription struct {
+	C <-chan *pkg.ProcessingResult
+
+	hub     *Hub
+	ch      chan *pkg.ProcessingResult
+	filter  Filter
+	dropped int64
+}
+
+// Dropped returns how many results were dropped because the subscriber was
+// too slow
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Close unsubscribes and closes C
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// Hub fans processing results out to live subscribers
+type Hub struct {
+	mu            sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+}
+
+// NewHub creates a new result hub
+func NewHub() *Hub {
+	return &Hub{subscriptions: make(map[*Subscription]struct{})}
+}
+
+// Subscribe returns a subscription buffering up to buffer results
+func (h *Hub) Subscribe(filter Filter, buffer int) *Subscription {
+	ch := make(chan *pkg.ProcessingResult, buffer)
+	sub := &Subscription{C: ch, hub: h, ch: ch, filter: filter}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return sub
+	}
+	h.subscriptions[sub] = struct{}{}
+	return sub
+}
+
+// Close ends every subscription, e.g. on shutdown; later subscriptions are
+// closed immediately
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subscriptions {
+		delete(h.subscriptions, sub)
+		close(sub.ch)
+	}
+}
+
+func (h *Hub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscriptions[sub]; ok {
+		delete(h.subscriptions, sub)
+		close(sub.ch)
+	}
+}
+
+// Publish hands the result to every matching subscriber without blocking
+func (h *Hub) Publish(result *pkg.ProcessingResult) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subscriptions {
+		if !sub.filter.Match(result) {
+			continue
+		}
+		select {
+		case sub.ch <- result:
+		default:
+			atomic.AddInt64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Subscribers returns the number of live subscriptions
+func (h *Hub) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subscriptions)
+}
@@ -0,0 +1,71 @@
+package results
+
+import (
+	"testing"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+func TestHubFiltersResults(t *testing.T) {
+	hub := NewHub()
+	all := hub.Subscribe(Filter{}, 10)
+	acme := hub.Subscribe(Filter{TenantID: "acme", Outcome: pkg.OutcomeDelivered}, 10)
+	defer all.Close()
+	defer acme.Close()
+
+	hub.Publish(&pkg.ProcessingResult{MessageID: "1", TenantID: "acme", Outcome: pkg.OutcomeDelivered})
+	hub.Publish(&pkg.ProcessingResult{MessageID: "2", TenantID: "acme", Outcome: pkg.OutcomeFailed})
+	hub.Publish(&pkg.ProcessingResult{MessageID: "3", TenantID: "globex", Outcome: pkg.OutcomeDelivered})
+
+	if len(all.C) != 3 {
+		t.Errorf("expected unfiltered subscriber to get 3 results, got %d", len(all.C))
+	}
+	if len(acme.C) != 1 {
+		t.Fatalf("expected filtered subscriber to get 1 result, got %d", len(acme.C))
+	}
+	if result := <-acme.C; result.MessageID != "1" {
+		t.Errorf("expected result 1, got %s", result.MessageID)
+	}
+}
+
+func TestHubDropsForSlowSubscribers(t *testing.T) {
+	hub := NewHub()
+	sub := hub.Subscribe(Filter{}, 2)
+
+	// Publishing never blocks on a full buffer
+	for i := 0; i < 5; i++ {
+		hub.Publish(&pkg.ProcessingResult{MessageID: "m"})
+	}
+	if len(sub.C) != 2 {
+		t.Errorf("expected buffer to hold 2 results, got %d", len(sub.C))
+	}
+	if sub.Dropped() != 3 {
+		t.Errorf("expected 3 dropped results, got %d", sub.Dropped())
+	}
+
+	sub.Close()
+	sub.Close()
+	if hub.Subscribers() != 0 {
+		t.Errorf("expected no subscribers after close, got %d", hub.Subscribers())
+	}
+	for range sub.C {
+		// Drain; the channel is closed
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub()
+	sub := hub.Subscribe(Filter{}, 1)
+
+	hub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Errorf("expected subscription to be closed")
+	}
+	sub.Close()
+
+	late := hub.Subscribe(Filter{}, 1)
+	if _, ok := <-late.C; ok {
+		t.Errorf("expected subscriptions after close to be closed")
+	}
+	hub.Publish(&pkg.ProcessingResult{MessageID: "m"})
+}
@@ -0,0 +1,185 @@
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// Event is the JSON form of a processing result sent to stream clients
+type Event struct {
+	MessageID     string      `json:"message_id"`
+	TenantID      string      `json:"tenant_id"`
+	UserID        string      `json:"user_id"`
+	Success       bool        `json:"success"`
+	Outcome       pkg.Outcome `json:"outcome"`
+	Channel       pkg.Channel `json:"channel"`
+	Provider      string      `json:"provider,omitempty"`
+	Error         string      `json:"error,omitempty"`
+	ProcessedAt   time.Time   `json:"processed_at"`
+	Attempts      int         `json:"attempts"`
+	DeferredUntil *time.Time  `json:"deferred_until,omitempty"`
+}
+
+// NewEvent converts a processing result
+func NewEvent(result *pkg.ProcessingResult) Event {
+	event := Event{
+		MessageID:     result.MessageID,
+		TenantID:      result.TenantID,
+		UserID:        result.UserID,
+		Success:       result.Success,
+		Outcome:       result.Outcome,
+		Channel:       result.Channel,
+		Provider:      result.Provider,
+		ProcessedAt:   result.ProcessedAt,
+		Attempts:      result.Attempts,
+		DeferredUntil: result.DeferredUntil,
+	}
+	if result.Error != nil {
+		event.Error = result.Error.Error()
+	}
+	return event
+}
+
+// Dropped tells a stream client how many results it has missed so far
+// because it read too slowly
+type Dropped struct {
+	Dropped int64 `json:"dropped"`
+}
+
+// message is a WebSocket frame: a result or a drop notice
+type message struct {
+	Type    string `json:"type"`
+	Result  *Event `json:"result,omitempty"`
+	Dropped int64  `json:"dropped,omitempty"`
+}
+
+// StreamSSE writes the subscription's results as server-sent "result"
+// events until the client goes away or the subscription is closed. A
+// comment is sent every heartbeat to keep idle connections open.
+func StreamSSE(w http.ResponseWriter, r *http.Request, sub *Subscription, heartbeat time.Duration) error {
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+		return fmt.Errorf("failed to clear write deadline: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return fmt.Errorf("streaming not supported: %w", err)
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	var reported int64
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case result, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if err := writeSSE(w, "result", NewEvent(result)); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return err
+			}
+		}
+
+		if dropped := sub.Dropped(); dropped != reported {
+			reported = dropped
+			if err := writeSSE(w, "dropped", Dropped{Dropped: dropped}); err != nil {
+				return err
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// writeSSE writes one server-sent event with a JSON payload
+func writeSSE(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", event, err)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// StreamWebSocket writes the subscription's results to an upgraded
+// connection as JSON text messages until the client disconnects or the
+// subscription is closed. The connection is pinged every heartbeat and
+// dropped if the client stops answering. It closes conn when done.
+func StreamWebSocket(conn *websocket.Conn, sub *Subscription, heartbeat time.Duration) error {
+	defer conn.Close()
+
+	// Clients only send control frames; reading processes them and
+	// notices when the client goes away
+	gone := make(chan struct{})
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	var reported int64
+	for {
+		select {
+		case <-gone:
+			return nil
+		case result, ok := <-sub.C:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+					time.Now().Add(time.Second))
+				return nil
+			}
+			event := NewEvent(result)
+			if err := writeWebSocket(conn, heartbeat, message{Type: "result", Result: &event}); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(heartbeat)); err != nil {
+				return err
+			}
+		}
+
+		if dropped := sub.Dropped(); dropped != reported {
+			reported = dropped
+			if err := writeWebSocket(conn, heartbeat, message{Type: "dropped", Dropped: dropped}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeWebSocket writes one JSON message, giving up after timeout
+func writeWebSocket(conn *websocket.Conn, timeout time.Duration, msg message) error {
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	return conn.WriteJSON(msg)
+}
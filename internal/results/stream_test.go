@@ -0,0 +1,199 @@
+package results
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/auth"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// waitForSubscribers waits until the hub has n subscriptions
+func waitForSubscribers(t *testing.T, hub *Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Subscribers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers, got %d", n, hub.Subscribers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStreamSSE(t *testing.T) {
+	hub := NewHub()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub := hub.Subscribe(Filter{UserID: "user1"}, 10)
+		defer sub.Close()
+		if err := StreamSSE(w, r, sub, time.Minute); err != nil {
+			t.Errorf("unexpected stream error: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %s", ct)
+	}
+
+	waitForSubscribers(t, hub, 1)
+	hub.Publish(&pkg.ProcessingResult{MessageID: "skip", UserID: "user2"})
+	hub.Publish(&pkg.ProcessingResult{
+		MessageID: "m1",
+		UserID:    "user1",
+		Outcome:   pkg.OutcomeFailed,
+		Error:     errors.New("device token expired"),
+	})
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("unexpected error reading stream: %v", err)
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if lines[0] != "event: result" {
+		t.Fatalf("expected result event, got %q", lines[0])
+	}
+
+	var event Event
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &event); err != nil {
+		t.Fatalf("unexpected error decoding event: %v", err)
+	}
+	if event.MessageID != "m1" || event.Outcome != pkg.OutcomeFailed || event.Error != "device token expired" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	// Closing the hub ends the stream
+	hub.Close()
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Errorf("expected stream to end after the hub closed, got %v", err)
+	}
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	hub := NewHub()
+
+	// A one-result buffer makes the second result drop
+	sub := hub.Subscribe(Filter{Provider: "apns"}, 1)
+	hub.Publish(&pkg.ProcessingResult{MessageID: "m1", Provider: "apns"})
+	hub.Publish(&pkg.ProcessingResult{MessageID: "m2", Provider: "apns"})
+	hub.Publish(&pkg.ProcessingResult{MessageID: "skip", Provider: "fcm"})
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer sub.Close()
+		StreamWebSocket(conn, sub, time.Minute)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Type != "result" || msg.Result == nil || msg.Result.MessageID != "m1" {
+		t.Fatalf("expected result m1, got %+v", msg)
+	}
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Type != "dropped" || msg.Dropped != 1 {
+		t.Errorf("expected 1 dropped result, got %+v", msg)
+	}
+
+	// The subscription ends when the client disconnects
+	conn.Close()
+	waitForSubscribers(t, hub, 0)
+}
+
+// TestStreamsThroughAuth streams through the auth middleware, which wraps
+// the response writer, behind a server whose write timeout the streams
+// must outlive
+func TestStreamsThroughAuth(t *testing.T) {
+	hub := NewHub()
+	authn := auth.NewAuthenticator(nil)
+	authn.SetBootstrapKey("pk_test")
+	scopes := func(r *http.Request) auth.Scope { return auth.ScopeReadStatus }
+
+	upgrader := websocket.Upgrader{}
+	handler := auth.Middleware(authn, scopes, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub := hub.Subscribe(Filter{UserID: "user1"}, 10)
+		defer sub.Close()
+		if r.URL.Path == "/ws" {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			StreamWebSocket(conn, sub, time.Minute)
+			return
+		}
+		if err := StreamSSE(w, r, sub, time.Minute); err != nil {
+			t.Errorf("unexpected stream error: %v", err)
+		}
+	}))
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/sse", nil)
+	req.Header.Set("X-API-Key", "pk_test")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the SSE stream to open, got status %d", resp.StatusCode)
+	}
+
+	header := http.Header{"X-API-Key": []string{"pk_test"}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatalf("expected the WebSocket upgrade to succeed, got %v", err)
+	}
+	defer conn.Close()
+
+	waitForSubscribers(t, hub, 2)
+	time.Sleep(2 * server.Config.WriteTimeout)
+	hub.Publish(&pkg.ProcessingResult{MessageID: "m1", UserID: "user1"})
+
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || strings.TrimSpace(line) != "event: result" {
+		t.Errorf("expected a result event past the write timeout, got %q: %v", line, err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg message
+	if err := conn.ReadJSON(&msg); err != nil || msg.Result == nil || msg.Result.MessageID != "m1" {
+		t.Errorf("expected result m1 over the WebSocket, got %+v: %v", msg, err)
+	}
+}
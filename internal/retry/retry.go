@@ -0,0 +1,94 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/provider"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// DefaultRetryableCodes are the provider error codes of failures that may
+// succeed when tried again
+var DefaultRetryableCodes = []string{
+	pkg.ErrorCodeTimeout,
+	pkg.ErrorCodeUnavailable,
+	pkg.ErrorCodeThrottled,
+}
+
+// Policy decides whether and when a failed delivery is tried again. Delays
+// grow exponentially from BaseDelay up to MaxDelay, with full jitter: each
+// delay is drawn uniformly between zero and its cap, so retries of many
+// notifications failing together spread out instead of arriving at once.
+type Policy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+
+	retryable map[string]bool
+}
+
+// NewPolicy creates a policy of up to maxRetries retries that retries
+// failed responses with the given error codes
+func NewPolicy(maxRetries int, baseDelay, maxDelay time.Duration, retryableCodes []string) Policy {
+	retryable := make(map[string]bool, len(retryableCodes))
+	for _, code := range retryableCodes {
+		retryable[code] = true
+	}
+	return Policy{
+		MaxRetries: maxRetries,
+		BaseDelay:  baseDelay,
+		MaxDelay:   maxDelay,
+		retryable:  retryable,
+	}
+}
+
+// Retryable reports whether the result of a provider call is a transient
+// failure. Errors are, unless the call was cancelled, as they stand for
+// failures to reach the provider; failed responses are when the provider
+// throttled us or their code is retryable.
+func (p Policy) Retryable(response *pkg.ProviderResponse, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	if _, throttled := provider.Throttled(response, nil); throttled {
+		return true
+	}
+	return response != nil && !response.Success && p.retryable[response.Code]
+}
+
+// Backoff returns the delay before a retry, numbered from 1: a random
+// duration up to BaseDelay doubled for each earlier retry, capped at MaxDelay
+func (p Policy) Backoff(retry int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < retry && (p.MaxDelay <= 0 || ceiling < p.MaxDelay); i++ {
+		ceiling *= 2
+	}
+	if p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Next returns the delay before the given retry of a notification, or false
+// when the retries are used up or the notification would expire first
+func (p Policy) Next(notification *pkg.NotificationMessage, retry int, now time.Time) (time.Duration, bool) {
+	if retry > p.MaxRetries {
+		return 0, false
+	}
+	delay := p.Backoff(retry)
+	if Expires(notification, now.Add(delay)) {
+		return 0, false
+	}
+	return delay, true
+}
+
+// Expires reports whether a notification expires before the given time
+func Expires(notification *pkg.NotificationMessage, at time.Time) bool {
+	return notification.ExpiresAt != nil && !notification.ExpiresAt.After(at)
+}
@@ -0,0 +1,75 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+func TestBackoff(t *testing.T) {
+	p := NewPolicy(10, 100*time.Millisecond, time.Second, DefaultRetryableCodes)
+
+	ceilings := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, ceiling := range ceilings {
+		var longest time.Duration
+		for j := 0; j < 200; j++ {
+			delay := p.Backoff(i + 1)
+			if delay < 0 || delay > ceiling {
+				t.Fatalf("retry %d: delay %v outside [0, %v]", i+1, delay, ceiling)
+			}
+			longest = max(longest, delay)
+		}
+		if longest < ceiling/2 {
+			t.Errorf("retry %d: expected delays spread up to %v, longest was %v", i+1, ceiling, longest)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	p := NewPolicy(3, time.Second, time.Minute, DefaultRetryableCodes)
+
+	tests := []struct {
+		name      string
+		response  *pkg.ProviderResponse
+		err       error
+		retryable bool
+	}{
+		{"network error", nil, errors.New("connection refused"), true},
+		{"cancelled", nil, context.Canceled, false},
+		{"unavailable", &pkg.ProviderResponse{Code: pkg.ErrorCodeUnavailable}, nil, true},
+		{"throttled", &pkg.ProviderResponse{Throttled: true}, nil, true},
+		{"unregistered", &pkg.ProviderResponse{Code: pkg.ErrorCodeUnregistered}, nil, false},
+		{"no code", &pkg.ProviderResponse{Error: "rejected"}, nil, false},
+		{"success", &pkg.ProviderResponse{Success: true}, nil, false},
+	}
+
+	for _, test := range tests {
+		if got := p.Retryable(test.response, test.err); got != test.retryable {
+			t.Errorf("%s: expected retryable %v, got %v", test.name, test.retryable, got)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	p := NewPolicy(2, time.Second, time.Second, DefaultRetryableCodes)
+	now := time.Now()
+
+	if _, ok := p.Next(&pkg.NotificationMessage{}, 2, now); !ok {
+		t.Errorf("expected a second retry")
+	}
+	if _, ok := p.Next(&pkg.NotificationMessage{}, 3, now); ok {
+		t.Errorf("expected no third retry")
+	}
+
+	expiresAt := now
+	if _, ok := p.Next(&pkg.NotificationMessage{ExpiresAt: &expiresAt}, 1, now); ok {
+		t.Errorf("expected no retry due at or past expiry")
+	}
+	expiresAt = now.Add(time.Hour)
+	if _, ok := p.Next(&pkg.NotificationMessage{ExpiresAt: &expiresAt}, 1, now); !ok {
+		t.Errorf("expected a retry well before expiry")
+	}
+}
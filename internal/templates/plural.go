@@ -0,0 +1,137 @@
+package templates
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Plural categories as defined by CLDR
+const (
+	PluralOne   = "one"
+	PluralFew   = "few"
+	PluralMany  = "many"
+	PluralOther = "other"
+)
+
+// Plural selects the form matching count for the locale. Forms are given as
+// category/text pairs and "#" in the chosen text is replaced by the count:
+//
+//	{{plural .count "one" "# new message" "other" "# new messages"}}
+func Plural(locale string, count interface{}, forms ...string) (string, error) {
+	if len(forms)%2 != 0 {
+		return "", fmt.Errorf("plural forms must be category/text pairs")
+	}
+
+	n, err := toInt(count)
+	if err != nil {
+		return "", err
+	}
+
+	byCategory := make(map[string]string, len(forms)/2)
+	for i := 0; i < len(forms); i += 2 {
+		byCategory[forms[i]] = forms[i+1]
+	}
+
+	text, ok := byCategory[PluralCategory(locale, n)]
+	if !ok {
+		if text, ok = byCategory[PluralOther]; !ok {
+			return "", fmt.Errorf("plural forms have no %q category", PluralOther)
+		}
+	}
+
+	return strings.ReplaceAll(text, "#", strconv.Itoa(n)), nil
+}
+
+// PluralCategory returns the CLDR cardinal plural category of n for a locale.
+// Only integer rules of common languages are covered; anything else uses the
+// English rule.
+func PluralCategory(locale string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	mod10, mod100 := n%10, n%100
+
+	switch language(locale) {
+	case "ja", "ko", "zh", "th", "vi", "id", "ms", "tr":
+		return PluralOther
+
+	case "fr", "pt-BR":
+		if n == 0 || n == 1 {
+			return PluralOne
+		}
+		return PluralOther
+
+	case "ru", "uk", "be":
+		switch {
+		case mod10 == 1 && mod100 != 11:
+			return PluralOne
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return PluralFew
+		default:
+			return PluralMany
+		}
+
+	case "pl":
+		switch {
+		case n == 1:
+			return PluralOne
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return PluralFew
+		default:
+			return PluralMany
+		}
+
+	case "cs", "sk":
+		switch {
+		case n == 1:
+			return PluralOne
+		case n >= 2 && n <= 4:
+			return PluralFew
+		default:
+			return PluralOther
+		}
+
+	default:
+		if n == 1 {
+			return PluralOne
+		}
+		return PluralOther
+	}
+}
+
+// language returns the rule key for a locale; Brazilian Portuguese differs
+// from European Portuguese so it keeps its region
+func language(locale string) string {
+	locale = NormalizeLocale(locale)
+	if locale == "pt-BR" {
+		return locale
+	}
+	if i := strings.Index(locale, "-"); i >= 0 {
+		return locale[:i]
+	}
+	return locale
+}
+
+// toInt converts template data values, which are often float64 after JSON
+// decoding, to an integer count
+func toInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	case string:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("plural count %q is not a number", v)
+		}
+		return n, nil
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("plural count of type %T is not a number", value)
+	}
+}
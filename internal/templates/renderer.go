@@ -0,0 +1,101 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// ErrNotFound is returned by stores for unknown templates or versions
+var ErrNotFound = errors.New("template not found")
+
+// Store persists versioned templates. Saving a template creates a new version
+// and makes it current; Rollback makes an earlier version current again.
+type Store interface {
+	Save(ctx context.Context, tpl *Template) (*Template, error)
+	Get(ctx context.Context, id string) (*Template, error)
+	GetVersion(ctx context.Context, id string, version int) (*Template, error)
+	Versions(ctx context.Context, id string) ([]int, error)
+	Rollback(ctx context.Context, id string, version int) (*Template, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// LocaleResolver returns a user's preferred locale, or "" when unknown
+type LocaleResolver interface {
+	Locale(ctx context.Context, userID string) (string, error)
+}
+
+// DataKeyLocale is the notification data key carrying an explicit locale
+const DataKeyLocale = "locale"
+
+// Renderer resolves template references on notifications
+type Renderer struct {
+	store   Store
+	locales LocaleResolver
+}
+
+// NewRenderer creates a new renderer. locales may be nil, in which case only
+// Data["locale"] and the template default are considered.
+func NewRenderer(store Store, locales LocaleResolver) *Renderer {
+	return &Renderer{
+		store:   store,
+		locales: locales,
+	}
+}
+
+// SetLocaleResolver sets the source of user locale preferences
+func (r *Renderer) SetLocaleResolver(locales LocaleResolver) {
+	r.locales = locales
+}
+
+// Apply renders the notification's template into its Title and Body. The
+// original message is left untouched; notifications without a template are
+// returned as is.
+func (r *Renderer) Apply(ctx context.Context, notification *pkg.NotificationMessage) (*pkg.NotificationMessage, error) {
+	if notification.TemplateID == "" {
+		return notification, nil
+	}
+
+	var tpl *Template
+	var err error
+	if notification.TemplateVersion > 0 {
+		tpl, err = r.store.GetVersion(ctx, notification.TemplateID, notification.TemplateVersion)
+	} else {
+		tpl, err = r.store.Get(ctx, notification.TemplateID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template %s: %w", notification.TemplateID, err)
+	}
+
+	rendered, err := tpl.Render(r.resolveLocale(ctx, notification), notification.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := *notification
+	out.Title = rendered.Title
+	out.Body = rendered.Body
+	out.Data = make(map[string]interface{}, len(notification.Data)+1)
+	for k, v := range notification.Data {
+		out.Data[k] = v
+	}
+	out.Data[DataKeyLocale] = rendered.Locale
+
+	return &out, nil
+}
+
+// resolveLocale picks the user's preferred locale, then Data["locale"]
+func (r *Renderer) resolveLocale(ctx context.Context, notification *pkg.NotificationMessage) string {
+	if r.locales != nil {
+		if locale, err := r.locales.Locale(ctx, notification.UserID); err == nil && locale != "" {
+			return locale
+		}
+	}
+
+	if locale, ok := notification.Data[DataKeyLocale].(string); ok {
+		return locale
+	}
+	return ""
+}
@@ -0,0 +1,170 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Template is a versioned, localized notification template
+type Template struct {
+	ID            string             `json:"id"`
+	Version       int                `json:"version"`
+	DefaultLocale string             `json:"default_locale"`
+	Locales       map[string]Content `json:"locales"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+// Content holds the title and body templates for one locale
+type Content struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// Rendered is the output of rendering a template
+type Rendered struct {
+	Title  string
+	Body   string
+	Locale string
+}
+
+// fallbackLocale is the last resort in every fallback chain
+const fallbackLocale = "en"
+
+// Validate checks that the template is well-formed and every locale parses
+func (t *Template) Validate() error {
+	if t.ID == "" {
+		return fmt.Errorf("template id is required")
+	}
+	if len(t.Locales) == 0 {
+		return fmt.Errorf("template %s has no locales", t.ID)
+	}
+
+	normalized := make(map[string]Content, len(t.Locales))
+	for locale, content := range t.Locales {
+		for field, text := range map[string]string{"title": content.Title, "body": content.Body} {
+			if _, err := parse(locale, text); err != nil {
+				return fmt.Errorf("locale %s %s: %w", locale, field, err)
+			}
+		}
+		normalized[NormalizeLocale(locale)] = content
+	}
+	t.Locales = normalized
+
+	if t.DefaultLocale == "" {
+		t.DefaultLocale = fallbackLocale
+	}
+	t.DefaultLocale = NormalizeLocale(t.DefaultLocale)
+	if _, ok := t.Locales[t.DefaultLocale]; !ok {
+		return fmt.Errorf("template %s has no content for default locale %s", t.ID, t.DefaultLocale)
+	}
+
+	return nil
+}
+
+// Render renders the template for the best matching locale
+func (t *Template) Render(locale string, data map[string]interface{}) (*Rendered, error) {
+	for _, candidate := range FallbackChain(locale, t.DefaultLocale) {
+		content, ok := t.Locales[candidate]
+		if !ok {
+			continue
+		}
+
+		title, err := execute(candidate, content.Title, data)
+		if err != nil {
+			return nil, fmt.Errorf("template %s v%d title: %w", t.ID, t.Version, err)
+		}
+		body, err := execute(candidate, content.Body, data)
+		if err != nil {
+			return nil, fmt.Errorf("template %s v%d body: %w", t.ID, t.Version, err)
+		}
+
+		return &Rendered{Title: title, Body: body, Locale: candidate}, nil
+	}
+
+	return nil, fmt.Errorf("template %s has no content for locale %s", t.ID, locale)
+}
+
+// FallbackChain returns the locales to try in order, e.g. "pt-BR" yields
+// pt-BR, pt, the template default, then en
+func FallbackChain(locale, defaultLocale string) []string {
+	var chain []string
+	seen := make(map[string]bool)
+	add := func(l string) {
+		if l != "" && !seen[l] {
+			seen[l] = true
+			chain = append(chain, l)
+		}
+	}
+
+	locale = NormalizeLocale(locale)
+	for locale != "" {
+		add(locale)
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+
+	add(NormalizeLocale(defaultLocale))
+	add(fallbackLocale)
+	return chain
+}
+
+// NormalizeLocale converts locale tags to the "ll-RR" form, e.g. pt_br to pt-BR
+func NormalizeLocale(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	if parts[0] == "" {
+		return ""
+	}
+
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		} else if len(parts[i]) == 4 {
+			// Script subtags are title case, e.g. zh-Hant
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// parse compiles a template string with the locale-aware function map
+func parse(locale, text string) (*template.Template, error) {
+	return template.New("").Option("missingkey=error").Funcs(funcMap(locale)).Parse(text)
+}
+
+// execute renders a template string against the notification data
+func execute(locale, text string, data map[string]interface{}) (string, error) {
+	tmpl, err := parse(locale, text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// funcMap returns the helper functions available to templates
+func funcMap(locale string) template.FuncMap {
+	return template.FuncMap{
+		"plural": func(count interface{}, forms ...string) (string, error) {
+			return Plural(locale, count, forms...)
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"default": func(fallback, value interface{}) interface{} {
+			if value == nil || value == "" {
+				return fallback
+			}
+			return value
+		},
+	}
+}
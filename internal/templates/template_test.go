@@ -0,0 +1,201 @@
+package templates
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+func TestFallbackChain(t *testing.T) {
+	tests := []struct {
+		locale        string
+		defaultLocale string
+		expected      []string
+	}{
+		{"pt_br", "es", []string{"pt-BR", "pt", "es", "en"}},
+		{"zh-hant-tw", "en", []string{"zh-Hant-TW", "zh-Hant", "zh", "en"}},
+		{"", "de", []string{"de", "en"}},
+		{"EN-gb", "en", []string{"en-GB", "en"}},
+	}
+
+	for _, test := range tests {
+		chain := FallbackChain(test.locale, test.defaultLocale)
+		if !reflect.DeepEqual(chain, test.expected) {
+			t.Errorf("FallbackChain(%q, %q) = %v, expected %v", test.locale, test.defaultLocale, chain, test.expected)
+		}
+	}
+}
+
+func TestPluralCategory(t *testing.T) {
+	tests := []struct {
+		locale   string
+		n        int
+		expected string
+	}{
+		{"en", 1, PluralOne},
+		{"en", 0, PluralOther},
+		{"en", 5, PluralOther},
+		{"fr", 0, PluralOne},
+		{"pt-PT", 0, PluralOther},
+		{"pt-BR", 0, PluralOne},
+		{"ru", 1, PluralOne},
+		{"ru", 3, PluralFew},
+		{"ru", 11, PluralMany},
+		{"ru", 21, PluralOne},
+		{"pl", 22, PluralFew},
+		{"pl", 25, PluralMany},
+		{"ja", 1, PluralOther},
+	}
+
+	for _, test := range tests {
+		if got := PluralCategory(test.locale, test.n); got != test.expected {
+			t.Errorf("PluralCategory(%q, %d) = %s, expected %s", test.locale, test.n, got, test.expected)
+		}
+	}
+}
+
+func TestTemplateRender(t *testing.T) {
+	tpl := &Template{
+		ID:            "new_messages",
+		DefaultLocale: "en",
+		Locales: map[string]Content{
+			"en": {
+				Title: "Hi {{.name}}",
+				Body:  `You have {{plural .count "one" "# new message" "other" "# new messages"}}`,
+			},
+			"ru": {
+				Title: "Привет, {{.name}}",
+				Body:  `У вас {{plural .count "one" "# новое сообщение" "few" "# новых сообщения" "many" "# новых сообщений"}}`,
+			},
+		},
+	}
+	if err := tpl.Validate(); err != nil {
+		t.Fatalf("Expected valid template, got %v", err)
+	}
+
+	// JSON decoded counts arrive as float64
+	rendered, err := tpl.Render("en-US", map[string]interface{}{"name": "Ada", "count": float64(1)})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rendered.Locale != "en" || rendered.Title != "Hi Ada" || rendered.Body != "You have 1 new message" {
+		t.Errorf("Unexpected rendering %+v", rendered)
+	}
+
+	rendered, err = tpl.Render("ru-RU", map[string]interface{}{"name": "Ада", "count": 3})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rendered.Locale != "ru" || rendered.Body != "У вас 3 новых сообщения" {
+		t.Errorf("Unexpected rendering %+v", rendered)
+	}
+
+	// Unknown locales fall back to the default
+	rendered, err = tpl.Render("de", map[string]interface{}{"name": "Ada", "count": 2})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rendered.Locale != "en" || rendered.Body != "You have 2 new messages" {
+		t.Errorf("Unexpected rendering %+v", rendered)
+	}
+
+	// Missing variables are an error rather than "<no value>"
+	if _, err := tpl.Render("en", map[string]interface{}{"count": 2}); err == nil {
+		t.Errorf("Expected error for missing variable")
+	}
+}
+
+func TestTemplateValidate(t *testing.T) {
+	invalid := &Template{ID: "broken", Locales: map[string]Content{"en": {Title: "{{.name"}}}
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected parse error")
+	}
+
+	noDefault := &Template{ID: "fr_only", DefaultLocale: "en", Locales: map[string]Content{"fr": {Title: "Salut"}}}
+	if err := noDefault.Validate(); err == nil {
+		t.Errorf("Expected error when default locale has no content")
+	}
+}
+
+// memoryStore is an in-memory Store for tests
+type memoryStore struct {
+	templates map[string]*Template
+}
+
+func (m *memoryStore) Save(ctx context.Context, tpl *Template) (*Template, error) {
+	m.templates[tpl.ID] = tpl
+	return tpl, nil
+}
+func (m *memoryStore) Get(ctx context.Context, id string) (*Template, error) {
+	if tpl, ok := m.templates[id]; ok {
+		return tpl, nil
+	}
+	return nil, ErrNotFound
+}
+func (m *memoryStore) GetVersion(ctx context.Context, id string, version int) (*Template, error) {
+	if tpl, ok := m.templates[id]; ok && tpl.Version == version {
+		return tpl, nil
+	}
+	return nil, ErrNotFound
+}
+func (m *memoryStore) Versions(ctx context.Context, id string) ([]int, error) { return nil, nil }
+func (m *memoryStore) Rollback(ctx context.Context, id string, version int) (*Template, error) {
+	return m.GetVersion(ctx, id, version)
+}
+func (m *memoryStore) Delete(ctx context.Context, id string) error { return nil }
+
+type staticLocales string
+
+func (s staticLocales) Locale(ctx context.Context, userID string) (string, error) {
+	return string(s), nil
+}
+
+func TestRendererApply(t *testing.T) {
+	store := &memoryStore{templates: map[string]*Template{
+		"welcome": {
+			ID:            "welcome",
+			Version:       1,
+			DefaultLocale: "en",
+			Locales: map[string]Content{
+				"en": {Title: "Welcome {{.name}}", Body: "Glad you're here"},
+				"fr": {Title: "Bienvenue {{.name}}", Body: "Ravi de vous voir"},
+			},
+		},
+	}}
+
+	notification := &pkg.NotificationMessage{
+		ID:         "test-123",
+		UserID:     "user-456",
+		TemplateID: "welcome",
+		Data:       map[string]interface{}{"name": "Ada", "locale": "fr-CA"},
+	}
+
+	renderer := NewRenderer(store, nil)
+	rendered, err := renderer.Apply(context.Background(), notification)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rendered.Title != "Bienvenue Ada" || rendered.Data[DataKeyLocale] != "fr" {
+		t.Errorf("Expected French rendering from data locale, got %+v", rendered)
+	}
+	if notification.Title != "" {
+		t.Errorf("Expected original notification to be left untouched")
+	}
+
+	// The user's preference takes precedence over the data locale
+	renderer.SetLocaleResolver(staticLocales("en-GB"))
+	rendered, err = renderer.Apply(context.Background(), notification)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rendered.Title != "Welcome Ada" {
+		t.Errorf("Expected English rendering from user preference, got %s", rendered.Title)
+	}
+
+	notification.TemplateVersion = 7
+	if _, err := renderer.Apply(context.Background(), notification); err == nil {
+		t.Errorf("Expected error for unknown pinned version")
+	}
+}
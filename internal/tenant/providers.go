@@ -0,0 +1,40 @@
+package tenant
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Providers holds a tenant's own provider credentials. Channels left empty
+// use the shared providers of the deployment.
+type Providers struct {
+	SMTPAddr     string `json:"smtp_addr,omitempty"`
+	SMTPFrom     string `json:"smtp_from,omitempty"`
+	SMTPUsername string `json:"smtp_username,omitempty"`
+	SMTPPassword string `json:"smtp_password,omitempty"`
+
+	SMSGatewayURL string `json:"sms_gateway_url,omitempty"`
+	SMSAPIKey     string `json:"sms_api_key,omitempty"`
+	SMSSender     string `json:"sms_sender,omitempty"`
+}
+
+// LoadProviders reads per-tenant provider credentials from a JSON file that
+// maps tenant IDs to Providers
+func LoadProviders(path string) (map[string]Providers, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenant providers: %w", err)
+	}
+
+	var providers map[string]Providers
+	if err := json.Unmarshal(data, &providers); err != nil {
+		return nil, fmt.Errorf("failed to parse tenant providers: %w", err)
+	}
+	for id := range providers {
+		if err := Validate(id); err != nil {
+			return nil, err
+		}
+	}
+	return providers, nil
+}
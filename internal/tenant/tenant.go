@@ -0,0 +1,54 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// Default is the tenant of requests and notifications that do not name one.
+// Its Redis keys are not prefixed so data written before tenants existed
+// stays visible.
+const Default = pkg.DefaultTenant
+
+// namePattern restricts tenant IDs to characters that are safe in Redis keys
+// and metric labels
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+type contextKey struct{}
+
+// Validate checks that id is a well-formed tenant ID
+func Validate(id string) error {
+	if !namePattern.MatchString(id) {
+		return fmt.Errorf("invalid tenant %q: use 1-64 letters, digits, '-' or '_'", id)
+	}
+	return nil
+}
+
+// WithID returns a context carrying the tenant ID
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ID of the context, or Default
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey{}).(string); ok && id != "" {
+		return id
+	}
+	return Default
+}
+
+// Key namespaces a Redis key by tenant, e.g. "tenant:acme:rate_limit:user-1"
+func Key(id, key string) string {
+	if id == "" || id == Default {
+		return key
+	}
+	return fmt.Sprintf("tenant:%s:%s", id, key)
+}
+
+// ContextKey namespaces a Redis key by the tenant of the context
+func ContextKey(ctx context.Context, key string) string {
+	return Key(FromContext(ctx), key)
+}
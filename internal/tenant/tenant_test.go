@@ -0,0 +1,36 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	if got := Key(Default, "rate_limit:user-1"); got != "rate_limit:user-1" {
+		t.Errorf("Expected default tenant keys to be unprefixed, got %s", got)
+	}
+	if got := Key("acme", "rate_limit:user-1"); got != "tenant:acme:rate_limit:user-1" {
+		t.Errorf("Unexpected key %s", got)
+	}
+
+	ctx := WithID(context.Background(), "acme")
+	if FromContext(ctx) != "acme" || FromContext(context.Background()) != Default {
+		t.Errorf("Unexpected tenant from context")
+	}
+	if got := ContextKey(ctx, "preferences:user-1"); got != "tenant:acme:preferences:user-1" {
+		t.Errorf("Unexpected key %s", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, id := range []string{"acme", "team_1", "A-B"} {
+		if err := Validate(id); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", id, err)
+		}
+	}
+	for _, id := range []string{"", "a:b", "a b", "*"} {
+		if err := Validate(id); err == nil {
+			t.Errorf("Expected %q to be invalid", id)
+		}
+	}
+}
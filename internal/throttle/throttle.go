@@ -0,0 +1,244 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Policy configures the outbound token bucket of a provider. The refill rate
+// adapts with AIMD: every success adds Increase tokens per second up to Rate,
+// every throttling response multiplies the rate by Decrease down to MinRate.
+type Policy struct {
+	// Rate is the highest and initial number of sends per second; 0 means
+	// the provider is not limited
+	Rate float64 `json:"rate"`
+	// Burst is the bucket capacity; defaults to one second at Rate
+	Burst float64 `json:"burst"`
+	// MinRate is the floor the rate is decreased to
+	MinRate float64 `json:"min_rate"`
+	// Increase is added to the rate after each successful send
+	Increase float64 `json:"increase"`
+	// Decrease is the factor the rate is multiplied with when throttled
+	Decrease float64 `json:"decrease"`
+	// Backoff is how long sends are paused after a throttling response
+	// without Retry-After
+	Backoff time.Duration `json:"backoff"`
+}
+
+// Validate checks that the policy's values are usable
+func (p Policy) Validate() error {
+	if p.Rate < 0 || p.Burst < 0 || p.MinRate < 0 || p.Increase < 0 || p.Backoff < 0 {
+		return fmt.Errorf("throttle policy values must not be negative")
+	}
+	if p.MinRate > p.Rate {
+		return fmt.Errorf("min_rate must not exceed rate")
+	}
+	if p.Decrease < 0 || p.Decrease >= 1 {
+		return fmt.Errorf("decrease must be between 0 and 1")
+	}
+	return nil
+}
+
+// Unlimited reports whether the policy does not limit sends
+func (p Policy) Unlimited() bool {
+	return p.Rate <= 0
+}
+
+// Capacity returns the bucket size
+func (p Policy) Capacity() float64 {
+	if p.Burst > 0 {
+		return p.Burst
+	}
+	return math.Max(p.Rate, 1)
+}
+
+// floor returns the lowest rate, never 0 so the bucket keeps refilling
+func (p Policy) floor() float64 {
+	if p.MinRate > 0 {
+		return p.MinRate
+	}
+	return math.Min(p.Rate, 0.1)
+}
+
+// Increased returns the rate after a successful send
+func (p Policy) Increased(rate float64) float64 {
+	return math.Min(rate+p.Increase, p.Rate)
+}
+
+// Decreased returns the rate after a throttling response
+func (p Policy) Decreased(rate float64) float64 {
+	return math.Max(rate*p.Decrease, p.floor())
+}
+
+// State is the shared state of a provider's bucket
+type State struct {
+	Provider     string    `json:"provider"`
+	Rate         float64   `json:"rate"`
+	Tokens       float64   `json:"tokens"`
+	BlockedUntil time.Time `json:"blocked_until,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Bucket is the token bucket logic shared by stores; it holds no locks
+type Bucket struct {
+	State
+}
+
+// NewBucket returns a full bucket at the policy's rate
+func NewBucket(provider string, policy Policy, now time.Time) *Bucket {
+	return &Bucket{State{Provider: provider, Rate: policy.Rate, Tokens: policy.Capacity(), UpdatedAt: now}}
+}
+
+// refill adds the tokens accrued since the last update
+func (b *Bucket) refill(policy Policy, now time.Time) {
+	if b.Rate <= 0 || b.Rate > policy.Rate {
+		// The policy changed since the bucket was created
+		b.Rate = policy.Rate
+	}
+	if elapsed := now.Sub(b.UpdatedAt).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(b.Tokens+elapsed*b.Rate, policy.Capacity())
+		b.UpdatedAt = now
+	}
+}
+
+// Take removes a token and returns 0, or returns how long until one is
+// available
+func (b *Bucket) Take(policy Policy, now time.Time) time.Duration {
+	if now.Before(b.BlockedUntil) {
+		return b.BlockedUntil.Sub(now)
+	}
+	b.refill(policy, now)
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return 0
+	}
+	return time.Duration((1 - b.Tokens) / b.Rate * float64(time.Second))
+}
+
+// Succeeded increases the rate additively
+func (b *Bucket) Succeeded(policy Policy) {
+	b.Rate = policy.Increased(b.Rate)
+}
+
+// Throttled decreases the rate multiplicatively, empties the bucket and
+// pauses sends for retryAfter, or the policy's backoff if that is 0
+func (b *Bucket) Throttled(policy Policy, retryAfter time.Duration, now time.Time) {
+	b.refill(policy, now)
+	b.Rate = policy.Decreased(b.Rate)
+	b.Tokens = 0
+	if retryAfter <= 0 {
+		retryAfter = policy.Backoff
+	}
+	if until := now.Add(retryAfter); until.After(b.BlockedUntil) {
+		b.BlockedUntil = until
+	}
+}
+
+// Store keeps provider buckets shared between instances
+type Store interface {
+	// Take takes a token from the provider's bucket and returns 0, or returns
+	// how long until one is available
+	Take(ctx context.Context, provider string, policy Policy) (time.Duration, error)
+	// Report adapts the provider's rate to the result of a send
+	Report(ctx context.Context, provider string, policy Policy, throttled bool, retryAfter time.Duration) error
+	// State returns the provider's bucket, or nil if it has none
+	State(ctx context.Context, provider string) (*State, error)
+}
+
+// Limiter paces sends to each provider with its bucket
+type Limiter struct {
+	store    Store
+	defaults Policy
+	maxWait  time.Duration
+
+	mu       sync.RWMutex
+	policies map[string]Policy
+}
+
+// NewLimiter creates a limiter applying defaults to every provider without a
+// policy of its own. Wait blocks for at most maxWait before giving up.
+func NewLimiter(store Store, defaults Policy, maxWait time.Duration) *Limiter {
+	return &Limiter{
+		store:    store,
+		defaults: defaults,
+		maxWait:  maxWait,
+		policies: make(map[string]Policy),
+	}
+}
+
+// SetPolicy overrides the default policy for a provider
+func (l *Limiter) SetPolicy(provider string, policy Policy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.policies[provider] = policy
+}
+
+// Policy returns the policy applied to a provider
+func (l *Limiter) Policy(provider string) Policy {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if policy, ok := l.policies[provider]; ok {
+		return policy
+	}
+	return l.defaults
+}
+
+// Wait blocks until the provider's bucket hands out a token and returns 0.
+// If no token becomes available within maxWait it returns how long the
+// caller should wait instead of blocking, so long pauses such as a
+// Retry-After can be handled by deferring the send.
+func (l *Limiter) Wait(ctx context.Context, provider string) (time.Duration, error) {
+	policy := l.Policy(provider)
+	if policy.Unlimited() {
+		return 0, nil
+	}
+
+	deadline := time.Now().Add(l.maxWait)
+	for {
+		wait, err := l.store.Take(ctx, provider, policy)
+		if err != nil {
+			return 0, fmt.Errorf("failed to take token for provider %s: %w", provider, err)
+		}
+		if wait <= 0 {
+			return 0, nil
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return wait, nil
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// Report adapts the provider's rate to the result of a send
+func (l *Limiter) Report(ctx context.Context, provider string, throttled bool, retryAfter time.Duration) error {
+	policy := l.Policy(provider)
+	if policy.Unlimited() {
+		return nil
+	}
+	if err := l.store.Report(ctx, provider, policy, throttled, retryAfter); err != nil {
+		return fmt.Errorf("failed to report to provider %s bucket: %w", provider, err)
+	}
+	return nil
+}
+
+// State returns the provider's current bucket, or a full one if it was not
+// used yet
+func (l *Limiter) State(ctx context.Context, provider string) (*State, error) {
+	state, err := l.store.State(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		policy := l.Policy(provider)
+		state = &NewBucket(provider, policy, time.Now()).State
+	}
+	return state, nil
+}
@@ -0,0 +1,186 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps buckets in memory
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*Bucket
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{buckets: make(map[string]*Bucket)}
+}
+
+func (ms *memoryStore) bucket(provider string, policy Policy, now time.Time) *Bucket {
+	b, ok := ms.buckets[provider]
+	if !ok {
+		b = NewBucket(provider, policy, now)
+		ms.buckets[provider] = b
+	}
+	return b
+}
+
+func (ms *memoryStore) Take(ctx context.Context, provider string, policy Policy) (time.Duration, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	now := time.Now()
+	return ms.bucket(provider, policy, now).Take(policy, now), nil
+}
+
+func (ms *memoryStore) Report(ctx context.Context, provider string, policy Policy, throttled bool, retryAfter time.Duration) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	now := time.Now()
+	b := ms.bucket(provider, policy, now)
+	if throttled {
+		b.Throttled(policy, retryAfter, now)
+	} else {
+		b.Succeeded(policy)
+	}
+	return nil
+}
+
+func (ms *memoryStore) State(ctx context.Context, provider string) (*State, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if b, ok := ms.buckets[provider]; ok {
+		state := b.State
+		return &state, nil
+	}
+	return nil, nil
+}
+
+func TestBucketRefillsAtRate(t *testing.T) {
+	policy := Policy{Rate: 10, Burst: 2}
+	now := time.Now()
+	b := NewBucket("sms", policy, now)
+
+	for i := 0; i < 2; i++ {
+		if wait := b.Take(policy, now); wait != 0 {
+			t.Fatalf("take %d: expected a token from the burst, got wait %v", i, wait)
+		}
+	}
+	if wait := b.Take(policy, now); wait != 100*time.Millisecond {
+		t.Errorf("expected to wait 100ms for the next token, got %v", wait)
+	}
+	if wait := b.Take(policy, now.Add(100*time.Millisecond)); wait != 0 {
+		t.Errorf("expected a token after 100ms, got wait %v", wait)
+	}
+}
+
+func TestBucketAIMD(t *testing.T) {
+	policy := Policy{Rate: 100, MinRate: 10, Increase: 5, Decrease: 0.5}
+	now := time.Now()
+	b := NewBucket("sms", policy, now)
+
+	b.Throttled(policy, 0, now)
+	if b.Rate != 50 {
+		t.Errorf("expected rate to halve to 50, got %v", b.Rate)
+	}
+	for i := 0; i < 3; i++ {
+		b.Throttled(policy, 0, now)
+	}
+	if b.Rate != 10 {
+		t.Errorf("expected rate to stop at the minimum 10, got %v", b.Rate)
+	}
+
+	b.Succeeded(policy)
+	if b.Rate != 15 {
+		t.Errorf("expected rate to increase to 15, got %v", b.Rate)
+	}
+	for i := 0; i < 100; i++ {
+		b.Succeeded(policy)
+	}
+	if b.Rate != 100 {
+		t.Errorf("expected rate to stop at the maximum 100, got %v", b.Rate)
+	}
+}
+
+func TestBucketHonoursRetryAfter(t *testing.T) {
+	policy := Policy{Rate: 100, Decrease: 0.5, Backoff: time.Second}
+	now := time.Now()
+	b := NewBucket("sms", policy, now)
+
+	b.Throttled(policy, 30*time.Second, now)
+	if wait := b.Take(policy, now.Add(10*time.Second)); wait != 20*time.Second {
+		t.Errorf("expected to wait out the Retry-After, got %v", wait)
+	}
+	if wait := b.Take(policy, now.Add(30*time.Second)); wait != 0 {
+		t.Errorf("expected a token once Retry-After passed, got wait %v", wait)
+	}
+
+	// Without Retry-After the policy's backoff applies
+	b.Throttled(policy, 0, now.Add(30*time.Second))
+	if wait := b.Take(policy, now.Add(30*time.Second)); wait != time.Second {
+		t.Errorf("expected to wait the backoff, got %v", wait)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	valid := Policy{Rate: 10, MinRate: 1, Increase: 1, Decrease: 0.5}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected policy to be valid, got %v", err)
+	}
+
+	invalid := []Policy{
+		{Rate: -1},
+		{Rate: 10, MinRate: 20},
+		{Rate: 10, Decrease: 1},
+	}
+	for _, policy := range invalid {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", policy)
+		}
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	limiter := NewLimiter(store, Policy{}, 500*time.Millisecond)
+	limiter.SetPolicy("sms", Policy{Rate: 20, Burst: 1, Decrease: 0.5})
+
+	// Providers without a rate are not limited
+	for i := 0; i < 5; i++ {
+		if wait, err := limiter.Wait(ctx, "push"); err != nil || wait != 0 {
+			t.Fatalf("expected unlimited provider to pass, got %v, %v", wait, err)
+		}
+	}
+
+	// Short waits block until a token is available
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if wait, err := limiter.Wait(ctx, "sms"); err != nil || wait != 0 {
+			t.Fatalf("expected a token, got %v, %v", wait, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected the second send to wait for a refill, took %v", elapsed)
+	}
+
+	// Long pauses are returned instead of blocking
+	if err := limiter.Report(ctx, "sms", true, time.Minute); err != nil {
+		t.Fatalf("report failed: %v", err)
+	}
+	wait, err := limiter.Wait(ctx, "sms")
+	if err != nil {
+		t.Fatalf("wait failed: %v", err)
+	}
+	if wait < 59*time.Second {
+		t.Errorf("expected to be told to wait about a minute, got %v", wait)
+	}
+
+	state, err := limiter.State(ctx, "sms")
+	if err != nil {
+		t.Fatalf("state failed: %v", err)
+	}
+	if state.Rate != 10 {
+		t.Errorf("expected rate to halve to 10, got %v", state.Rate)
+	}
+}
@@ -0,0 +1,141 @@
+package topics
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Import formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// LineError reports a malformed record of a bulk import
+type LineError struct {
+	Line int    `json:"line"`
+	Err  string `json:"error"`
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// Reader streams subscribers from a CSV or NDJSON bulk import. CSV records
+// are "user_id[,device_id]" with an optional header row; NDJSON records are
+// Subscriber objects. Malformed records are returned as *LineError so the
+// caller can skip them and carry on.
+type Reader struct {
+	format  string
+	csv     *csv.Reader
+	scanner *bufio.Scanner
+	records int
+	line    int
+}
+
+// FormatFromContentType maps a request content type to an import format
+func FormatFromContentType(contentType string) (string, error) {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	switch mediaType {
+	case "text/csv":
+		return FormatCSV, nil
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return FormatNDJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported import content type %q", mediaType)
+	}
+}
+
+// NewReader creates a bulk import reader for the given format
+func NewReader(r io.Reader, format string) (*Reader, error) {
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+		cr.Comment = '#'
+		return &Reader{format: format, csv: cr}, nil
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+		return &Reader{format: format, scanner: scanner}, nil
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+}
+
+// Next returns the next subscriber, or io.EOF at the end of the input
+func (r *Reader) Next() (Subscriber, error) {
+	if r.format == FormatCSV {
+		return r.nextCSV()
+	}
+	return r.nextNDJSON()
+}
+
+// Line returns the input line of the record last returned by Next
+func (r *Reader) Line() int {
+	return r.line
+}
+
+func (r *Reader) nextCSV() (Subscriber, error) {
+	for {
+		record, err := r.csv.Read()
+		if err == io.EOF {
+			return Subscriber{}, io.EOF
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return Subscriber{}, &LineError{Line: parseErr.Line, Err: parseErr.Err.Error()}
+		}
+		if err != nil {
+			return Subscriber{}, err
+		}
+
+		r.line, _ = r.csv.FieldPos(0)
+		r.records++
+		if r.records == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "user_id") {
+			continue // Header row
+		}
+		if len(record) > 2 {
+			return Subscriber{}, &LineError{Line: r.line, Err: "expected user_id[,device_id]"}
+		}
+
+		sub := Subscriber{UserID: strings.TrimSpace(record[0])}
+		if len(record) == 2 {
+			sub.DeviceID = strings.TrimSpace(record[1])
+		}
+		if sub.UserID == "" {
+			return Subscriber{}, &LineError{Line: r.line, Err: "user_id is required"}
+		}
+		return sub, nil
+	}
+}
+
+func (r *Reader) nextNDJSON() (Subscriber, error) {
+	for r.scanner.Scan() {
+		r.line++
+		text := strings.TrimSpace(r.scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var sub Subscriber
+		if err := json.Unmarshal([]byte(text), &sub); err != nil {
+			return Subscriber{}, &LineError{Line: r.line, Err: err.Error()}
+		}
+		if sub.UserID == "" {
+			return Subscriber{}, &LineError{Line: r.line, Err: "user_id is required"}
+		}
+		return sub, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return Subscriber{}, err
+	}
+	return Subscriber{}, io.EOF
+}
@@ -0,0 +1,35 @@
+package topics
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// namePattern matches the topic names accepted by FCM so topics can be
+// mirrored to providers unchanged
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9\-_.~%]{1,128}$`)
+
+// Subscriber is a topic subscription held either by a user directly or by
+// one of the user's registered devices. A user is a topic member as long as
+// at least one of its subscriptions remains.
+type Subscriber struct {
+	UserID   string `json:"user_id"`
+	DeviceID string `json:"device_id,omitempty"`
+}
+
+// Handle identifies the subscription within the user's subscriptions to a topic
+func (s Subscriber) Handle() string {
+	if s.DeviceID != "" {
+		return "device:" + s.DeviceID
+	}
+	return "user"
+}
+
+// ValidateName checks that a topic name can be used as a Redis key segment
+// and by push providers
+func ValidateName(topic string) error {
+	if !namePattern.MatchString(topic) {
+		return fmt.Errorf("invalid topic name %q", topic)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package topics
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, input, format string) ([]Subscriber, []int) {
+	t.Helper()
+	reader, err := NewReader(strings.NewReader(input), format)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var subs []Subscriber
+	var badLines []int
+	for {
+		sub, err := reader.Next()
+		if err == io.EOF {
+			return subs, badLines
+		}
+		var lineErr *LineError
+		if errors.As(err, &lineErr) {
+			badLines = append(badLines, lineErr.Line)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		subs = append(subs, sub)
+	}
+}
+
+func TestReaderCSV(t *testing.T) {
+	input := "user_id,device_id\nuser-1\nuser-2, ios-abc\n# comment\n,orphan\nuser-3,a,b\n\"user-4\ncontinued\",\"bad\"quote\nuser-5,\n"
+
+	subs, badLines := readAll(t, input, FormatCSV)
+	expected := []Subscriber{
+		{UserID: "user-1"},
+		{UserID: "user-2", DeviceID: "ios-abc"},
+		{UserID: "user-5"},
+	}
+	if !reflect.DeepEqual(subs, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, subs)
+	}
+	if !reflect.DeepEqual(badLines, []int{5, 6, 8}) {
+		t.Errorf("Expected malformed lines [5 6 8], got %v", badLines)
+	}
+}
+
+func TestReaderNDJSON(t *testing.T) {
+	input := "{\"user_id\":\"user-1\"}\n\n{\"user_id\":\"user-2\",\"device_id\":\"web-1\"}\n{\"device_id\":\"x\"}\nnot json\n"
+
+	subs, badLines := readAll(t, input, FormatNDJSON)
+	expected := []Subscriber{
+		{UserID: "user-1"},
+		{UserID: "user-2", DeviceID: "web-1"},
+	}
+	if !reflect.DeepEqual(subs, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, subs)
+	}
+	if !reflect.DeepEqual(badLines, []int{4, 5}) {
+		t.Errorf("Expected malformed lines [4 5], got %v", badLines)
+	}
+}
+
+func TestFormatFromContentType(t *testing.T) {
+	if format, err := FormatFromContentType("text/csv; charset=utf-8"); err != nil || format != FormatCSV {
+		t.Errorf("Expected csv, got %q (%v)", format, err)
+	}
+	if format, err := FormatFromContentType("application/x-ndjson"); err != nil || format != FormatNDJSON {
+		t.Errorf("Expected ndjson, got %q (%v)", format, err)
+	}
+	if _, err := FormatFromContentType("application/json"); err == nil {
+		t.Errorf("Expected error for unsupported content type")
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"sports", "news.fr", "team-42_~%"} {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "a b", "topic:members", strings.Repeat("x", 129)} {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+}
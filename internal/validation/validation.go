@@ -0,0 +1,190 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/provider"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// Codes of field errors
+const (
+	CodeRequired   = "required"
+	CodeTooLong    = "too_long"
+	CodeTooLarge   = "too_large"
+	CodeOutOfRange = "out_of_range"
+	CodeInvalid    = "invalid"
+	CodeExpired    = "expired"
+)
+
+// FieldError describes why one field of a notification is invalid. Field is
+// the JSON name, with an index for list entries such as channels[1].
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error lists every invalid field of a notification
+type Error struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		parts[i] = field.Field + ": " + field.Message
+	}
+	return "invalid notification: " + strings.Join(parts, "; ")
+}
+
+// Limits bounds the fields of a notification. Lengths count characters,
+// sizes count bytes of the JSON encoding.
+type Limits struct {
+	MaxIDLength          int
+	MaxUserIDLength      int
+	MaxTypeLength        int
+	MaxTitleLength       int
+	MaxBodyLength        int
+	MaxCollapseKeyLength int
+	// MaxDataBytes caps the data of notifications delivered as push or web
+	// push, whose payloads the services limit to about 4KB
+	MaxDataBytes int
+	// MaxPushPayloadBytes caps the APNs payload built for push
+	// notifications; APNs rejects payloads above 4KB
+	MaxPushPayloadBytes int
+}
+
+// DefaultLimits fit the payload caps of the push services
+var DefaultLimits = Limits{
+	MaxIDLength:          128,
+	MaxUserIDLength:      256,
+	MaxTypeLength:        64,
+	MaxTitleLength:       256,
+	MaxBodyLength:        2048,
+	MaxCollapseKeyLength: 256,
+	MaxDataBytes:         3072,
+	MaxPushPayloadBytes:  4096,
+}
+
+// Validate checks a notification against the default limits
+func Validate(notification *pkg.NotificationMessage, now time.Time) error {
+	return DefaultLimits.Validate(notification, now)
+}
+
+// Validate checks a notification against the limits and returns an *Error
+// listing every invalid field. The expiry is checked against now; pass the
+// zero time to skip that check, as for messages that may have waited in a
+// queue and are dropped on expiry by the worker anyway.
+func (l Limits) Validate(notification *pkg.NotificationMessage, now time.Time) error {
+	v := &validator{}
+
+	v.required("id", notification.ID)
+	v.maxLength("id", notification.ID, l.MaxIDLength)
+	v.required("user_id", notification.UserID)
+	v.maxLength("user_id", notification.UserID, l.MaxUserIDLength)
+	if notification.TenantID != "" {
+		if err := tenant.Validate(notification.TenantID); err != nil {
+			v.add("tenant_id", CodeInvalid, err.Error())
+		}
+	}
+	v.maxLength("type", notification.Type, l.MaxTypeLength)
+	v.maxLength("title", notification.Title, l.MaxTitleLength)
+	v.maxLength("body", notification.Body, l.MaxBodyLength)
+	v.maxLength("collapse_key", notification.CollapseKey, l.MaxCollapseKeyLength)
+
+	if notification.Priority < pkg.PriorityLow || notification.Priority > pkg.PriorityUrgent {
+		v.add("priority", CodeOutOfRange, fmt.Sprintf("must be between %d and %d", pkg.PriorityLow, pkg.PriorityUrgent))
+	}
+	if notification.ExpiresAt != nil && !now.IsZero() && !notification.ExpiresAt.After(now) {
+		v.add("expires_at", CodeExpired, "must be in the future")
+	}
+	if notification.Retry < 0 {
+		v.add("retry", CodeOutOfRange, "must not be negative")
+	}
+	if notification.TemplateVersion < 0 {
+		v.add("template_version", CodeOutOfRange, "must not be negative")
+	}
+	if notification.Badge != nil && *notification.Badge < 0 {
+		v.add("badge", CodeOutOfRange, "must not be negative")
+	}
+	for i, ch := range notification.Channels {
+		if !ch.IsValid() {
+			v.add(fmt.Sprintf("channels[%d]", i), CodeInvalid, fmt.Sprintf("unknown channel: %s", ch))
+		}
+	}
+	if !notification.CollapseMode.IsValid() {
+		v.add("collapse_mode", CodeInvalid, fmt.Sprintf("unknown collapse mode: %s", notification.CollapseMode))
+	}
+
+	if len(notification.Data) > 0 {
+		data, err := json.Marshal(notification.Data)
+		switch {
+		case err != nil:
+			v.add("data", CodeInvalid, fmt.Sprintf("cannot be encoded: %v", err))
+		case len(data) > l.MaxDataBytes && targetsDevice(notification):
+			v.add("data", CodeTooLarge, fmt.Sprintf("is %d bytes, at most %d allowed", len(data), l.MaxDataBytes))
+		}
+	}
+
+	// A template is rendered later, so only a literal push payload can be
+	// measured here
+	if len(v.fields) == 0 && notification.TemplateID == "" && targetsPush(notification) {
+		_, payload := provider.BuildAPNs(notification)
+		if data, err := json.Marshal(payload); err == nil && len(data) > l.MaxPushPayloadBytes {
+			v.add("payload", CodeTooLarge, fmt.Sprintf("push payload is %d bytes, at most %d allowed", len(data), l.MaxPushPayloadBytes))
+		}
+	}
+
+	if len(v.fields) > 0 {
+		return &Error{Fields: v.fields}
+	}
+	return nil
+}
+
+// targetsPush reports whether the notification is delivered as a mobile push
+func targetsPush(notification *pkg.NotificationMessage) bool {
+	for _, ch := range notification.TargetChannels() {
+		if ch == pkg.ChannelPush {
+			return true
+		}
+	}
+	return false
+}
+
+// targetsDevice reports whether the notification is delivered as a mobile
+// or web push, which carry the data in a size-limited payload
+func targetsDevice(notification *pkg.NotificationMessage) bool {
+	for _, ch := range notification.TargetChannels() {
+		if ch == pkg.ChannelPush || ch == pkg.ChannelWebPush {
+			return true
+		}
+	}
+	return false
+}
+
+// validator collects field errors
+type validator struct {
+	fields []FieldError
+}
+
+func (v *validator) add(field, code, message string) {
+	v.fields = append(v.fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+func (v *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, CodeRequired, "is required")
+	}
+}
+
+func (v *validator) maxLength(field, value string, max int) {
+	if n := utf8.RuneCountInString(value); n > max {
+		v.add(field, CodeTooLong, fmt.Sprintf("is %d characters, at most %d allowed", n, max))
+	}
+}
@@ -0,0 +1,108 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// fields returns the invalid fields reported by err
+func fields(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var invalid *Error
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	codes := make(map[string]string)
+	for _, field := range invalid.Fields {
+		codes[field.Field] = field.Code
+	}
+	return codes
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+	badge := -1
+
+	valid := &pkg.NotificationMessage{ID: "n1", UserID: "user-1", Title: "Hi", Body: "Hello", ExpiresAt: &future}
+	if err := Validate(valid, now); err != nil {
+		t.Errorf("expected notification to be valid, got %v", err)
+	}
+
+	invalid := &pkg.NotificationMessage{
+		ID:           "n1",
+		Title:        strings.Repeat("t", DefaultLimits.MaxTitleLength+1),
+		Priority:     pkg.PriorityUrgent + 1,
+		ExpiresAt:    &past,
+		Channels:     []pkg.Channel{pkg.ChannelPush, "pigeon"},
+		CollapseMode: "stack",
+		Badge:        &badge,
+		Data:         map[string]interface{}{"blob": strings.Repeat("x", DefaultLimits.MaxDataBytes)},
+	}
+	want := map[string]string{
+		"user_id":       CodeRequired,
+		"title":         CodeTooLong,
+		"priority":      CodeOutOfRange,
+		"expires_at":    CodeExpired,
+		"channels[1]":   CodeInvalid,
+		"collapse_mode": CodeInvalid,
+		"badge":         CodeOutOfRange,
+		"data":          CodeTooLarge,
+	}
+	got := fields(t, Validate(invalid, now))
+	for field, code := range want {
+		if got[field] != code {
+			t.Errorf("expected %s to fail with %s, got %q", field, code, got[field])
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d invalid fields, got %v", len(want), got)
+	}
+
+	// Expiry is skipped without a reference time
+	expired := &pkg.NotificationMessage{ID: "n1", UserID: "user-1", ExpiresAt: &past}
+	if err := Validate(expired, time.Time{}); err != nil {
+		t.Errorf("expected expiry to be skipped, got %v", err)
+	}
+}
+
+func TestValidatePushPayload(t *testing.T) {
+	// Each field fits its own limit, but together they exceed the APNs cap
+	notification := &pkg.NotificationMessage{
+		ID:     "n1",
+		UserID: "user-1",
+		Body:   strings.Repeat("b", DefaultLimits.MaxBodyLength),
+		Data:   map[string]interface{}{"blob": strings.Repeat("x", DefaultLimits.MaxDataBytes-20)},
+	}
+	if got := fields(t, Validate(notification, time.Now())); got["payload"] != CodeTooLarge {
+		t.Errorf("expected oversized push payload to be rejected, got %v", got)
+	}
+
+	// The same content is fine by email, and templates are measured after
+	// rendering
+	notification.Channels = []pkg.Channel{pkg.ChannelEmail}
+	if err := Validate(notification, time.Now()); err != nil {
+		t.Errorf("expected email notification to be valid, got %v", err)
+	}
+	notification.Channels = nil
+	notification.TemplateID = "welcome"
+	if err := Validate(notification, time.Now()); err != nil {
+		t.Errorf("expected templated notification to be valid, got %v", err)
+	}
+
+	// Only device payloads limit the data
+	notification.Data["blob"] = strings.Repeat("x", 10*DefaultLimits.MaxDataBytes)
+	notification.Channels = []pkg.Channel{pkg.ChannelEmail}
+	if err := Validate(notification, time.Now()); err != nil {
+		t.Errorf("expected large data by email to be valid, got %v", err)
+	}
+	notification.Channels = []pkg.Channel{pkg.ChannelEmail, pkg.ChannelWebPush}
+	if got := fields(t, Validate(notification, time.Now())); got["data"] != CodeTooLarge {
+		t.Errorf("expected large data by web push to be rejected, got %v", got)
+	}
+}
@@ -0,0 +1,169 @@
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// RecordSize is the aes128gcm record size used for outgoing messages. Push
+// payloads are limited to 4096 bytes, so every message fits a single record.
+const RecordSize = 4096
+
+// saltLength, keyLength and nonceLength are fixed by RFC 8188
+const (
+	saltLength   = 16
+	keyLength    = 16
+	nonceLength  = 12
+	headerLength = saltLength + 4 + 1
+	tagLength    = 16
+)
+
+// Encrypt encrypts a push message payload for a subscription per RFC 8291
+// using the aes128gcm content coding. uaPublic is the subscription's p256dh
+// key and authSecret its auth secret, both already base64url decoded.
+func Encrypt(plaintext, uaPublic, authSecret []byte) ([]byte, error) {
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	return encrypt(plaintext, uaPublic, authSecret, asPrivate, salt)
+}
+
+// encrypt performs the deterministic part of Encrypt so it can be checked
+// against the RFC 8291 test vector
+func encrypt(plaintext, uaPublic, authSecret []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	if len(plaintext)+1+tagLength > RecordSize-headerLength-65 {
+		return nil, fmt.Errorf("payload of %d bytes exceeds the single record limit", len(plaintext))
+	}
+
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	ecdhSecret, err := asPrivate.ECDH(uaKey)
+	if err != nil {
+		return nil, fmt.Errorf("ecdh failed: %w", err)
+	}
+
+	asPublic := asPrivate.PublicKey().Bytes()
+	gcm, nonce, err := contentCipher(ecdhSecret, authSecret, uaPublic, asPublic, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single, final record is terminated by the 0x02 padding delimiter
+	record := append(append([]byte{}, plaintext...), 0x02)
+
+	header := make([]byte, 0, headerLength+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, RecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+// Decrypt reverses Encrypt using the user agent's private key. It implements
+// the receiving side of RFC 8291 for tests and tooling that stand in for a
+// browser.
+func Decrypt(body []byte, uaPrivate *ecdh.PrivateKey, authSecret []byte) ([]byte, error) {
+	if len(body) < headerLength {
+		return nil, errors.New("message too short")
+	}
+
+	salt := body[:saltLength]
+	recordSize := binary.BigEndian.Uint32(body[saltLength : saltLength+4])
+	idLength := int(body[saltLength+4])
+	if len(body) < headerLength+idLength {
+		return nil, errors.New("truncated key id")
+	}
+	asPublic := body[headerLength : headerLength+idLength]
+	ciphertext := body[headerLength+idLength:]
+	if uint32(len(ciphertext)) > recordSize {
+		return nil, errors.New("multi-record messages are not supported")
+	}
+
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender key: %w", err)
+	}
+
+	ecdhSecret, err := uaPrivate.ECDH(asKey)
+	if err != nil {
+		return nil, fmt.Errorf("ecdh failed: %w", err)
+	}
+
+	gcm, nonce, err := contentCipher(ecdhSecret, authSecret, uaPrivate.PublicKey().Bytes(), asPublic, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed: %w", err)
+	}
+
+	// Strip padding back to the delimiter
+	end := len(record) - 1
+	for end >= 0 && record[end] == 0x00 {
+		end--
+	}
+	if end < 0 || record[end] != 0x02 {
+		return nil, errors.New("invalid padding delimiter")
+	}
+	return record[:end], nil
+}
+
+// contentCipher derives the AES-GCM content encryption key and nonce
+func contentCipher(ecdhSecret, authSecret, uaPublic, asPublic, salt []byte) (cipher.AEAD, []byte, error) {
+	keyInfo := make([]byte, 0, 14+len(uaPublic)+len(asPublic))
+	keyInfo = append(keyInfo, "WebPush: info\x00"...)
+	keyInfo = append(keyInfo, uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+
+	ikm, err := hkdf.Key(sha256.New, ecdhSecret, authSecret, string(keyInfo), 32)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive input keying material: %w", err)
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive pseudorandom key: %w", err)
+	}
+
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", keyLength)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive content key: %w", err)
+	}
+
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", nonceLength)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive nonce: %w", err)
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+
+	return gcm, nonce, nil
+}
@@ -0,0 +1,130 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+)
+
+// VAPIDKeys is the application server key pair used to identify this service
+// to push services (RFC 8292)
+type VAPIDKeys struct {
+	private *ecdsa.PrivateKey
+	public  []byte // uncompressed P-256 point
+}
+
+// GenerateVAPIDKeys creates a new random VAPID key pair
+func GenerateVAPIDKeys() (*VAPIDKeys, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate vapid key: %w", err)
+	}
+	return newVAPIDKeys(key)
+}
+
+// ParseVAPIDPrivateKey loads a VAPID key pair from a base64url encoded raw
+// P-256 private scalar, the format produced by common web-push tooling
+func ParseVAPIDPrivateKey(encoded string) (*VAPIDKeys, error) {
+	raw, err := DecodeKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vapid private key encoding: %w", err)
+	}
+
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vapid private key: %w", err)
+	}
+	return newVAPIDKeys(key)
+}
+
+func newVAPIDKeys(key *ecdh.PrivateKey) (*VAPIDKeys, error) {
+	public := key.PublicKey().Bytes()
+
+	private := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:65]),
+		},
+		D: new(big.Int).SetBytes(key.Bytes()),
+	}
+
+	return &VAPIDKeys{private: private, public: public}, nil
+}
+
+// PublicKey returns the base64url encoded public key shared with browsers as
+// the applicationServerKey
+func (k *VAPIDKeys) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.public)
+}
+
+// PrivateKey returns the base64url encoded raw private scalar
+func (k *VAPIDKeys) PrivateKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.private.D.FillBytes(make([]byte, 32)))
+}
+
+// AuthorizationHeader builds the "vapid" Authorization header for a request to
+// the push service hosting endpoint. subject is a mailto: or https: contact URI.
+func (k *VAPIDKeys) AuthorizationHeader(endpoint, subject string, expiresAt time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid push endpoint %q", endpoint)
+	}
+
+	token, err := k.signJWT(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": expiresAt.Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("vapid t=%s, k=%s", token, k.PublicKey()), nil
+}
+
+// signJWT produces a compact ES256 JWT for the given claims
+func (k *VAPIDKeys) signJWT(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal vapid claims: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	r, s, err := ecdsa.Sign(rand.Reader, k.private, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign vapid token: %w", err)
+	}
+
+	// JWS uses the fixed-width R || S encoding rather than ASN.1
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// DecodeKey decodes base64url key material, tolerating padding and the
+// standard alphabet some clients send
+func DecodeKey(encoded string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{base64.RawURLEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.StdEncoding} {
+		if b, err := enc.DecodeString(encoded); err == nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid base64 key")
+}
@@ -0,0 +1,152 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Failed to decode %q: %v", s, err)
+	}
+	return b
+}
+
+// TestEncryptRFC8291Vector checks the encryption against the example in RFC 8291 section 5
+func TestEncryptRFC8291Vector(t *testing.T) {
+	plaintext := []byte("When I grow up, I want to be a watermelon")
+	asPrivate, err := ecdh.P256().NewPrivateKey(mustDecode(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatalf("Failed to load application server key: %v", err)
+	}
+	uaPublic := mustDecode(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4")
+	authSecret := mustDecode(t, "BTBZMqHH6r4Tts7J_aSIgg")
+	salt := mustDecode(t, "DGv6ra1nlYgDCS1FRnbzlw")
+
+	// The RFC example uses the same record size
+	body, err := encrypt(plaintext, uaPublic, authSecret, asPrivate, salt)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if got := base64.RawURLEncoding.EncodeToString(body); got != expected {
+		t.Errorf("Encrypted body mismatch\n got: %s\nwant: %s", got, expected)
+	}
+
+	uaPrivate, err := ecdh.P256().NewPrivateKey(mustDecode(t, "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"))
+	if err != nil {
+		t.Fatalf("Failed to load user agent key: %v", err)
+	}
+	decrypted, err := Decrypt(body, uaPrivate, authSecret)
+	if err != nil {
+		t.Fatalf("Expected no error decrypting, got %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Expected %q, got %q", plaintext, decrypted)
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	uaPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	authSecret := make([]byte, 16)
+	rand.Read(authSecret)
+
+	plaintext := []byte(`{"title":"Hello","body":"World"}`)
+	body, err := Encrypt(plaintext, uaPrivate.PublicKey().Bytes(), authSecret)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	decrypted, err := Decrypt(body, uaPrivate, authSecret)
+	if err != nil {
+		t.Fatalf("Expected no error decrypting, got %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Expected %q, got %q", plaintext, decrypted)
+	}
+
+	// A wrong auth secret must fail authentication
+	if _, err := Decrypt(body, uaPrivate, make([]byte, 16)); err == nil {
+		t.Errorf("Expected decryption with wrong auth secret to fail")
+	}
+
+	if _, err := Encrypt(make([]byte, 4000), uaPrivate.PublicKey().Bytes(), authSecret); err == nil {
+		t.Errorf("Expected oversized payload to be rejected")
+	}
+}
+
+func TestVAPIDAuthorizationHeader(t *testing.T) {
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	// Keys survive a round trip through their encoded form
+	parsed, err := ParseVAPIDPrivateKey(keys.PrivateKey())
+	if err != nil {
+		t.Fatalf("Failed to parse private key: %v", err)
+	}
+	if parsed.PublicKey() != keys.PublicKey() {
+		t.Errorf("Expected parsed public key to match")
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	header, err := parsed.AuthorizationHeader("https://push.example.net/send/abc", "mailto:ops@example.com", expiresAt)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var token, key string
+	for _, part := range strings.Split(strings.TrimPrefix(header, "vapid "), ", ") {
+		switch {
+		case strings.HasPrefix(part, "t="):
+			token = strings.TrimPrefix(part, "t=")
+		case strings.HasPrefix(part, "k="):
+			key = strings.TrimPrefix(part, "k=")
+		}
+	}
+	if key != keys.PublicKey() {
+		t.Errorf("Expected k= to carry the public key")
+	}
+
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		t.Fatalf("Expected a compact JWT, got %q", token)
+	}
+
+	var claims map[string]interface{}
+	json.Unmarshal(mustDecode(t, segments[1]), &claims)
+	if claims["aud"] != "https://push.example.net" {
+		t.Errorf("Expected aud to be the push service origin, got %v", claims["aud"])
+	}
+	if claims["sub"] != "mailto:ops@example.com" {
+		t.Errorf("Expected sub to be the contact, got %v", claims["sub"])
+	}
+
+	publicKey, err := ecdh.P256().NewPublicKey(mustDecode(t, key))
+	if err != nil {
+		t.Fatalf("Invalid public key: %v", err)
+	}
+	raw := publicKey.Bytes()
+	verifier := &ecdsa.PublicKey{Curve: parsed.private.Curve, X: new(big.Int).SetBytes(raw[1:33]), Y: new(big.Int).SetBytes(raw[33:])}
+	signature := mustDecode(t, segments[2])
+	digest := sha256.Sum256([]byte(segments[0] + "." + segments[1]))
+	if !ecdsa.Verify(verifier, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		t.Errorf("Expected JWT signature to verify")
+	}
+}
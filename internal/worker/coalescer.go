@@ -0,0 +1,181 @@
+package worker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// DataKeyCollapsedCount is set on merged notifications to the number of
+// notifications they stand for, so templates can render "5 new messages"
+const DataKeyCollapsedCount = "collapsed_count"
+
+// Coalescer holds notifications with a collapse key for a short window so
+// that later ones for the same user and key replace or merge with earlier
+// unsent ones. Messages are keyed by user on Kafka, so all notifications of a
+// user reach the same instance and can be coalesced in memory.
+type Coalescer struct {
+	window  time.Duration
+	pending map[coalesceKey]*coalesceGroup
+	ready   chan *pkg.NotificationMessage
+	done    chan struct{}
+	stopped bool
+
+	// leftover collects flushed messages that could not be handed over
+	// because the coalescer was stopped
+	leftover []*pkg.NotificationMessage
+
+	mu sync.Mutex
+	wg sync.WaitGroup
+}
+
+type coalesceKey struct {
+	tenantID    string
+	userID      string
+	collapseKey string
+}
+
+// coalesceGroup is the unsent state of one user and collapse key
+type coalesceGroup struct {
+	latest   *pkg.NotificationMessage
+	count    int
+	priority pkg.Priority
+	timer    *time.Timer
+}
+
+// NewCoalescer creates a coalescer that holds notifications for window
+func NewCoalescer(window time.Duration, readySize int) *Coalescer {
+	return &Coalescer{
+		window:  window,
+		pending: make(map[coalesceKey]*coalesceGroup),
+		ready:   make(chan *pkg.NotificationMessage, readySize),
+		done:    make(chan struct{}),
+	}
+}
+
+// Ready returns the channel of notifications whose window has ended
+func (c *Coalescer) Ready() <-chan *pkg.NotificationMessage {
+	return c.ready
+}
+
+// Add holds a notification and returns the unsent notification it
+// supersedes, if any. Urgent notifications are not held: they absorb the
+// pending group and are returned as immediate for delivery right away.
+func (c *Coalescer) Add(n *pkg.NotificationMessage) (superseded, immediate *pkg.NotificationMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped {
+		return nil, n
+	}
+
+	key := coalesceKey{tenantID: n.Tenant(), userID: n.UserID, collapseKey: n.CollapseKey}
+	group, ok := c.pending[key]
+	if !ok {
+		group = &coalesceGroup{priority: n.Priority}
+	} else {
+		superseded = group.latest
+	}
+
+	group.latest = n
+	group.count++
+	if n.Priority > group.priority {
+		group.priority = n.Priority
+	}
+
+	if n.Priority >= pkg.PriorityUrgent {
+		if ok {
+			group.timer.Stop()
+			delete(c.pending, key)
+		}
+		return superseded, group.build()
+	}
+
+	if !ok {
+		c.pending[key] = group
+		group.timer = time.AfterFunc(c.window, func() { c.flush(key, group) })
+	}
+	return superseded, nil
+}
+
+// flush hands the group over for delivery once its window has ended
+func (c *Coalescer) flush(key coalesceKey, group *coalesceGroup) {
+	c.mu.Lock()
+	if c.stopped || c.pending[key] != group {
+		c.mu.Unlock()
+		return // Collected by Stop or taken by an urgent notification
+	}
+	delete(c.pending, key)
+	c.wg.Add(1)
+	c.mu.Unlock()
+	defer c.wg.Done()
+
+	msg := group.build()
+	select {
+	case c.ready <- msg:
+	case <-c.done:
+		c.mu.Lock()
+		c.leftover = append(c.leftover, msg)
+		c.mu.Unlock()
+	}
+}
+
+// Pending returns the number of notifications currently held back
+func (c *Coalescer) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// Stop ends all windows and returns the notifications that were not yet
+// delivered. Notifications added afterwards are returned as immediate.
+func (c *Coalescer) Stop() []*pkg.NotificationMessage {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return nil
+	}
+	c.stopped = true
+
+	var remaining []*pkg.NotificationMessage
+	for key, group := range c.pending {
+		group.timer.Stop()
+		remaining = append(remaining, group.build())
+		delete(c.pending, key)
+	}
+	c.mu.Unlock()
+
+	close(c.done)
+	c.wg.Wait()
+
+	for {
+		select {
+		case msg := <-c.ready:
+			remaining = append(remaining, msg)
+		default:
+			return append(remaining, c.leftover...)
+		}
+	}
+}
+
+// build returns the notification to deliver for the group
+func (g *coalesceGroup) build() *pkg.NotificationMessage {
+	msg := *g.latest
+	msg.Priority = g.priority
+
+	if g.count > 1 && msg.CollapseMode == pkg.CollapseMerge {
+		msg.Data = make(map[string]interface{}, len(g.latest.Data)+1)
+		for k, v := range g.latest.Data {
+			msg.Data[k] = v
+		}
+		msg.Data[DataKeyCollapsedCount] = g.count
+
+		// Templated notifications render the count themselves
+		if msg.TemplateID == "" {
+			msg.Body = fmt.Sprintf("%d new notifications", g.count)
+		}
+	}
+	return &msg
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+func TestCoalescerReplace(t *testing.T) {
+	c := NewCoalescer(50*time.Millisecond, 10)
+
+	first := &pkg.NotificationMessage{ID: "msg-1", UserID: "user-1", CollapseKey: "chat", Body: "one"}
+	second := &pkg.NotificationMessage{ID: "msg-2", UserID: "user-1", CollapseKey: "chat", Body: "two", Priority: pkg.PriorityHigh}
+	other := &pkg.NotificationMessage{ID: "msg-3", UserID: "user-2", CollapseKey: "chat", Body: "other"}
+
+	if superseded, immediate := c.Add(first); superseded != nil || immediate != nil {
+		t.Fatalf("Expected first notification to be held")
+	}
+	if superseded, _ := c.Add(second); superseded != first {
+		t.Errorf("Expected second notification to supersede the first")
+	}
+	if superseded, _ := c.Add(other); superseded != nil {
+		t.Errorf("Expected other user's notification not to collapse")
+	}
+
+	flushed := make(map[string]*pkg.NotificationMessage)
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-c.Ready():
+			flushed[msg.UserID] = msg
+		case <-time.After(time.Second):
+			t.Fatalf("Expected coalesced notifications to be flushed")
+		}
+	}
+
+	if msg := flushed["user-1"]; msg.ID != "msg-2" || msg.Body != "two" || msg.Priority != pkg.PriorityHigh {
+		t.Errorf("Expected latest notification for user-1, got %+v", msg)
+	}
+	if msg := flushed["user-2"]; msg.ID != "msg-3" {
+		t.Errorf("Expected user-2 notification, got %+v", msg)
+	}
+}
+
+func TestCoalescerMerge(t *testing.T) {
+	c := NewCoalescer(time.Hour, 10)
+
+	for i := 0; i < 4; i++ {
+		c.Add(&pkg.NotificationMessage{ID: "msg", UserID: "user-1", CollapseKey: "chat", CollapseMode: pkg.CollapseMerge, Title: "Chat"})
+	}
+
+	// An urgent notification absorbs the pending group and skips the window
+	superseded, immediate := c.Add(&pkg.NotificationMessage{
+		ID:           "msg-urgent",
+		UserID:       "user-1",
+		CollapseKey:  "chat",
+		CollapseMode: pkg.CollapseMerge,
+		Title:        "Chat",
+		Priority:     pkg.PriorityUrgent,
+	})
+	if superseded == nil || immediate == nil {
+		t.Fatalf("Expected urgent notification to be delivered immediately")
+	}
+	if immediate.Data[DataKeyCollapsedCount] != 5 || immediate.Body != "5 new notifications" {
+		t.Errorf("Expected merged digest of 5, got %+v", immediate)
+	}
+	if c.Pending() != 0 {
+		t.Errorf("Expected no pending groups, got %d", c.Pending())
+	}
+}
+
+func TestCoalescerStop(t *testing.T) {
+	c := NewCoalescer(time.Hour, 10)
+	c.Add(&pkg.NotificationMessage{ID: "msg-1", UserID: "user-1", CollapseKey: "chat"})
+	c.Add(&pkg.NotificationMessage{ID: "msg-2", UserID: "user-2", CollapseKey: "chat"})
+
+	if remaining := c.Stop(); len(remaining) != 2 {
+		t.Errorf("Expected 2 pending notifications on stop, got %d", len(remaining))
+	}
+
+	n := &pkg.NotificationMessage{ID: "msg-3", UserID: "user-1", CollapseKey: "chat"}
+	if _, immediate := c.Add(n); immediate != n {
+		t.Errorf("Expected notifications added after stop to pass through")
+	}
+}
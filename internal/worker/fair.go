@@ -0,0 +1,111 @@
+package worker
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// fairQueue holds pending notifications in one FIFO per tenant and hands
+// them out round robin, so a tenant with a backlog only delays its own
+// notifications. capacity bounds all queues together and tenantCapacity,
+// when set, bounds each tenant's queue.
+type fairQueue struct {
+	queues map[string][]*pkg.NotificationMessage
+	order  []string // tenants with pending notifications, next one first
+	size   int
+
+	capacity       int
+	tenantCapacity int
+
+	// ready is signalled when a notification is pushed
+	ready chan struct{}
+	mu    sync.Mutex
+}
+
+func newFairQueue(capacity int) *fairQueue {
+	return &fairQueue{
+		queues:   make(map[string][]*pkg.NotificationMessage),
+		capacity: capacity,
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// push appends a notification to its tenant's queue
+func (q *fairQueue) push(n *pkg.NotificationMessage) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.size >= q.capacity {
+		return fmt.Errorf("job queue is full")
+	}
+	tenantID := n.Tenant()
+	pending := q.queues[tenantID]
+	if q.tenantCapacity > 0 && len(pending) >= q.tenantCapacity {
+		return fmt.Errorf("job queue of tenant %s is full", tenantID)
+	}
+
+	if len(pending) == 0 {
+		q.order = append(q.order, tenantID)
+	}
+	q.queues[tenantID] = append(pending, n)
+	q.size++
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pop removes the next notification, taking tenants in turn
+func (q *fairQueue) pop() (*pkg.NotificationMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.order) == 0 {
+		return nil, false
+	}
+
+	tenantID := q.order[0]
+	q.order = q.order[1:]
+	pending := q.queues[tenantID]
+	n := pending[0]
+	pending[0] = nil
+	q.size--
+
+	if len(pending) == 1 {
+		delete(q.queues, tenantID)
+	} else {
+		q.queues[tenantID] = pending[1:]
+		q.order = append(q.order, tenantID)
+	}
+	return n, true
+}
+
+// len returns the number of pending notifications
+func (q *fairQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// lengths returns the number of pending notifications per tenant
+func (q *fairQueue) lengths() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	lengths := make(map[string]int, len(q.queues))
+	for tenantID, pending := range q.queues {
+		lengths[tenantID] = len(pending)
+	}
+	return lengths
+}
+
+// setTenantCapacity bounds the queue of each tenant; 0 removes the bound
+func (q *fairQueue) setTenantCapacity(capacity int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.tenantCapacity = capacity
+}
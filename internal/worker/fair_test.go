@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+func TestFairQueueServesTenantsInTurn(t *testing.T) {
+	q := newFairQueue(100)
+
+	// A burst from one tenant queued ahead of two others
+	for i := 0; i < 5; i++ {
+		q.push(&pkg.NotificationMessage{ID: fmt.Sprintf("busy-%d", i), TenantID: "busy"})
+	}
+	q.push(&pkg.NotificationMessage{ID: "quiet-0", TenantID: "quiet"})
+	q.push(&pkg.NotificationMessage{ID: "default-0"})
+
+	var got []string
+	for {
+		n, ok := q.pop()
+		if !ok {
+			break
+		}
+		got = append(got, n.ID)
+	}
+
+	want := []string{"busy-0", "quiet-0", "default-0", "busy-1", "busy-2", "busy-3", "busy-4"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected order %v, got %v", want, got)
+	}
+	if q.len() != 0 {
+		t.Errorf("Expected empty queue, got %d", q.len())
+	}
+}
+
+func TestFairQueueLimits(t *testing.T) {
+	q := newFairQueue(4)
+	q.setTenantCapacity(2)
+
+	for i := 0; i < 2; i++ {
+		if err := q.push(&pkg.NotificationMessage{TenantID: "busy"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if err := q.push(&pkg.NotificationMessage{TenantID: "busy"}); err == nil {
+		t.Errorf("Expected the tenant limit to reject a third notification")
+	}
+
+	// Other tenants still have room until the total capacity is reached
+	q.push(&pkg.NotificationMessage{TenantID: "a"})
+	q.push(&pkg.NotificationMessage{TenantID: "b"})
+	if err := q.push(&pkg.NotificationMessage{TenantID: "c"}); err == nil {
+		t.Errorf("Expected a full queue to reject notifications")
+	}
+
+	if lengths := q.lengths(); lengths["busy"] != 2 || lengths["a"] != 1 {
+		t.Errorf("Unexpected lengths %v", lengths)
+	}
+}
@@ -2,20 +2,29 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
 	"time"
 
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/channel"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/preferences"
 	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/provider"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/quota"
 	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/redis"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/retry"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/templates"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/tenant"
 	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
 )
 
 // Pool represents a worker pool for processing notifications
 type Pool struct {
-	workers     int
-	jobQueue    chan *pkg.NotificationMessage
+	shared      *lane
+	topics      map[string]*topicState
+	queueSize   int
+	tenantLimit int
 	resultQueue chan *pkg.ProcessingResult
 	errorQueue  chan error
 	quit        chan bool
@@ -23,63 +32,338 @@ type Pool struct {
 
 	rateLimiter     *redis.RateLimiter
 	providerManager *provider.ProviderManager
+	router          *channel.Router
+	renderer        *templates.Renderer
+	preferences     preferences.Store
+	deferrer        Deferrer
+	coalescer       *Coalescer
+	digester        Digester
+	quota           QuotaEnforcer
+	limiter         ProviderLimiter
+	inbox           Inbox
+	retrier         Retrier
 
-	retryAttempts int
-	retryDelay    time.Duration
+	retryPolicy      retry.Policy
+	providerSettings *provider.SettingsTable
+	latencies        *provider.LatencyTracker
+	hedgePercentile  float64
 
 	// Metrics
 	processed   int64
 	failed      int64
 	rateLimited int64
+	hedged      int64
+	hedgeWins   int64
+	channels    map[pkg.Channel]*ChannelMetrics
+	outcomes    map[pkg.Outcome]int64
+	tenants     map[string]*TenantMetrics
+	topicStats  map[string]*TopicMetrics
 	mu          sync.RWMutex
 }
 
-// NewPool creates a new worker pool
-func NewPool(workers, maxQueueSize int, rateLimiter *redis.RateLimiter, providerManager *provider.ProviderManager, retryAttempts int, retryDelay time.Duration) *Pool {
+// Deferrer schedules notifications for delivery at a later time
+type Deferrer interface {
+	Defer(ctx context.Context, notification *pkg.NotificationMessage, until time.Time) error
+}
+
+// Digester accumulates notifications into periodic digests. Accumulate
+// reports whether the notification was taken into a digest.
+type Digester interface {
+	Accumulate(ctx context.Context, notification *pkg.NotificationMessage) (bool, error)
+}
+
+// QuotaEnforcer charges notifications against their tenant's aggregate
+// throughput quota. Recharge charges notifications that were queued for
+// quota, which are not counted as queued again.
+type QuotaEnforcer interface {
+	Charge(ctx context.Context, tenantID string, n int64) (quota.Decision, error)
+	Recharge(ctx context.Context, tenantID string, n int64) (quota.Decision, error)
+}
+
+// ProviderLimiter paces sends to providers and adapts to their throttling.
+// Wait returns 0 once a send may go ahead, or how long to hold the send back
+// when that is longer than the limiter is willing to block.
+type ProviderLimiter interface {
+	Wait(ctx context.Context, provider string) (time.Duration, error)
+	Report(ctx context.Context, provider string, throttled bool, retryAfter time.Duration) error
+}
+
+// Inbox keeps notifications in the users' in-app inboxes. Add returns the
+// user's unread count, whether or not it kept the notification.
+type Inbox interface {
+	Add(ctx context.Context, notification *pkg.NotificationMessage) (int64, error)
+}
+
+// Retrier retries failed deliveries later without holding up a worker.
+// Retry schedules the next attempt after delay and returns when it is due,
+// DeadLetter parks a notification that is out of retries.
+type Retrier interface {
+	Retry(notification *pkg.NotificationMessage, reason error, delay time.Duration) (time.Time, error)
+	DeadLetter(notification *pkg.NotificationMessage, reason error) error
+}
+
+// ChannelMetrics holds delivery counters for a single channel
+type ChannelMetrics struct {
+	Processed int64 `json:"processed"`
+	Failed    int64 `json:"failed"`
+}
+
+// TenantMetrics holds the counters of a single tenant
+type TenantMetrics struct {
+	Processed   int64                 `json:"processed"`
+	Failed      int64                 `json:"failed"`
+	RateLimited int64                 `json:"rate_limited"`
+	OverQuota   int64                 `json:"over_quota"`
+	Queued      int                   `json:"queued"`
+	Outcomes    map[pkg.Outcome]int64 `json:"outcomes"`
+}
+
+// defaultMaxRetryDelay caps the backoff of the retry policy NewPool sets up
+const defaultMaxRetryDelay = 30 * time.Second
+
+// latencyWindow is how many recent sends to each provider its latency
+// percentiles are taken over
+const latencyWindow = 200
+
+// NewPool creates a new worker pool retrying transient failures up to
+// retryAttempts times, with exponential backoff from retryDelay. Sends to
+// providers are bounded by their timeout in providerSettings and fail over
+// to another provider after its retries; a nil table applies
+// provider.DefaultTimeout and fails over after the first failure.
+func NewPool(workers, maxQueueSize int, rateLimiter *redis.RateLimiter, providerManager *provider.ProviderManager, retryAttempts int, retryDelay time.Duration, providerSettings *provider.SettingsTable) *Pool {
+	// The provider manager handed in serves the push channel; other channels
+	// are registered on the router
+	router := channel.NewRouter()
+	router.Register(pkg.ChannelPush, providerManager)
+
 	return &Pool{
-		workers:         workers,
-		jobQueue:        make(chan *pkg.NotificationMessage, maxQueueSize),
-		resultQueue:     make(chan *pkg.ProcessingResult, maxQueueSize),
-		errorQueue:      make(chan error, maxQueueSize),
-		quit:            make(chan bool),
-		rateLimiter:     rateLimiter,
-		providerManager: providerManager,
-		retryAttempts:   retryAttempts,
-		retryDelay:      retryDelay,
+		shared:           newLane("shared", workers, maxQueueSize, 0),
+		topics:           make(map[string]*topicState),
+		queueSize:        maxQueueSize,
+		resultQueue:      make(chan *pkg.ProcessingResult, maxQueueSize),
+		errorQueue:       make(chan error, maxQueueSize),
+		quit:             make(chan bool),
+		rateLimiter:      rateLimiter,
+		providerManager:  providerManager,
+		router:           router,
+		retryPolicy:      retry.NewPolicy(retryAttempts, retryDelay, defaultMaxRetryDelay, retry.DefaultRetryableCodes),
+		providerSettings: providerSettings,
+		latencies:        provider.NewLatencyTracker(latencyWindow),
+		channels:         make(map[pkg.Channel]*ChannelMetrics),
+		outcomes:         make(map[pkg.Outcome]int64),
+		tenants:          make(map[string]*TenantMetrics),
+		topicStats:       make(map[string]*TopicMetrics),
+	}
+}
+
+// SetRenderer enables template rendering for notifications with a TemplateID
+func (p *Pool) SetRenderer(renderer *templates.Renderer) {
+	p.renderer = renderer
+}
+
+// SetPreferences enables enforcement of user preferences before delivery
+func (p *Pool) SetPreferences(store preferences.Store) {
+	p.preferences = store
+}
+
+// SetDeferrer enables quiet hours by holding back notifications below
+// PriorityHigh until the user's quiet window ends
+func (p *Pool) SetDeferrer(deferrer Deferrer) {
+	p.deferrer = deferrer
+}
+
+// SetDigester enables digest mode: low priority notifications with a digest
+// policy are accumulated instead of being delivered one by one
+func (p *Pool) SetDigester(digester Digester) {
+	p.digester = digester
+}
+
+// SetQuota enables per-tenant throughput quotas. Over-quota notifications
+// are deferred until the quota allows them when the tenant's policy queues
+// them and a deferrer is set, and rejected otherwise.
+func (p *Pool) SetQuota(enforcer QuotaEnforcer) {
+	p.quota = enforcer
+}
+
+// SetProviderLimiter enables outbound rate limiting per provider. Sends the
+// limiter holds back for long, e.g. after a Retry-After, are deferred for
+// that channel when a deferrer is set and reported as throttled otherwise.
+func (p *Pool) SetProviderLimiter(limiter ProviderLimiter) {
+	p.limiter = limiter
+}
+
+// SetInbox stores notifications in the user's inbox as they are handed to
+// the providers and sets their badge to the user's unread count
+func (p *Pool) SetInbox(inbox Inbox) {
+	p.inbox = inbox
+}
+
+// SetRetryPolicy sets which failures are retried and how long retries in
+// the worker wait; topic policies may override its retries and base delay
+func (p *Pool) SetRetryPolicy(policy retry.Policy) {
+	p.retryPolicy = policy
+}
+
+// SetRetrier hands failed deliveries to a retrier instead of retrying them
+// in the worker. Each retry comes back as a new attempt, until the retry
+// attempts of the notification's topic are used up and it is dead-lettered.
+func (p *Pool) SetRetrier(retrier Retrier) {
+	p.retrier = retrier
+}
+
+// SetHedging hedges sends of urgent notifications: once a send takes longer
+// than the given percentile, e.g. 95, of the provider's recent latencies,
+// the notification is also sent to another provider of the channel and the
+// first success wins. 0 disables hedging.
+func (p *Pool) SetHedging(percentile float64) {
+	p.hedgePercentile = percentile
+}
+
+// SetCoalesceWindow enables coalescing of notifications with a CollapseKey:
+// they are held for window and later ones for the same user and key replace
+// or merge with earlier unsent ones. Must be called before Start.
+func (p *Pool) SetCoalesceWindow(window time.Duration) {
+	if window <= 0 {
+		p.coalescer = nil
+		return
 	}
+	p.coalescer = NewCoalescer(window, p.queueSize)
+}
+
+// SetTenantQueueLimit bounds the notifications queued for a single tenant so
+// a burst from one tenant cannot fill the whole queue; 0 removes the bound
+func (p *Pool) SetTenantQueueLimit(limit int) {
+	p.tenantLimit = limit
+	for _, l := range p.lanes() {
+		l.queue.setTenantCapacity(limit)
+	}
+}
+
+// SetTopicPolicy applies a policy to the notifications consumed from its
+// topic. A topic with its own workers gets a queue of the pool's size; a
+// nil rate limiter keeps the pool's. Must be called before Start.
+func (p *Pool) SetTopicPolicy(policy TopicPolicy, rateLimiter *redis.RateLimiter) {
+	state := &topicState{policy: policy, rateLimiter: rateLimiter}
+	if policy.Workers > 0 {
+		state.lane = newLane(policy.Topic, policy.Workers, p.queueSize, p.tenantLimit)
+	}
+	p.topics[policy.Topic] = state
+}
+
+// Router returns the channel router used to dispatch deliveries
+func (p *Pool) Router() *channel.Router {
+	return p.router
 }
 
 // Start starts the worker pool
 func (p *Pool) Start(ctx context.Context) {
-	log.Printf("Starting worker pool with %d workers", p.workers)
+	log.Printf("Starting worker pool with %d workers", p.Workers())
 
-	// Start workers
-	for i := 0; i < p.workers; i++ {
+	workerID := 0
+	for _, l := range p.lanes() {
+		// Feed the lane's workers from its per-tenant queues
 		p.wg.Add(1)
-		go p.worker(ctx, i)
+		go p.dispatch(ctx, l)
+
+		// Start workers
+		for i := 0; i < l.workers; i++ {
+			p.wg.Add(1)
+			go p.worker(ctx, workerID, l)
+			workerID++
+		}
+		if l != p.shared {
+			log.Printf("Topic %s has %d dedicated workers", l.name, l.workers)
+		}
 	}
 
-	log.Printf("Worker pool started with %d workers", p.workers)
+	log.Printf("Worker pool started with %d workers", p.Workers())
+}
+
+// Workers returns the number of workers over all lanes
+func (p *Pool) Workers() int {
+	total := 0
+	for _, l := range p.lanes() {
+		total += l.workers
+	}
+	return total
+}
+
+// lanes returns the shared lane followed by the dedicated lanes of topics
+func (p *Pool) lanes() []*lane {
+	lanes := []*lane{p.shared}
+	for _, state := range p.topics {
+		if state.lane != nil {
+			lanes = append(lanes, state.lane)
+		}
+	}
+	return lanes
 }
 
 // Stop stops the worker pool
 func (p *Pool) Stop() {
 	log.Println("Stopping worker pool...")
+
+	// Notifications still inside their coalescing window are handed to the
+	// deferrer as due now so they survive the restart, marked so they are
+	// not held for another window
+	if p.coalescer != nil {
+		for _, n := range p.coalescer.Stop() {
+			if p.deferrer == nil {
+				log.Printf("Dropping coalesced notification %s on shutdown", n.ID)
+				continue
+			}
+			coalesced := *n
+			coalesced.Coalesced = true
+			if err := p.deferrer.Defer(context.Background(), &coalesced, time.Now()); err != nil {
+				log.Printf("Failed to persist coalesced notification %s: %v", n.ID, err)
+			}
+		}
+	}
+
 	close(p.quit)
 	p.wg.Wait()
-	close(p.jobQueue)
+	for _, l := range p.lanes() {
+		close(l.jobs)
+	}
 	close(p.resultQueue)
 	close(p.errorQueue)
 	log.Println("Worker pool stopped")
 }
 
-// Submit submits a job to the worker pool
+// Submit queues a job for the worker pool. Jobs are queued per tenant and
+// tenants are served in turn, on the lane of the job's topic.
 func (p *Pool) Submit(notification *pkg.NotificationMessage) error {
-	select {
-	case p.jobQueue <- notification:
-		return nil
-	default:
-		return fmt.Errorf("job queue is full")
+	l := p.shared
+	if state, ok := p.topics[notification.Source]; ok && state.lane != nil {
+		l = state.lane
+	}
+	return l.queue.push(notification)
+}
+
+// dispatch hands jobs queued on a lane to its workers as they become free
+func (p *Pool) dispatch(ctx context.Context, l *lane) {
+	defer p.wg.Done()
+
+	for {
+		job, ok := l.queue.pop()
+		if !ok {
+			select {
+			case <-l.queue.ready:
+				continue
+			case <-p.quit:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case l.jobs <- job:
+		case <-p.quit:
+			return
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
@@ -100,24 +384,156 @@ func (p *Pool) GetMetrics() (processed, failed, rateLimited int64) {
 	return p.processed, p.failed, p.rateLimited
 }
 
+// GetHedgeMetrics returns how many sends were hedged and how many of those
+// were won by the hedge
+func (p *Pool) GetHedgeMetrics() (hedged, won int64) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.hedged, p.hedgeWins
+}
+
+// GetChannelMetrics returns a snapshot of per-channel delivery counters
+func (p *Pool) GetChannelMetrics() map[pkg.Channel]ChannelMetrics {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	snapshot := make(map[pkg.Channel]ChannelMetrics, len(p.channels))
+	for ch, m := range p.channels {
+		snapshot[ch] = *m
+	}
+	return snapshot
+}
+
+// GetOutcomeMetrics returns a snapshot of result counts by outcome
+func (p *Pool) GetOutcomeMetrics() map[pkg.Outcome]int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	snapshot := make(map[pkg.Outcome]int64, len(p.outcomes))
+	for outcome, count := range p.outcomes {
+		snapshot[outcome] = count
+	}
+	return snapshot
+}
+
+// GetTenantMetrics returns a snapshot of the counters of every tenant
+func (p *Pool) GetTenantMetrics() map[string]TenantMetrics {
+	queued := make(map[string]int)
+	for _, l := range p.lanes() {
+		for tenantID, n := range l.queue.lengths() {
+			queued[tenantID] += n
+		}
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	snapshot := make(map[string]TenantMetrics, len(p.tenants))
+	for tenantID, m := range p.tenants {
+		outcomes := make(map[pkg.Outcome]int64, len(m.Outcomes))
+		for outcome, count := range m.Outcomes {
+			outcomes[outcome] = count
+		}
+		snapshot[tenantID] = TenantMetrics{
+			Processed:   m.Processed,
+			Failed:      m.Failed,
+			RateLimited: m.RateLimited,
+			OverQuota:   m.OverQuota,
+			Queued:      queued[tenantID],
+			Outcomes:    outcomes,
+		}
+	}
+	for tenantID, n := range queued {
+		if _, ok := snapshot[tenantID]; !ok {
+			snapshot[tenantID] = TenantMetrics{Queued: n, Outcomes: map[pkg.Outcome]int64{}}
+		}
+	}
+	return snapshot
+}
+
+// GetTopicMetrics returns a snapshot of the counters of every topic with a
+// policy or processed notifications. Queued and Workers are only reported
+// for topics with their own lane.
+func (p *Pool) GetTopicMetrics() map[string]TopicMetrics {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	snapshot := make(map[string]TopicMetrics, len(p.topicStats))
+	for topic, m := range p.topicStats {
+		outcomes := make(map[pkg.Outcome]int64, len(m.Outcomes))
+		for outcome, count := range m.Outcomes {
+			outcomes[outcome] = count
+		}
+		snapshot[topic] = TopicMetrics{
+			Processed:   m.Processed,
+			Failed:      m.Failed,
+			RateLimited: m.RateLimited,
+			Outcomes:    outcomes,
+		}
+	}
+	for topic, state := range p.topics {
+		m, ok := snapshot[topic]
+		if !ok {
+			m = TopicMetrics{Outcomes: map[pkg.Outcome]int64{}}
+		}
+		if state.lane != nil {
+			m.Queued = state.lane.queue.len()
+			m.Workers = state.lane.workers
+		}
+		snapshot[topic] = m
+	}
+	return snapshot
+}
+
+// topicMetrics returns the counters of a topic, or nil for notifications
+// that were not consumed from Kafka; p.mu must be held
+func (p *Pool) topicMetrics(topic string) *TopicMetrics {
+	if topic == "" {
+		return nil
+	}
+	m, ok := p.topicStats[topic]
+	if !ok {
+		m = &TopicMetrics{Outcomes: make(map[pkg.Outcome]int64)}
+		p.topicStats[topic] = m
+	}
+	return m
+}
+
+// tenantMetrics returns the counters of a tenant; p.mu must be held
+func (p *Pool) tenantMetrics(tenantID string) *TenantMetrics {
+	m, ok := p.tenants[tenantID]
+	if !ok {
+		m = &TenantMetrics{Outcomes: make(map[pkg.Outcome]int64)}
+		p.tenants[tenantID] = m
+	}
+	return m
+}
+
 // worker is the main worker function
-func (p *Pool) worker(ctx context.Context, workerID int) {
+func (p *Pool) worker(ctx context.Context, workerID int, l *lane) {
 	defer p.wg.Done()
 
 	log.Printf("Worker %d started", workerID)
 	defer log.Printf("Worker %d stopped", workerID)
 
+	var coalesced <-chan *pkg.NotificationMessage
+	if p.coalescer != nil {
+		coalesced = p.coalescer.Ready()
+	}
+
 	for {
 		select {
 		case <-p.quit:
 			return
 		case <-ctx.Done():
 			return
-		case job := <-p.jobQueue:
+		case job := <-l.jobs:
 			if job == nil {
 				return
 			}
 			p.processNotification(ctx, workerID, job)
+		case job := <-coalesced:
+			p.process(ctx, workerID, job, time.Now())
 		}
 	}
 }
@@ -134,116 +550,664 @@ func (p *Pool) processNotification(ctx context.Context, workerID int, notificati
 		return
 	}
 
-	// Check rate limiting
-	allowed, err := p.rateLimiter.IsAllowed(ctx, notification.UserID)
+	// Hold notifications with a collapse key for the coalescing window, once
+	if p.coalescer != nil && notification.CollapseKey != "" && !notification.Admitted && !notification.QuotaQueued && !notification.Coalesced {
+		superseded, immediate := p.coalescer.Add(notification)
+		if superseded != nil {
+			p.reportCollapsed(superseded, notification.ID)
+		}
+		if immediate == nil {
+			return
+		}
+		notification = immediate
+	}
+
+	p.process(ctx, workerID, notification, startTime)
+}
+
+// process applies preferences, rate limiting and rendering, then delivers
+// the notification on each of its channels
+func (p *Pool) process(ctx context.Context, workerID int, notification *pkg.NotificationMessage, startTime time.Time) {
+	// Stores and providers are scoped to the notification's tenant
+	ctx = tenant.WithID(ctx, notification.Tenant())
+
+	// Retries and sends held back for a throttled provider were charged and
+	// checked on their first pass and are only delivered again, on the
+	// channel they were held for
+	if notification.Admitted {
+		p.deliverAll(ctx, workerID, notification, startTime)
+		return
+	}
+
+	// Enforce user preferences before spending rate limit budget
+	var prefs *preferences.Preferences
+	if p.preferences != nil {
+		var err error
+		prefs, err = p.preferences.Get(ctx, notification.UserID)
+		if err != nil {
+			p.sendError(fmt.Errorf("preference lookup failed for user %s: %w", notification.UserID, err))
+			return
+		}
+
+		decision := prefs.Apply(notification)
+		for _, ch := range decision.Suppressed {
+			p.sendResult(&pkg.ProcessingResult{
+				MessageID:   notification.ID,
+				TenantID:    notification.Tenant(),
+				UserID:      notification.UserID,
+				Source:      notification.Source,
+				Success:     false,
+				Outcome:     pkg.OutcomeSuppressedByPreference,
+				Channel:     ch,
+				Error:       fmt.Errorf("suppressed by preference: %s", decision.Reason),
+				ProcessedAt: time.Now(),
+				Attempts:    notification.Retry + 1,
+			})
+		}
+		if len(decision.Allowed) == 0 {
+			log.Printf("Worker %d: notification %s suppressed for user %s: %s", workerID, notification.ID, notification.UserID, decision.Reason)
+			return
+		}
+		if len(decision.Suppressed) > 0 {
+			filtered := *notification
+			filtered.Channels = decision.Allowed
+			notification = &filtered
+		}
+	}
+
+	// Batch low priority notifications into the user's digest; if that fails
+	// the notification is delivered on its own
+	if p.digester != nil {
+		digested, err := p.digester.Accumulate(ctx, notification)
+		if err != nil {
+			p.sendError(fmt.Errorf("digest failed for notification %s: %w", notification.ID, err))
+		}
+		if digested {
+			log.Printf("Worker %d: added notification %s to the %s digest of user %s", workerID, notification.ID, notification.Type, notification.UserID)
+			p.reportOutcome(notification, pkg.OutcomeDigested, nil)
+			return
+		}
+	}
+
+	// Hold back non-urgent notifications during the user's quiet hours
+	if prefs != nil && p.deferrer != nil && notification.Priority < pkg.PriorityHigh {
+		if until, quiet := prefs.QuietHours.Until(time.Now()); quiet {
+			p.deferNotification(ctx, workerID, notification, until, "quiet hours")
+			return
+		}
+	}
+
+	// Check rate limiting; notifications waiting for quota took their slot
+	// on their first pass
+	if !notification.QuotaQueued && !p.allowRate(ctx, notification) {
+		return
+	}
+
+	// Charge the tenant's aggregate quota; notifications waiting for quota
+	// were counted as over quota on their first pass
+	if p.quota != nil {
+		charge := p.quota.Charge
+		if notification.QuotaQueued {
+			charge = p.quota.Recharge
+		}
+		decision, err := charge(ctx, notification.Tenant(), 1)
+		if err != nil {
+			p.sendError(fmt.Errorf("quota error for tenant %s: %w", notification.Tenant(), err))
+			return
+		}
+		if !decision.Allowed {
+			if !notification.QuotaQueued {
+				p.mu.Lock()
+				p.tenantMetrics(notification.Tenant()).OverQuota++
+				p.mu.Unlock()
+			}
+
+			if decision.Mode == quota.ModeQueue && p.deferrer != nil {
+				queued := *notification
+				queued.QuotaQueued = true
+				p.deferNotification(ctx, workerID, &queued, decision.RetryAt(time.Now()), "tenant quota")
+				return
+			}
+			p.reportOutcome(notification, pkg.OutcomeQuotaExceeded, fmt.Errorf("quota of tenant %s exceeded", notification.Tenant()))
+			return
+		}
+	}
+
+	// Render templated notifications into their title and body
+	if p.renderer != nil {
+		rendered, err := p.renderer.Apply(ctx, notification)
+		if err != nil {
+			p.mu.Lock()
+			p.failed++
+			p.tenantMetrics(notification.Tenant()).Failed++
+			if tm := p.topicMetrics(notification.Source); tm != nil {
+				tm.Failed++
+			}
+			p.mu.Unlock()
+
+			p.sendResult(&pkg.ProcessingResult{
+				MessageID:   notification.ID,
+				TenantID:    notification.Tenant(),
+				UserID:      notification.UserID,
+				Source:      notification.Source,
+				Success:     false,
+				Outcome:     pkg.OutcomeFailed,
+				Error:       fmt.Errorf("template rendering failed: %w", err),
+				ProcessedAt: time.Now(),
+				Attempts:    notification.Retry + 1,
+			})
+			return
+		}
+		notification = rendered
+	}
+
+	// Keep the notification in the user's inbox and badge it with the unread
+	// count; if that fails it is delivered without a badge
+	if p.inbox != nil {
+		unread, err := p.inbox.Add(ctx, notification)
+		if err != nil {
+			p.sendError(fmt.Errorf("inbox error for notification %s: %w", notification.ID, err))
+		} else if notification.Badge == nil {
+			badged := *notification
+			badge := int(unread)
+			badged.Badge = &badge
+			notification = &badged
+		}
+	}
+
+	p.deliverAll(ctx, workerID, notification, startTime)
+}
+
+// allowRate checks the user's rate limit, counted per topic for topics with
+// their own limit, and reports notifications over it
+func (p *Pool) allowRate(ctx context.Context, notification *pkg.NotificationMessage) bool {
+	rateLimiter := p.rateLimiter
+	if state, ok := p.topics[notification.Source]; ok && state.rateLimiter != nil {
+		rateLimiter = state.rateLimiter
+	}
+	allowed, err := rateLimiter.IsAllowed(ctx, notification.UserID)
 	if err != nil {
 		p.sendError(fmt.Errorf("rate limiter error for user %s: %w", notification.UserID, err))
-		return
+		return false
 	}
 
 	if !allowed {
 		p.mu.Lock()
 		p.rateLimited++
+		p.tenantMetrics(notification.Tenant()).RateLimited++
+		if tm := p.topicMetrics(notification.Source); tm != nil {
+			tm.RateLimited++
+		}
 		p.mu.Unlock()
 
 		result := &pkg.ProcessingResult{
 			MessageID:   notification.ID,
+			TenantID:    notification.Tenant(),
 			UserID:      notification.UserID,
+			Source:      notification.Source,
 			Success:     false,
+			Outcome:     pkg.OutcomeRateLimited,
 			Error:       fmt.Errorf("rate limit exceeded for user %s", notification.UserID),
 			ProcessedAt: time.Now(),
 			Attempts:    notification.Retry + 1,
 		}
 		p.sendResult(result)
-		return
+		return false
+	}
+	return true
+}
+
+// deliverAll delivers on every target channel, each with its own provider
+// and result
+func (p *Pool) deliverAll(ctx context.Context, workerID int, notification *pkg.NotificationMessage, startTime time.Time) {
+	for _, ch := range notification.TargetChannels() {
+		p.deliver(ctx, workerID, notification, ch, startTime)
 	}
+}
 
-	// Get a provider
-	selectedProvider, err := p.providerManager.GetProvider(ctx)
+// deliver sends a notification on a single channel and reports the result
+func (p *Pool) deliver(ctx context.Context, workerID int, notification *pkg.NotificationMessage, ch pkg.Channel, startTime time.Time) {
+	// Get a provider for the channel
+	selectedProvider, err := p.router.GetProviderFor(ctx, ch, notification)
 	if err != nil {
-		p.sendError(fmt.Errorf("failed to get provider: %w", err))
+		p.recordDelivery(notification, ch, false)
+		p.sendResult(&pkg.ProcessingResult{
+			MessageID:   notification.ID,
+			TenantID:    notification.Tenant(),
+			UserID:      notification.UserID,
+			Source:      notification.Source,
+			Success:     false,
+			Outcome:     pkg.OutcomeFailed,
+			Channel:     ch,
+			Error:       fmt.Errorf("failed to get provider: %w", err),
+			ProcessedAt: time.Now(),
+			Attempts:    notification.Retry + 1,
+		})
 		return
 	}
 
-	// Attempt to send notification with retries
+	// Attempt to send notification, retrying transient failures. A retry
+	// from the retrier picks up the failures of the provider it failed on.
+	policy := p.retryPolicyFor(notification)
 	var lastErr error
-	maxAttempts := p.retryAttempts + 1 // +1 for initial attempt
-
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		if attempt > 1 {
-			// Add exponential backoff for retries
-			delay := p.retryDelay * time.Duration(attempt-1)
-			select {
-			case <-time.After(delay):
-			case <-ctx.Done():
+	attempt := 1
+	providerFailures := 0
+	if notification.RetryProvider == selectedProvider.Name() {
+		selectedProvider, providerFailures = p.failover(ctx, workerID, notification, ch, selectedProvider, notification.ProviderFailures)
+	}
+	for {
+		// Wait for the provider's outbound bucket
+		if p.limiter != nil {
+			wait, err := p.limiter.Wait(ctx, selectedProvider.Name())
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				// Fail open: an unavailable limiter must not stop deliveries
+				p.sendError(err)
+			} else if wait > 0 {
+				p.holdBack(ctx, workerID, notification, ch, selectedProvider.Name(), time.Now().Add(wait))
 				return
 			}
 		}
 
-		// Create a timeout context for the provider call
-		providerCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		sent := p.send(ctx, workerID, notification, ch, selectedProvider)
+		response, err := sent.response, sent.err
+		selectedProvider = sent.provider
 
-		response, err := selectedProvider.Send(providerCtx, notification)
-		cancel()
+		// A live connection that went away hands over to the regular
+		// providers without using up an attempt
+		if errors.Is(err, provider.ErrRecipientOffline) {
+			if fallback, ferr := p.router.GetProvider(ctx, ch); ferr == nil && fallback != selectedProvider {
+				log.Printf("Worker %d: %s could not reach user %s, falling back to %s: %v",
+					workerID, selectedProvider.Name(), notification.UserID, fallback.Name(), err)
+				selectedProvider = fallback
+				continue
+			}
+		}
 
-		if err != nil {
-			lastErr = err
-			log.Printf("Worker %d: Attempt %d failed for notification %s: %v", workerID, attempt, notification.ID, err)
-			continue
+		if p.limiter != nil {
+			retryAfter, throttled := provider.Throttled(response, err)
+			if throttled || (err == nil && response.Success) {
+				if err := p.limiter.Report(ctx, selectedProvider.Name(), throttled, retryAfter); err != nil {
+					p.sendError(err)
+				}
+			}
 		}
 
 		// Process provider response
 		result := &pkg.ProcessingResult{
 			MessageID:   notification.ID,
+			TenantID:    notification.Tenant(),
 			UserID:      notification.UserID,
-			Success:     response.Success,
+			Source:      notification.Source,
+			Success:     err == nil && response.Success,
+			Outcome:     pkg.OutcomeFailed,
+			Channel:     ch,
 			Provider:    selectedProvider.Name(),
 			ProcessedAt: time.Now(),
-			Attempts:    attempt,
+			Attempts:    notification.Retry + attempt,
 		}
 
-		if response.Success {
-			p.mu.Lock()
-			p.processed++
-			p.mu.Unlock()
+		if result.Success {
+			result.Outcome = pkg.OutcomeDelivered
+			log.Printf("Worker %d: Successfully sent notification %s on %s via %s (took %v)",
+				workerID, notification.ID, ch, selectedProvider.Name(), time.Since(startTime))
+			p.recordDelivery(notification, ch, true)
+			p.sendResult(result)
+			return
+		}
 
-			log.Printf("Worker %d: Successfully sent notification %s via %s (took %v)",
-				workerID, notification.ID, selectedProvider.Name(), time.Since(startTime))
-		} else {
-			result.Error = fmt.Errorf("provider error: %s", response.Error)
+		retryable := policy.Retryable(response, err)
+		lastErr = err
+		if err == nil {
+			lastErr = fmt.Errorf("provider error: %s", response.Error)
+		}
+
+		// Permanent failures such as an unknown recipient are not retried
+		if !retryable {
+			log.Printf("Worker %d: Failed to send notification %s on %s via %s: %v",
+				workerID, notification.ID, ch, selectedProvider.Name(), lastErr)
+			result.Error = lastErr
+			p.recordDelivery(notification, ch, false)
+			p.sendResult(result)
+			return
+		}
+
+		log.Printf("Worker %d: Attempt %d failed for notification %s on %s: %v", workerID, result.Attempts, notification.ID, ch, lastErr)
+		providerFailures++
+		if p.retrier != nil {
+			p.retryLater(workerID, notification, ch, selectedProvider.Name(), providerFailures, policy, lastErr)
+			return
+		}
+
+		delay, ok := policy.Next(notification, attempt, time.Now())
+		if !ok {
+			break
+		}
+
+		selectedProvider, providerFailures = p.failover(ctx, workerID, notification, ch, selectedProvider, providerFailures)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		attempt++
+	}
+
+	// Retries are used up, or the notification expires before the next one
+	attempts := notification.Retry + attempt
+	err = fmt.Errorf("all %d attempts failed, last error: %w", attempts, lastErr)
+	if attempt <= policy.MaxRetries {
+		err = fmt.Errorf("attempt %d failed and a retry would outlive the notification, last error: %w", attempts, lastErr)
+	}
+	result := &pkg.ProcessingResult{
+		MessageID:   notification.ID,
+		TenantID:    notification.Tenant(),
+		UserID:      notification.UserID,
+		Source:      notification.Source,
+		Success:     false,
+		Outcome:     pkg.OutcomeFailed,
+		Channel:     ch,
+		Provider:    selectedProvider.Name(),
+		Error:       err,
+		ProcessedAt: time.Now(),
+		Attempts:    attempts,
+	}
 
+	p.recordDelivery(notification, ch, false)
+	p.sendResult(result)
+}
+
+// sent is the outcome of a send to a provider
+type sent struct {
+	provider provider.Provider
+	response *pkg.ProviderResponse
+	err      error
+}
+
+// send sends a notification to the selected provider. Urgent notifications
+// are hedged when hedging is enabled: once the send is slower than the
+// provider's latency percentile, the notification is also sent to another
+// provider of the channel, if its outbound bucket allows, and the first
+// success wins while the other send is cancelled. When both fail, the
+// selected provider's failure is returned.
+func (p *Pool) send(ctx context.Context, workerID int, notification *pkg.NotificationMessage, ch pkg.Channel, selected provider.Provider) sent {
+	if p.hedgePercentile <= 0 || notification.Priority != pkg.PriorityUrgent {
+		return p.call(ctx, selected, notification)
+	}
+	threshold, ok := p.latencies.Percentile(selected.Name(), p.hedgePercentile)
+	if !ok {
+		return p.call(ctx, selected, notification)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan sent, 2)
+	go func() { results <- p.call(ctx, selected, notification) }()
+
+	timer := time.NewTimer(threshold)
+	defer timer.Stop()
+
+	var failure *sent
+	pending := 1
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			hedge, err := p.router.GetAlternative(ctx, ch, selected)
+			if err != nil {
+				continue
+			}
+			log.Printf("Worker %d: %s slower than %v for notification %s, hedging with %s",
+				workerID, selected.Name(), threshold, notification.ID, hedge.Name())
 			p.mu.Lock()
-			p.failed++
+			p.hedged++
 			p.mu.Unlock()
 
-			log.Printf("Worker %d: Failed to send notification %s via %s: %s",
-				workerID, notification.ID, selectedProvider.Name(), response.Error)
+			pending++
+			go func() {
+				if p.limiter != nil {
+					if wait, err := p.limiter.Wait(ctx, hedge.Name()); err == nil && wait > 0 {
+						results <- sent{provider: hedge, err: fmt.Errorf("provider %s is throttled", hedge.Name())}
+						return
+					}
+				}
+				results <- p.call(ctx, hedge, notification)
+			}()
+		case result := <-results:
+			pending--
+			if result.err == nil && result.response.Success {
+				if result.provider != selected {
+					p.mu.Lock()
+					p.hedgeWins++
+					p.mu.Unlock()
+				}
+				return result
+			}
+			if failure == nil || result.provider == selected {
+				failure = &result
+			}
 		}
+	}
+	return *failure
+}
 
-		p.sendResult(result)
-		return
+// call sends a notification to a provider within the provider's timeout and
+// records the latency of sends the provider answered
+func (p *Pool) call(ctx context.Context, selected provider.Provider, notification *pkg.NotificationMessage) sent {
+	ctx, cancel := context.WithTimeout(ctx, p.providerSettings.For(selected.Name()).Timeout)
+	defer cancel()
+
+	start := time.Now()
+	response, err := selected.Send(ctx, notification)
+	if err == nil {
+		p.latencies.Observe(selected.Name(), time.Since(start))
 	}
+	return sent{provider: selected, response: response, err: err}
+}
+
+// failover moves on to another provider of the channel once a provider's
+// retries are used up and returns the provider to send to with its failures
+// so far
+func (p *Pool) failover(ctx context.Context, workerID int, notification *pkg.NotificationMessage, ch pkg.Channel, selected provider.Provider, failures int) (provider.Provider, int) {
+	if failures <= p.providerSettings.For(selected.Name()).Retries {
+		return selected, failures
+	}
+	alternative, err := p.router.GetAlternative(ctx, ch, selected)
+	if err != nil {
+		return selected, failures
+	}
+	log.Printf("Worker %d: %s failed %d times for notification %s, failing over to %s",
+		workerID, selected.Name(), failures, notification.ID, alternative.Name())
+	return alternative, 0
+}
+
+// retryLater hands a failed delivery on a channel to the retrier, due after
+// the policy's backoff, and dead-letters it once its retries are used up.
+// The retry carries the provider's failures so it can fail over. A
+// notification that would expire before the retry is due fails right away.
+func (p *Pool) retryLater(workerID int, notification *pkg.NotificationMessage, ch pkg.Channel, providerName string, providerFailures int, policy retry.Policy, lastErr error) {
+	single := *notification
+	single.Channels = []pkg.Channel{ch}
+	single.RetryProvider = providerName
+	single.ProviderFailures = providerFailures
 
-	// All attempts failed
 	result := &pkg.ProcessingResult{
 		MessageID:   notification.ID,
+		TenantID:    notification.Tenant(),
 		UserID:      notification.UserID,
+		Source:      notification.Source,
 		Success:     false,
-		Provider:    selectedProvider.Name(),
-		Error:       fmt.Errorf("all %d attempts failed, last error: %w", maxAttempts, lastErr),
+		Outcome:     pkg.OutcomeFailed,
+		Channel:     ch,
+		Provider:    providerName,
 		ProcessedAt: time.Now(),
-		Attempts:    maxAttempts,
+		Attempts:    notification.Retry + 1,
 	}
 
-	p.mu.Lock()
-	p.failed++
-	p.mu.Unlock()
+	delay, ok := policy.Next(notification, notification.Retry+1, time.Now())
+	switch {
+	case notification.Retry >= policy.MaxRetries:
+		if err := p.retrier.DeadLetter(&single, lastErr); err != nil {
+			p.sendError(fmt.Errorf("failed to dead-letter notification %s: %w", notification.ID, err))
+			result.Error = fmt.Errorf("all %d attempts failed, last error: %w", result.Attempts, lastErr)
+		} else {
+			result.Error = fmt.Errorf("all %d attempts failed, moved to dead letter queue, last error: %w", result.Attempts, lastErr)
+		}
+	case !ok:
+		result.Error = fmt.Errorf("attempt %d failed and a retry would outlive the notification, last error: %w", result.Attempts, lastErr)
+	default:
+		due, err := p.retrier.Retry(&single, lastErr, delay)
+		if err == nil {
+			log.Printf("Worker %d: attempt %d failed for notification %s on %s, retrying at %s: %v",
+				workerID, result.Attempts, notification.ID, ch, due.Format(time.RFC3339), lastErr)
+			result.Outcome = pkg.OutcomeRetryScheduled
+			result.Error = lastErr
+			result.DeferredUntil = &due
+			p.sendResult(result)
+			return
+		}
+		p.sendError(fmt.Errorf("failed to schedule retry of notification %s: %w", notification.ID, err))
+		result.Error = fmt.Errorf("attempt %d failed and could not be retried, last error: %w", result.Attempts, lastErr)
+	}
 
+	p.recordDelivery(notification, ch, false)
 	p.sendResult(result)
 }
 
+// retryPolicyFor returns the retry policy of a notification, with the
+// retries and base delay of its topic's policy where set
+func (p *Pool) retryPolicyFor(notification *pkg.NotificationMessage) retry.Policy {
+	policy := p.retryPolicy
+	if state, ok := p.topics[notification.Source]; ok {
+		if state.policy.RetryAttempts != nil {
+			policy.MaxRetries = *state.policy.RetryAttempts
+		}
+		if state.policy.RetryDelay > 0 {
+			policy.BaseDelay = state.policy.RetryDelay
+		}
+	}
+	return policy
+}
+
+// holdBack defers delivery on a channel whose provider is throttled until
+// the provider's bucket allows it, or reports it as throttled without a
+// deferrer. The deferred notification is marked admitted, as it has been
+// charged already, and only targets that channel.
+func (p *Pool) holdBack(ctx context.Context, workerID int, notification *pkg.NotificationMessage, ch pkg.Channel, providerName string, until time.Time) {
+	single := *notification
+	single.Channels = []pkg.Channel{ch}
+	single.Admitted = true
+
+	if p.deferrer != nil {
+		p.deferNotification(ctx, workerID, &single, until, "provider "+providerName+" throttled")
+		return
+	}
+	p.reportOutcome(&single, pkg.OutcomeProviderThrottled, fmt.Errorf("provider %s is throttled until %s", providerName, until.Format(time.RFC3339)))
+}
+
+// deferNotification schedules the notification for later, e.g. the end of the
+// quiet window, and reports a deferred result for each target channel
+func (p *Pool) deferNotification(ctx context.Context, workerID int, notification *pkg.NotificationMessage, until time.Time, reason string) {
+	if err := p.deferrer.Defer(ctx, notification, until); err != nil {
+		p.sendError(fmt.Errorf("failed to defer notification %s: %w", notification.ID, err))
+		return
+	}
+
+	log.Printf("Worker %d: deferred notification %s for user %s until %s (%s)",
+		workerID, notification.ID, notification.UserID, until.Format(time.RFC3339), reason)
+
+	for _, ch := range notification.TargetChannels() {
+		p.sendResult(&pkg.ProcessingResult{
+			MessageID:     notification.ID,
+			TenantID:      notification.Tenant(),
+			UserID:        notification.UserID,
+			Source:        notification.Source,
+			Success:       false,
+			Outcome:       pkg.OutcomeDeferred,
+			Channel:       ch,
+			ProcessedAt:   time.Now(),
+			Attempts:      notification.Retry + 1,
+			DeferredUntil: &until,
+		})
+	}
+}
+
+// reportCollapsed reports a collapsed result for each target channel of a
+// notification that was superseded before it was sent
+func (p *Pool) reportCollapsed(notification *pkg.NotificationMessage, supersededBy string) {
+	p.reportOutcome(notification, pkg.OutcomeCollapsed, fmt.Errorf("collapsed into notification %s", supersededBy))
+}
+
+// reportOutcome reports an undelivered result for each target channel
+func (p *Pool) reportOutcome(notification *pkg.NotificationMessage, outcome pkg.Outcome, err error) {
+	for _, ch := range notification.TargetChannels() {
+		p.sendResult(&pkg.ProcessingResult{
+			MessageID:   notification.ID,
+			TenantID:    notification.Tenant(),
+			UserID:      notification.UserID,
+			Source:      notification.Source,
+			Success:     false,
+			Outcome:     outcome,
+			Channel:     ch,
+			Error:       err,
+			ProcessedAt: time.Now(),
+			Attempts:    notification.Retry + 1,
+		})
+	}
+}
+
+// recordDelivery updates the overall, per-channel, per-tenant and per-topic
+// delivery counters
+func (p *Pool) recordDelivery(notification *pkg.NotificationMessage, ch pkg.Channel, success bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tm := p.tenantMetrics(notification.Tenant())
+	if success {
+		tm.Processed++
+	} else {
+		tm.Failed++
+	}
+
+	if topic := p.topicMetrics(notification.Source); topic != nil {
+		if success {
+			topic.Processed++
+		} else {
+			topic.Failed++
+		}
+	}
+
+	m, ok := p.channels[ch]
+	if !ok {
+		m = &ChannelMetrics{}
+		p.channels[ch] = m
+	}
+
+	if success {
+		p.processed++
+		m.Processed++
+	} else {
+		p.failed++
+		m.Failed++
+	}
+}
+
 // sendResult sends a result to the result channel without blocking
 func (p *Pool) sendResult(result *pkg.ProcessingResult) {
+	if result.TenantID == "" {
+		result.TenantID = pkg.DefaultTenant
+	}
+
+	p.mu.Lock()
+	p.outcomes[result.Outcome]++
+	p.tenantMetrics(result.TenantID).Outcomes[result.Outcome]++
+	if tm := p.topicMetrics(result.Source); tm != nil {
+		tm.Outcomes[result.Outcome]++
+	}
+	p.mu.Unlock()
+
 	select {
 	case p.resultQueue <- result:
 	default:
@@ -260,9 +1224,13 @@ func (p *Pool) sendError(err error) {
 	}
 }
 
-// QueueSize returns the current size of the job queue
+// QueueSize returns the current size of the job queues
 func (p *Pool) QueueSize() int {
-	return len(p.jobQueue)
+	size := 0
+	for _, l := range p.lanes() {
+		size += l.queue.len()
+	}
+	return size
 }
 
 // IsHealthy performs a basic health check
@@ -0,0 +1,432 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/preferences"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/provider"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/quota"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// recordingRetrier keeps the notifications it retries, with their delays,
+// and dead-letters
+type recordingRetrier struct {
+	retried      []*pkg.NotificationMessage
+	delays       []time.Duration
+	deadLettered []*pkg.NotificationMessage
+}
+
+func (r *recordingRetrier) Retry(notification *pkg.NotificationMessage, reason error, delay time.Duration) (time.Time, error) {
+	r.retried = append(r.retried, notification)
+	r.delays = append(r.delays, delay)
+	return time.Now().Add(delay), nil
+}
+
+func (r *recordingRetrier) DeadLetter(notification *pkg.NotificationMessage, reason error) error {
+	r.deadLettered = append(r.deadLettered, notification)
+	return nil
+}
+
+func TestPoolRetrier(t *testing.T) {
+	p := NewPool(1, 10, nil, nil, 2, time.Second, nil)
+	retrier := &recordingRetrier{}
+	p.SetRetrier(retrier)
+
+	notification := &pkg.NotificationMessage{
+		ID:       "n1",
+		UserID:   "user-1",
+		Channels: []pkg.Channel{pkg.ChannelPush, pkg.ChannelEmail},
+		Retry:    1,
+	}
+	reason := errors.New("connection reset")
+
+	policy := p.retryPolicyFor(notification)
+	p.retryLater(0, notification, pkg.ChannelEmail, "smtp", 1, policy, reason)
+	result := <-p.Results()
+	if result.Outcome != pkg.OutcomeRetryScheduled || result.DeferredUntil == nil || result.Attempts != 2 {
+		t.Errorf("expected a scheduled retry after attempt 2, got %+v", result)
+	}
+	if len(retrier.retried) != 1 || len(retrier.retried[0].Channels) != 1 || retrier.retried[0].Channels[0] != pkg.ChannelEmail {
+		t.Errorf("expected only the failed channel to be retried, got %+v", retrier.retried)
+	}
+	if delay := retrier.delays[0]; delay < 0 || delay > 2*time.Second {
+		t.Errorf("expected the policy's backoff for retry 2, up to 2s, got %v", delay)
+	}
+
+	// A notification expiring before the retry is due fails at once
+	expiresAt := time.Now()
+	expiring := *notification
+	expiring.ExpiresAt = &expiresAt
+	p.retryLater(0, &expiring, pkg.ChannelEmail, "smtp", 1, policy, reason)
+	result = <-p.Results()
+	if result.Outcome != pkg.OutcomeFailed || len(retrier.retried) != 1 || len(retrier.deadLettered) != 0 {
+		t.Errorf("expected no retry past expiry, got %+v", result)
+	}
+
+	notification.Retry = 2
+	p.retryLater(0, notification, pkg.ChannelEmail, "smtp", 1, policy, reason)
+	result = <-p.Results()
+	if result.Outcome != pkg.OutcomeFailed || !errors.Is(result.Error, reason) {
+		t.Errorf("expected a failure once retries are used up, got %+v", result)
+	}
+	if len(retrier.deadLettered) != 1 {
+		t.Errorf("expected the notification to be dead-lettered, got %d", len(retrier.deadLettered))
+	}
+	if _, failed, _ := p.GetMetrics(); failed != 2 {
+		t.Errorf("expected only the final failures to count, got %d", failed)
+	}
+}
+
+// scriptedProvider answers sends with a fixed sequence of results, each
+// after delay
+type scriptedProvider struct {
+	name      string
+	delay     time.Duration
+	responses []*pkg.ProviderResponse
+	calls     int
+}
+
+func (sp *scriptedProvider) Name() string {
+	if sp.name == "" {
+		return "scripted"
+	}
+	return sp.name
+}
+
+func (sp *scriptedProvider) Send(ctx context.Context, notification *pkg.NotificationMessage) (*pkg.ProviderResponse, error) {
+	response := sp.responses[min(sp.calls, len(sp.responses)-1)]
+	sp.calls++
+	select {
+	case <-time.After(sp.delay):
+		return response, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (sp *scriptedProvider) HealthCheck(ctx context.Context) error { return nil }
+
+func TestDeliverRetryPolicy(t *testing.T) {
+	unavailable := &pkg.ProviderResponse{Error: "service unavailable", Code: pkg.ErrorCodeUnavailable}
+	delivered := &pkg.ProviderResponse{Success: true}
+	tests := []struct {
+		name      string
+		responses []*pkg.ProviderResponse
+		expired   bool
+		outcome   pkg.Outcome
+		calls     int
+	}{
+		{"transient failures are retried", []*pkg.ProviderResponse{unavailable, unavailable, delivered}, false, pkg.OutcomeDelivered, 3},
+		{"permanent failures are not", []*pkg.ProviderResponse{{Error: "invalid token", Code: pkg.ErrorCodeUnregistered}}, false, pkg.OutcomeFailed, 1},
+		{"retries stop at the limit", []*pkg.ProviderResponse{unavailable}, false, pkg.OutcomeFailed, 3},
+		{"retries stop at expiry", []*pkg.ProviderResponse{unavailable}, true, pkg.OutcomeFailed, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sp := &scriptedProvider{responses: test.responses}
+			manager := provider.NewProviderManager(provider.RoundRobin)
+			manager.AddProvider(sp)
+			p := NewPool(1, 10, nil, manager, 2, time.Millisecond, nil)
+
+			notification := &pkg.NotificationMessage{ID: "n1", UserID: "user-1"}
+			if test.expired {
+				expiresAt := time.Now()
+				notification.ExpiresAt = &expiresAt
+			}
+			p.deliver(context.Background(), 0, notification, pkg.ChannelPush, time.Now())
+
+			result := <-p.Results()
+			if result.Outcome != test.outcome || result.Attempts != test.calls || sp.calls != test.calls {
+				t.Errorf("expected %s after %d attempts, got %s after %d attempts and %d sends: %v",
+					test.outcome, test.calls, result.Outcome, result.Attempts, sp.calls, result.Error)
+			}
+		})
+	}
+}
+
+func TestDeliverProviderSettings(t *testing.T) {
+	delivered := []*pkg.ProviderResponse{{Success: true}}
+	slow := &scriptedProvider{name: "slow", delay: time.Second, responses: delivered}
+	backup := &scriptedProvider{name: "backup", responses: delivered}
+	manager := provider.NewProviderManager(provider.HealthBased)
+	manager.AddProvider(slow)
+	manager.AddProvider(backup)
+
+	settings := provider.NewSettingsTable(provider.Settings{Timeout: time.Second, Retries: 2})
+	settings.Set("slow", provider.Settings{Timeout: 10 * time.Millisecond, Retries: 1})
+	p := NewPool(1, 10, nil, manager, 3, time.Millisecond, settings)
+
+	// Both sends to slow time out, then its retry is used up and the
+	// delivery fails over to backup
+	p.deliver(context.Background(), 0, &pkg.NotificationMessage{ID: "n1", UserID: "user-1"}, pkg.ChannelPush, time.Now())
+	result := <-p.Results()
+	if !result.Success || result.Provider != "backup" || result.Attempts != 3 || slow.calls != 2 {
+		t.Errorf("expected delivery via backup on attempt 3 after 2 timeouts, got %s via %s on attempt %d after %d sends to slow: %v",
+			result.Outcome, result.Provider, result.Attempts, slow.calls, result.Error)
+	}
+}
+
+func TestDeliverRetrierFailover(t *testing.T) {
+	unavailable := []*pkg.ProviderResponse{{Error: "service unavailable", Code: pkg.ErrorCodeUnavailable}}
+	primary := &scriptedProvider{name: "primary", responses: unavailable}
+	backup := &scriptedProvider{name: "backup", responses: []*pkg.ProviderResponse{{Success: true}}}
+	manager := provider.NewProviderManager(provider.HealthBased)
+	manager.AddProvider(primary)
+	manager.AddProvider(backup)
+
+	settings := provider.NewSettingsTable(provider.Settings{Timeout: time.Second})
+	settings.Set("primary", provider.Settings{Timeout: time.Second, Retries: 1})
+	p := NewPool(1, 10, nil, manager, 3, time.Millisecond, settings)
+	retrier := &recordingRetrier{}
+	p.SetRetrier(retrier)
+
+	// Each failure goes to the retrier with the provider's failures, and
+	// the retry after primary's retry is used up fails over to backup
+	notification := &pkg.NotificationMessage{ID: "n1", UserID: "user-1"}
+	for pass := 1; pass <= 2; pass++ {
+		p.deliver(context.Background(), 0, notification, pkg.ChannelPush, time.Now())
+		if result := <-p.Results(); result.Outcome != pkg.OutcomeRetryScheduled || result.Provider != "primary" {
+			t.Fatalf("expected pass %d to fail on primary and be retried, got %s via %s", pass, result.Outcome, result.Provider)
+		}
+		notification = retrier.retried[len(retrier.retried)-1]
+		if notification.RetryProvider != "primary" || notification.ProviderFailures != pass {
+			t.Fatalf("expected the retry to carry %d failures of primary, got %d of %q", pass, notification.ProviderFailures, notification.RetryProvider)
+		}
+		notification.Retry++
+	}
+
+	p.deliver(context.Background(), 0, notification, pkg.ChannelPush, time.Now())
+	result := <-p.Results()
+	if !result.Success || result.Provider != "backup" || result.Attempts != 3 || primary.calls != 2 {
+		t.Errorf("expected delivery via backup on attempt 3 after 2 failures on primary, got %s via %s on attempt %d after %d sends to primary: %v",
+			result.Outcome, result.Provider, result.Attempts, primary.calls, result.Error)
+	}
+}
+
+func TestDeliverHedging(t *testing.T) {
+	delivered := []*pkg.ProviderResponse{{Success: true}}
+	slow := &scriptedProvider{name: "slow", delay: 200 * time.Millisecond, responses: delivered}
+	fast := &scriptedProvider{name: "fast", responses: delivered}
+	manager := provider.NewProviderManager(provider.HealthBased)
+	manager.AddProvider(slow)
+	manager.AddProvider(fast)
+
+	p := NewPool(1, 10, nil, manager, 0, time.Millisecond, nil)
+	p.SetHedging(95)
+	for i := 0; i < 20; i++ {
+		p.latencies.Observe("slow", time.Millisecond)
+	}
+
+	p.deliver(context.Background(), 0, &pkg.NotificationMessage{ID: "n1", UserID: "user-1"}, pkg.ChannelPush, time.Now())
+	if result := <-p.Results(); result.Provider != "slow" {
+		t.Errorf("expected a normal notification not to be hedged, got a delivery via %s", result.Provider)
+	}
+
+	start := time.Now()
+	p.deliver(context.Background(), 0, &pkg.NotificationMessage{ID: "n2", UserID: "user-1", Priority: pkg.PriorityUrgent}, pkg.ChannelPush, time.Now())
+	result := <-p.Results()
+	if !result.Success || result.Provider != "fast" || time.Since(start) >= 200*time.Millisecond {
+		t.Errorf("expected the hedge to win, got %s via %s after %v", result.Outcome, result.Provider, time.Since(start))
+	}
+	if hedged, won := p.GetHedgeMetrics(); hedged != 1 || won != 1 {
+		t.Errorf("expected 1 hedged send won by the hedge, got %d hedged and %d won", hedged, won)
+	}
+}
+
+// countingQuota allows every notification and counts the charges
+type countingQuota struct {
+	charges int64
+}
+
+func (cq *countingQuota) Charge(ctx context.Context, tenantID string, n int64) (quota.Decision, error) {
+	cq.charges += n
+	return quota.Decision{Allowed: true}, nil
+}
+
+func (cq *countingQuota) Recharge(ctx context.Context, tenantID string, n int64) (quota.Decision, error) {
+	return cq.Charge(ctx, tenantID, n)
+}
+
+// exhaustedQuota queues every notification, counting first charges and
+// recharges apart
+type exhaustedQuota struct {
+	charges, recharges int64
+}
+
+func (eq *exhaustedQuota) Charge(ctx context.Context, tenantID string, n int64) (quota.Decision, error) {
+	eq.charges += n
+	return quota.Decision{Mode: quota.ModeQueue, RetryAfter: time.Second}, nil
+}
+
+func (eq *exhaustedQuota) Recharge(ctx context.Context, tenantID string, n int64) (quota.Decision, error) {
+	eq.recharges += n
+	return quota.Decision{Mode: quota.ModeQueue, RetryAfter: time.Second}, nil
+}
+
+func TestProcessAdmittedRetry(t *testing.T) {
+	sp := &scriptedProvider{responses: []*pkg.ProviderResponse{{Success: true}}}
+	manager := provider.NewProviderManager(provider.RoundRobin)
+	manager.AddProvider(sp)
+
+	// Without a rate limiter any admission check would fail the test
+	p := NewPool(1, 10, nil, manager, 2, time.Millisecond, nil)
+	charges := &countingQuota{}
+	p.SetQuota(charges)
+
+	retried := &pkg.NotificationMessage{
+		ID:       "n1",
+		UserID:   "user-1",
+		Channels: []pkg.Channel{pkg.ChannelPush},
+		Retry:    1,
+		Admitted: true,
+	}
+	p.process(context.Background(), 0, retried, time.Now())
+
+	result := <-p.Results()
+	if result.Outcome != pkg.OutcomeDelivered || result.Attempts != 2 {
+		t.Errorf("expected the retry to be delivered on attempt 2, got %s on attempt %d: %v", result.Outcome, result.Attempts, result.Error)
+	}
+	if charges.charges != 0 {
+		t.Errorf("expected the retry not to be charged again, got %d charges", charges.charges)
+	}
+}
+
+// recordingDeferrer keeps the notifications it defers
+type recordingDeferrer struct {
+	deferred []*pkg.NotificationMessage
+}
+
+func (rd *recordingDeferrer) Defer(ctx context.Context, notification *pkg.NotificationMessage, until time.Time) error {
+	rd.deferred = append(rd.deferred, notification)
+	return nil
+}
+
+// holdingLimiter holds back the first send and lets later ones through
+type holdingLimiter struct {
+	waits int
+}
+
+func (hl *holdingLimiter) Wait(ctx context.Context, provider string) (time.Duration, error) {
+	hl.waits++
+	if hl.waits == 1 {
+		return time.Minute, nil
+	}
+	return 0, nil
+}
+
+func (hl *holdingLimiter) Report(ctx context.Context, provider string, throttled bool, retryAfter time.Duration) error {
+	return nil
+}
+
+func TestHoldBackIsNotChargedAgain(t *testing.T) {
+	sp := &scriptedProvider{responses: []*pkg.ProviderResponse{{Success: true}}}
+	manager := provider.NewProviderManager(provider.RoundRobin)
+	manager.AddProvider(sp)
+	emailManager := provider.NewProviderManager(provider.RoundRobin)
+	emailManager.AddProvider(&scriptedProvider{name: "smtp", responses: []*pkg.ProviderResponse{{Success: true}}})
+
+	p := NewPool(1, 10, nil, manager, 2, time.Millisecond, nil)
+	p.Router().Register(pkg.ChannelEmail, emailManager)
+	deferrer := &recordingDeferrer{}
+	p.SetDeferrer(deferrer)
+	p.SetProviderLimiter(&holdingLimiter{})
+	charges := &countingQuota{}
+	p.SetQuota(charges)
+
+	notification := &pkg.NotificationMessage{ID: "n1", UserID: "user-1", Channels: []pkg.Channel{pkg.ChannelPush, pkg.ChannelEmail}}
+	p.deliverAll(context.Background(), 0, notification, time.Now())
+	if result := <-p.Results(); result.Outcome != pkg.OutcomeDeferred || result.Channel != pkg.ChannelPush {
+		t.Fatalf("expected push to be held back, got %s on %s", result.Outcome, result.Channel)
+	}
+	if result := <-p.Results(); result.Outcome != pkg.OutcomeDelivered || result.Channel != pkg.ChannelEmail {
+		t.Fatalf("expected email to be delivered, got %s on %s", result.Outcome, result.Channel)
+	}
+
+	if len(deferrer.deferred) != 1 {
+		t.Fatalf("expected 1 deferred notification, got %d", len(deferrer.deferred))
+	}
+	held := deferrer.deferred[0]
+	if !held.Admitted || len(held.Channels) != 1 || held.Channels[0] != pkg.ChannelPush {
+		t.Fatalf("expected an admitted notification for push only, got %+v", held)
+	}
+
+	// Released from the deferred queue, it is only delivered on push
+	p.process(context.Background(), 0, held, time.Now())
+	if result := <-p.Results(); result.Outcome != pkg.OutcomeDelivered || result.Channel != pkg.ChannelPush {
+		t.Errorf("expected push to be delivered, got %s on %s: %v", result.Outcome, result.Channel, result.Error)
+	}
+	if charges.charges != 0 || len(p.Results()) != 0 {
+		t.Errorf("expected no further charges or results, got %d charges and %d results", charges.charges, len(p.Results()))
+	}
+}
+
+func TestQuotaQueuedIsNotCountedAgain(t *testing.T) {
+	// Without a rate limiter any rate limit check would fail the test
+	p := NewPool(1, 10, nil, nil, 2, time.Millisecond, nil)
+	charges := &exhaustedQuota{}
+	deferrer := &recordingDeferrer{}
+	p.SetQuota(charges)
+	p.SetDeferrer(deferrer)
+
+	queued := &pkg.NotificationMessage{ID: "n1", UserID: "user-1", Channels: []pkg.Channel{pkg.ChannelPush}, QuotaQueued: true}
+	for i := 0; i < 2; i++ {
+		p.process(context.Background(), 0, queued, time.Now())
+		if result := <-p.Results(); result.Outcome != pkg.OutcomeDeferred {
+			t.Fatalf("expected the notification to wait for quota again, got %s", result.Outcome)
+		}
+		queued = deferrer.deferred[len(deferrer.deferred)-1]
+		if !queued.QuotaQueued {
+			t.Fatalf("expected the deferred notification to stay marked as queued for quota")
+		}
+	}
+	if charges.charges != 0 || charges.recharges != 2 {
+		t.Errorf("expected 2 recharges and no first charge, got %d and %d", charges.recharges, charges.charges)
+	}
+	if metrics := p.GetTenantMetrics()[pkg.DefaultTenant]; metrics.OverQuota != 0 {
+		t.Errorf("expected the notification not to be counted over quota again, got %d", metrics.OverQuota)
+	}
+}
+
+// mutedStore has every user mute their notifications
+type mutedStore struct{}
+
+func (mutedStore) Get(ctx context.Context, userID string) (*preferences.Preferences, error) {
+	return &preferences.Preferences{UserID: userID, Muted: true}, nil
+}
+
+func (mutedStore) Save(ctx context.Context, prefs *preferences.Preferences) error { return nil }
+
+func (mutedStore) Delete(ctx context.Context, userID string) error { return nil }
+
+func TestCoalescedOnShutdownAreNotHeldAgain(t *testing.T) {
+	p := NewPool(1, 10, nil, nil, 2, time.Millisecond, nil)
+	p.SetCoalesceWindow(time.Hour)
+	deferrer := &recordingDeferrer{}
+	p.SetDeferrer(deferrer)
+
+	p.processNotification(context.Background(), 0, &pkg.NotificationMessage{ID: "n1", UserID: "user-1", CollapseKey: "score"})
+	p.Stop()
+	if len(deferrer.deferred) != 1 || !deferrer.deferred[0].Coalesced {
+		t.Fatalf("expected the held notification to be persisted as coalesced, got %+v", deferrer.deferred)
+	}
+
+	// After the restart it goes on to processing, where the muted user's
+	// preferences report it at once
+	restarted := NewPool(1, 10, nil, nil, 2, time.Millisecond, nil)
+	restarted.SetCoalesceWindow(time.Hour)
+	restarted.SetPreferences(mutedStore{})
+	restarted.processNotification(context.Background(), 0, deferrer.deferred[0])
+	select {
+	case result := <-restarted.Results():
+		if result.Outcome != pkg.OutcomeSuppressedByPreference {
+			t.Errorf("unexpected outcome %s", result.Outcome)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected the notification not to be held for another window")
+	}
+}
@@ -0,0 +1,152 @@
+package worker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/internal/redis"
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// TopicPolicy tunes the processing of the notifications consumed from one
+// Kafka topic. Unset settings fall back to the pool's.
+type TopicPolicy struct {
+	Topic string
+	// Workers dedicates workers and a queue to the topic so a backlog on
+	// another topic cannot hold it up; 0 shares the pool's workers
+	Workers int
+	// RetryAttempts and RetryDelay replace the pool's provider retries
+	RetryAttempts *int
+	RetryDelay    time.Duration
+	// RateLimit caps the notifications a user gets from the topic per
+	// RateWindow, counted apart from other topics; 0 uses the pool's limiter
+	RateLimit  int
+	RateWindow time.Duration
+	// Priority is given to notifications consumed from the topic without
+	// one; it is applied by the consumer, see kafka.Consumer.
+	// SetDefaultPriorities
+	Priority *pkg.Priority
+}
+
+// TopicMetrics holds the counters of a single topic
+type TopicMetrics struct {
+	Processed   int64                 `json:"processed"`
+	Failed      int64                 `json:"failed"`
+	RateLimited int64                 `json:"rate_limited"`
+	Queued      int                   `json:"queued"`
+	Workers     int                   `json:"workers"`
+	Outcomes    map[pkg.Outcome]int64 `json:"outcomes"`
+}
+
+// ParseTopicPolicies parses "topic:key=value,..." entries separated by
+// semicolons, e.g. "notifications.transactional:workers=8,retries=5,
+// retry_delay=200ms,priority=high;notifications.marketing:rate_limit=3/1h".
+// The keys are workers, retries, retry_delay, rate_limit as count/window and
+// priority by name or number.
+func ParseTopicPolicies(spec string) (map[string]TopicPolicy, error) {
+	policies := make(map[string]TopicPolicy)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		topic, settings, _ := strings.Cut(entry, ":")
+		if topic = strings.TrimSpace(topic); topic == "" {
+			return nil, fmt.Errorf("invalid topic policy %q, expected topic:key=value,...", entry)
+		}
+		if _, ok := policies[topic]; ok {
+			return nil, fmt.Errorf("duplicate policy for topic %s", topic)
+		}
+
+		policy := TopicPolicy{Topic: topic}
+		for _, setting := range strings.Split(settings, ",") {
+			setting = strings.TrimSpace(setting)
+			if setting == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(setting, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid setting %q for topic %s, expected key=value", setting, topic)
+			}
+			if err := policy.set(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid setting %q for topic %s: %w", setting, topic, err)
+			}
+		}
+		policies[topic] = policy
+	}
+	return policies, nil
+}
+
+// set applies one key=value setting
+func (tp *TopicPolicy) set(key, value string) error {
+	switch key {
+	case "workers":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("must be a number of workers")
+		}
+		tp.Workers = n
+	case "retries":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("must be a number of retries")
+		}
+		tp.RetryAttempts = &n
+	case "retry_delay":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("must be a positive duration")
+		}
+		tp.RetryDelay = d
+	case "rate_limit":
+		count, window, ok := strings.Cut(value, "/")
+		n, err := strconv.Atoi(count)
+		if !ok || err != nil || n <= 0 {
+			return fmt.Errorf("must be count/window, e.g. 100/1m")
+		}
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("must be count/window, e.g. 100/1m")
+		}
+		tp.RateLimit, tp.RateWindow = n, d
+	case "priority":
+		priority, err := pkg.ParsePriority(value)
+		if err != nil {
+			return err
+		}
+		tp.Priority = &priority
+	default:
+		return fmt.Errorf("unknown key %s", key)
+	}
+	return nil
+}
+
+// topicState is a topic's policy with the lane and rate limiter it runs on
+type topicState struct {
+	policy      TopicPolicy
+	lane        *lane
+	rateLimiter *redis.RateLimiter
+}
+
+// lane is a queue with the workers serving it. The pool's shared lane serves
+// every topic without dedicated workers.
+type lane struct {
+	name    string
+	workers int
+	queue   *fairQueue
+	jobs    chan *pkg.NotificationMessage
+}
+
+func newLane(name string, workers, maxQueueSize, tenantQueueLimit int) *lane {
+	l := &lane{
+		name:    name,
+		workers: workers,
+		queue:   newFairQueue(maxQueueSize),
+		jobs:    make(chan *pkg.NotificationMessage),
+	}
+	l.queue.setTenantCapacity(tenantQueueLimit)
+	return l
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+func TestParseTopicPolicies(t *testing.T) {
+	policies, err := ParseTopicPolicies("notifications.transactional:workers=8,retries=0,retry_delay=200ms,priority=high; notifications.marketing:rate_limit=3/1h")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	tx := policies["notifications.transactional"]
+	if tx.Workers != 8 || tx.RetryAttempts == nil || *tx.RetryAttempts != 0 || tx.RetryDelay != 200*time.Millisecond ||
+		tx.Priority == nil || *tx.Priority != pkg.PriorityHigh {
+		t.Errorf("unexpected transactional policy %+v", tx)
+	}
+	marketing := policies["notifications.marketing"]
+	if marketing.RateLimit != 3 || marketing.RateWindow != time.Hour || marketing.RetryAttempts != nil || marketing.Priority != nil {
+		t.Errorf("unexpected marketing policy %+v", marketing)
+	}
+
+	for _, spec := range []string{
+		":workers=1",
+		"a:workers=-1",
+		"a:workers",
+		"a:rate_limit=10",
+		"a:priority=critical",
+		"a:colour=blue",
+		"a:workers=1;a:workers=2",
+	} {
+		if _, err := ParseTopicPolicies(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestPoolTopicPolicies(t *testing.T) {
+	p := NewPool(2, 10, nil, nil, 3, time.Second, nil)
+	retries := 0
+	p.SetTopicPolicy(TopicPolicy{Topic: "tx", Workers: 4, RetryAttempts: &retries}, nil)
+	p.SetTopicPolicy(TopicPolicy{Topic: "marketing", RetryDelay: time.Minute}, nil)
+
+	if p.Workers() != 6 {
+		t.Errorf("expected 6 workers over all lanes, got %d", p.Workers())
+	}
+
+	p.Submit(&pkg.NotificationMessage{ID: "a", Source: "tx"})
+	p.Submit(&pkg.NotificationMessage{ID: "b", Source: "tx"})
+	p.Submit(&pkg.NotificationMessage{ID: "c", Source: "marketing"})
+	p.Submit(&pkg.NotificationMessage{ID: "d"})
+
+	lane := p.topics["tx"].lane
+	if lane.queue.len() != 2 || p.shared.queue.len() != 2 || p.QueueSize() != 4 {
+		t.Fatalf("expected tx on its own lane, got %d dedicated and %d shared", lane.queue.len(), p.shared.queue.len())
+	}
+	for i := 0; i < 2; i++ {
+		if n, _ := lane.queue.pop(); n.Priority != pkg.PriorityLow {
+			t.Errorf("expected the priority to be left to the consumer, got %v", n.Priority)
+		}
+	}
+
+	if policy := p.retryPolicyFor(&pkg.NotificationMessage{Source: "tx"}); policy.MaxRetries != 0 || policy.BaseDelay != time.Second {
+		t.Errorf("unexpected tx retry policy %+v", policy)
+	}
+	if policy := p.retryPolicyFor(&pkg.NotificationMessage{Source: "marketing"}); policy.MaxRetries != 3 || policy.BaseDelay != time.Minute {
+		t.Errorf("unexpected marketing retry policy %+v", policy)
+	}
+
+	p.recordDelivery(&pkg.NotificationMessage{Source: "marketing"}, pkg.ChannelPush, true)
+	p.sendResult(&pkg.ProcessingResult{Source: "marketing", Outcome: pkg.OutcomeDelivered})
+	metrics := p.GetTopicMetrics()
+	if m := metrics["marketing"]; m.Processed != 1 || m.Outcomes[pkg.OutcomeDelivered] != 1 {
+		t.Errorf("unexpected marketing metrics %+v", m)
+	}
+	if m := metrics["tx"]; m.Workers != 4 || m.Queued != 0 {
+		t.Errorf("unexpected tx metrics %+v", m)
+	}
+	if _, ok := metrics[""]; ok {
+		t.Errorf("expected notifications without a topic to be left out")
+	}
+}
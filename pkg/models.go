@@ -1,12 +1,15 @@
 package pkg
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 )
 
 // NotificationMessage represents a notification to be processed
 type NotificationMessage struct {
 	ID        string                 `json:"id"`
+	TenantID  string                 `json:"tenant_id,omitempty"`
 	UserID    string                 `json:"user_id"`
 	Type      string                 `json:"type"`
 	Title     string                 `json:"title"`
@@ -16,6 +19,111 @@ type NotificationMessage struct {
 	CreatedAt time.Time              `json:"created_at"`
 	ExpiresAt *time.Time             `json:"expires_at,omitempty"`
 	Retry     int                    `json:"retry"`
+	Channels  []Channel              `json:"channels,omitempty"`
+
+	// TemplateID renders Title and Body from a stored template using Data as
+	// variables; TemplateVersion pins a version instead of the current one
+	TemplateID      string `json:"template_id,omitempty"`
+	TemplateVersion int    `json:"template_version,omitempty"`
+
+	// CollapseKey marks notifications of a user that supersede each other;
+	// CollapseMode decides whether a newer one replaces or merges with older
+	// unsent ones
+	CollapseKey  string       `json:"collapse_key,omitempty"`
+	CollapseMode CollapseMode `json:"collapse_mode,omitempty"`
+
+	// Badge is the app icon badge count; with the inbox enabled it is set
+	// to the user's unread count before delivery
+	Badge *int `json:"badge,omitempty"`
+
+	// Source is the Kafka topic the notification was consumed from, which
+	// selects its processing policy
+	Source string `json:"source,omitempty"`
+
+	// Admitted marks a notification coming back for delivery, such as a
+	// retry or a send held back for a throttled provider, after it passed
+	// preferences, rate limits and quotas once. It is set by the service
+	// only and never read from clients.
+	Admitted bool `json:"-"`
+
+	// QuotaQueued marks a notification waiting for its tenant's quota. It
+	// took its rate limit slot and was counted as queued on its first pass,
+	// so it is only charged again. Like Admitted, it is set by the service
+	// only.
+	QuotaQueued bool `json:"-"`
+
+	// Coalesced marks a notification that was held for its coalescing
+	// window when the service stopped, so it is not held again. Like
+	// Admitted, it is set by the service only.
+	Coalesced bool `json:"-"`
+
+	// RetryProvider is the provider a retried delivery last failed on and
+	// ProviderFailures how many times in a row it failed there, so the retry
+	// fails over once the provider's retries are used up. Like Admitted,
+	// they are set by the service only.
+	RetryProvider    string `json:"-"`
+	ProviderFailures int    `json:"-"`
+}
+
+// DefaultTenant owns notifications without a TenantID
+const DefaultTenant = "default"
+
+// Tenant returns the tenant owning the notification
+func (n *NotificationMessage) Tenant() string {
+	if n.TenantID == "" {
+		return DefaultTenant
+	}
+	return n.TenantID
+}
+
+// TargetChannels returns the channels the notification should be delivered on,
+// defaulting to push when none are declared
+func (n *NotificationMessage) TargetChannels() []Channel {
+	if len(n.Channels) == 0 {
+		return []Channel{ChannelPush}
+	}
+	return n.Channels
+}
+
+// Channel identifies a delivery channel
+type Channel string
+
+const (
+	ChannelPush    Channel = "push"
+	ChannelEmail   Channel = "email"
+	ChannelSMS     Channel = "sms"
+	ChannelWebPush Channel = "webpush"
+)
+
+// IsValid reports whether the channel is one of the known delivery channels
+func (c Channel) IsValid() bool {
+	switch c {
+	case ChannelPush, ChannelEmail, ChannelSMS, ChannelWebPush:
+		return true
+	default:
+		return false
+	}
+}
+
+// CollapseMode defines how notifications sharing a collapse key are coalesced
+type CollapseMode string
+
+const (
+	// CollapseReplace delivers only the latest notification (the default)
+	CollapseReplace CollapseMode = "replace"
+	// CollapseMerge delivers the latest notification with a count of the
+	// notifications it stands for
+	CollapseMerge CollapseMode = "merge"
+)
+
+// IsValid reports whether the mode is empty or one of the known modes
+func (m CollapseMode) IsValid() bool {
+	switch m {
+	case "", CollapseReplace, CollapseMerge:
+		return true
+	default:
+		return false
+	}
 }
 
 // Priority defines notification priority levels
@@ -44,20 +152,146 @@ func (p Priority) String() string {
 	}
 }
 
+// ParsePriority parses a priority given by name, such as "high", or number
+func ParsePriority(s string) (Priority, error) {
+	for p := PriorityLow; p <= PriorityUrgent; p++ {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil && Priority(n) >= PriorityLow && Priority(n) <= PriorityUrgent {
+		return Priority(n), nil
+	}
+	return PriorityNormal, fmt.Errorf("unknown priority: %s", s)
+}
+
 // ProviderResponse represents the response from external providers
 type ProviderResponse struct {
 	Success   bool   `json:"success"`
 	MessageID string `json:"message_id,omitempty"`
 	Error     string `json:"error,omitempty"`
+	// Code classifies the error of a failed response, see the ErrorCode
+	// constants
+	Code string `json:"code,omitempty"`
+	// Throttled is set when the provider refused the message because we
+	// exceeded its rate limit
+	Throttled bool `json:"throttled,omitempty"`
 }
 
+// Error codes of failed provider responses
+const (
+	ErrorCodeTimeout          = "timeout"
+	ErrorCodeUnavailable      = "unavailable"
+	ErrorCodeThrottled        = "throttled"
+	ErrorCodeInvalidRecipient = "invalid_recipient"
+	ErrorCodeUnregistered     = "unregistered"
+	ErrorCodePayloadTooLarge  = "payload_too_large"
+	ErrorCodeRejected         = "rejected"
+)
+
+// Outcome classifies how processing of a notification ended
+type Outcome string
+
+const (
+	OutcomeDelivered              Outcome = "delivered"
+	OutcomeFailed                 Outcome = "failed"
+	OutcomeRateLimited            Outcome = "rate_limited"
+	OutcomeSuppressedByPreference Outcome = "suppressed_by_preference"
+	OutcomeDeferred               Outcome = "deferred"
+	OutcomeCollapsed              Outcome = "collapsed"
+	OutcomeDigested               Outcome = "digested"
+	OutcomeQuotaExceeded          Outcome = "quota_exceeded"
+	OutcomeProviderThrottled      Outcome = "provider_throttled"
+	OutcomeRetryScheduled         Outcome = "retry_scheduled"
+)
+
 // ProcessingResult represents the result of processing a notification
 type ProcessingResult struct {
 	MessageID   string
+	TenantID    string
 	UserID      string
+	Source      string
 	Success     bool
+	Outcome     Outcome
+	Channel     Channel
 	Provider    string
 	Error       error
 	ProcessedAt time.Time
 	Attempts    int
+
+	// DeferredUntil is set when delivery was postponed, e.g. by quiet hours
+	// or until a retry is due
+	DeferredUntil *time.Time
+}
+
+// DeliveryStatus is the latest known state of a notification on each channel
+type DeliveryStatus struct {
+	MessageID string                    `json:"message_id"`
+	UserID    string                    `json:"user_id"`
+	Channels  map[Channel]ChannelStatus `json:"channels"`
+}
+
+// ChannelStatus is the latest processing result of a notification on one channel
+type ChannelStatus struct {
+	Outcome       Outcome    `json:"outcome"`
+	Provider      string     `json:"provider,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	Attempts      int        `json:"attempts"`
+	DeferredUntil *time.Time `json:"deferred_until,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// PushSubscription is a browser Web Push subscription as returned by
+// PushManager.subscribe()
+type PushSubscription struct {
+	Endpoint string               `json:"endpoint"`
+	Keys     PushSubscriptionKeys `json:"keys"`
+}
+
+// PushSubscriptionKeys holds the base64url encoded client keys of a subscription
+type PushSubscriptionKeys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// BroadcastMessage targets every user subscribed to a topic and/or matching a
+// segment of user attributes. The notification is the template for each
+// per-user message; its ID and UserID are filled in during fan-out.
+type BroadcastMessage struct {
+	ID           string              `json:"id"`
+	Topic        string              `json:"topic,omitempty"`
+	Segment      map[string]string   `json:"segment,omitempty"`
+	Notification NotificationMessage `json:"notification"`
+	CreatedAt    time.Time           `json:"created_at"`
+}
+
+// BroadcastState is the lifecycle state of a broadcast fan-out
+type BroadcastState string
+
+const (
+	BroadcastPending   BroadcastState = "pending"
+	BroadcastRunning   BroadcastState = "running"
+	BroadcastCompleted BroadcastState = "completed"
+	BroadcastCancelled BroadcastState = "cancelled"
+	BroadcastFailed    BroadcastState = "failed"
+)
+
+// BroadcastProgress tracks how far a broadcast fan-out has got
+type BroadcastProgress struct {
+	ID         string         `json:"id"`
+	State      BroadcastState `json:"state"`
+	Total      int64          `json:"total"`
+	Enqueued   int64          `json:"enqueued"`
+	Error      string         `json:"error,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
+
+// Device is a registered client installation of a user
+type Device struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Platform  string    `json:"platform"`
+	Token     string    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -59,6 +59,30 @@ func TestPriorityString(t *testing.T) {
 	}
 }
 
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Priority
+	}{
+		{"low", PriorityLow},
+		{"high", PriorityHigh},
+		{"3", PriorityUrgent},
+	}
+
+	for _, test := range tests {
+		priority, err := ParsePriority(test.input)
+		if err != nil || priority != test.expected {
+			t.Errorf("Expected %q to parse as %v, got %v (%v)", test.input, test.expected, priority, err)
+		}
+	}
+
+	for _, input := range []string{"", "critical", "4", "-1"} {
+		if _, err := ParsePriority(input); err == nil {
+			t.Errorf("Expected %q to be rejected", input)
+		}
+	}
+}
+
 func TestProviderResponse(t *testing.T) {
 	// Test successful response
 	successResponse := &ProviderResponse{
@@ -121,3 +145,25 @@ func TestProcessingResult(t *testing.T) {
 		t.Errorf("Expected Attempts to be 2, got %d", result.Attempts)
 	}
 }
+
+func TestTargetChannels(t *testing.T) {
+	msg := &NotificationMessage{ID: "test-123"}
+
+	channels := msg.TargetChannels()
+	if len(channels) != 1 || channels[0] != ChannelPush {
+		t.Errorf("Expected default channels to be [push], got %v", channels)
+	}
+
+	msg.Channels = []Channel{ChannelEmail, ChannelSMS}
+	channels = msg.TargetChannels()
+	if len(channels) != 2 || channels[0] != ChannelEmail || channels[1] != ChannelSMS {
+		t.Errorf("Expected channels to be [email sms], got %v", channels)
+	}
+
+	if Channel("pager").IsValid() {
+		t.Errorf("Expected unknown channel to be invalid")
+	}
+	if !ChannelWebPush.IsValid() {
+		t.Errorf("Expected webpush channel to be valid")
+	}
+}
@@ -0,0 +1,93 @@
+package notificationpb
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/sv410/Distributed-Real-Time-Push-Notification-Service/pkg"
+)
+
+// FromMessage converts a notification into its gRPC form
+func FromMessage(n *pkg.NotificationMessage) (*Notification, error) {
+	notification := &Notification{
+		Id:              n.ID,
+		TenantId:        n.TenantID,
+		UserId:          n.UserID,
+		Type:            n.Type,
+		Title:           n.Title,
+		Body:            n.Body,
+		TemplateId:      n.TemplateID,
+		TemplateVersion: int32(n.TemplateVersion),
+		CollapseKey:     n.CollapseKey,
+		CollapseMode:    string(n.CollapseMode),
+		ExpiresAt:       Timestamp(n.ExpiresAt),
+		Retry:           int32(n.Retry),
+	}
+	priority := int32(n.Priority)
+	notification.Priority = &priority
+	if !n.CreatedAt.IsZero() {
+		notification.CreatedAt = timestamppb.New(n.CreatedAt)
+	}
+	if n.Badge != nil {
+		badge := int32(*n.Badge)
+		notification.Badge = &badge
+	}
+	if n.Data != nil {
+		data, err := structpb.NewStruct(n.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data: %w", err)
+		}
+		notification.Data = data
+	}
+	for _, ch := range n.Channels {
+		notification.Channels = append(notification.Channels, string(ch))
+	}
+	return notification, nil
+}
+
+// ToMessage converts a gRPC notification into the pipeline's message
+func (x *Notification) ToMessage() *pkg.NotificationMessage {
+	notification := &pkg.NotificationMessage{
+		ID:              x.GetId(),
+		TenantID:        x.GetTenantId(),
+		UserID:          x.GetUserId(),
+		Type:            x.GetType(),
+		Title:           x.GetTitle(),
+		Body:            x.GetBody(),
+		Priority:        pkg.Priority(x.GetPriority()),
+		TemplateID:      x.GetTemplateId(),
+		TemplateVersion: int(x.GetTemplateVersion()),
+		CollapseKey:     x.GetCollapseKey(),
+		CollapseMode:    pkg.CollapseMode(x.GetCollapseMode()),
+		Retry:           int(x.GetRetry()),
+	}
+	if x.GetCreatedAt() != nil {
+		notification.CreatedAt = x.GetCreatedAt().AsTime()
+	}
+	if x.Badge != nil {
+		badge := int(x.GetBadge())
+		notification.Badge = &badge
+	}
+	if x.GetData() != nil {
+		notification.Data = x.GetData().AsMap()
+	}
+	if x.GetExpiresAt() != nil {
+		expiresAt := x.GetExpiresAt().AsTime()
+		notification.ExpiresAt = &expiresAt
+	}
+	for _, ch := range x.GetChannels() {
+		notification.Channels = append(notification.Channels, pkg.Channel(ch))
+	}
+	return notification
+}
+
+// Timestamp converts an optional time
+func Timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
@@ -0,0 +1,5 @@
+// Package notificationpb holds the gRPC API of the notification service and
+// its generated Go client and server code
+package notificationpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative notification.proto